@@ -0,0 +1,93 @@
+package accounts
+
+import (
+    "sort"
+    "sync"
+    "time"
+
+    "high-frequency-matching-engine/engine"
+)
+
+// Position is a client's holding in one symbol: Quantity in the base asset
+// and Cash as the net quote amount paid (negative) or received (positive)
+type Position struct {
+    ClientID  string    `json:"client_id"`
+    Symbol    string    `json:"symbol"`
+    Quantity  float64   `json:"quantity"`
+    Cash      float64   `json:"cash"`
+    Volume    float64   `json:"volume"`
+    Timestamp time.Time `json:"timestamp"`
+}
+
+// Ledger tracks positions per client and symbol from execution reports
+type Ledger struct {
+    positions map[string]map[string]*Position
+    mutex     sync.RWMutex
+}
+
+func NewLedger() *Ledger {
+    return &Ledger{
+        positions: make(map[string]map[string]*Position),
+    }
+}
+
+// Apply books a fill and returns a copy of the updated position, or nil
+// if the report does not change any position. Every fill must be applied
+// exactly once, so reports should come from an engine event queue.
+func (l *Ledger) Apply(report *engine.ExecutionReport) *Position {
+    if report.Type != engine.EXEC_TRADE || report.Order.ClientID == "" {
+        return nil
+    }
+
+    l.mutex.Lock()
+    defer l.mutex.Unlock()
+
+    bySymbol, exists := l.positions[report.Order.ClientID]
+    if !exists {
+        bySymbol = make(map[string]*Position)
+        l.positions[report.Order.ClientID] = bySymbol
+    }
+    position, exists := bySymbol[report.Order.Symbol]
+    if !exists {
+        position = &Position{ClientID: report.Order.ClientID, Symbol: report.Order.Symbol}
+        bySymbol[report.Order.Symbol] = position
+    }
+
+    notional := report.LastPrice * report.LastQty
+    if report.Order.Side == engine.BUY {
+        position.Quantity += report.LastQty
+        position.Cash -= notional
+    } else {
+        position.Quantity -= report.LastQty
+        position.Cash += notional
+    }
+    position.Volume += report.LastQty
+    position.Timestamp = report.Timestamp
+
+    copied := *position
+    return &copied
+}
+
+// Position returns a client's position in a symbol
+func (l *Ledger) Position(clientID, symbol string) Position {
+    l.mutex.RLock()
+    defer l.mutex.RUnlock()
+
+    if position, exists := l.positions[clientID][symbol]; exists {
+        return *position
+    }
+    return Position{ClientID: clientID, Symbol: symbol}
+}
+
+// Positions returns all of a client's positions sorted by symbol
+func (l *Ledger) Positions(clientID string) []Position {
+    l.mutex.RLock()
+    defer l.mutex.RUnlock()
+
+    positions := make([]Position, 0, len(l.positions[clientID]))
+    for _, position := range l.positions[clientID] {
+        positions = append(positions, *position)
+    }
+    sort.Slice(positions, func(i, j int) bool { return positions[i].Symbol < positions[j].Symbol })
+    return positions
+}
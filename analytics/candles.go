@@ -0,0 +1,328 @@
+package analytics
+
+import (
+    "bufio"
+    "encoding/json"
+    "fmt"
+    "os"
+    "path/filepath"
+    "sync"
+    "time"
+
+    "high-frequency-matching-engine/clock"
+    "high-frequency-matching-engine/engine"
+    "high-frequency-matching-engine/utils"
+)
+
+const maxCandlesInMemory = 1000
+
+var Intervals = map[string]time.Duration{
+    "1s": time.Second,
+    "1m": time.Minute,
+    "5m": 5 * time.Minute,
+    "1h": time.Hour,
+    "1d": 24 * time.Hour,
+}
+
+type Candle struct {
+    Symbol      string    `json:"symbol"`
+    Interval    string    `json:"interval"`
+    OpenTime    time.Time `json:"open_time"`
+    CloseTime   time.Time `json:"close_time"`
+    Open        float64   `json:"open"`
+    High        float64   `json:"high"`
+    Low         float64   `json:"low"`
+    Close       float64   `json:"close"`
+    Volume      float64   `json:"volume"`
+    QuoteVolume float64   `json:"quote_volume"`
+    VWAP        float64   `json:"vwap"`
+    Trades      int       `json:"trades"`
+    Closed      bool      `json:"closed"`
+}
+
+type series struct {
+    current *Candle
+    closed  []*Candle
+    file    *os.File
+    writer  *bufio.Writer
+}
+
+type candleSubscriber struct {
+    ch       chan *Candle
+    symbol   string
+    interval string
+}
+
+// CandleAggregator builds OHLCV bars for every interval in Intervals from
+// the engine's trade stream and persists each bar once it closes
+type CandleAggregator struct {
+    dir         string
+    clock       clock.Clock
+    series      map[string]*series
+    subscribers map[*candleSubscriber]struct{}
+    mutex       sync.Mutex
+}
+
+// NewCandleAggregator closes bars by clk, which should be the engine's
+// clock so bars of replayed trades close at their recorded times
+func NewCandleAggregator(dir string, clk clock.Clock) (*CandleAggregator, error) {
+    if err := os.MkdirAll(dir, 0755); err != nil {
+        return nil, err
+    }
+    return &CandleAggregator{
+        dir:         dir,
+        clock:       clk,
+        series:      make(map[string]*series),
+        subscribers: make(map[*candleSubscriber]struct{}),
+    }, nil
+}
+
+func seriesKey(symbol, interval string) string {
+    return symbol + "_" + interval
+}
+
+// getSeries returns the series for a symbol/interval, loading previously
+// persisted bars on first use. Callers must hold the write lock.
+func (ca *CandleAggregator) getSeries(symbol, interval string) (*series, error) {
+    key := seriesKey(symbol, interval)
+    if s, exists := ca.series[key]; exists {
+        return s, nil
+    }
+    if !utils.ValidSymbol(symbol) {
+        return nil, fmt.Errorf("invalid symbol %q", symbol)
+    }
+
+    path := filepath.Join(ca.dir, key+".candles")
+    file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+    if err != nil {
+        return nil, err
+    }
+
+    s := &series{file: file, writer: bufio.NewWriter(file)}
+
+    scanner := bufio.NewScanner(file)
+    for scanner.Scan() {
+        var candle Candle
+        if json.Unmarshal(scanner.Bytes(), &candle) == nil {
+            s.closed = append(s.closed, &candle)
+        }
+    }
+    if len(s.closed) > maxCandlesInMemory {
+        s.closed = s.closed[len(s.closed)-maxCandlesInMemory:]
+    }
+
+    ca.series[key] = s
+    return s, nil
+}
+
+// late reports whether the bar opening at openTime has already closed
+func (s *series) late(openTime time.Time) bool {
+    if s.current != nil {
+        return openTime.Before(s.current.OpenTime)
+    }
+    return len(s.closed) > 0 && !openTime.After(s.closed[len(s.closed)-1].OpenTime)
+}
+
+// OnTrade folds a trade into the open bar of every interval. A trade that
+// arrives after its bar has closed is left out of that interval rather
+// than open the period a second time.
+func (ca *CandleAggregator) OnTrade(trade *engine.Trade) error {
+    ca.mutex.Lock()
+    defer ca.mutex.Unlock()
+
+    for interval, duration := range Intervals {
+        s, err := ca.getSeries(trade.Symbol, interval)
+        if err != nil {
+            return err
+        }
+
+        openTime := trade.Timestamp.Truncate(duration)
+        if s.late(openTime) {
+            continue
+        }
+        if s.current != nil && !s.current.OpenTime.Equal(openTime) {
+            if err := ca.closeCandle(s); err != nil {
+                return err
+            }
+        }
+
+        c := s.current
+        if c == nil {
+            c = &Candle{
+                Symbol:    trade.Symbol,
+                Interval:  interval,
+                OpenTime:  openTime,
+                CloseTime: openTime.Add(duration),
+                Open:      trade.Price,
+                High:      trade.Price,
+                Low:       trade.Price,
+            }
+            s.current = c
+        }
+
+        if trade.Price > c.High {
+            c.High = trade.Price
+        }
+        if trade.Price < c.Low {
+            c.Low = trade.Price
+        }
+        c.Close = trade.Price
+        c.Volume += trade.Quantity
+        c.QuoteVolume += trade.Price * trade.Quantity
+        c.VWAP = c.QuoteVolume / c.Volume
+        c.Trades++
+
+        ca.publish(c)
+    }
+    return nil
+}
+
+// closeCandle finalizes the open bar of a series. Callers must hold the
+// write lock.
+func (ca *CandleAggregator) closeCandle(s *series) error {
+    c := s.current
+    s.current = nil
+    c.Closed = true
+
+    s.closed = append(s.closed, c)
+    if len(s.closed) > maxCandlesInMemory {
+        s.closed = s.closed[len(s.closed)-maxCandlesInMemory:]
+    }
+
+    ca.publish(c)
+
+    data, err := json.Marshal(c)
+    if err != nil {
+        return err
+    }
+    if _, err := s.writer.Write(append(data, '\n')); err != nil {
+        return err
+    }
+    return s.writer.Flush()
+}
+
+// CloseExpired finalizes bars whose interval has ended without a new
+// trade to roll them over
+func (ca *CandleAggregator) CloseExpired(now time.Time) error {
+    ca.mutex.Lock()
+    defer ca.mutex.Unlock()
+
+    for _, s := range ca.series {
+        if s.current != nil && !now.Before(s.current.CloseTime) {
+            if err := ca.closeCandle(s); err != nil {
+                return err
+            }
+        }
+    }
+    return nil
+}
+
+// Candles returns up to limit of the most recent bars, oldest first,
+// including the bar that is still open
+func (ca *CandleAggregator) Candles(symbol, interval string, limit int) ([]Candle, error) {
+    if _, valid := Intervals[interval]; !valid {
+        return nil, fmt.Errorf("unsupported interval %q", interval)
+    }
+
+    ca.mutex.Lock()
+    defer ca.mutex.Unlock()
+
+    // Only load series that exist, never create files for a lookup
+    if _, exists := ca.series[seriesKey(symbol, interval)]; !exists {
+        if !utils.ValidSymbol(symbol) {
+            return nil, nil
+        }
+        if _, err := os.Stat(filepath.Join(ca.dir, seriesKey(symbol, interval)+".candles")); err != nil {
+            return nil, nil
+        }
+    }
+
+    s, err := ca.getSeries(symbol, interval)
+    if err != nil {
+        return nil, err
+    }
+
+    candles := make([]Candle, 0, len(s.closed)+1)
+    for _, c := range s.closed {
+        candles = append(candles, *c)
+    }
+    if s.current != nil {
+        candles = append(candles, *s.current)
+    }
+
+    if limit > 0 && len(candles) > limit {
+        candles = candles[len(candles)-limit:]
+    }
+    return candles, nil
+}
+
+// Subscribe streams bar updates for a symbol and interval; empty values
+// match everything. The returned function cancels the subscription.
+func (ca *CandleAggregator) Subscribe(symbol, interval string) (<-chan *Candle, func()) {
+    sub := &candleSubscriber{
+        ch:       make(chan *Candle, 1000),
+        symbol:   symbol,
+        interval: interval,
+    }
+
+    ca.mutex.Lock()
+    ca.subscribers[sub] = struct{}{}
+    ca.mutex.Unlock()
+
+    return sub.ch, func() {
+        ca.mutex.Lock()
+        delete(ca.subscribers, sub)
+        ca.mutex.Unlock()
+    }
+}
+
+// publish sends a copy of the bar to matching subscribers. Callers must
+// hold the write lock.
+func (ca *CandleAggregator) publish(c *Candle) {
+    for sub := range ca.subscribers {
+        if (sub.symbol != "" && sub.symbol != c.Symbol) || (sub.interval != "" && sub.interval != c.Interval) {
+            continue
+        }
+
+        update := *c
+        select {
+        case sub.ch <- &update:
+        default:
+            // Slow subscriber, drop the update
+        }
+    }
+}
+
+// Run closes expired bars until done is closed. It checks once a second
+// on the wall clock but judges expiry by the aggregator's clock.
+func (ca *CandleAggregator) Run(done <-chan struct{}, onError func(error)) {
+    ticker := time.NewTicker(time.Second)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-done:
+            return
+        case <-ticker.C:
+            if err := ca.CloseExpired(ca.clock.Now()); err != nil && onError != nil {
+                onError(err)
+            }
+        }
+    }
+}
+
+func (ca *CandleAggregator) Close() error {
+    ca.mutex.Lock()
+    defer ca.mutex.Unlock()
+
+    var firstErr error
+    for _, s := range ca.series {
+        if err := s.writer.Flush(); err != nil && firstErr == nil {
+            firstErr = err
+        }
+        if err := s.file.Close(); err != nil && firstErr == nil {
+            firstErr = err
+        }
+    }
+    return firstErr
+}
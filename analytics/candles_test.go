@@ -0,0 +1,56 @@
+package analytics
+
+import (
+    "testing"
+    "time"
+
+    "high-frequency-matching-engine/clock"
+    "high-frequency-matching-engine/engine"
+)
+
+func testTrade(at time.Time, price float64) *engine.Trade {
+    return &engine.Trade{Symbol: "BTCUSDT", Price: price, Quantity: 1, Timestamp: at}
+}
+
+// A trade for a bar that has already closed must not open it again
+func TestCandleLateTradeDropped(t *testing.T) {
+    ca, err := NewCandleAggregator(t.TempDir(), clock.Real{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer ca.Close()
+
+    start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+    trades := []*engine.Trade{
+        testTrade(start.Add(10*time.Second), 100),
+        testTrade(start.Add(70*time.Second), 101), // closes the first minute
+        testTrade(start.Add(20*time.Second), 99),  // late for the first minute
+    }
+    for _, trade := range trades {
+        if err := ca.OnTrade(trade); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    // And after the open bar is closed by time rather than a trade
+    if err := ca.CloseExpired(start.Add(2 * time.Minute)); err != nil {
+        t.Fatal(err)
+    }
+    if err := ca.OnTrade(testTrade(start.Add(80*time.Second), 98)); err != nil {
+        t.Fatal(err)
+    }
+
+    candles, err := ca.Candles("BTCUSDT", "1m", 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(candles) != 2 {
+        t.Fatalf("got %d bars, want 2: %+v", len(candles), candles)
+    }
+    for i, want := range []float64{100, 101} {
+        c := candles[i]
+        if !c.OpenTime.Equal(start.Add(time.Duration(i)*time.Minute)) || c.Trades != 1 || c.Low != want || !c.Closed {
+            t.Errorf("bar %d is %+v, want one trade at %v", i, c, want)
+        }
+    }
+}
@@ -0,0 +1,237 @@
+package analytics
+
+import (
+    "sort"
+    "sync"
+    "time"
+
+    "high-frequency-matching-engine/clock"
+    "high-frequency-matching-engine/engine"
+)
+
+const (
+    tickerWindow = 24 * time.Hour
+    bucketSize   = time.Minute
+    bucketCount  = int(tickerWindow / bucketSize)
+)
+
+type Ticker struct {
+    Symbol             string    `json:"symbol"`
+    LastPrice          float64   `json:"last_price"`
+    LastQty            float64   `json:"last_qty"`
+    BidPrice           float64   `json:"bid_price"`
+    BidQty             float64   `json:"bid_qty"`
+    AskPrice           float64   `json:"ask_price"`
+    AskQty             float64   `json:"ask_qty"`
+    OpenPrice          float64   `json:"open_price"`
+    HighPrice          float64   `json:"high_price"`
+    LowPrice           float64   `json:"low_price"`
+    Volume             float64   `json:"volume"`
+    QuoteVolume        float64   `json:"quote_volume"`
+    PriceChange        float64   `json:"price_change"`
+    PriceChangePercent float64   `json:"price_change_percent"`
+    Trades             int       `json:"trades"`
+    Timestamp          time.Time `json:"timestamp"`
+}
+
+// minuteBucket holds one minute of trade statistics for the rolling window
+type minuteBucket struct {
+    start       int64
+    open        float64
+    high        float64
+    low         float64
+    volume      float64
+    quoteVolume float64
+    trades      int
+}
+
+type symbolTicker struct {
+    buckets [bucketCount]minuteBucket
+    last    float64
+    lastQty float64
+    top     engine.TopOfBook
+    updated time.Time
+}
+
+// compute folds the buckets inside the 24h window ending at now
+func (st *symbolTicker) compute(symbol string, now time.Time) Ticker {
+    ticker := Ticker{
+        Symbol:    symbol,
+        LastPrice: st.last,
+        LastQty:   st.lastQty,
+        BidPrice:  st.top.BidPrice,
+        BidQty:    st.top.BidQty,
+        AskPrice:  st.top.AskPrice,
+        AskQty:    st.top.AskQty,
+        Timestamp: st.updated,
+    }
+
+    cutoff := now.Add(-tickerWindow).UnixNano()
+    var oldest int64
+    for i := range st.buckets {
+        b := &st.buckets[i]
+        if b.trades == 0 || b.start <= cutoff {
+            continue
+        }
+        if ticker.Trades == 0 || b.high > ticker.HighPrice {
+            ticker.HighPrice = b.high
+        }
+        if ticker.Trades == 0 || b.low < ticker.LowPrice {
+            ticker.LowPrice = b.low
+        }
+        if ticker.Trades == 0 || b.start < oldest {
+            oldest = b.start
+            ticker.OpenPrice = b.open
+        }
+        ticker.Volume += b.volume
+        ticker.QuoteVolume += b.quoteVolume
+        ticker.Trades += b.trades
+    }
+
+    if ticker.OpenPrice > 0 {
+        ticker.PriceChange = ticker.LastPrice - ticker.OpenPrice
+        ticker.PriceChangePercent = ticker.PriceChange / ticker.OpenPrice * 100
+    }
+    return ticker
+}
+
+// TickerStats maintains rolling 24h statistics per symbol from the
+// engine's trades and top-of-book changes
+type TickerStats struct {
+    clock       clock.Clock
+    symbols     map[string]*symbolTicker
+    subscribers map[chan *Ticker]string
+    mutex       sync.Mutex
+}
+
+// NewTickerStats rolls the window on clk, which should be the engine's
+// clock so it matches the times of the trades it counts
+func NewTickerStats(clk clock.Clock) *TickerStats {
+    return &TickerStats{
+        clock:       clk,
+        symbols:     make(map[string]*symbolTicker),
+        subscribers: make(map[chan *Ticker]string),
+    }
+}
+
+func (ts *TickerStats) get(symbol string) *symbolTicker {
+    st, exists := ts.symbols[symbol]
+    if !exists {
+        st = &symbolTicker{}
+        ts.symbols[symbol] = st
+    }
+    return st
+}
+
+func (ts *TickerStats) OnTrade(trade *engine.Trade) {
+    ts.mutex.Lock()
+    defer ts.mutex.Unlock()
+
+    st := ts.get(trade.Symbol)
+    st.last = trade.Price
+    st.lastQty = trade.Quantity
+    st.updated = trade.Timestamp
+
+    start := trade.Timestamp.Truncate(bucketSize)
+    b := &st.buckets[int(start.Unix()/int64(bucketSize/time.Second))%bucketCount]
+    if b.start != start.UnixNano() {
+        // Slot still holds a bucket from a previous day, recycle it
+        *b = minuteBucket{start: start.UnixNano(), open: trade.Price, high: trade.Price, low: trade.Price}
+    }
+    if trade.Price > b.high {
+        b.high = trade.Price
+    }
+    if trade.Price < b.low {
+        b.low = trade.Price
+    }
+    b.volume += trade.Quantity
+    b.quoteVolume += trade.Price * trade.Quantity
+    b.trades++
+
+    ts.publish(trade.Symbol, st, trade.Timestamp)
+}
+
+// OnTopOfBook records the latest best bid/ask, publishing only when it
+// actually changed
+func (ts *TickerStats) OnTopOfBook(tob *engine.TopOfBook) {
+    if tob == nil {
+        return
+    }
+
+    ts.mutex.Lock()
+    defer ts.mutex.Unlock()
+
+    st := ts.get(tob.Symbol)
+    if st.top.BidPrice == tob.BidPrice && st.top.BidQty == tob.BidQty &&
+        st.top.AskPrice == tob.AskPrice && st.top.AskQty == tob.AskQty {
+        return
+    }
+    st.top = *tob
+    st.updated = tob.Timestamp
+
+    ts.publish(tob.Symbol, st, tob.Timestamp)
+}
+
+// Ticker returns the current statistics for a symbol
+func (ts *TickerStats) Ticker(symbol string) (Ticker, bool) {
+    ts.mutex.Lock()
+    defer ts.mutex.Unlock()
+
+    st, exists := ts.symbols[symbol]
+    if !exists {
+        return Ticker{}, false
+    }
+    return st.compute(symbol, ts.clock.Now()), true
+}
+
+// Tickers returns the statistics for every known symbol, sorted by symbol
+func (ts *TickerStats) Tickers() []Ticker {
+    ts.mutex.Lock()
+    defer ts.mutex.Unlock()
+
+    now := ts.clock.Now()
+    tickers := make([]Ticker, 0, len(ts.symbols))
+    for symbol, st := range ts.symbols {
+        tickers = append(tickers, st.compute(symbol, now))
+    }
+    sort.Slice(tickers, func(i, j int) bool { return tickers[i].Symbol < tickers[j].Symbol })
+    return tickers
+}
+
+// Subscribe streams ticker updates for a symbol, or all symbols when
+// empty. The returned function cancels the subscription.
+func (ts *TickerStats) Subscribe(symbol string) (<-chan *Ticker, func()) {
+    ch := make(chan *Ticker, 1000)
+
+    ts.mutex.Lock()
+    ts.subscribers[ch] = symbol
+    ts.mutex.Unlock()
+
+    return ch, func() {
+        ts.mutex.Lock()
+        delete(ts.subscribers, ch)
+        ts.mutex.Unlock()
+    }
+}
+
+// publish pushes a fresh ticker to matching subscribers. Callers must
+// hold the mutex.
+func (ts *TickerStats) publish(symbol string, st *symbolTicker, now time.Time) {
+    if len(ts.subscribers) == 0 {
+        return
+    }
+
+    ticker := st.compute(symbol, now)
+    for ch, filter := range ts.subscribers {
+        if filter != "" && filter != symbol {
+            continue
+        }
+
+        update := ticker
+        select {
+        case ch <- &update:
+        default:
+            // Slow subscriber, drop the update
+        }
+    }
+}
@@ -0,0 +1,445 @@
+// Package backtest runs strategies against recorded market data offline.
+// Strategy orders are matched by the real engine, with the historical
+// market simulated around them: aggressive orders take the recorded best
+// bid or offer, and passive orders fill from recorded trades once the
+// queue estimated ahead of them has traded.
+package backtest
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "time"
+
+    "go.uber.org/zap"
+
+    "high-frequency-matching-engine/clock"
+    "high-frequency-matching-engine/engine"
+    "high-frequency-matching-engine/marketdata"
+    "high-frequency-matching-engine/strategy"
+)
+
+// Config sets up a backtest. Path is a capture directory or one capture,
+// JSON lines or CSV file, as for replay, and Filter picks events from it.
+// Strategy orders, cancels and amends reach the market OrderLatency after
+// they are sent, and execution reports take as long to come back; market
+// data reaches the strategy MarketDataLatency after it was received. Fees
+// are fractions of notional, negative for rebates. Equity is sampled every
+// SampleInterval for drawdown and Sharpe.
+type Config struct {
+    Path              string
+    Filter            marketdata.CaptureFilter
+    OrderLatency      time.Duration
+    MarketDataLatency time.Duration
+    MakerFee          float64
+    TakerFee          float64
+    SampleInterval    time.Duration
+}
+
+// Backtester plays recorded market data through one strategy in
+// simulated time
+type Backtester struct {
+    cfg      Config
+    strategy strategy.Strategy
+    logger   *zap.Logger
+
+    engine  *engine.MatchingEngine
+    clock   *clock.Simulated
+    markets map[string]*market
+    resting map[string]*passive
+    ctx     *simContext
+    venue   *strategy.Portfolio // positions as the market sees them
+    report  *reportBuilder
+
+    pending  []*engine.ExecutionReport
+    takerID  string // our order currently taking liquidity
+    orderSeq uint64
+    histSeq  uint64
+}
+
+func NewBacktester(cfg Config, s strategy.Strategy, logger *zap.Logger) *Backtester {
+    if cfg.SampleInterval <= 0 {
+        cfg.SampleInterval = time.Minute
+    }
+    cfg.Filter.Kind = marketdata.CaptureData
+
+    b := &Backtester{
+        cfg:      cfg,
+        strategy: s,
+        logger:   logger,
+        clock:    clock.NewSimulated(time.Time{}),
+        markets:  make(map[string]*market),
+        resting:  make(map[string]*passive),
+        venue:    strategy.NewPortfolio(),
+    }
+    b.engine = engine.NewMatchingEngineWithClock(b.clock)
+    b.ctx = newSimContext(b)
+    b.report = newReportBuilder(s.GetName(), cfg)
+
+    // Called under the book lock, so reports are only collected here
+    b.engine.OnExecution(func(reports []*engine.ExecutionReport) {
+        b.pending = append(b.pending, reports...)
+    })
+    return b
+}
+
+// Run plays every event through the strategy and reports how it did. A
+// panicking strategy ends the run with an error.
+func (b *Backtester) Run(ctx context.Context) (report *Report, err error) {
+    defer func() {
+        if p := recover(); p != nil {
+            report, err = nil, fmt.Errorf("strategy panicked at %s: %v", b.clock.Now().Format(time.RFC3339Nano), p)
+        }
+    }()
+
+    paths, err := marketdata.CapturePaths(b.cfg.Path)
+    if err != nil {
+        return nil, err
+    }
+
+    started := false
+    for _, path := range paths {
+        reader, err := marketdata.OpenCapture(path)
+        if err != nil {
+            return nil, err
+        }
+        for {
+            record, err := reader.Next()
+            if err == io.EOF {
+                break
+            }
+            if err != nil {
+                reader.Close()
+                return nil, fmt.Errorf("%s: %w", path, err)
+            }
+            if record.Data == nil || !b.cfg.Filter.Match(record) {
+                continue
+            }
+            if err := ctx.Err(); err != nil {
+                reader.Close()
+                return nil, err
+            }
+
+            at := record.Received
+            if !started {
+                b.start(at)
+                started = true
+            }
+            b.clock.Set(at)
+            b.onMarketData(record.Data)
+        }
+        reader.Close()
+    }
+    if !started {
+        return nil, errors.New("no market data matched")
+    }
+
+    // Let orders and reports in flight land before stopping
+    b.clock.Advance(2*b.cfg.OrderLatency + b.cfg.MarketDataLatency)
+    b.strategy.OnStop(b.ctx)
+    b.ctx.stopTimers()
+    b.clock.Advance(2 * b.cfg.OrderLatency)
+    b.sample()
+
+    return b.report.finish(b.clock.Now(), b.venue.Positions()), nil
+}
+
+func (b *Backtester) start(at time.Time) {
+    b.clock.Set(at)
+    b.report.Start = at
+    b.sample()
+    b.scheduleSample()
+    b.strategy.OnStart(b.ctx)
+}
+
+func (b *Backtester) scheduleSample() {
+    b.clock.AfterFunc(b.cfg.SampleInterval, func() {
+        b.sample()
+        b.scheduleSample()
+    })
+}
+
+// sample records equity with positions marked to the market
+func (b *Backtester) sample() {
+    var inventory, unrealized, realized float64
+    for _, position := range b.venue.Positions() {
+        inventory += position.Quantity
+        realized += position.Realized
+        if m, exists := b.markets[position.Symbol]; exists {
+            unrealized += position.Unrealized(m.mark())
+        }
+    }
+    b.report.sample(b.clock.Now(), inventory, realized, unrealized)
+}
+
+func (b *Backtester) market(symbol string) *market {
+    m, exists := b.markets[symbol]
+    if !exists {
+        m = &market{symbol: symbol}
+        b.markets[symbol] = m
+    }
+    return m
+}
+
+// onMarketData moves the historical market on, fills our resting orders
+// it reaches, and passes the event to the strategy after the data latency
+func (b *Backtester) onMarketData(data *engine.MarketData) {
+    b.report.Events++
+    m := b.market(data.Symbol)
+
+    if data.Type == engine.MarketDataTrade && data.Price > 0 && data.Quantity > 0 {
+        b.onTrade(m, data)
+    }
+    if data.BidPrice > 0 || data.AskPrice > 0 {
+        b.onQuote(m, data)
+    }
+    if data.Price > 0 {
+        m.last = data.Price
+    }
+
+    event := *data
+    b.clock.AfterFunc(b.cfg.MarketDataLatency, func() {
+        event.ReceiveTime = b.clock.Now()
+        b.strategy.OnMarketData(b.ctx, &event)
+    })
+}
+
+// onTrade fills our orders on the side the trade hit. The aggressor is
+// inferred from the trade price against the quote where it can be.
+func (b *Backtester) onTrade(m *market, data *engine.MarketData) {
+    sellerAggressed := data.Side == engine.SELL
+    switch {
+    case m.bid > 0 && data.Price <= m.bid:
+        sellerAggressed = true
+    case m.ask > 0 && data.Price >= m.ask:
+        sellerAggressed = false
+    }
+
+    if sellerAggressed {
+        if data.Price == m.bid {
+            m.tradedAtBid += data.Quantity
+        }
+        b.fillPassive(m.symbol, engine.BUY, data.Price, data.Quantity)
+    } else {
+        if data.Price == m.ask {
+            m.tradedAtAsk += data.Quantity
+        }
+        b.fillPassive(m.symbol, engine.SELL, data.Price, data.Quantity)
+    }
+}
+
+// onQuote fills our orders the new quote crosses, at their own price and
+// up to the size shown, then moves every order's queue position on
+func (b *Backtester) onQuote(m *market, data *engine.MarketData) {
+    if data.AskPrice > 0 && data.AskQty > 0 {
+        b.fillPassive(m.symbol, engine.BUY, data.AskPrice, data.AskQty)
+    }
+    if data.BidPrice > 0 && data.BidQty > 0 {
+        b.fillPassive(m.symbol, engine.SELL, data.BidPrice, data.BidQty)
+    }
+
+    for _, p := range b.resting {
+        if p.symbol == m.symbol {
+            m.requeue(p, data.BidPrice, data.BidQty, data.AskPrice, data.AskQty)
+        }
+    }
+    if data.BidPrice > 0 {
+        m.bid, m.bidQty = data.BidPrice, data.BidQty
+    }
+    if data.AskPrice > 0 {
+        m.ask, m.askQty = data.AskPrice, data.AskQty
+    }
+    m.tradedAtBid, m.tradedAtAsk = 0, 0
+}
+
+// fillPassive matches historical volume against our resting orders on
+// side by sending the engine an opposing order for each price level filled
+func (b *Backtester) fillPassive(symbol string, side engine.OrderSide, price, quantity float64) {
+    var orders []*passive
+    for _, p := range b.resting {
+        if p.symbol == symbol && p.side == side {
+            orders = append(orders, p)
+        }
+    }
+    if len(orders) == 0 {
+        return
+    }
+
+    fills := allocate(orders, side, price, quantity, func(p *passive) float64 {
+        order, exists := b.engine.GetOrder(symbol, p.id)
+        if !exists {
+            return 0
+        }
+        return order.Quantity - order.Filled
+    })
+    for _, fill := range fills {
+        contra := b.historicalOrder(symbol, opposite(side), fill.price, fill.quantity)
+        trades := b.engine.ProcessOrder(contra)
+        b.engine.CancelOrder(symbol, contra.ID) // any rounding left over
+        b.flush(trades)
+    }
+}
+
+func (b *Backtester) historicalOrder(symbol string, side engine.OrderSide, price, quantity float64) *engine.Order {
+    b.histSeq++
+    return &engine.Order{
+        ID:       fmt.Sprintf("hist-%d", b.histSeq),
+        Symbol:   symbol,
+        Side:     side,
+        Type:     engine.LIMIT,
+        Quantity: quantity,
+        Price:    price,
+        ClientID: "historical",
+    }
+}
+
+// liquidity rests the historical best opposing quote on the simulated book
+// when order would trade against it, and returns it so what is left can
+// be taken out again
+func (b *Backtester) liquidity(symbol string, side engine.OrderSide, orderType engine.OrderType, price float64) *engine.Order {
+    m := b.market(symbol)
+    if side == engine.BUY && m.ask > 0 && m.askQty > epsilon && (orderType == engine.MARKET || price >= m.ask) {
+        return b.historicalOrder(symbol, engine.SELL, m.ask, m.askQty)
+    }
+    if side == engine.SELL && m.bid > 0 && m.bidQty > epsilon && (orderType == engine.MARKET || price <= m.bid) {
+        return b.historicalOrder(symbol, engine.BUY, m.bid, m.bidQty)
+    }
+    return nil
+}
+
+// withdraw takes historical liquidity back off the book, leaving the quote
+// with only what was not taken until the next update
+func (b *Backtester) withdraw(contra *engine.Order) {
+    if contra == nil {
+        return
+    }
+    left := 0.0
+    if order, exists := b.engine.GetOrder(contra.Symbol, contra.ID); exists {
+        left = order.Quantity - order.Filled
+        b.engine.CancelOrder(contra.Symbol, contra.ID)
+    }
+    m := b.market(contra.Symbol)
+    if contra.Side == engine.SELL {
+        m.askQty = left
+    } else {
+        m.bidQty = left
+    }
+}
+
+// submit is a strategy order arriving at the market
+func (b *Backtester) submit(order *engine.Order) {
+    contra := b.liquidity(order.Symbol, order.Side, order.Type, order.Price)
+    if contra != nil {
+        b.engine.ProcessOrder(contra)
+    }
+    b.takerID = order.ID
+    trades := b.engine.ProcessOrder(order)
+    b.takerID = ""
+    b.withdraw(contra)
+    b.flush(trades)
+}
+
+// cancel is a strategy cancel arriving at the market
+func (b *Backtester) cancel(symbol, orderID string) {
+    if !b.engine.CancelOrder(symbol, orderID) {
+        b.report.Rejected++
+    }
+    b.flush(nil)
+}
+
+// amend is a strategy amend arriving at the market
+func (b *Backtester) amend(symbol, orderID string, price, quantity float64) {
+    current, exists := b.engine.GetOrder(symbol, orderID)
+    if !exists {
+        b.report.Rejected++
+        return
+    }
+    contra := b.liquidity(symbol, current.Side, engine.LIMIT, price)
+    if contra != nil {
+        b.engine.ProcessOrder(contra)
+    }
+    b.takerID = orderID
+    _, trades, err := b.engine.AmendOrder(symbol, orderID, price, quantity)
+    b.takerID = ""
+    b.withdraw(contra)
+    if err != nil {
+        b.report.Rejected++
+    }
+    b.flush(trades)
+}
+
+// flush handles the execution reports and trades of an engine call: our
+// fills are booked and our resting orders' queue positions set, and the
+// strategy hears of them after the order latency
+func (b *Backtester) flush(trades []*engine.Trade) {
+    reports := b.pending
+    b.pending = nil
+
+    for _, report := range reports {
+        if !b.ctx.owns(report.Order.ID) {
+            continue
+        }
+        b.venue.Apply(report)
+        order := report.Order
+
+        switch {
+        case order.Status == engine.FILLED || order.Status == engine.CANCELLED:
+            delete(b.resting, order.ID)
+        case report.Type == engine.EXEC_NEW || report.Type == engine.EXEC_REPLACED:
+            b.rest(order)
+        }
+
+        if report.Type == engine.EXEC_TRADE {
+            maker := order.ID != b.takerID
+            fee := b.cfg.TakerFee
+            if maker {
+                fee = b.cfg.MakerFee
+            }
+            position := b.venue.Position(order.Symbol).Quantity
+            b.report.fill(b.clock.Now(), order, report.LastPrice, report.LastQty, maker, fee, position)
+        }
+
+        delivered := report
+        b.clock.AfterFunc(b.cfg.OrderLatency, func() {
+            b.ctx.onReport(delivered)
+        })
+    }
+
+    for _, trade := range trades {
+        delivered := *trade
+        b.clock.AfterFunc(b.cfg.OrderLatency, func() {
+            b.strategy.OnTrade(b.ctx, &delivered)
+        })
+    }
+}
+
+// rest starts tracking the queue position of one of our orders that is
+// new or re-entered at a new price. Ahead is settled against the market
+// before the order can trade, so an order that trades on entry is no
+// different.
+func (b *Backtester) rest(order engine.Order) {
+    if order.Type != engine.LIMIT {
+        return
+    }
+    p, exists := b.resting[order.ID]
+    if exists && p.price == order.Price {
+        return // a quantity reduction keeps its place
+    }
+    b.orderSeq++
+    b.resting[order.ID] = &passive{
+        id:     order.ID,
+        symbol: order.Symbol,
+        side:   order.Side,
+        price:  order.Price,
+        seq:    b.orderSeq,
+        ahead:  b.market(order.Symbol).queueAhead(order.Side, order.Price),
+    }
+}
+
+func opposite(side engine.OrderSide) engine.OrderSide {
+    if side == engine.BUY {
+        return engine.SELL
+    }
+    return engine.BUY
+}
@@ -0,0 +1,192 @@
+package backtest
+
+import (
+    "fmt"
+    "time"
+
+    "go.uber.org/zap"
+
+    "high-frequency-matching-engine/clock"
+    "high-frequency-matching-engine/engine"
+    "high-frequency-matching-engine/strategy"
+)
+
+// simContext is the strategy.Context of a backtested strategy. Its book is
+// the historical market, and its open orders and positions only change as
+// execution reports reach the strategy.
+type simContext struct {
+    b          *Backtester
+    portfolio  *strategy.Portfolio
+    ours       map[string]bool
+    cancelling map[string]bool
+    timers     []*simTimer
+    orderSeq   int
+}
+
+func newSimContext(b *Backtester) *simContext {
+    return &simContext{
+        b:          b,
+        portfolio:  strategy.NewPortfolio(),
+        ours:       make(map[string]bool),
+        cancelling: make(map[string]bool),
+    }
+}
+
+func (c *simContext) owns(orderID string) bool {
+    return c.ours[orderID]
+}
+
+// onReport is an execution report reaching the strategy
+func (c *simContext) onReport(report *engine.ExecutionReport) {
+    c.portfolio.Apply(report)
+    order := report.Order
+    if order.Status == engine.FILLED || order.Status == engine.CANCELLED {
+        delete(c.cancelling, order.ID)
+    }
+    c.b.strategy.OnOrderUpdate(c, &order)
+}
+
+func (c *simContext) Place(order *engine.Order) (string, error) {
+    if order == nil || order.Symbol == "" || order.Quantity <= 0 || (order.Type == engine.LIMIT && order.Price <= 0) {
+        return "", strategy.ErrInvalidOrder
+    }
+
+    placed := *order
+    if placed.ID == "" {
+        c.orderSeq++
+        placed.ID = fmt.Sprintf("%s-%d", c.b.strategy.GetName(), c.orderSeq)
+    }
+    if placed.ClientID == "" {
+        placed.ClientID = c.b.strategy.GetName()
+    }
+    placed.Filled = 0
+    placed.Status = engine.PENDING
+    placed.Timestamp = c.Now()
+
+    c.portfolio.Track(placed)
+    c.ours[placed.ID] = true
+    c.b.report.placed(placed.Quantity)
+
+    sent := placed
+    c.b.clock.AfterFunc(c.b.cfg.OrderLatency, func() { c.b.submit(&sent) })
+    return placed.ID, nil
+}
+
+func (c *simContext) Cancel(symbol, orderID string) error {
+    if !c.portfolio.IsOpen(orderID) {
+        return engine.ErrOrderNotFound
+    }
+    if c.cancelling[orderID] {
+        return nil
+    }
+    c.cancelling[orderID] = true
+    c.b.report.Cancels++
+    c.b.clock.AfterFunc(c.b.cfg.OrderLatency, func() { c.b.cancel(symbol, orderID) })
+    return nil
+}
+
+func (c *simContext) Amend(symbol, orderID string, price, quantity float64) error {
+    if !c.portfolio.IsOpen(orderID) {
+        return engine.ErrOrderNotFound
+    }
+    if price <= 0 || quantity <= 0 {
+        return engine.ErrInvalidAmend
+    }
+    c.b.report.amended(quantity)
+    c.b.clock.AfterFunc(c.b.cfg.OrderLatency, func() { c.b.amend(symbol, orderID, price, quantity) })
+    return nil
+}
+
+func (c *simContext) OpenOrders(symbol string) []engine.Order {
+    return c.portfolio.OpenOrders(symbol)
+}
+
+func (c *simContext) Position(symbol string) strategy.Position {
+    return c.portfolio.Position(symbol)
+}
+
+// TopOfBook returns the historical best bid and offer
+func (c *simContext) TopOfBook(symbol string) *engine.TopOfBook {
+    m, exists := c.b.markets[symbol]
+    if !exists {
+        return nil
+    }
+    return &engine.TopOfBook{
+        Symbol:    symbol,
+        BidPrice:  m.bid,
+        BidQty:    m.bidQty,
+        AskPrice:  m.ask,
+        AskQty:    m.askQty,
+        Timestamp: c.Now(),
+    }
+}
+
+// Depth only knows the historical best bid and offer, so it returns at
+// most one level a side
+func (c *simContext) Depth(symbol string, levels int) *engine.OrderBookSnapshot {
+    top := c.TopOfBook(symbol)
+    if top == nil {
+        return nil
+    }
+    snapshot := &engine.OrderBookSnapshot{
+        Symbol:    symbol,
+        Bids:      []engine.OrderBookLevel{},
+        Asks:      []engine.OrderBookLevel{},
+        Timestamp: top.Timestamp,
+    }
+    if top.BidPrice > 0 {
+        snapshot.Bids = append(snapshot.Bids, engine.OrderBookLevel{Price: top.BidPrice, Quantity: top.BidQty})
+    }
+    if top.AskPrice > 0 {
+        snapshot.Asks = append(snapshot.Asks, engine.OrderBookLevel{Price: top.AskPrice, Quantity: top.AskQty})
+    }
+    return snapshot
+}
+
+// simTimer runs on the simulated clock
+type simTimer struct {
+    timer   clock.Timer
+    stopped bool
+}
+
+func (t *simTimer) Stop() {
+    t.stopped = true
+    t.timer.Stop()
+}
+
+func (c *simContext) After(d time.Duration, fn func(strategy.Context)) strategy.Timer {
+    return c.schedule(d, 0, fn)
+}
+
+func (c *simContext) Every(d time.Duration, fn func(strategy.Context)) strategy.Timer {
+    return c.schedule(d, d, fn)
+}
+
+func (c *simContext) schedule(d, interval time.Duration, fn func(strategy.Context)) strategy.Timer {
+    t := &simTimer{}
+    var fire func()
+    fire = func() {
+        fn(c)
+        if interval > 0 && !t.stopped {
+            t.timer.Reset(interval)
+        }
+    }
+    t.timer = c.b.clock.AfterFunc(d, fire)
+    c.timers = append(c.timers, t)
+    return t
+}
+
+func (c *simContext) stopTimers() {
+    for _, t := range c.timers {
+        t.Stop()
+    }
+    c.timers = nil
+}
+
+func (c *simContext) Now() time.Time {
+    return c.b.clock.Now()
+}
+
+func (c *simContext) Logger() *zap.Logger {
+    return c.b.logger
+}
@@ -0,0 +1,150 @@
+package backtest
+
+import (
+    "math"
+    "sort"
+
+    "high-frequency-matching-engine/engine"
+)
+
+const epsilon = 1e-9
+
+// market is the historical top of book for a symbol, as of the last event
+type market struct {
+    symbol string
+    bid    float64
+    bidQty float64
+    ask    float64
+    askQty float64
+    last   float64
+
+    // Traded at the best prices since the last quote, so a smaller quote
+    // is not also taken as cancellations
+    tradedAtBid float64
+    tradedAtAsk float64
+}
+
+// mark is the price open positions are valued at
+func (m *market) mark() float64 {
+    if m.bid > 0 && m.ask > 0 {
+        return (m.bid + m.ask) / 2
+    }
+    return m.last
+}
+
+// passive is one of our orders resting on the simulated book. Ahead is
+// the historical quantity queued in front of it at its price, +Inf while
+// its price is behind the best and the queue there is unknown.
+type passive struct {
+    id     string
+    symbol string
+    side   engine.OrderSide
+    price  float64
+    seq    uint64 // time priority among our orders
+    ahead  float64
+}
+
+// queueAhead estimates the queue in front of an order joining at price:
+// none if it improves on the best price, the shown size if it joins the
+// best, and unknown if it is behind
+func (m *market) queueAhead(side engine.OrderSide, price float64) float64 {
+    best, size := m.bid, m.bidQty
+    better := price > m.bid
+    if side == engine.SELL {
+        best, size = m.ask, m.askQty
+        better = price < m.ask
+    }
+    switch {
+    case best <= 0 || better:
+        return 0
+    case price == best:
+        return size
+    default:
+        return math.Inf(1)
+    }
+}
+
+// requeue moves an order's queue position on for a new quote. A smaller
+// size at its price, beyond what traded, is taken as cancellations spread
+// evenly through the queue; if the best price moves past the order, the
+// queue in front of it is gone.
+func (m *market) requeue(p *passive, bid, bidQty, ask, askQty float64) {
+    oldBest, oldSize, traded := m.bid, m.bidQty, m.tradedAtBid
+    best, size := bid, bidQty
+    behind := best > p.price
+    if p.side == engine.SELL {
+        oldBest, oldSize, traded = m.ask, m.askQty, m.tradedAtAsk
+        best, size = ask, askQty
+        behind = best < p.price
+    }
+    if best <= 0 {
+        return
+    }
+
+    switch {
+    case !behind && best != p.price:
+        p.ahead = 0
+    case best == p.price && math.IsInf(p.ahead, 1):
+        p.ahead = size
+    case best == p.price:
+        if oldBest == p.price && oldSize > 0 {
+            if cancelled := oldSize - size - traded; cancelled > 0 {
+                p.ahead -= cancelled * p.ahead / oldSize
+            }
+        }
+        p.ahead = max(0, min(p.ahead, size))
+    }
+}
+
+// levelFill is quantity to fill at one of our price levels
+type levelFill struct {
+    price    float64
+    quantity float64
+}
+
+// allocate shares historical volume trading at price among our resting
+// orders on side. Orders priced through the trade fill first, best price
+// first; orders at the trade price fill once the queue ahead of them has
+// traded. remaining returns how much of an order is still open.
+func allocate(orders []*passive, side engine.OrderSide, price, quantity float64, remaining func(*passive) float64) []levelFill {
+    sort.Slice(orders, func(i, j int) bool {
+        if orders[i].price != orders[j].price {
+            if side == engine.BUY {
+                return orders[i].price > orders[j].price
+            }
+            return orders[i].price < orders[j].price
+        }
+        return orders[i].seq < orders[j].seq
+    })
+
+    var fills []levelFill
+    for _, p := range orders {
+        if quantity <= epsilon {
+            break
+        }
+        through := p.price > price
+        if side == engine.SELL {
+            through = p.price < price
+        }
+        if !through && p.price != price {
+            break
+        }
+        if !through {
+            take := min(quantity, p.ahead)
+            p.ahead -= take
+            quantity -= take
+        }
+
+        fill := min(quantity, remaining(p))
+        if fill <= epsilon {
+            continue
+        }
+        quantity -= fill
+        if n := len(fills); n > 0 && fills[n-1].price == p.price {
+            fills[n-1].quantity += fill
+        } else {
+            fills = append(fills, levelFill{price: p.price, quantity: fill})
+        }
+    }
+    return fills
+}
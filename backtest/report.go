@@ -0,0 +1,250 @@
+package backtest
+
+import (
+    "encoding/csv"
+    "encoding/json"
+    "io"
+    "math"
+    "strconv"
+    "time"
+
+    "high-frequency-matching-engine/engine"
+    "high-frequency-matching-engine/strategy"
+)
+
+// Fill is one execution of a strategy order. Position is the strategy's
+// position in the symbol after it.
+type Fill struct {
+    Time      time.Time `json:"time"`
+    OrderID   string    `json:"order_id"`
+    Symbol    string    `json:"symbol"`
+    Side      string    `json:"side"`
+    Price     float64   `json:"price"`
+    Quantity  float64   `json:"quantity"`
+    Liquidity string    `json:"liquidity"` // maker or taker
+    Fee       float64   `json:"fee"`
+    Position  float64   `json:"position"`
+}
+
+// EquityPoint is the strategy's P&L at one sample, with open positions
+// marked to the historical mid. Inventory sums positions across symbols.
+type EquityPoint struct {
+    Time       time.Time `json:"time"`
+    Inventory  float64   `json:"inventory"`
+    Realized   float64   `json:"realized"`
+    Unrealized float64   `json:"unrealized"`
+    Fees       float64   `json:"fees"`
+    Equity     float64   `json:"equity"`
+}
+
+// Report summarizes a backtest. PnL is realized plus unrealized, less
+// fees. FillRatio is the quantity filled over the quantity ordered, each
+// amend counting as a new quote; Sharpe is annualized from the change in
+// equity between samples; MaxDrawdown is the largest fall in equity from
+// a previous high.
+type Report struct {
+    Strategy string        `json:"strategy"`
+    Start    time.Time     `json:"start"`
+    End      time.Time     `json:"end"`
+    Duration time.Duration `json:"duration"`
+    Events   int64         `json:"events"`
+
+    Orders         int64   `json:"orders"`
+    Cancels        int64   `json:"cancels"`
+    Amends         int64   `json:"amends"`
+    Rejected       int64   `json:"rejected"`
+    Fills          int64   `json:"fills"`
+    MakerFills     int64   `json:"maker_fills"`
+    TakerFills     int64   `json:"taker_fills"`
+    OrderedQty     float64 `json:"ordered_quantity"`
+    FilledQty      float64 `json:"filled_quantity"`
+    FillRatio      float64 `json:"fill_ratio"`
+    Volume         float64 `json:"volume"` // notional
+    Fees           float64 `json:"fees"`
+    RealizedPnL    float64 `json:"realized_pnl"`
+    UnrealizedPnL  float64 `json:"unrealized_pnl"`
+    PnL            float64 `json:"pnl"`
+    MaxDrawdown    float64 `json:"max_drawdown"`
+    Sharpe         float64 `json:"sharpe"`
+    FinalInventory float64 `json:"final_inventory"`
+    MaxLong        float64 `json:"max_long"`
+    MaxShort       float64 `json:"max_short"`
+    MeanInventory  float64 `json:"mean_abs_inventory"` // over samples
+
+    Positions []strategy.Position `json:"positions"`
+
+    Equity     []EquityPoint `json:"-"`
+    Executions []Fill        `json:"-"`
+}
+
+type reportBuilder struct {
+    Report
+    interval time.Duration
+}
+
+func newReportBuilder(name string, cfg Config) *reportBuilder {
+    return &reportBuilder{
+        Report:   Report{Strategy: name, Positions: []strategy.Position{}},
+        interval: cfg.SampleInterval,
+    }
+}
+
+func (rb *reportBuilder) placed(quantity float64) {
+    rb.Orders++
+    rb.OrderedQty += quantity
+}
+
+// amended counts an amend as a new quote for the fill ratio
+func (rb *reportBuilder) amended(quantity float64) {
+    rb.Amends++
+    rb.OrderedQty += quantity
+}
+
+func (rb *reportBuilder) fill(at time.Time, order engine.Order, price, quantity float64, maker bool, feeRate, position float64) {
+    fill := Fill{
+        Time:      at,
+        OrderID:   order.ID,
+        Symbol:    order.Symbol,
+        Side:      "buy",
+        Price:     price,
+        Quantity:  quantity,
+        Liquidity: "taker",
+        Fee:       price * quantity * feeRate,
+        Position:  position,
+    }
+    if order.Side == engine.SELL {
+        fill.Side = "sell"
+    }
+    if maker {
+        fill.Liquidity = "maker"
+        rb.MakerFills++
+    } else {
+        rb.TakerFills++
+    }
+    rb.Executions = append(rb.Executions, fill)
+
+    rb.Fills++
+    rb.FilledQty += quantity
+    rb.Volume += price * quantity
+    rb.Fees += fill.Fee
+    rb.MaxLong = max(rb.MaxLong, position)
+    rb.MaxShort = min(rb.MaxShort, position)
+}
+
+func (rb *reportBuilder) sample(at time.Time, inventory, realized, unrealized float64) {
+    rb.Equity = append(rb.Equity, EquityPoint{
+        Time:       at,
+        Inventory:  inventory,
+        Realized:   realized,
+        Unrealized: unrealized,
+        Fees:       rb.Fees,
+        Equity:     realized + unrealized - rb.Fees,
+    })
+}
+
+func (rb *reportBuilder) finish(end time.Time, positions []strategy.Position) *Report {
+    r := rb.Report
+    r.End = end
+    r.Duration = end.Sub(r.Start)
+    r.Positions = positions
+    if r.OrderedQty > 0 {
+        r.FillRatio = r.FilledQty / r.OrderedQty
+    }
+
+    if n := len(r.Equity); n > 0 {
+        last := r.Equity[n-1]
+        r.RealizedPnL, r.UnrealizedPnL, r.PnL = last.Realized, last.Unrealized, last.Equity
+        r.FinalInventory = last.Inventory
+    }
+
+    peak := math.Inf(-1)
+    var sumAbs float64
+    for _, point := range r.Equity {
+        peak = max(peak, point.Equity)
+        r.MaxDrawdown = max(r.MaxDrawdown, peak-point.Equity)
+        r.MaxLong = max(r.MaxLong, point.Inventory)
+        r.MaxShort = min(r.MaxShort, point.Inventory)
+        sumAbs += math.Abs(point.Inventory)
+    }
+    if len(r.Equity) > 0 {
+        r.MeanInventory = sumAbs / float64(len(r.Equity))
+    }
+    r.Sharpe = sharpe(r.Equity, rb.interval)
+    return &r
+}
+
+// sharpe annualizes the mean over the standard deviation of the change in
+// equity between samples
+func sharpe(equity []EquityPoint, interval time.Duration) float64 {
+    if len(equity) < 3 {
+        return 0
+    }
+    changes := make([]float64, len(equity)-1)
+    var mean float64
+    for i := 1; i < len(equity); i++ {
+        changes[i-1] = equity[i].Equity - equity[i-1].Equity
+        mean += changes[i-1]
+    }
+    mean /= float64(len(changes))
+
+    var variance float64
+    for _, change := range changes {
+        variance += (change - mean) * (change - mean)
+    }
+    std := math.Sqrt(variance / float64(len(changes)-1))
+    if std == 0 {
+        return 0
+    }
+    perYear := float64(365*24*time.Hour) / float64(interval)
+    return mean / std * math.Sqrt(perYear)
+}
+
+// WriteJSON writes the summary, without the equity curve and fills
+func (r *Report) WriteJSON(w io.Writer) error {
+    encoder := json.NewEncoder(w)
+    encoder.SetIndent("", "  ")
+    return encoder.Encode(r)
+}
+
+// WriteEquityCSV writes the equity curve, one row per sample
+func (r *Report) WriteEquityCSV(w io.Writer) error {
+    writer := csv.NewWriter(w)
+    writer.Write([]string{"time", "inventory", "realized", "unrealized", "fees", "equity"})
+    for _, point := range r.Equity {
+        writer.Write([]string{
+            point.Time.UTC().Format(time.RFC3339Nano),
+            formatFloat(point.Inventory),
+            formatFloat(point.Realized),
+            formatFloat(point.Unrealized),
+            formatFloat(point.Fees),
+            formatFloat(point.Equity),
+        })
+    }
+    writer.Flush()
+    return writer.Error()
+}
+
+// WriteFillsCSV writes every fill in the order they happened
+func (r *Report) WriteFillsCSV(w io.Writer) error {
+    writer := csv.NewWriter(w)
+    writer.Write([]string{"time", "order_id", "symbol", "side", "price", "quantity", "liquidity", "fee", "position"})
+    for _, fill := range r.Executions {
+        writer.Write([]string{
+            fill.Time.UTC().Format(time.RFC3339Nano),
+            fill.OrderID,
+            fill.Symbol,
+            fill.Side,
+            formatFloat(fill.Price),
+            formatFloat(fill.Quantity),
+            fill.Liquidity,
+            formatFloat(fill.Fee),
+            formatFloat(fill.Position),
+        })
+    }
+    writer.Flush()
+    return writer.Error()
+}
+
+func formatFloat(v float64) string {
+    return strconv.FormatFloat(v, 'f', -1, 64)
+}
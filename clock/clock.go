@@ -0,0 +1,31 @@
+// Package clock abstracts time for the engine, strategies and metrics, so
+// they can run on the wall clock live, on a manually advanced clock in
+// tests and backtests, or on the recorded time of replayed market data.
+package clock
+
+import "time"
+
+// Clock tells the time and runs callbacks after a delay
+type Clock interface {
+    Now() time.Time
+    Since(t time.Time) time.Duration
+    // AfterFunc calls f on its own goroutine, or for clocks advanced by
+    // hand on the goroutine advancing it, once d has passed
+    AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a pending AfterFunc call. Stop and Reset behave as on a
+// time.Timer.
+type Timer interface {
+    Stop() bool
+    Reset(d time.Duration) bool
+}
+
+// Real is the wall clock
+type Real struct{}
+
+func (Real) Now() time.Time { return time.Now() }
+
+func (Real) Since(t time.Time) time.Duration { return time.Since(t) }
+
+func (Real) AfterFunc(d time.Duration, f func()) Timer { return time.AfterFunc(d, f) }
@@ -0,0 +1,83 @@
+package clock
+
+import (
+    "sync"
+    "time"
+)
+
+// Replay follows the receive times of replayed market data, which Observe
+// gives it as each event is sent. A paced replay's clock runs on between
+// events at speed times the wall clock, with timers scaled to match; at
+// speed 0, for replays sent as fast as possible, it steps from event to
+// event and timers fire as the replayed time passes them. It reads the
+// zero time until the first event, and never goes back, so a looped replay
+// carries on from where it was.
+type Replay struct {
+    speed   float64
+    stepped *Simulated
+
+    mutex  sync.Mutex
+    anchor time.Time // replayed time at wall
+    wall   time.Time
+}
+
+func NewReplay(speed float64) *Replay {
+    return &Replay{speed: max(speed, 0), stepped: NewSimulated(time.Time{})}
+}
+
+// Observe moves the clock to the receive time of an event being replayed
+func (r *Replay) Observe(t time.Time) {
+    if r.speed == 0 {
+        r.stepped.Set(t)
+        return
+    }
+
+    r.mutex.Lock()
+    defer r.mutex.Unlock()
+    // Paced events go out on time or late, so the clock only needs moving
+    // when one is early
+    if r.wall.IsZero() || t.After(r.nowLocked()) {
+        r.anchor, r.wall = t, time.Now()
+    }
+}
+
+func (r *Replay) Now() time.Time {
+    if r.speed == 0 {
+        return r.stepped.Now()
+    }
+    r.mutex.Lock()
+    defer r.mutex.Unlock()
+    return r.nowLocked()
+}
+
+func (r *Replay) nowLocked() time.Time {
+    if r.wall.IsZero() {
+        return r.anchor
+    }
+    return r.anchor.Add(time.Duration(float64(time.Since(r.wall)) * r.speed))
+}
+
+func (r *Replay) Since(t time.Time) time.Duration {
+    return r.Now().Sub(t)
+}
+
+func (r *Replay) AfterFunc(d time.Duration, f func()) Timer {
+    if r.speed == 0 {
+        return r.stepped.AfterFunc(d, f)
+    }
+    return &scaledTimer{timer: time.AfterFunc(r.scale(d), f), replay: r}
+}
+
+func (r *Replay) scale(d time.Duration) time.Duration {
+    return time.Duration(float64(d) / r.speed)
+}
+
+// scaledTimer is a wall clock timer for a paced replay
+type scaledTimer struct {
+    timer  *time.Timer
+    replay *Replay
+}
+
+func (t *scaledTimer) Stop() bool { return t.timer.Stop() }
+
+func (t *scaledTimer) Reset(d time.Duration) bool { return t.timer.Reset(t.replay.scale(d)) }
@@ -0,0 +1,69 @@
+package clock
+
+import (
+    "testing"
+    "time"
+)
+
+// At speed 0 the clock steps from event to event and runs timers as the
+// replayed time passes them
+func TestReplayStepped(t *testing.T) {
+    r := NewReplay(0)
+    if !r.Now().IsZero() {
+        t.Errorf("clock reads %v before the first event", r.Now())
+    }
+
+    r.Observe(start)
+    fired := false
+    r.AfterFunc(time.Minute, func() { fired = true })
+
+    r.Observe(start.Add(30 * time.Second))
+    r.Observe(start) // a looped replay starting over
+    if !r.Now().Equal(start.Add(30 * time.Second)) {
+        t.Errorf("clock at %v, want 30s in", r.Now())
+    }
+    if fired {
+        t.Error("timer fired early")
+    }
+
+    r.Observe(start.Add(2 * time.Minute))
+    if !fired {
+        t.Error("timer did not fire once the replayed time passed it")
+    }
+}
+
+// A paced replay runs on between events at speed times the wall clock
+func TestReplayPaced(t *testing.T) {
+    const speed = 1000
+    r := NewReplay(speed)
+    r.Observe(start)
+
+    time.Sleep(10 * time.Millisecond)
+    if elapsed := r.Since(start); elapsed < 10*time.Second {
+        t.Errorf("clock moved %v in 10ms at speed %d", elapsed, speed)
+    }
+
+    // An event behind the clock leaves it running; one ahead moves it on
+    r.Observe(start)
+    if r.Now().Before(start.Add(10 * time.Second)) {
+        t.Errorf("clock went back to %v", r.Now())
+    }
+    ahead := start.Add(time.Hour)
+    r.Observe(ahead)
+    if now := r.Now(); now.Before(ahead) || now.After(ahead.Add(time.Minute)) {
+        t.Errorf("clock at %v after an event at %v", now, ahead)
+    }
+
+    // Timers are scaled to match: a replayed minute is 60ms
+    fired := make(chan time.Time, 1)
+    set := time.Now()
+    r.AfterFunc(time.Minute, func() { fired <- time.Now() })
+    select {
+    case at := <-fired:
+        if at.Sub(set) < 60*time.Millisecond {
+            t.Errorf("timer fired after %v, want 60ms", at.Sub(set))
+        }
+    case <-time.After(5 * time.Second):
+        t.Fatal("scaled timer did not fire")
+    }
+}
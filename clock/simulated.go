@@ -0,0 +1,134 @@
+package clock
+
+import (
+    "container/heap"
+    "sync"
+    "time"
+)
+
+// Simulated only moves when Set or Advance moves it, running the timers
+// that fall due on the way in time order, those due together in the order
+// they were set. Timers run on the goroutine moving the clock, which sees
+// the time each was due, and can set further timers that run in the same
+// move if they fall due in it.
+type Simulated struct {
+    now    time.Time
+    timers timerQueue
+    seq    uint64
+    mutex  sync.Mutex
+}
+
+func NewSimulated(start time.Time) *Simulated {
+    return &Simulated{now: start}
+}
+
+func (s *Simulated) Now() time.Time {
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+    return s.now
+}
+
+func (s *Simulated) Since(t time.Time) time.Duration {
+    return s.Now().Sub(t)
+}
+
+func (s *Simulated) AfterFunc(d time.Duration, f func()) Timer {
+    t := &simTimer{clock: s, fn: f, index: -1}
+    t.Reset(d)
+    return t
+}
+
+// Advance moves the clock on by d
+func (s *Simulated) Advance(d time.Duration) {
+    s.Set(s.Now().Add(d))
+}
+
+// Set moves the clock on to t. The clock never goes back, so an earlier t
+// leaves it where it is.
+func (s *Simulated) Set(t time.Time) {
+    for {
+        s.mutex.Lock()
+        if len(s.timers) == 0 || s.timers[0].at.After(t) {
+            if t.After(s.now) {
+                s.now = t
+            }
+            s.mutex.Unlock()
+            return
+        }
+        timer := heap.Pop(&s.timers).(*simTimer)
+        if timer.at.After(s.now) {
+            s.now = timer.at
+        }
+        s.mutex.Unlock()
+
+        // Unlocked, as timers usually set more timers
+        timer.fn()
+    }
+}
+
+// simTimer is a Simulated AfterFunc call; index is its place in the queue,
+// -1 once it has fired or been stopped
+type simTimer struct {
+    clock *Simulated
+    fn    func()
+    at    time.Time
+    seq   uint64
+    index int
+}
+
+func (t *simTimer) Stop() bool {
+    s := t.clock
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+
+    if t.index < 0 {
+        return false
+    }
+    heap.Remove(&s.timers, t.index)
+    return true
+}
+
+func (t *simTimer) Reset(d time.Duration) bool {
+    s := t.clock
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+
+    pending := t.index >= 0
+    if pending {
+        heap.Remove(&s.timers, t.index)
+    }
+    s.seq++
+    t.at, t.seq = s.now.Add(max(d, 0)), s.seq
+    heap.Push(&s.timers, t)
+    return pending
+}
+
+type timerQueue []*simTimer
+
+func (q timerQueue) Len() int { return len(q) }
+
+func (q timerQueue) Less(i, j int) bool {
+    if !q[i].at.Equal(q[j].at) {
+        return q[i].at.Before(q[j].at)
+    }
+    return q[i].seq < q[j].seq
+}
+
+func (q timerQueue) Swap(i, j int) {
+    q[i], q[j] = q[j], q[i]
+    q[i].index, q[j].index = i, j
+}
+
+func (q *timerQueue) Push(x any) {
+    t := x.(*simTimer)
+    t.index = len(*q)
+    *q = append(*q, t)
+}
+
+func (q *timerQueue) Pop() any {
+    old := *q
+    t := old[len(old)-1]
+    t.index = -1
+    *q = old[:len(old)-1]
+    return t
+}
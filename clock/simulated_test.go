@@ -0,0 +1,92 @@
+package clock
+
+import (
+    "reflect"
+    "testing"
+    "time"
+)
+
+var start = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Timers run in time order, those due together in the order they were
+// set, each seeing the time it was due
+func TestSimulatedRunsTimersInOrder(t *testing.T) {
+    s := NewSimulated(start)
+    var fired []string
+    at := map[string]time.Duration{}
+    timer := func(name string, d time.Duration) {
+        s.AfterFunc(d, func() {
+            fired = append(fired, name)
+            if got := s.Since(start); got != at[name] {
+                t.Errorf("%s ran at %v, want %v", name, got, at[name])
+            }
+        })
+        at[name] = s.Since(start) + d
+    }
+
+    timer("3s", 3*time.Second)
+    timer("1s", time.Second)
+    timer("2s-a", 2*time.Second)
+    timer("2s-b", 2*time.Second)
+    s.AfterFunc(time.Second, func() {
+        // Set from a timer, due within the same move
+        timer("1s+2s", 2*time.Second)
+        // And one due after it
+        timer("1s+9s", 9*time.Second)
+    })
+
+    s.Advance(5 * time.Second)
+    want := []string{"1s", "2s-a", "2s-b", "3s", "1s+2s"}
+    if !reflect.DeepEqual(fired, want) {
+        t.Errorf("fired %v, want %v", fired, want)
+    }
+    if got := s.Since(start); got != 5*time.Second {
+        t.Errorf("clock at %v, want 5s", got)
+    }
+
+    // Never back
+    s.Set(start)
+    if got := s.Since(start); got != 5*time.Second {
+        t.Errorf("clock went back to %v", got)
+    }
+
+    s.Set(start.Add(10 * time.Second))
+    if len(fired) != 6 || fired[5] != "1s+9s" {
+        t.Errorf("fired %v, want 1s+9s last", fired)
+    }
+}
+
+func TestSimulatedStopAndReset(t *testing.T) {
+    s := NewSimulated(start)
+    var fired []string
+    stopped := s.AfterFunc(time.Second, func() { fired = append(fired, "stopped") })
+    moved := s.AfterFunc(time.Second, func() { fired = append(fired, "moved") })
+
+    if !stopped.Stop() {
+        t.Error("Stop of a pending timer returned false")
+    }
+    if stopped.Stop() {
+        t.Error("second Stop returned true")
+    }
+    if !moved.Reset(3 * time.Second) {
+        t.Error("Reset of a pending timer returned false")
+    }
+
+    s.Advance(2 * time.Second)
+    if len(fired) != 0 {
+        t.Fatalf("fired %v before the reset time", fired)
+    }
+    s.Advance(time.Second)
+    if !reflect.DeepEqual(fired, []string{"moved"}) {
+        t.Fatalf("fired %v, want only the reset timer", fired)
+    }
+
+    // A fired timer can be set again
+    if moved.Reset(time.Second) {
+        t.Error("Reset of a fired timer returned true")
+    }
+    s.Advance(time.Second)
+    if len(fired) != 2 {
+        t.Errorf("fired %v, want the reset timer twice", fired)
+    }
+}
@@ -0,0 +1,173 @@
+// Command backtest runs a strategy against recorded market data in
+// simulated time and reports its P&L, drawdown, Sharpe ratio, inventory
+// and fill ratio.
+//
+//	backtest -data data/capture -strategy maker -symbol BTCUSDT
+//	backtest -data data/capture -strategy avellaneda -config as.yaml -out results
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+
+	"high-frequency-matching-engine/backtest"
+	"high-frequency-matching-engine/engine"
+	"high-frequency-matching-engine/marketdata"
+	"high-frequency-matching-engine/strategy"
+)
+
+func main() {
+	data := flag.String("data", "data/capture", "capture directory, or one capture, JSONL or CSV file")
+	name := flag.String("strategy", "maker", "maker or avellaneda")
+	configPath := flag.String("config", "", "YAML strategy config for -strategy avellaneda")
+	symbol := flag.String("symbol", "", "symbol to trade; also limits the data to it")
+	quantity := flag.Float64("quantity", 1, "quote size for -strategy maker")
+	spread := flag.Float64("spread", 0.001, "quoted spread as a fraction of the price for -strategy maker")
+	exchange := flag.String("exchange", "", "only replay this exchange's data")
+	dataType := flag.String("type", "", "only replay ticker, trade or depth data")
+	from := flag.String("from", "", "start of the receive time range, RFC 3339")
+	to := flag.String("to", "", "end of the receive time range, RFC 3339")
+	orderLatency := flag.Duration("order-latency", time.Millisecond, "one-way latency of orders and execution reports")
+	mdLatency := flag.Duration("md-latency", 0, "market data latency to the strategy")
+	makerFee := flag.Float64("maker-fee", 0, "maker fee as a fraction of notional (negative for a rebate)")
+	takerFee := flag.Float64("taker-fee", 0, "taker fee as a fraction of notional")
+	sample := flag.Duration("sample", time.Minute, "equity sampling interval")
+	out := flag.String("out", "", "directory to write report.json, equity.csv and fills.csv to")
+	asJSON := flag.Bool("json", false, "print the report as JSON")
+	verbose := flag.Bool("v", false, "log strategy output")
+	flag.Parse()
+
+	s, err := newStrategy(*name, *configPath, *symbol, *quantity, *spread)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	logger := zap.NewNop()
+	if *verbose {
+		logger, _ = zap.NewDevelopment()
+	}
+
+	backtester := backtest.NewBacktester(backtest.Config{
+		Path: *data,
+		Filter: marketdata.CaptureFilter{
+			Exchange: *exchange,
+			Symbol:   *symbol,
+			Type:     engine.MarketDataType(*dataType),
+			From:     parseTime("from", *from),
+			To:       parseTime("to", *to),
+		},
+		OrderLatency:      *orderLatency,
+		MarketDataLatency: *mdLatency,
+		MakerFee:          *makerFee,
+		TakerFee:          *takerFee,
+		SampleInterval:    *sample,
+	}, s, logger)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	report, err := backtester.Run(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *out != "" {
+		if err := writeReport(*out, report); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *asJSON {
+		report.WriteJSON(os.Stdout)
+		return
+	}
+	printReport(report)
+}
+
+func newStrategy(name, configPath, symbol string, quantity, spread float64) (strategy.Strategy, error) {
+	switch name {
+	case "maker":
+		if symbol == "" {
+			return nil, fmt.Errorf("-symbol required for -strategy maker")
+		}
+		return strategy.NewMarketMakerStrategy(symbol, spread, quantity), nil
+	case "avellaneda":
+		var cfg strategy.AvellanedaStoikovConfig
+		if configPath != "" {
+			raw, err := os.ReadFile(configPath)
+			if err != nil {
+				return nil, err
+			}
+			if err := yaml.Unmarshal(raw, &cfg); err != nil {
+				return nil, fmt.Errorf("%s: %w", configPath, err)
+			}
+		}
+		if symbol != "" {
+			cfg.Symbol = symbol
+		}
+		return strategy.NewAvellanedaStoikovStrategy(cfg)
+	default:
+		return nil, fmt.Errorf("unknown strategy %q", name)
+	}
+}
+
+func parseTime(name, value string) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		log.Fatalf("invalid -%s: %v", name, err)
+	}
+	return t
+}
+
+func writeReport(dir string, report *backtest.Report) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	files := []struct {
+		name  string
+		write func(*os.File) error
+	}{
+		{"report.json", func(f *os.File) error { return report.WriteJSON(f) }},
+		{"equity.csv", func(f *os.File) error { return report.WriteEquityCSV(f) }},
+		{"fills.csv", func(f *os.File) error { return report.WriteFillsCSV(f) }},
+	}
+	for _, file := range files {
+		f, err := os.Create(filepath.Join(dir, file.name))
+		if err != nil {
+			return err
+		}
+		err = file.write(f)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func printReport(r *backtest.Report) {
+	fmt.Printf("%s  %s to %s (%s)  events %d\n\n", r.Strategy,
+		r.Start.UTC().Format(time.RFC3339), r.End.UTC().Format(time.RFC3339), r.Duration.Round(time.Second), r.Events)
+
+	fmt.Printf("orders %d  cancels %d  amends %d  rejected %d\n", r.Orders, r.Cancels, r.Amends, r.Rejected)
+	fmt.Printf("fills %d (maker %d, taker %d)  filled %g of %g (%.1f%%)  volume %.2f\n",
+		r.Fills, r.MakerFills, r.TakerFills, r.FilledQty, r.OrderedQty, 100*r.FillRatio, r.Volume)
+	fmt.Printf("pnl %.4f  realized %.4f  unrealized %.4f  fees %.4f\n", r.PnL, r.RealizedPnL, r.UnrealizedPnL, r.Fees)
+	fmt.Printf("max drawdown %.4f  sharpe %.2f\n", r.MaxDrawdown, r.Sharpe)
+	fmt.Printf("inventory final %g  max long %g  max short %g  mean abs %.4f\n",
+		r.FinalInventory, r.MaxLong, r.MaxShort, r.MeanInventory)
+}
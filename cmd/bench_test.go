@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"high-frequency-matching-engine/engine"
+	"high-frequency-matching-engine/store"
+)
+
+// BenchmarkRESTRoundTrip times POST /orders through the API server's
+// handler, for comparison with BenchmarkGatewayRoundTrip in gateway. Buys
+// and sells alternate at one price, so the book stays empty.
+func BenchmarkRESTRoundTrip(b *testing.B) {
+	matchingEngine := engine.NewMatchingEngine()
+	orderStore, err := store.OpenOrderStore(b.TempDir())
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer orderStore.Close()
+
+	server := httptest.NewServer(ordersHandler(matchingEngine, orderStore, zap.NewNop()))
+	defer server.Close()
+	client := server.Client()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		side := engine.BUY
+		if i%2 == 1 {
+			side = engine.SELL
+		}
+		body, _ := json.Marshal(&engine.Order{
+			Symbol:   "BENCH",
+			Side:     side,
+			Type:     engine.LIMIT,
+			Quantity: 1,
+			Price:    100,
+			ClientID: "bench",
+		})
+		resp, err := client.Post(server.URL+"/orders", "application/json", bytes.NewReader(body))
+		if err != nil {
+			b.Fatal(err)
+		}
+		var decoded map[string]interface{}
+		err = json.NewDecoder(resp.Body).Decode(&decoded)
+		resp.Body.Close()
+		if err != nil || resp.StatusCode != http.StatusOK {
+			b.Fatalf("status %d: %v", resp.StatusCode, err)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+// Command gatewaybench compares order round-trip latency of the binary
+// gateway against the REST /orders endpoint on a running engine. Orders
+// alternate buy and sell at one price so each pair matches and the book is
+// left empty.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"high-frequency-matching-engine/engine"
+	"high-frequency-matching-engine/gateway"
+)
+
+func main() {
+	gatewayAddr := flag.String("gateway", "localhost:9880", "binary gateway address")
+	restURL := flag.String("rest", "http://localhost:8080", "REST API base URL")
+	apiKey := flag.String("key", "demo-key", "gateway API key")
+	symbol := flag.String("symbol", "BENCH", "symbol to trade")
+	count := flag.Int("n", 10000, "orders per protocol")
+	price := flag.Float64("price", 100, "order price")
+	flag.Parse()
+
+	gatewayLatencies, err := benchGateway(*gatewayAddr, *apiKey, *symbol, *count, *price)
+	if err != nil {
+		log.Fatalf("gateway: %v", err)
+	}
+	restLatencies, err := benchREST(*restURL, *symbol, *count, *price)
+	if err != nil {
+		log.Fatalf("rest: %v", err)
+	}
+
+	fmt.Printf("%-8s %8s %10s %10s %10s %10s %10s %12s\n", "path", "orders", "mean", "p50", "p90", "p99", "max", "orders/sec")
+	report("gateway", gatewayLatencies)
+	report("rest", restLatencies)
+}
+
+func side(i int) engine.OrderSide {
+	if i%2 == 0 {
+		return engine.BUY
+	}
+	return engine.SELL
+}
+
+// benchGateway measures the time from sending EnterOrder to receiving the
+// matching Accepted
+func benchGateway(addr, apiKey, symbol string, count int, price float64) ([]time.Duration, error) {
+	client, err := gateway.Dial(addr, apiKey, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	// Tokens are at most 14 characters and must be unique per client
+	run := time.Now().Unix() % 1e6
+	latencies := make([]time.Duration, 0, count)
+	for i := 0; i < count; i++ {
+		token := fmt.Sprintf("B%d_%d", run, i)
+		start := time.Now()
+		if err := client.Enter(token, symbol, side(i), engine.LIMIT, 1, price); err != nil {
+			return nil, err
+		}
+
+	wait:
+		for {
+			msg, ok := <-client.Responses()
+			if !ok {
+				return nil, fmt.Errorf("connection closed: %v", client.Err())
+			}
+			switch m := msg.(type) {
+			case gateway.Accepted:
+				if m.Token == token {
+					break wait
+				}
+			case gateway.Rejected:
+				if m.Token == token {
+					return nil, fmt.Errorf("order %s rejected: %c", token, m.Reason)
+				}
+			}
+		}
+		latencies = append(latencies, time.Since(start))
+	}
+	return latencies, nil
+}
+
+// benchREST measures POST /orders round trips over a keep-alive connection
+func benchREST(baseURL, symbol string, count int, price float64) ([]time.Duration, error) {
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	latencies := make([]time.Duration, 0, count)
+	for i := 0; i < count; i++ {
+		body, _ := json.Marshal(map[string]interface{}{
+			"symbol":    symbol,
+			"side":      side(i),
+			"type":      engine.LIMIT,
+			"quantity":  1,
+			"price":     price,
+			"client_id": "gatewaybench",
+		})
+
+		start := time.Now()
+		resp, err := client.Post(baseURL+"/orders", "application/json", bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		var decoded map[string]interface{}
+		err = json.NewDecoder(resp.Body).Decode(&decoded)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("status %d", resp.StatusCode)
+		}
+		latencies = append(latencies, time.Since(start))
+	}
+	return latencies, nil
+}
+
+func report(name string, latencies []time.Duration) {
+	if len(latencies) == 0 {
+		return
+	}
+
+	var total time.Duration
+	for _, latency := range latencies {
+		total += latency
+	}
+	sorted := append([]time.Duration(nil), latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	percentile := func(p float64) time.Duration {
+		return sorted[int(p*float64(len(sorted)-1))]
+	}
+
+	fmt.Printf("%-8s %8d %10s %10s %10s %10s %10s %12.0f\n",
+		name,
+		len(latencies),
+		total/time.Duration(len(latencies)),
+		percentile(0.50),
+		percentile(0.90),
+		percentile(0.99),
+		sorted[len(sorted)-1],
+		float64(len(latencies))/total.Seconds())
+}
@@ -0,0 +1,71 @@
+// Command itchbook is a reference consumer of the ITCH feed. It rebuilds
+// the book from a snapshot and the UDP stream, recovering gaps over TCP,
+// and prints the top levels of a symbol every second.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+
+	"high-frequency-matching-engine/itch"
+)
+
+func main() {
+	feedAddr := flag.String("feed", "127.0.0.1:30001", "UDP feed address or multicast group")
+	iface := flag.String("iface", "", "multicast interface")
+	retransmitAddr := flag.String("retransmit", "localhost:30002", "retransmission server")
+	snapshotAddr := flag.String("snapshot", "localhost:30003", "snapshot server")
+	symbol := flag.String("symbol", "BTCUSDT", "symbol to display")
+	depth := flag.Int("depth", 5, "levels per side")
+	flag.Parse()
+
+	logger, _ := zap.NewDevelopment()
+	defer logger.Sync()
+
+	receiver := itch.NewReceiver(itch.ReceiverConfig{
+		FeedAddr:       *feedAddr,
+		Interface:      *iface,
+		RetransmitAddr: *retransmitAddr,
+		SnapshotAddr:   *snapshotAddr,
+	}, logger)
+
+	done := make(chan struct{})
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigChan
+		close(done)
+	}()
+
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				bids, asks := receiver.Book().Depth(*symbol, *depth)
+				fmt.Printf("\n%s  orders=%d\n", *symbol, receiver.Book().Orders())
+				for i := len(asks) - 1; i >= 0; i-- {
+					fmt.Printf("          %14.8f %14.8f (%d)\n", asks[i].Price, asks[i].Quantity, asks[i].Orders)
+				}
+				fmt.Println("          ------------------------------")
+				for _, bid := range bids {
+					fmt.Printf("          %14.8f %14.8f (%d)\n", bid.Price, bid.Quantity, bid.Orders)
+				}
+			}
+		}
+	}()
+
+	if err := receiver.Run(done); err != nil {
+		log.Fatalf("feed: %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+// Command loadgen drives synthetic order flow through the matching engine,
+// in-process or against a running server's REST API, and reports the
+// throughput and latency percentiles achieved.
+//
+//	loadgen -rate 100000 -duration 30s -workers 8
+//	loadgen -target api -url http://localhost:8080 -rate 2000 -model gbm
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"high-frequency-matching-engine/engine"
+	"high-frequency-matching-engine/loadgen"
+)
+
+func main() {
+	target := flag.String("target", "engine", "engine (in-process) or api")
+	baseURL := flag.String("url", "http://localhost:8080", "REST API base URL for -target api")
+	rate := flag.Float64("rate", 0, "mean orders per second, Poisson arrivals; 0 sends as fast as possible")
+	duration := flag.Duration("duration", 10*time.Second, "how long to generate orders")
+	orders := flag.Int("orders", 0, "stop after this many actions (0 for no limit)")
+	workers := flag.Int("workers", runtime.GOMAXPROCS(0), "concurrent workers")
+	clients := flag.Int("clients", 100, "distinct client IDs")
+	symbols := flag.String("symbols", "LOADTEST", "comma-separated symbols")
+	mix := flag.String("mix", "limit=0.6,market=0.1,cancel=0.2,amend=0.1", "relative weights of each action")
+	model := flag.String("model", "walk", "mid price model: walk or gbm")
+	start := flag.Float64("start", 100, "starting mid price")
+	volatility := flag.Float64("vol", 0.05, "volatility per sqrt second (price units for walk, fraction for gbm)")
+	drift := flag.Float64("drift", 0, "gbm drift per second")
+	tick := flag.Float64("tick", 0.01, "price tick size")
+	spread := flag.Int("spread", 10, "limit prices within this many ticks of the mid")
+	minQty := flag.Float64("min-qty", 0.001, "minimum order size")
+	maxQty := flag.Float64("max-qty", 1, "maximum order size")
+	seed := flag.Int64("seed", 0, "random seed (0 seeds from the clock)")
+	asJSON := flag.Bool("json", false, "print the report as JSON")
+	flag.Parse()
+
+	weights, err := parseMix(*mix)
+	if err != nil {
+		log.Fatalf("invalid -mix: %v", err)
+	}
+
+	var t loadgen.Target
+	switch *target {
+	case "engine":
+		t = loadgen.NewEngineTarget(engine.NewMatchingEngine())
+	case "api":
+		t = loadgen.NewAPITarget(strings.TrimSuffix(*baseURL, "/"), *workers)
+	default:
+		log.Fatalf("unknown target %q", *target)
+	}
+
+	generator, err := loadgen.NewGenerator(t, loadgen.Config{
+		Symbols:  strings.Split(*symbols, ","),
+		Rate:     *rate,
+		Duration: *duration,
+		Orders:   *orders,
+		Workers:  *workers,
+		Clients:  *clients,
+		Mix:      weights,
+		Price: loadgen.PriceConfig{
+			Model:      *model,
+			Start:      *start,
+			Volatility: *volatility,
+			Drift:      *drift,
+			TickSize:   *tick,
+		},
+		Spread:      *spread,
+		MinQuantity: *minQty,
+		MaxQuantity: *maxQty,
+		Seed:        *seed,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Ctrl-C ends the run early but still reports
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	report := generator.Run(ctx)
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(report)
+		return
+	}
+	printReport(report)
+}
+
+func parseMix(value string) (loadgen.Mix, error) {
+	var mix loadgen.Mix
+	for _, part := range strings.Split(value, ",") {
+		name, weight, found := strings.Cut(strings.TrimSpace(part), "=")
+		if !found {
+			return mix, fmt.Errorf("expected action=weight, got %q", part)
+		}
+		w, err := strconv.ParseFloat(weight, 64)
+		if err != nil {
+			return mix, err
+		}
+		switch loadgen.Action(name) {
+		case loadgen.ActionLimit:
+			mix.Limit = w
+		case loadgen.ActionMarket:
+			mix.Market = w
+		case loadgen.ActionCancel:
+			mix.Cancel = w
+		case loadgen.ActionAmend:
+			mix.Amend = w
+		default:
+			return mix, fmt.Errorf("unknown action %q", name)
+		}
+	}
+	return mix, nil
+}
+
+func printReport(report *loadgen.Report) {
+	fmt.Printf("elapsed %s  actions %d  throughput %.0f/s", report.Elapsed.Round(time.Millisecond), report.Actions, report.Throughput)
+	if report.TargetRate > 0 {
+		fmt.Printf(" (target %.0f/s)", report.TargetRate)
+	}
+	fmt.Printf("  trades %d  errors %d\n\n", report.Trades, report.Errors)
+
+	fmt.Printf("%-8s %10s %8s %8s %10s %10s %10s %10s %10s\n", "action", "count", "missed", "errors", "mean", "p50", "p99", "p99.9", "max")
+	rows := append(report.ByAction, report.Total)
+	for _, row := range rows {
+		l := row.Latency
+		fmt.Printf("%-8s %10d %8d %8d %10s %10s %10s %10s %10s\n",
+			row.Action, l.Count, row.Missed, row.Errors, l.Mean, l.P50, l.P99, l.P999, l.Max)
+	}
+
+	// With open-loop arrivals, time queued behind schedule matters too
+	if report.TargetRate > 0 {
+		r := report.Total.Response
+		fmt.Printf("\nresponse time from scheduled arrival: p50 %s  p99 %s  p99.9 %s  max %s\n", r.P50, r.P99, r.P999, r.Max)
+	}
+	if report.FirstError != "" {
+		fmt.Printf("\nfirst error: %s\n", report.FirstError)
+	}
+}
@@ -3,20 +3,32 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 
+	"high-frequency-matching-engine/accounts"
+	"high-frequency-matching-engine/analytics"
+	"high-frequency-matching-engine/clock"
 	"high-frequency-matching-engine/config"
 	"high-frequency-matching-engine/engine"
+	"high-frequency-matching-engine/fix"
+	"high-frequency-matching-engine/gateway"
+	"high-frequency-matching-engine/itch"
 	"high-frequency-matching-engine/marketdata"
+	"high-frequency-matching-engine/store"
+	"high-frequency-matching-engine/stream"
 	"high-frequency-matching-engine/strategy"
 	"high-frequency-matching-engine/utils"
 )
@@ -32,31 +44,222 @@ func main() {
 		logger.Fatal("Failed to load config", zap.Error(err))
 	}
 
+	// A replay feed can drive the clock, so the engine and strategies run
+	// on the recorded time
+	var engineClock clock.Clock = clock.Real{}
+	var replayClock *clock.Replay
+	for _, exchCfg := range cfg.Exchanges {
+		if strings.EqualFold(exchCfg.Name, "replay") && exchCfg.Replay.Clock {
+			replayClock = marketdata.NewReplayClock(exchCfg.Replay)
+			engineClock = replayClock
+			break
+		}
+	}
+
 	// Initialize matching engine
-	matchingEngine := engine.NewMatchingEngine()
+	matchingEngine := engine.NewMatchingEngineWithClock(engineClock)
+
+	// Stores, analytics and strategies take every trade and order update,
+	// in order, from this queue rather than the engine's channels, which
+	// drop when full
+	engineEvents := matchingEngine.Subscribe()
+
+	// Initialize latency tracker; processing latency is always wall time
+	latencyTracker := utils.NewLatencyTracker(clock.Real{}, logger)
+
+	// Open trade history store
+	tradeStore, err := store.OpenTradeStore(cfg.Storage.Dir, cfg.Storage.RecentTrades)
+	if err != nil {
+		logger.Fatal("Failed to open trade store", zap.Error(err))
+	}
+	defer tradeStore.Close()
+
+	// Open order history store
+	orderStore, err := store.OpenOrderStore(cfg.Storage.Dir)
+	if err != nil {
+		logger.Fatal("Failed to open order store", zap.Error(err))
+	}
+	defer orderStore.Close()
+
+	// Initialize candle aggregation
+	candleAggregator, err := analytics.NewCandleAggregator(filepath.Join(cfg.Storage.Dir, "candles"), matchingEngine.Clock())
+	if err != nil {
+		logger.Fatal("Failed to initialize candle aggregator", zap.Error(err))
+	}
+	defer candleAggregator.Close()
+	tickerStats := analytics.NewTickerStats(matchingEngine.Clock())
+
+	// Initialize WebSocket market data gateway
+	streamHub := stream.NewHub(logger)
+	defer streamHub.Close()
+	marketDataPublisher := stream.NewMarketDataPublisher(streamHub, matchingEngine, cfg.Stream.SnapshotInterval)
+	stream.NewL3Publisher(streamHub, matchingEngine)
+
+	// Initialize WebSocket order entry with per-client positions
+	ledger := accounts.NewLedger()
+	apiKeys := make(map[string]string)
+	for _, apiKey := range cfg.Auth.APIKeys {
+		apiKeys[apiKey.Key] = apiKey.ClientID
+	}
+	orderEntry := stream.NewOrderEntry(streamHub, matchingEngine, ledger, apiKeys, logger)
+
+	// Start binary order entry gateway
+	orderGateway := gateway.NewServer(matchingEngine, apiKeys, logger)
+	if cfg.Gateway.Enabled {
+		if err := orderGateway.Listen(fmt.Sprintf(":%d", cfg.Gateway.Port)); err != nil {
+			logger.Fatal("Failed to start order entry gateway", zap.Error(err))
+		}
+		defer orderGateway.Close()
+	}
 
-	// Initialize latency tracker
-	latencyTracker := utils.NewLatencyTracker(logger)
+	// Start ITCH market-by-order feed
+	if cfg.ITCH.Enabled {
+		itchPublisher := itch.NewPublisher(matchingEngine, itch.PublisherConfig{
+			Session:        cfg.ITCH.Session,
+			FeedAddr:       cfg.ITCH.FeedAddr,
+			RetransmitAddr: fmt.Sprintf(":%d", cfg.ITCH.RetransmitPort),
+			SnapshotAddr:   fmt.Sprintf(":%d", cfg.ITCH.SnapshotPort),
+			Retain:         cfg.ITCH.Retain,
+		}, logger)
+		if err := itchPublisher.Start(); err != nil {
+			logger.Fatal("Failed to start ITCH feed", zap.Error(err))
+		}
+		defer itchPublisher.Close()
+	}
+
+	// Start FIX order entry acceptor
+	fixGateway := fix.NewOrderGateway(matchingEngine, logger)
+	if cfg.FIX.Enabled {
+		var sessions []*fix.Session
+		for _, sessionCfg := range cfg.FIX.Sessions {
+			messageStore, err := fix.OpenMessageStore(cfg.FIX.StoreDir, sessionCfg.SenderCompID+"-"+sessionCfg.TargetCompID)
+			if err != nil {
+				logger.Fatal("Failed to open FIX message store", zap.String("target_comp_id", sessionCfg.TargetCompID), zap.Error(err))
+			}
+			defer messageStore.Close()
+
+			session := fix.NewSession(fixSessionConfig(sessionCfg), messageStore, fixGateway, logger)
+			fixGateway.Register(session)
+			sessions = append(sessions, session)
+		}
 
-	// Initialize strategies
-	strategies := []strategy.Strategy{
-		strategy.NewMarketMakerStrategy("BTCUSDT", 0.001, 0.01),
+		acceptor := fix.NewAcceptor(sessions, logger)
+		if err := acceptor.Listen(fmt.Sprintf(":%d", cfg.FIX.Port)); err != nil {
+			logger.Fatal("Failed to start FIX acceptor", zap.Error(err))
+		}
+		defer acceptor.Close()
+	}
+
+	// Start FIX drop copy acceptor
+	dropCopy := fix.NewDropCopy(matchingEngine, logger)
+	if cfg.FIX.DropCopy.Enabled {
+		var sessions []*fix.Session
+		for _, sessionCfg := range cfg.FIX.DropCopy.Sessions {
+			messageStore, err := fix.OpenMessageStore(cfg.FIX.StoreDir, sessionCfg.SenderCompID+"-"+sessionCfg.TargetCompID)
+			if err != nil {
+				logger.Fatal("Failed to open FIX message store", zap.String("target_comp_id", sessionCfg.TargetCompID), zap.Error(err))
+			}
+			defer messageStore.Close()
+
+			session := fix.NewSession(fixSessionConfig(sessionCfg.FIXSessionConfig), messageStore, dropCopy, logger)
+			dropCopy.Register(session, sessionCfg.Clients)
+			sessions = append(sessions, session)
+		}
+
+		dropCopyAcceptor := fix.NewAcceptor(sessions, logger)
+		if err := dropCopyAcceptor.Listen(fmt.Sprintf(":%d", cfg.FIX.DropCopy.Port)); err != nil {
+			logger.Fatal("Failed to start FIX drop copy acceptor", zap.Error(err))
+		}
+		defer dropCopyAcceptor.Close()
+	}
+
+	// Strategies run on their own goroutines; their orders go through the
+	// router rather than back into the event loop
+	orderRouter := strategy.NewOrderRouter(matchingEngine, latencyTracker, 0, logger)
+	strategyRunner := strategy.NewRunner(orderRouter, strategy.RunnerConfig{
+		InboxSize:    cfg.Strategies.InboxSize,
+		MaxOrderRate: cfg.Strategies.MaxOrderRate,
+		OrderBurst:   cfg.Strategies.OrderBurst,
+	}, logger)
+	strategyRunner.Add(strategy.NewMarketMakerStrategy("BTCUSDT", 0.001, 0.01))
+	for _, makerCfg := range cfg.Strategies.AvellanedaStoikov {
+		maker, err := strategy.NewAvellanedaStoikovStrategy(makerCfg)
+		if err == nil {
+			err = strategyRunner.Add(maker)
+		}
+		if err != nil {
+			logger.Error("Invalid Avellaneda-Stoikov strategy", zap.String("symbol", makerCfg.Symbol), zap.Error(err))
+		}
+	}
+
+	// Capture exchange market data to disk if enabled
+	var recorder *marketdata.Recorder
+	if cfg.Recording.Enabled {
+		recorder, err = marketdata.NewRecorder(marketdata.RecorderConfig{
+			Dir:            cfg.Recording.Dir,
+			MaxBytes:       cfg.Recording.MaxBytes,
+			RotateInterval: cfg.Recording.RotateInterval,
+		}, logger)
+		if err != nil {
+			logger.Fatal("Failed to start market data recorder", zap.Error(err))
+		}
 	}
 
 	// Start market data feeders
-	var feeders []*marketdata.MarketDataFeeder
+	var feeders []marketdata.Feed
+	depthBooks := marketdata.NewDepthBooks()
 	for _, exchCfg := range cfg.Exchanges {
-		feeder := marketdata.NewMarketDataFeeder(exchCfg.WSUrl, exchCfg.Symbols, logger)
-		if err := feeder.Connect(); err != nil {
-			logger.Error("Failed to connect to market data feed",
-				zap.String("exchange", exchCfg.Name),
-				zap.Error(err))
+		// Replay feeds play back recorded data, so the engine runs offline
+		if strings.EqualFold(exchCfg.Name, "replay") {
+			replayCfg := exchCfg.Replay
+			replayCfg.Symbols = exchCfg.Symbols
+			// Only the first replay with clock set drives it
+			var feedClock *clock.Replay
+			if replayCfg.Clock {
+				feedClock, replayClock = replayClock, nil
+			}
+			replay, err := marketdata.NewReplayFeeder(replayCfg, feedClock, logger)
+			if err != nil {
+				logger.Error("Invalid market data replay", zap.Error(err))
+				continue
+			}
+			feeders = append(feeders, replay)
+			continue
+		}
+
+		adapter, err := marketdata.NewFeedAdapter(exchCfg.Name, exchCfg.RESTUrl, exchCfg.Generic)
+		if err != nil {
+			logger.Error("Invalid market data feed", zap.String("exchange", exchCfg.Name), zap.Error(err))
 			continue
 		}
-		feeder.StartFeed()
+		feeder := marketdata.NewMarketDataFeeder(adapter, marketdata.FeederConfig{
+			WSUrl:        exchCfg.WSUrl,
+			Symbols:      exchCfg.Symbols,
+			PingInterval: exchCfg.PingInterval,
+			StaleTimeout: exchCfg.StaleTimeout,
+			MinBackoff:   exchCfg.ReconnectMin,
+			MaxBackoff:   exchCfg.ReconnectMax,
+		}, logger)
+		if exchCfg.Depth {
+			if err := feeder.EnableDepth(depthBooks); err != nil {
+				logger.Error("Failed to enable market data depth", zap.String("exchange", exchCfg.Name), zap.Error(err))
+			}
+		}
+		if recorder != nil {
+			feeder.EnableRecording(recorder)
+		}
 		feeders = append(feeders, feeder)
 	}
 
+	// Merge quotes across exchanges into a best bid and offer if enabled
+	var consolidator *marketdata.Consolidator
+	if cfg.Consolidator.Enabled {
+		consolidator = marketdata.NewConsolidator(marketdata.ConsolidatorConfig{
+			StaleAfter: cfg.Consolidator.StaleAfter,
+			Symbols:    cfg.Consolidator.Symbols,
+		}, matchingEngine.Clock(), logger)
+	}
+
 	// Start metrics server if enabled
 	if cfg.Metrics.Enabled {
 		go func() {
@@ -70,24 +273,65 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// Feeders connect in the background and reconnect until shutdown
+	for _, feeder := range feeders {
+		feeder.Start(ctx)
+	}
+
+	go candleAggregator.Run(ctx.Done(), func(err error) {
+		logger.Error("Failed to close candles", zap.Error(err))
+	})
+	go marketDataPublisher.Run(ctx.Done())
+	go orderRouter.Run(ctx)
+	go fixGateway.Run(ctx.Done())
+	go dropCopy.Run(ctx.Done())
+	strategyRunner.Start(ctx)
+
+	// Forward ticker updates to the WebSocket ticker channel
+	tickerUpdates, unsubscribeTickers := tickerStats.Subscribe("")
+	defer unsubscribeTickers()
 	go func() {
 		for {
 			select {
 			case <-ctx.Done():
 				return
+			case ticker := <-tickerUpdates:
+				marketDataPublisher.OnTicker(ticker)
+			}
+		}
+	}()
 
-			case trade := <-matchingEngine.GetTradesChannel():
-				latencyTracker.LogTrade(trade.Symbol, trade.Price, trade.Quantity)
+	go engineEvents.Run(ctx.Done(), func(event engine.BookEvent) {
+		for _, report := range event.Reports {
+			if err := orderStore.Apply(report); err != nil {
+				logger.Error("Failed to record order update", zap.String("order_id", report.Order.ID), zap.Error(err))
+			}
+			orderEntry.OnExecution(report, ledger.Apply(report))
+		}
+		if len(event.Reports) > 0 {
+			symbol := event.Reports[0].Order.Symbol
+			tickerStats.OnTopOfBook(matchingEngine.GetTopOfBook(symbol))
+			marketDataPublisher.OnBookChange(symbol)
+		}
+		for _, trade := range event.Trades {
+			latencyTracker.LogTrade(trade.Symbol, trade.Price, trade.Quantity)
+			if err := tradeStore.Append(trade); err != nil {
+				logger.Error("Failed to persist trade", zap.String("trade_id", trade.ID), zap.Error(err))
+			}
+			if err := candleAggregator.OnTrade(trade); err != nil {
+				logger.Error("Failed to aggregate trade", zap.String("trade_id", trade.ID), zap.Error(err))
+			}
+			tickerStats.OnTrade(trade)
+			marketDataPublisher.OnTrade(trade)
+			strategyRunner.OnTrade(trade)
+		}
+	})
 
-				// Notify strategies of trade
-				for _, strat := range strategies {
-					orders := strat.OnTrade(trade)
-					for _, order := range orders {
-						startTime := time.Now()
-						matchingEngine.ProcessOrder(order)
-						latencyTracker.TrackOrderLatency(order.Symbol, startTime)
-					}
-				}
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
 
 			case order := <-matchingEngine.GetOrdersChannel():
 				utils.OrdersProcessed.WithLabelValues(
@@ -95,44 +339,44 @@ func main() {
 					fmt.Sprintf("%d", order.Side),
 					fmt.Sprintf("%d", order.Type),
 				).Inc()
-
-				// Notify strategies of order update
-				for _, strat := range strategies {
-					orders := strat.OnOrderUpdate(order)
-					for _, newOrder := range orders {
-						startTime := time.Now()
-						matchingEngine.ProcessOrder(newOrder)
-						latencyTracker.TrackOrderLatency(newOrder.Symbol, startTime)
-					}
-				}
 			}
 		}
 	}()
 
 	// Handle market data from feeders
 	for _, feeder := range feeders {
-		go func(f *marketdata.MarketDataFeeder) {
+		go func(f marketdata.Feed) {
 			for {
 				select {
 				case <-ctx.Done():
 					return
 				case data := <-f.GetDataChannel():
-					// Notify strategies of market data
-					for _, strat := range strategies {
-						orders := strat.OnMarketData(data)
-						for _, order := range orders {
-							startTime := time.Now()
-							matchingEngine.ProcessOrder(order)
-							latencyTracker.TrackOrderLatency(order.Symbol, startTime)
-						}
+					if consolidator != nil {
+						consolidator.Update(data)
 					}
+					strategyRunner.OnMarketData(data)
 				}
 			}
 		}(feeder)
 	}
 
+	// Consolidated quotes reach strategies as nbbo events
+	if consolidator != nil {
+		go consolidator.Run(ctx)
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case data := <-consolidator.GetDataChannel():
+					strategyRunner.OnMarketData(data)
+				}
+			}
+		}()
+	}
+
 	// Start HTTP API server
-	go startAPIServer(cfg.Server.Port, matchingEngine, logger)
+	go startAPIServer(cfg, matchingEngine, tradeStore, orderStore, candleAggregator, tickerStats, streamHub, feeders, depthBooks, consolidator, strategyRunner, logger)
 
 	// Wait for shutdown signal
 	sigChan := make(chan os.Signal, 1)
@@ -140,69 +384,221 @@ func main() {
 	<-sigChan
 
 	logger.Info("Shutting down...")
+	strategyRunner.Close()
 	cancel()
 
 	// Close market data feeders
 	for _, feeder := range feeders {
 		feeder.Close()
 	}
+	if recorder != nil {
+		recorder.Close()
+	}
 
 	logger.Info("Shutdown complete")
 }
 
-func startAPIServer(port int, matchingEngine *engine.MatchingEngine, logger *zap.Logger) {
+func startAPIServer(cfg *config.Config, matchingEngine *engine.MatchingEngine, tradeStore *store.TradeStore, orderStore *store.OrderStore, candleAggregator *analytics.CandleAggregator, tickerStats *analytics.TickerStats, streamHub *stream.Hub, feeders []marketdata.Feed, depthBooks *marketdata.DepthBooks, consolidator *marketdata.Consolidator, strategyRunner *strategy.Runner, logger *zap.Logger) {
+	port := cfg.Server.Port
 	mux := http.NewServeMux()
 
 	// Health check endpoint
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		// Market data feeds that are not connected degrade, but do not fail,
+		// health. A replay that has played all its data is fine.
+		status := "healthy"
+		feeds := make([]marketdata.FeedStatus, 0, len(feeders))
+		for _, feeder := range feeders {
+			feed := feeder.Status()
+			if feed.State != marketdata.FeedConnected && feed.State != marketdata.FeedFinished {
+				status = "degraded"
+			}
+			feeds = append(feeds, feed)
+		}
+
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]string{
-			"status":    "healthy",
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":    status,
 			"timestamp": time.Now().Format(time.RFC3339),
+			"feeds":     feeds,
 		})
 	})
 
-	// Order placement endpoint
-	mux.HandleFunc("/orders", func(w http.ResponseWriter, r *http.Request) {
+	// Local copies of exchange order books
+	mux.HandleFunc("/marketdata/depth", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		book := depthBooks.Get(query.Get("exchange"), query.Get("symbol"))
+		if book == nil {
+			http.Error(w, "Book not found", http.StatusNotFound)
+			return
+		}
+		depth, _ := strconv.Atoi(query.Get("depth"))
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"exchange": book.Exchange,
+			"synced":   book.Synced(),
+			"book":     book.Snapshot(depth),
+		})
+	})
+
+	// Consolidated best bid and offer across exchanges
+	mux.HandleFunc("/marketdata/nbbo", func(w http.ResponseWriter, r *http.Request) {
+		if consolidator == nil {
+			http.Error(w, "Consolidation not enabled", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		symbol := r.URL.Query().Get("symbol")
+		if symbol == "" {
+			json.NewEncoder(w).Encode(map[string]interface{}{"quotes": consolidator.List()})
+			return
+		}
+		quote := consolidator.Get(symbol)
+		if quote == nil {
+			http.Error(w, "Symbol not found", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(quote)
+	})
+
+	// Strategy status, and lifecycle control with
+	// POST /strategies/{name}/{start|stop|pause|resume}
+	mux.HandleFunc("/strategies", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"strategies": strategyRunner.Status()})
+	})
+
+	mux.HandleFunc("/strategies/", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
+		name, action, found := strings.Cut(strings.TrimPrefix(r.URL.Path, "/strategies/"), "/")
+		if !found || name == "" {
+			http.Error(w, "Expected /strategies/{name}/{action}", http.StatusBadRequest)
+			return
+		}
 
-		var order *engine.Order
-		if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
-			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		var err error
+		switch action {
+		case "start":
+			err = strategyRunner.StartStrategy(name)
+		case "stop":
+			err = strategyRunner.Stop(name)
+		case "pause":
+			err = strategyRunner.Pause(name)
+		case "resume":
+			err = strategyRunner.Resume(name)
+		default:
+			http.Error(w, "Unknown action", http.StatusBadRequest)
+			return
+		}
+		switch {
+		case errors.Is(err, strategy.ErrUnknownStrategy):
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusConflict)
 			return
 		}
 
-		// Generate order ID if not provided
-		if order.ID == "" {
-			order.ID = fmt.Sprintf("API_%d", time.Now().UnixNano())
+		for _, status := range strategyRunner.Status() {
+			if status.Name == name {
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(status)
+			}
 		}
+	})
 
-		startTime := time.Now()
-		trades := matchingEngine.ProcessOrder(order)
+	// Order placement and order listing endpoint
+	mux.HandleFunc("/orders", ordersHandler(matchingEngine, orderStore, logger))
 
-		response := map[string]interface{}{
-			"order":      order,
-			"trades":     trades,
-			"latency_us": time.Since(startTime).Microseconds(),
+	// Order lookup endpoint
+	mux.HandleFunc("/orders/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		orderID := strings.TrimPrefix(r.URL.Path, "/orders/")
+		if orderID == "" {
+			http.Error(w, "Order ID required", http.StatusBadRequest)
+			return
+		}
+
+		order, err := orderStore.Get(orderID)
+		if err != nil {
+			logger.Error("Order lookup failed", zap.String("order_id", orderID), zap.Error(err))
+			http.Error(w, "Order lookup failed", http.StatusInternalServerError)
+			return
+		}
+		if order == nil {
+			http.Error(w, "Order not found", http.StatusNotFound)
+			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(response)
+		json.NewEncoder(w).Encode(order)
 	})
 
 	// Order book snapshot endpoint
 	mux.HandleFunc("/orderbook", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		symbol := query.Get("symbol")
+		if symbol == "" {
+			http.Error(w, "Symbol parameter required", http.StatusBadRequest)
+			return
+		}
+
+		if top, _ := strconv.ParseBool(query.Get("top")); top {
+			tob := matchingEngine.GetTopOfBook(symbol)
+			if tob == nil {
+				http.Error(w, "Symbol not found", http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(tob)
+			return
+		}
+
+		var depth engine.DepthQuery
+		var err error
+		if value := query.Get("depth"); value != "" {
+			if depth.Levels, err = strconv.Atoi(value); err != nil || depth.Levels < 0 {
+				http.Error(w, "Invalid depth parameter", http.StatusBadRequest)
+				return
+			}
+		}
+		if value := query.Get("group"); value != "" {
+			if depth.Group, err = strconv.ParseFloat(value, 64); err != nil || depth.Group < 0 {
+				http.Error(w, "Invalid group parameter", http.StatusBadRequest)
+				return
+			}
+		}
+		depth.Cumulative, _ = strconv.ParseBool(query.Get("cumulative"))
+
+		snapshot := matchingEngine.GetDepth(symbol, depth)
+		if snapshot == nil {
+			http.Error(w, "Symbol not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(snapshot)
+	})
+
+	// Market-by-order snapshot endpoint
+	mux.HandleFunc("/orderbook/l3", func(w http.ResponseWriter, r *http.Request) {
 		symbol := r.URL.Query().Get("symbol")
 		if symbol == "" {
 			http.Error(w, "Symbol parameter required", http.StatusBadRequest)
 			return
 		}
 
-		snapshot := matchingEngine.GetOrderBookSnapshot(symbol) // Changed from engine.GetOrderBookSnapshot
+		snapshot := matchingEngine.GetL3Snapshot(symbol)
 		if snapshot == nil {
 			http.Error(w, "Symbol not found", http.StatusNotFound)
 			return
@@ -234,6 +630,263 @@ func startAPIServer(port int, matchingEngine *engine.MatchingEngine, logger *zap
 		json.NewEncoder(w).Encode(response)
 	})
 
+	// Amend order endpoint
+	mux.HandleFunc("/orders/amend", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		query := r.URL.Query()
+		symbol := query.Get("symbol")
+		orderID := query.Get("order_id")
+		if symbol == "" || orderID == "" {
+			http.Error(w, "Symbol and order_id parameters required", http.StatusBadRequest)
+			return
+		}
+		price, err := strconv.ParseFloat(query.Get("price"), 64)
+		if err != nil || price <= 0 {
+			http.Error(w, "Invalid price parameter", http.StatusBadRequest)
+			return
+		}
+		quantity, err := strconv.ParseFloat(query.Get("quantity"), 64)
+		if err != nil || quantity <= 0 {
+			http.Error(w, "Invalid quantity parameter", http.StatusBadRequest)
+			return
+		}
+
+		order, trades, err := matchingEngine.AmendOrder(symbol, orderID, price, quantity)
+		switch {
+		case errors.Is(err, engine.ErrOrderNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"order":  order,
+			"trades": trades,
+		})
+	})
+
+	// Trade history endpoint
+	mux.HandleFunc("/trades", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		symbol := query.Get("symbol")
+		if symbol == "" {
+			http.Error(w, "Symbol parameter required", http.StatusBadRequest)
+			return
+		}
+
+		from, err := parseTimeParam(query.Get("from"))
+		if err != nil {
+			http.Error(w, "Invalid from parameter", http.StatusBadRequest)
+			return
+		}
+		to, err := parseTimeParam(query.Get("to"))
+		if err != nil {
+			http.Error(w, "Invalid to parameter", http.StatusBadRequest)
+			return
+		}
+		limit, _ := strconv.Atoi(query.Get("limit"))
+		cursor, _ := strconv.ParseInt(query.Get("cursor"), 10, 64)
+
+		page, err := tradeStore.Query(store.TradeQuery{
+			Symbol:   symbol,
+			From:     from,
+			To:       to,
+			ClientID: query.Get("client_id"),
+			Cursor:   cursor,
+			Limit:    limit,
+		})
+		if errors.Is(err, store.ErrInvalidSymbol) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			logger.Error("Trade query failed", zap.Error(err))
+			http.Error(w, "Trade query failed", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(page)
+	})
+
+	// Recent trades endpoint
+	mux.HandleFunc("/trades/recent", func(w http.ResponseWriter, r *http.Request) {
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		trades := tradeStore.Recent(r.URL.Query().Get("symbol"), limit)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"trades": trades})
+	})
+
+	// Candles endpoint
+	mux.HandleFunc("/candles", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		symbol := query.Get("symbol")
+		if symbol == "" {
+			http.Error(w, "Symbol parameter required", http.StatusBadRequest)
+			return
+		}
+		interval := query.Get("interval")
+		if _, valid := analytics.Intervals[interval]; !valid {
+			http.Error(w, "Invalid interval parameter", http.StatusBadRequest)
+			return
+		}
+		limit, _ := strconv.Atoi(query.Get("limit"))
+
+		candles, err := candleAggregator.Candles(symbol, interval, limit)
+		if err != nil {
+			logger.Error("Candle query failed", zap.Error(err))
+			http.Error(w, "Candle query failed", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"candles": candles})
+	})
+
+	// Live candle updates as server-sent events
+	mux.HandleFunc("/candles/stream", func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+
+		query := r.URL.Query()
+		interval := query.Get("interval")
+		if _, valid := analytics.Intervals[interval]; interval != "" && !valid {
+			http.Error(w, "Invalid interval parameter", http.StatusBadRequest)
+			return
+		}
+
+		updates, unsubscribe := candleAggregator.Subscribe(query.Get("symbol"), interval)
+		defer unsubscribe()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		flusher.Flush()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case candle := <-updates:
+				data, _ := json.Marshal(candle)
+				fmt.Fprintf(w, "event: candle\ndata: %s\n\n", data)
+				flusher.Flush()
+			}
+		}
+	})
+
+	// 24h ticker endpoint
+	mux.HandleFunc("/ticker", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		symbol := r.URL.Query().Get("symbol")
+		if symbol == "" {
+			json.NewEncoder(w).Encode(tickerStats.Tickers())
+			return
+		}
+
+		ticker, exists := tickerStats.Ticker(symbol)
+		if !exists {
+			http.Error(w, "Symbol not found", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(ticker)
+	})
+
+	// WebSocket market data
+	if cfg.Stream.Path != "" {
+		mux.Handle(cfg.Stream.Path, streamHub)
+	}
+
 	logger.Info("Starting API server", zap.Int("port", port))
 	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", port), mux))
 }
+
+// parseTimeParam accepts either RFC3339 or Unix milliseconds
+func parseTimeParam(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if millis, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.UnixMilli(millis), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func fixSessionConfig(cfg config.FIXSessionConfig) fix.SessionConfig {
+	return fix.SessionConfig{
+		SenderCompID: cfg.SenderCompID,
+		TargetCompID: cfg.TargetCompID,
+		ClientID:     cfg.ClientID,
+	}
+}
+
+// ordersHandler serves GET /orders from the order store and enters orders
+// posted to it
+func ordersHandler(matchingEngine *engine.MatchingEngine, orderStore *store.OrderStore, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			query := r.URL.Query()
+			status := query.Get("status")
+			if status != "" && status != "open" && status != "filled" && status != "cancelled" {
+				http.Error(w, "Invalid status parameter", http.StatusBadRequest)
+				return
+			}
+			limit, _ := strconv.Atoi(query.Get("limit"))
+
+			orders, err := orderStore.Query(store.OrderQuery{
+				ClientID: query.Get("client_id"),
+				Symbol:   query.Get("symbol"),
+				Status:   status,
+				Limit:    limit,
+			})
+			if err != nil {
+				logger.Error("Order query failed", zap.Error(err))
+				http.Error(w, "Order query failed", http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{"orders": orders})
+			return
+		}
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var order *engine.Order
+		if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		// Generate order ID if not provided
+		if order.ID == "" {
+			order.ID = fmt.Sprintf("API_%d", time.Now().UnixNano())
+		}
+
+		startTime := time.Now()
+		trades := matchingEngine.ProcessOrder(order)
+
+		response := map[string]interface{}{
+			"order":      order,
+			"trades":     trades,
+			"latency_us": time.Since(startTime).Microseconds(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
@@ -0,0 +1,246 @@
+// Command mdcapture inspects market data capture files written by the
+// recorder. It lists the files in a capture directory and exports their
+// records, optionally filtered, as JSON lines or CSV.
+//
+//	mdcapture list -dir data/capture
+//	mdcapture export -dir data/capture -symbol BTCUSDT -type ticker -format csv
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"high-frequency-matching-engine/engine"
+	"high-frequency-matching-engine/marketdata"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	switch os.Args[1] {
+	case "list":
+		list(os.Args[2:])
+	case "export":
+		export(os.Args[2:])
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: mdcapture list|export [flags]")
+	os.Exit(2)
+}
+
+func list(args []string) {
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+	dir := flags.String("dir", "data/capture", "capture directory")
+	count := flags.Bool("count", false, "read each file to count its records")
+	flags.Parse(args)
+
+	files, err := marketdata.ListCaptures(*dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("%-24s %12s", "start", "bytes")
+	if *count {
+		fmt.Printf(" %10s %10s  %s", "raw", "data", "last")
+	}
+	fmt.Printf("  %s\n", "file")
+	for _, file := range files {
+		fmt.Printf("%-24s %12d", file.Start.Format(time.RFC3339), file.Size)
+		if *count {
+			raw, data, last, err := countRecords(file.Path)
+			if err != nil {
+				log.Fatalf("%s: %v", file.Path, err)
+			}
+			fmt.Printf(" %10d %10d  %s", raw, data, last.Format(time.RFC3339))
+		}
+		fmt.Printf("  %s\n", file.Path)
+	}
+}
+
+func countRecords(path string) (raw, data int, last time.Time, err error) {
+	reader, err := marketdata.OpenCapture(path)
+	if err != nil {
+		return 0, 0, time.Time{}, err
+	}
+	defer reader.Close()
+
+	for {
+		record, err := reader.Next()
+		if err == io.EOF {
+			return raw, data, last, nil
+		}
+		if err != nil {
+			return raw, data, last, err
+		}
+		if record.Kind == marketdata.CaptureRaw {
+			raw++
+		} else {
+			data++
+		}
+		last = record.Received
+	}
+}
+
+func export(args []string) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	dir := flags.String("dir", "data/capture", "capture directory")
+	file := flags.String("file", "", "export one capture, JSONL or CSV file instead of the directory")
+	format := flags.String("format", "jsonl", "output format: jsonl or csv")
+	out := flags.String("out", "", "output file (default stdout)")
+	kind := flags.String("kind", "", "raw or data")
+	exchange := flags.String("exchange", "", "exchange name")
+	symbol := flags.String("symbol", "", "normalized symbol (data records only)")
+	dataType := flags.String("type", "", "ticker, trade or depth (data records only)")
+	from := flags.String("from", "", "start of the receive time range, RFC 3339")
+	to := flags.String("to", "", "end of the receive time range, RFC 3339")
+	flags.Parse(args)
+
+	filter := marketdata.CaptureFilter{
+		Kind:     marketdata.CaptureKind(*kind),
+		Exchange: *exchange,
+		Symbol:   *symbol,
+		Type:     engine.MarketDataType(*dataType),
+		From:     parseTime("from", *from),
+		To:       parseTime("to", *to),
+	}
+
+	var paths []string
+	if *file != "" {
+		paths = []string{*file}
+	} else {
+		files, err := marketdata.ListCaptures(*dir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for i, f := range files {
+			// A file ends where the next one starts
+			if !filter.From.IsZero() && i+1 < len(files) && !files[i+1].Start.After(filter.From) {
+				continue
+			}
+			if !filter.To.IsZero() && !f.Start.Before(filter.To) {
+				break
+			}
+			paths = append(paths, f.Path)
+		}
+	}
+
+	output := os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		output = f
+	}
+	buffered := bufio.NewWriter(output)
+	defer buffered.Flush()
+
+	var writer recordWriter
+	switch *format {
+	case "jsonl":
+		writer = &jsonlWriter{encoder: json.NewEncoder(buffered)}
+	case "csv":
+		writer = newCSVWriter(buffered)
+	default:
+		log.Fatalf("unknown format %q", *format)
+	}
+
+	for _, path := range paths {
+		if err := exportFile(path, filter, writer); err != nil {
+			log.Fatalf("%s: %v", path, err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func parseTime(name, value string) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		log.Fatalf("invalid -%s: %v", name, err)
+	}
+	return t
+}
+
+func exportFile(path string, filter marketdata.CaptureFilter, writer recordWriter) error {
+	reader, err := marketdata.OpenCapture(path)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	for {
+		record, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !filter.Match(record) {
+			continue
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+}
+
+type recordWriter interface {
+	Write(record *marketdata.CaptureRecord) error
+	Flush() error
+}
+
+type jsonlWriter struct {
+	encoder *json.Encoder
+}
+
+func (w *jsonlWriter) Write(record *marketdata.CaptureRecord) error {
+	return w.encoder.Encode(record)
+}
+
+func (w *jsonlWriter) Flush() error {
+	return nil
+}
+
+type csvWriter struct {
+	writer *csv.Writer
+	header bool
+}
+
+func newCSVWriter(w io.Writer) *csvWriter {
+	return &csvWriter{writer: csv.NewWriter(w)}
+}
+
+func (w *csvWriter) Write(record *marketdata.CaptureRecord) error {
+	if !w.header {
+		w.header = true
+		if err := w.writer.Write(marketdata.CaptureCSVHeader); err != nil {
+			return err
+		}
+	}
+	return w.writer.Write(record.CSVRow())
+}
+
+func (w *csvWriter) Flush() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
@@ -3,12 +3,52 @@ package config
 import (
     "gopkg.in/yaml.v3"
     "os"
+    "time"
+
+    "high-frequency-matching-engine/marketdata"
+    "high-frequency-matching-engine/strategy"
 )
 
+// ExchangeConfig selects a market data feed. Name picks the adapter
+// (binance, coinbase, kraken or generic), or replay to play back recorded
+// data instead, and Symbols are written as the exchange writes them. Depth
+// also keeps local order books where the adapter supports it; RESTUrl
+// overrides the exchange's REST API base. Generic is only read by the
+// generic adapter and Replay by replay feeds.
 type ExchangeConfig struct {
     Name      string `yaml:"name"`
     WSUrl     string `yaml:"ws_url"`
+    RESTUrl   string `yaml:"rest_url"`
     Symbols   []string `yaml:"symbols"`
+    Depth     bool `yaml:"depth"`
+    
+    // Connection health; zero uses the feeder defaults
+    PingInterval time.Duration `yaml:"ping_interval"`
+    StaleTimeout time.Duration `yaml:"stale_timeout"`
+    ReconnectMin time.Duration `yaml:"reconnect_min"`
+    ReconnectMax time.Duration `yaml:"reconnect_max"`
+    Generic   marketdata.GenericConfig `yaml:"generic"`
+    Replay    marketdata.ReplayConfig `yaml:"replay"`
+}
+
+// FIXSessionConfig is one FIX counterparty, identified by its CompIDs and
+// trading as ClientID
+type FIXSessionConfig struct {
+    SenderCompID string `yaml:"sender_comp_id"`
+    TargetCompID string `yaml:"target_comp_id"`
+    ClientID     string `yaml:"client_id"`
+}
+
+// DropCopySessionConfig is a read-only session receiving the execution
+// reports of the listed clients, or of every client when Clients is empty
+type DropCopySessionConfig struct {
+    FIXSessionConfig `yaml:",inline"`
+    Clients          []string `yaml:"clients"`
+}
+
+type APIKeyConfig struct {
+    Key      string `yaml:"key"`
+    ClientID string `yaml:"client_id"`
 }
 
 type Config struct {
@@ -16,8 +56,69 @@ type Config struct {
         Port int `yaml:"port"`
     } `yaml:"server"`
     
+    Stream struct {
+        Path             string        `yaml:"path"`
+        SnapshotInterval time.Duration `yaml:"snapshot_interval"`
+    } `yaml:"stream"`
+    
+    Auth struct {
+        APIKeys []APIKeyConfig `yaml:"api_keys"`
+    } `yaml:"auth"`
+    
+    Gateway struct {
+        Enabled bool `yaml:"enabled"`
+        Port    int  `yaml:"port"`
+    } `yaml:"gateway"`
+    
+    ITCH struct {
+        Enabled        bool   `yaml:"enabled"`
+        Session        string `yaml:"session"`
+        FeedAddr       string `yaml:"feed_addr"`
+        RetransmitPort int    `yaml:"retransmit_port"`
+        SnapshotPort   int    `yaml:"snapshot_port"`
+        Retain         int    `yaml:"retain"`
+    } `yaml:"itch"`
+    
+    FIX struct {
+        Enabled  bool                `yaml:"enabled"`
+        Port     int                 `yaml:"port"`
+        StoreDir string              `yaml:"store_dir"`
+        Sessions []FIXSessionConfig `yaml:"sessions"`
+        
+        DropCopy struct {
+            Enabled  bool                 `yaml:"enabled"`
+            Port     int                  `yaml:"port"`
+            Sessions []DropCopySessionConfig `yaml:"sessions"`
+        } `yaml:"drop_copy"`
+    } `yaml:"fix"`
+    
     Exchanges []ExchangeConfig `yaml:"exchanges"`
     
+    // Consolidator merges exchange quotes into a best bid and offer per
+    // symbol; symbols maps venue symbols to consolidated ones
+    Consolidator struct {
+        Enabled    bool              `yaml:"enabled"`
+        StaleAfter time.Duration     `yaml:"stale_after"`
+        Symbols    map[string]string `yaml:"symbols"`
+    } `yaml:"consolidator"`
+    
+    // Strategies bounds each strategy's event inbox and order rate, and
+    // lists the inventory-aware market makers to run
+    Strategies struct {
+        InboxSize         int                                `yaml:"inbox_size"`
+        MaxOrderRate      float64                            `yaml:"max_order_rate"`
+        OrderBurst        int                                `yaml:"order_burst"`
+        AvellanedaStoikov []strategy.AvellanedaStoikovConfig `yaml:"avellaneda_stoikov"`
+    } `yaml:"strategies"`
+    
+    // Recording captures all exchange market data to rotated files
+    Recording struct {
+        Enabled        bool          `yaml:"enabled"`
+        Dir            string        `yaml:"dir"`
+        MaxBytes       int64         `yaml:"max_bytes"`
+        RotateInterval time.Duration `yaml:"rotate_interval"`
+    } `yaml:"recording"`
+    
     Logging struct {
         Level string `yaml:"level"`
         File  string `yaml:"file"`
@@ -27,6 +128,11 @@ type Config struct {
         Enabled bool `yaml:"enabled"`
         Port    int  `yaml:"port"`
     } `yaml:"metrics"`
+    
+    Storage struct {
+        Dir          string `yaml:"dir"`
+        RecentTrades int    `yaml:"recent_trades"`
+    } `yaml:"storage"`
 }
 
 func LoadConfig(filename string) (*Config, error) {
@@ -0,0 +1,68 @@
+package engine
+
+import "sync"
+
+// BookEvent is the outcome of one book operation: the execution reports
+// of every order it touched and the trades it made, in event order
+type BookEvent struct {
+    Reports []*ExecutionReport
+    Trades  []*Trade
+}
+
+// EventQueue hands every book event to one consumer, none dropped and in
+// the order the books produced them. The engine appends under the book
+// lock without blocking; the consumer takes what is pending whenever Ready
+// fires, so a slow consumer falls behind rather than losing events.
+type EventQueue struct {
+    pending []BookEvent
+    ready   chan struct{}
+    mutex   sync.Mutex
+}
+
+// Subscribe returns a queue of every book event from now on. Like
+// OnExecution, it must be called before orders are processed.
+func (me *MatchingEngine) Subscribe() *EventQueue {
+    q := &EventQueue{ready: make(chan struct{}, 1)}
+    me.eventQueues = append(me.eventQueues, q)
+    return q
+}
+
+func (q *EventQueue) push(event BookEvent) {
+    q.mutex.Lock()
+    q.pending = append(q.pending, event)
+    q.mutex.Unlock()
+
+    select {
+    case q.ready <- struct{}{}:
+    default:
+    }
+}
+
+// Ready fires when events are waiting to be taken
+func (q *EventQueue) Ready() <-chan struct{} {
+    return q.ready
+}
+
+// Take returns every pending event, oldest first
+func (q *EventQueue) Take() []BookEvent {
+    q.mutex.Lock()
+    defer q.mutex.Unlock()
+    events := q.pending
+    q.pending = nil
+    return events
+}
+
+// Run passes each event to handle, on the calling goroutine, until done is
+// closed
+func (q *EventQueue) Run(done <-chan struct{}, handle func(BookEvent)) {
+    for {
+        select {
+        case <-done:
+            return
+        case <-q.ready:
+            for _, event := range q.Take() {
+                handle(event)
+            }
+        }
+    }
+}
@@ -0,0 +1,51 @@
+package engine
+
+import (
+    "fmt"
+    "testing"
+)
+
+// More events than the engine's channels hold must all be queued, in order
+func TestEventQueueKeepsEveryEvent(t *testing.T) {
+    me := NewMatchingEngine()
+    q := me.Subscribe()
+
+    const pairs = 12000
+    for i := 0; i < pairs; i++ {
+        for _, side := range []OrderSide{BUY, SELL} {
+            me.ProcessOrder(&Order{
+                ID:       fmt.Sprintf("%d-%d", i, side),
+                Symbol:   "BTCUSDT",
+                Side:     side,
+                Type:     LIMIT,
+                Price:    100,
+                Quantity: 1,
+                Status:   PENDING,
+            })
+        }
+    }
+
+    select {
+    case <-q.Ready():
+    default:
+        t.Fatal("queue not ready")
+    }
+    var seq uint64
+    var trades int
+    for _, event := range q.Take() {
+        for _, report := range event.Reports {
+            seq++
+            if report.Seq != seq {
+                t.Fatalf("report seq %d, want %d", report.Seq, seq)
+            }
+        }
+        trades += len(event.Trades)
+    }
+    // Each pair is two NEW reports, two fills and one trade
+    if seq != 4*pairs || trades != pairs {
+        t.Errorf("got %d reports and %d trades, want %d and %d", seq, trades, 4*pairs, pairs)
+    }
+    if events := q.Take(); len(events) != 0 {
+        t.Errorf("%d events left after taking them all", len(events))
+    }
+}
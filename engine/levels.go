@@ -0,0 +1,107 @@
+package engine
+
+import (
+    "math"
+    "sort"
+)
+
+// priceLevels keeps the resting quantity and order count at every price on
+// one side of the book, best price first. It is updated as orders rest,
+// fill and leave so depth queries never have to walk individual orders.
+type priceLevels struct {
+    bids   bool // highest price first
+    prices []float64
+    levels map[float64]*OrderBookLevel
+}
+
+func newPriceLevels(bids bool) *priceLevels {
+    return &priceLevels{bids: bids, levels: make(map[float64]*OrderBookLevel)}
+}
+
+// search returns the index of price in prices, or where it would be inserted
+func (pl *priceLevels) search(price float64) int {
+    if pl.bids {
+        return sort.Search(len(pl.prices), func(i int) bool { return pl.prices[i] <= price })
+    }
+    return sort.Search(len(pl.prices), func(i int) bool { return pl.prices[i] >= price })
+}
+
+// add changes the level at price by quantity and orders, creating it if
+// needed and removing it once no orders remain
+func (pl *priceLevels) add(price, quantity float64, orders int) {
+    level, exists := pl.levels[price]
+    if !exists {
+        level = &OrderBookLevel{Price: price}
+        pl.levels[price] = level
+        i := pl.search(price)
+        pl.prices = append(pl.prices, 0)
+        copy(pl.prices[i+1:], pl.prices[i:])
+        pl.prices[i] = price
+    }
+
+    level.Quantity += quantity
+    level.Orders += orders
+    if level.Orders <= 0 {
+        delete(pl.levels, price)
+        i := pl.search(price)
+        pl.prices = append(pl.prices[:i], pl.prices[i+1:]...)
+    }
+}
+
+// best returns the top level, or a zero level if the side is empty
+func (pl *priceLevels) best() OrderBookLevel {
+    if len(pl.prices) == 0 {
+        return OrderBookLevel{}
+    }
+    return *pl.levels[pl.prices[0]]
+}
+
+// DepthQuery selects the levels GetDepth returns. The zero value returns
+// every level as is.
+type DepthQuery struct {
+    Levels     int     // maximum levels per side, 0 for all
+    Group      float64 // bucket prices to multiples of this step, 0 for none
+    Cumulative bool    // fill in each level's running total from the top
+}
+
+// depth copies levels best first, applying the query. Grouped bids round
+// down and grouped asks round up, so a bucket never looks better than the
+// orders in it.
+func (pl *priceLevels) depth(query DepthQuery) []OrderBookLevel {
+    result := []OrderBookLevel{}
+    var total float64
+
+    for _, price := range pl.prices {
+        level := *pl.levels[price]
+        if query.Group > 0 {
+            level.Price = groupPrice(price, query.Group, pl.bids)
+        }
+
+        if n := len(result); n > 0 && result[n-1].Price == level.Price {
+            result[n-1].Quantity += level.Quantity
+            result[n-1].Orders += level.Orders
+        } else {
+            if query.Levels > 0 && n == query.Levels {
+                break
+            }
+            result = append(result, level)
+        }
+
+        if query.Cumulative {
+            total += level.Quantity
+            result[len(result)-1].Cumulative = total
+        }
+    }
+    return result
+}
+
+func groupPrice(price, step float64, down bool) float64 {
+    // Nudge by a tiny epsilon so prices already on a boundary stay there
+    buckets := price / step
+    if down {
+        buckets = math.Floor(buckets + 1e-9)
+    } else {
+        buckets = math.Ceil(buckets - 1e-9)
+    }
+    return math.Round(buckets*step*1e8) / 1e8
+}
@@ -2,7 +2,8 @@ package engine
 
 import (
     "sync"
-    "time"
+
+    "high-frequency-matching-engine/clock"
 )
 
 type MatchingEngine struct {
@@ -10,16 +11,35 @@ type MatchingEngine struct {
     mutex      sync.RWMutex
     tradesChan chan *Trade
     ordersChan chan *Order
+    execChan   chan *ExecutionReport
+    
+    executionHandlers []func([]*ExecutionReport)
+    eventQueues       []*EventQueue
+    clock             clock.Clock
+    tradeSeq          int64 // numbers trades across every book
 }
 
 func NewMatchingEngine() *MatchingEngine {
+    return NewMatchingEngineWithClock(clock.Real{})
+}
+
+// NewMatchingEngineWithClock creates an engine whose order books tell the
+// time from clk, such as a simulated clock for tests and backtests
+func NewMatchingEngineWithClock(clk clock.Clock) *MatchingEngine {
     return &MatchingEngine{
         orderBooks: make(map[string]*OrderBook),
         tradesChan: make(chan *Trade, 10000),
         ordersChan: make(chan *Order, 10000),
+        execChan:   make(chan *ExecutionReport, 10000),
+        clock:      clk,
     }
 }
 
+// Clock is the clock the engine timestamps orders and trades from
+func (me *MatchingEngine) Clock() clock.Clock {
+    return me.clock
+}
+
 func (me *MatchingEngine) GetOrCreateOrderBook(symbol string) *OrderBook {
     me.mutex.RLock()
     ob, exists := me.orderBooks[symbol]
@@ -29,7 +49,9 @@ func (me *MatchingEngine) GetOrCreateOrderBook(symbol string) *OrderBook {
         me.mutex.Lock()
         // Double-check after acquiring write lock
         if ob, exists = me.orderBooks[symbol]; !exists {
-            ob = NewOrderBook(symbol)
+            ob = NewOrderBookWithClock(symbol, me.clock)
+            ob.onEvent = me.dispatch
+            ob.tradeSeq = &me.tradeSeq
             me.orderBooks[symbol] = ob
         }
         me.mutex.Unlock()
@@ -39,10 +61,9 @@ func (me *MatchingEngine) GetOrCreateOrderBook(symbol string) *OrderBook {
 }
 
 func (me *MatchingEngine) ProcessOrder(order *Order) []*Trade {
-    order.Timestamp = time.Now()
-    
     ob := me.GetOrCreateOrderBook(order.Symbol)
-    trades := ob.AddOrder(order)
+    trades, reports := ob.submit(order)
+    me.publishReports(reports)
     
     // Send order update
     select {
@@ -72,7 +93,104 @@ func (me *MatchingEngine) CancelOrder(symbol, orderID string) bool {
         return false
     }
     
-    return ob.CancelOrder(orderID)
+    report := ob.cancel(orderID)
+    if report == nil {
+        return false
+    }
+    me.publishReports([]*ExecutionReport{report})
+    return true
+}
+
+// AmendOrder changes the price and total quantity of a resting order and
+// returns the amended order along with any trades the change triggered
+func (me *MatchingEngine) AmendOrder(symbol, orderID string, price, quantity float64) (Order, []*Trade, error) {
+    me.mutex.RLock()
+    ob, exists := me.orderBooks[symbol]
+    me.mutex.RUnlock()
+    
+    if !exists {
+        return Order{}, nil, ErrOrderNotFound
+    }
+    
+    order, trades, reports, err := ob.amend(orderID, price, quantity)
+    if err != nil {
+        return Order{}, nil, err
+    }
+    me.publishReports(reports)
+    
+    for _, trade := range trades {
+        select {
+        case me.tradesChan <- trade:
+        default:
+            // Channel full, handle appropriately
+        }
+    }
+    
+    return order, trades, nil
+}
+
+// CancelClientOrders cancels all resting orders of a client, in one
+// symbol or across every book when symbol is empty, and returns how many
+// were cancelled
+func (me *MatchingEngine) CancelClientOrders(clientID, symbol string) int {
+    me.mutex.RLock()
+    var books []*OrderBook
+    for _, ob := range me.orderBooks {
+        if symbol == "" || ob.Symbol == symbol {
+            books = append(books, ob)
+        }
+    }
+    me.mutex.RUnlock()
+    
+    cancelled := 0
+    for _, ob := range books {
+        reports := ob.cancelClient(clientID)
+        me.publishReports(reports)
+        cancelled += len(reports)
+    }
+    return cancelled
+}
+
+// OnExecution registers a handler called synchronously with the execution
+// reports of each book operation (a submit, amend or cancel), while the
+// order book is still locked, so each book's reports arrive in event order
+// ahead of the executions channel. Handlers must not block or call back
+// into the engine, and must be registered before orders are processed.
+// Consumers that cannot keep to that take events from Subscribe instead.
+func (me *MatchingEngine) OnExecution(handler func([]*ExecutionReport)) {
+    me.executionHandlers = append(me.executionHandlers, handler)
+}
+
+func (me *MatchingEngine) dispatch(event BookEvent) {
+    for _, handler := range me.executionHandlers {
+        handler(event.Reports)
+    }
+    for _, q := range me.eventQueues {
+        q.push(event)
+    }
+}
+
+func (me *MatchingEngine) publishReports(reports []*ExecutionReport) {
+    for _, report := range reports {
+        select {
+        case me.execChan <- report:
+        default:
+            // Channel full, handle appropriately
+        }
+    }
+}
+
+// GetOrder returns a copy of a resting order
+func (me *MatchingEngine) GetOrder(symbol, orderID string) (Order, bool) {
+    me.mutex.RLock()
+    ob, exists := me.orderBooks[symbol]
+    me.mutex.RUnlock()
+    
+    if !exists {
+        return Order{}, false
+    }
+    
+    return ob.GetOrder(orderID)
 }
 
 func (me *MatchingEngine) GetOrderBookSnapshot(symbol string) *OrderBookSnapshot {
@@ -87,10 +205,51 @@ func (me *MatchingEngine) GetOrderBookSnapshot(symbol string) *OrderBookSnapshot
     return ob.GetSnapshot()
 }
 
+// GetDepth returns a depth-limited and optionally grouped view of a book
+func (me *MatchingEngine) GetDepth(symbol string, query DepthQuery) *OrderBookSnapshot {
+    me.mutex.RLock()
+    ob, exists := me.orderBooks[symbol]
+    me.mutex.RUnlock()
+    
+    if !exists {
+        return nil
+    }
+    
+    return ob.GetDepth(query)
+}
+
+func (me *MatchingEngine) GetL3Snapshot(symbol string) *L3Snapshot {
+    me.mutex.RLock()
+    ob, exists := me.orderBooks[symbol]
+    me.mutex.RUnlock()
+    
+    if !exists {
+        return nil
+    }
+    
+    return ob.GetL3Snapshot()
+}
+
+func (me *MatchingEngine) GetTopOfBook(symbol string) *TopOfBook {
+    me.mutex.RLock()
+    ob, exists := me.orderBooks[symbol]
+    me.mutex.RUnlock()
+    
+    if !exists {
+        return nil
+    }
+    
+    return ob.GetTopOfBook()
+}
+
 func (me *MatchingEngine) GetTradesChannel() <-chan *Trade {
     return me.tradesChan
 }
 
 func (me *MatchingEngine) GetOrdersChannel() <-chan *Order {
     return me.ordersChan
+}
+
+func (me *MatchingEngine) GetExecutionsChannel() <-chan *ExecutionReport {
+    return me.execChan
 }
\ No newline at end of file
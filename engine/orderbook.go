@@ -4,11 +4,21 @@ import (
     "container/heap"
     "sort"
     "sync"
-    "time"
 	"fmt"
 	"sync/atomic"
+
+    "high-frequency-matching-engine/clock"
 )
 
+// queuedBefore is time priority. Orders stamped at the same time, as on a
+// simulated clock, keep the order they reached the book in.
+func queuedBefore(a, b *Order) bool {
+    if !a.Timestamp.Equal(b.Timestamp) {
+        return a.Timestamp.Before(b.Timestamp)
+    }
+    return a.arrival < b.arrival
+}
+
 // Priority queue for buy orders (max heap)
 type BuyOrderQueue []*Order
 
@@ -16,7 +26,7 @@ func (pq BuyOrderQueue) Len() int { return len(pq) }
 
 func (pq BuyOrderQueue) Less(i, j int) bool {
     if pq[i].Price == pq[j].Price {
-        return pq[i].Timestamp.Before(pq[j].Timestamp)
+        return queuedBefore(pq[i], pq[j])
     }
     return pq[i].Price > pq[j].Price // Max heap for buy orders
 }
@@ -44,7 +54,7 @@ func (pq SellOrderQueue) Len() int { return len(pq) }
 
 func (pq SellOrderQueue) Less(i, j int) bool {
     if pq[i].Price == pq[j].Price {
-        return pq[i].Timestamp.Before(pq[j].Timestamp)
+        return queuedBefore(pq[i], pq[j])
     }
     return pq[i].Price < pq[j].Price // Min heap for sell orders
 }
@@ -71,11 +81,24 @@ type OrderBook struct {
     SellOrders *SellOrderQueue
     Orders     map[string]*Order
     LastPrice  float64
+    bidLevels  *priceLevels
+    askLevels  *priceLevels
     mutex      sync.RWMutex
-    tradeSeq   int64
+    tradeSeq   *int64 // shared by an engine's books, so trade IDs are unique across them
+    reports    []*ExecutionReport
+    reportSeq  uint64
+    onEvent    func(BookEvent)
+    clock      clock.Clock
+    arrivals   uint64
 }
 
 func NewOrderBook(symbol string) *OrderBook {
+    return NewOrderBookWithClock(symbol, clock.Real{})
+}
+
+// NewOrderBookWithClock creates an order book that timestamps orders,
+// trades and snapshots from clk
+func NewOrderBookWithClock(symbol string, clk clock.Clock) *OrderBook {
     buyQueue := &BuyOrderQueue{}
     sellQueue := &SellOrderQueue{}
     heap.Init(buyQueue)
@@ -86,23 +109,123 @@ func NewOrderBook(symbol string) *OrderBook {
         BuyOrders:  buyQueue,
         SellOrders: sellQueue,
         Orders:     make(map[string]*Order),
-        tradeSeq:   0,
+        bidLevels:  newPriceLevels(true),
+        askLevels:  newPriceLevels(false),
+        tradeSeq:   new(int64),
+        clock:      clk,
+    }
+}
+
+func (ob *OrderBook) sideLevels(side OrderSide) *priceLevels {
+    if side == BUY {
+        return ob.bidLevels
+    }
+    return ob.askLevels
+}
+
+// rest adds an order's remaining quantity to the book
+func (ob *OrderBook) rest(order *Order) {
+    if order.Side == BUY {
+        heap.Push(ob.BuyOrders, order)
+    } else {
+        heap.Push(ob.SellOrders, order)
     }
+    ob.Orders[order.ID] = order
+    ob.sideLevels(order.Side).add(order.Price, order.Quantity-order.Filled, 1)
+}
+
+// unrest takes a resting order's remaining quantity out of the price
+// levels; callers remove it from the queues
+func (ob *OrderBook) unrest(order *Order) {
+    delete(ob.Orders, order.ID)
+    ob.sideLevels(order.Side).add(order.Price, -(order.Quantity - order.Filled), -1)
 }
 
 func (ob *OrderBook) AddOrder(order *Order) []*Trade {
+    trades, _ := ob.submit(order)
+    return trades
+}
+
+// submit matches an order and returns the resulting trades together with
+// the execution reports for every order it touched, in event order
+func (ob *OrderBook) submit(order *Order) ([]*Trade, []*ExecutionReport) {
     ob.mutex.Lock()
     defer ob.mutex.Unlock()
     
+    // Stamped under the lock so time priority matches arrival at the book
+    order.Timestamp = ob.clock.Now()
+    ob.arrivals++
+    order.arrival = ob.arrivals
+    ob.report(EXEC_NEW, order, nil)
+    
+    var trades []*Trade
     if order.Type == MARKET {
-        return ob.processMarketOrder(order)
+        trades = ob.processMarketOrder(order)
+    } else {
+        trades = ob.processLimitOrder(order)
     }
-    return ob.processLimitOrder(order)
+    return trades, ob.takeReports(trades)
+}
+
+func (ob *OrderBook) report(execType ExecType, order *Order, trade *Trade) {
+    ob.reportSeq++
+    report := &ExecutionReport{
+        Type:      execType,
+        Order:     *order,
+        Seq:       ob.reportSeq,
+        Timestamp: ob.clock.Now(),
+    }
+    if trade != nil {
+        report.TradeID = trade.ID
+        report.LastPrice = trade.Price
+        report.LastQty = trade.Quantity
+        report.Timestamp = trade.Timestamp
+    }
+    ob.reports = append(ob.reports, report)
+}
+
+// takeReports hands the pending reports and the operation's trades to the
+// book's event handler, still under the book lock so handlers see each
+// book's events in order, and returns the reports
+func (ob *OrderBook) takeReports(trades []*Trade) []*ExecutionReport {
+    reports := ob.reports
+    ob.reports = nil
+    if ob.onEvent != nil && len(reports) > 0 {
+        ob.onEvent(BookEvent{Reports: reports, Trades: trades})
+    }
+    return reports
+}
+
+// fill applies a match to both orders and records their execution reports
+func (ob *OrderBook) fill(taker, maker *Order, trade *Trade) {
+    taker.Filled += trade.Quantity
+    maker.Filled += trade.Quantity
+    
+    if taker.Filled >= taker.Quantity {
+        taker.Status = FILLED
+    } else {
+        taker.Status = PARTIAL
+    }
+    if maker.Filled >= maker.Quantity {
+        maker.Status = FILLED
+    } else {
+        maker.Status = PARTIAL
+    }
+    
+    // The maker is resting; a filled maker leaves its level
+    levelOrders := 0
+    if maker.Status == FILLED {
+        levelOrders = -1
+    }
+    ob.sideLevels(maker.Side).add(maker.Price, -trade.Quantity, levelOrders)
+    
+    ob.report(EXEC_TRADE, taker, trade)
+    ob.report(EXEC_TRADE, maker, trade)
 }
 
 func (ob *OrderBook) processMarketOrder(order *Order) []*Trade {
     var trades []*Trade
-    remaining := order.Quantity
+    remaining := order.Quantity - order.Filled
     
     if order.Side == BUY {
         // Match against sell orders
@@ -114,11 +237,9 @@ func (ob *OrderBook) processMarketOrder(order *Order) []*Trade {
             trades = append(trades, trade)
             
             remaining -= matchQty
-            order.Filled += matchQty
-            bestSell.Filled += matchQty
+            ob.fill(order, bestSell, trade)
             
-            if bestSell.Filled >= bestSell.Quantity {
-                bestSell.Status = FILLED
+            if bestSell.Status == FILLED {
                 heap.Pop(ob.SellOrders)
                 delete(ob.Orders, bestSell.ID)
             }
@@ -133,21 +254,19 @@ func (ob *OrderBook) processMarketOrder(order *Order) []*Trade {
             trades = append(trades, trade)
             
             remaining -= matchQty
-            order.Filled += matchQty
-            bestBuy.Filled += matchQty
+            ob.fill(order, bestBuy, trade)
             
-            if bestBuy.Filled >= bestBuy.Quantity {
-                bestBuy.Status = FILLED
+            if bestBuy.Status == FILLED {
                 heap.Pop(ob.BuyOrders)
                 delete(ob.Orders, bestBuy.ID)
             }
         }
     }
     
-    if order.Filled >= order.Quantity {
-        order.Status = FILLED
-    } else if order.Filled > 0 {
-        order.Status = PARTIAL
+    // Market orders never rest; whatever could not be filled is cancelled
+    if remaining > 0 {
+        order.Status = CANCELLED
+        ob.report(EXEC_CANCELLED, order, nil)
     }
     
     return trades
@@ -155,7 +274,7 @@ func (ob *OrderBook) processMarketOrder(order *Order) []*Trade {
 
 func (ob *OrderBook) processLimitOrder(order *Order) []*Trade {
     var trades []*Trade
-    remaining := order.Quantity
+    remaining := order.Quantity - order.Filled
     
     if order.Side == BUY {
         // Try to match against sell orders
@@ -170,11 +289,9 @@ func (ob *OrderBook) processLimitOrder(order *Order) []*Trade {
             trades = append(trades, trade)
             
             remaining -= matchQty
-            order.Filled += matchQty
-            bestSell.Filled += matchQty
+            ob.fill(order, bestSell, trade)
             
-            if bestSell.Filled >= bestSell.Quantity {
-                bestSell.Status = FILLED
+            if bestSell.Status == FILLED {
                 heap.Pop(ob.SellOrders)
                 delete(ob.Orders, bestSell.ID)
             }
@@ -182,9 +299,7 @@ func (ob *OrderBook) processLimitOrder(order *Order) []*Trade {
         
         // Add remaining quantity to order book
         if remaining > 0 {
-            order.Quantity = remaining
-            heap.Push(ob.BuyOrders, order)
-            ob.Orders[order.ID] = order
+            ob.rest(order)
         }
     } else {
         // Try to match against buy orders
@@ -199,11 +314,9 @@ func (ob *OrderBook) processLimitOrder(order *Order) []*Trade {
             trades = append(trades, trade)
             
             remaining -= matchQty
-            order.Filled += matchQty
-            bestBuy.Filled += matchQty
+            ob.fill(order, bestBuy, trade)
             
-            if bestBuy.Filled >= bestBuy.Quantity {
-                bestBuy.Status = FILLED
+            if bestBuy.Status == FILLED {
                 heap.Pop(ob.BuyOrders)
                 delete(ob.Orders, bestBuy.ID)
             }
@@ -211,51 +324,137 @@ func (ob *OrderBook) processLimitOrder(order *Order) []*Trade {
         
         // Add remaining quantity to order book
         if remaining > 0 {
-            order.Quantity = remaining
-            heap.Push(ob.SellOrders, order)
-            ob.Orders[order.ID] = order
+            ob.rest(order)
         }
     }
     
-    if order.Filled >= order.Quantity {
-        order.Status = FILLED
-    } else if order.Filled > 0 {
-        order.Status = PARTIAL
-    }
-    
     return trades
 }
 
 func (ob *OrderBook) createTrade(buyOrder, sellOrder *Order, price, quantity float64) *Trade {
-    tradeID := atomic.AddInt64(&ob.tradeSeq, 1)
+    tradeID := atomic.AddInt64(ob.tradeSeq, 1)
     ob.LastPrice = price
     
+    // The taker is whichever side is not yet resting in the book
+    takerSide := BUY
+    if _, resting := ob.Orders[buyOrder.ID]; resting {
+        takerSide = SELL
+    }
+    
     return &Trade{
-        ID:          fmt.Sprintf("T%d", tradeID),
-        Symbol:      ob.Symbol,
-        BuyOrderID:  buyOrder.ID,
-        SellOrderID: sellOrder.ID,
-        Price:       price,
-        Quantity:    quantity,
-        Timestamp:   time.Now(),
+        ID:           fmt.Sprintf("T%d", tradeID),
+        Symbol:       ob.Symbol,
+        BuyOrderID:   buyOrder.ID,
+        SellOrderID:  sellOrder.ID,
+        BuyClientID:  buyOrder.ClientID,
+        SellClientID: sellOrder.ClientID,
+        TakerSide:    takerSide,
+        Price:        price,
+        Quantity:     quantity,
+        Timestamp:    ob.clock.Now(),
     }
 }
 
 func (ob *OrderBook) CancelOrder(orderID string) bool {
+    return ob.cancel(orderID) != nil
+}
+
+// cancel removes a resting order and returns its cancellation report,
+// or nil if the order is not in the book
+func (ob *OrderBook) cancel(orderID string) *ExecutionReport {
     ob.mutex.Lock()
     defer ob.mutex.Unlock()
     
     order, exists := ob.Orders[orderID]
     if !exists {
-        return false
+        return nil
     }
     
     order.Status = CANCELLED
-    delete(ob.Orders, orderID)
+    ob.unrest(order)
     
     // Remove from appropriate queue (this is simplified - in production you'd need more efficient removal)
     ob.rebuildQueues()
-    return true
+    
+    ob.report(EXEC_CANCELLED, order, nil)
+    return ob.takeReports(nil)[0]
+}
+
+// amend changes the price and/or total quantity of a resting order. A pure
+// quantity reduction keeps time priority; anything else re-enters the order
+// at the back of the queue and may trade immediately.
+func (ob *OrderBook) amend(orderID string, price, quantity float64) (Order, []*Trade, []*ExecutionReport, error) {
+    // Checked here so no entry point can re-price an order to zero, where
+    // a sell would sweep every bid
+    if price <= 0 {
+        return Order{}, nil, nil, ErrInvalidPrice
+    }
+    if quantity <= 0 {
+        return Order{}, nil, nil, ErrInvalidAmend
+    }
+    
+    ob.mutex.Lock()
+    defer ob.mutex.Unlock()
+    
+    order, exists := ob.Orders[orderID]
+    if !exists {
+        return Order{}, nil, nil, ErrOrderNotFound
+    }
+    if quantity <= order.Filled {
+        return Order{}, nil, nil, ErrInvalidAmend
+    }
+    
+    if price == order.Price && quantity <= order.Quantity {
+        ob.sideLevels(order.Side).add(order.Price, quantity-order.Quantity, 0)
+        order.Quantity = quantity
+        ob.report(EXEC_REPLACED, order, nil)
+        return *order, nil, ob.takeReports(nil), nil
+    }
+    
+    ob.unrest(order)
+    ob.rebuildQueues()
+    
+    order.Price = price
+    order.Quantity = quantity
+    order.Timestamp = ob.clock.Now()
+    ob.arrivals++
+    order.arrival = ob.arrivals
+    ob.report(EXEC_REPLACED, order, nil)
+    
+    trades := ob.processLimitOrder(order)
+    return *order, trades, ob.takeReports(trades), nil
+}
+
+// cancelClient removes every resting order of a client and returns the
+// cancellation reports
+func (ob *OrderBook) cancelClient(clientID string) []*ExecutionReport {
+    ob.mutex.Lock()
+    defer ob.mutex.Unlock()
+    
+    for _, order := range ob.Orders {
+        if order.ClientID == clientID {
+            order.Status = CANCELLED
+            ob.unrest(order)
+            ob.report(EXEC_CANCELLED, order, nil)
+        }
+    }
+    
+    if len(ob.reports) > 0 {
+        ob.rebuildQueues()
+    }
+    return ob.takeReports(nil)
+}
+
+// GetOrder returns a copy of a resting order
+func (ob *OrderBook) GetOrder(orderID string) (Order, bool) {
+    ob.mutex.RLock()
+    defer ob.mutex.RUnlock()
+    
+    order, exists := ob.Orders[orderID]
+    if !exists {
+        return Order{}, false
+    }
+    return *order, true
 }
 
 func (ob *OrderBook) rebuildQueues() {
@@ -278,40 +477,88 @@ func (ob *OrderBook) rebuildQueues() {
 }
 
 func (ob *OrderBook) GetSnapshot() *OrderBookSnapshot {
+    return ob.GetDepth(DepthQuery{})
+}
+
+// GetDepth returns the book's price levels, best first, limited, grouped
+// and accumulated as the query asks
+func (ob *OrderBook) GetDepth(query DepthQuery) *OrderBookSnapshot {
     ob.mutex.RLock()
     defer ob.mutex.RUnlock()
     
-    var bids, asks []OrderBookLevel
-    
-    // Aggregate buy orders by price level
-    buyLevels := make(map[float64]float64)
-    for _, order := range *ob.BuyOrders {
-        buyLevels[order.Price] += order.Quantity - order.Filled
-    }
-    
-    for price, qty := range buyLevels {
-        bids = append(bids, OrderBookLevel{Price: price, Quantity: qty, Orders: 1})
+    return &OrderBookSnapshot{
+        Symbol:    ob.Symbol,
+        Bids:      ob.bidLevels.depth(query),
+        Asks:      ob.askLevels.depth(query),
+        Timestamp: ob.clock.Now(),
     }
+}
+
+// GetL3Snapshot returns every resting order in priority order: best price
+// first, then earliest first within a price
+func (ob *OrderBook) GetL3Snapshot() *L3Snapshot {
+    ob.mutex.RLock()
+    defer ob.mutex.RUnlock()
     
-    // Aggregate sell orders by price level
-    sellLevels := make(map[float64]float64)
-    for _, order := range *ob.SellOrders {
-        sellLevels[order.Price] += order.Quantity - order.Filled
+    buys := append(BuyOrderQueue(nil), *ob.BuyOrders...)
+    sort.Slice(buys, buys.Less)
+    bids := make([]L3Order, 0, len(buys))
+    for _, order := range buys {
+        bids = append(bids, l3Order(order))
     }
-    
-    for price, qty := range sellLevels {
-        asks = append(asks, OrderBookLevel{Price: price, Quantity: qty, Orders: 1})
+    sells := append(SellOrderQueue(nil), *ob.SellOrders...)
+    sort.Slice(sells, sells.Less)
+    asks := make([]L3Order, 0, len(sells))
+    for _, order := range sells {
+        asks = append(asks, l3Order(order))
     }
     
-    // Sort bids (highest first) and asks (lowest first)
-    sort.Slice(bids, func(i, j int) bool { return bids[i].Price > bids[j].Price })
-    sort.Slice(asks, func(i, j int) bool { return asks[i].Price < asks[j].Price })
+    setPositions(bids)
+    setPositions(asks)
     
-    return &OrderBookSnapshot{
+    return &L3Snapshot{
         Symbol:    ob.Symbol,
+        Seq:       ob.reportSeq,
         Bids:      bids,
         Asks:      asks,
-        Timestamp: time.Now(),
+        Timestamp: ob.clock.Now(),
+    }
+}
+
+func l3Order(order *Order) L3Order {
+    return L3Order{
+        ID:        order.ID,
+        Side:      order.Side,
+        Price:     order.Price,
+        Quantity:  order.Quantity - order.Filled,
+        Timestamp: order.Timestamp,
+    }
+}
+
+// setPositions numbers orders within each price level of a sorted side
+func setPositions(orders []L3Order) {
+    for i := range orders {
+        if i > 0 && orders[i].Price == orders[i-1].Price {
+            orders[i].Position = orders[i-1].Position + 1
+        }
+    }
+}
+
+// GetTopOfBook returns the best bid and ask with the total quantity
+// resting at each price; a zero price means that side is empty
+func (ob *OrderBook) GetTopOfBook() *TopOfBook {
+    ob.mutex.RLock()
+    defer ob.mutex.RUnlock()
+    
+    bid := ob.bidLevels.best()
+    ask := ob.askLevels.best()
+    return &TopOfBook{
+        Symbol:    ob.Symbol,
+        BidPrice:  bid.Price,
+        BidQty:    bid.Quantity,
+        AskPrice:  ask.Price,
+        AskQty:    ask.Quantity,
+        Timestamp: ob.clock.Now(),
     }
 }
 
@@ -1,9 +1,16 @@
 package engine
 
 import (
+    "errors"
     "time"
 )
 
+var (
+    ErrOrderNotFound = errors.New("order not found")
+    ErrInvalidAmend  = errors.New("amended quantity must exceed filled quantity")
+    ErrInvalidPrice  = errors.New("amended price must be positive")
+)
+
 type OrderSide int
 
 const (
@@ -27,17 +34,29 @@ const (
     CANCELLED
 )
 
+type ExecType int
+
+const (
+    EXEC_NEW ExecType = iota
+    EXEC_TRADE
+    EXEC_CANCELLED
+    EXEC_REPLACED
+)
+
 type Order struct {
-    ID          string      `json:"id"`
-    Symbol      string      `json:"symbol"`
-    Side        OrderSide   `json:"side"`
-    Type        OrderType   `json:"type"`
-    Quantity    float64     `json:"quantity"`
-    Price       float64     `json:"price"`
-    Filled      float64     `json:"filled"`
-    Status      OrderStatus `json:"status"`
-    Timestamp   time.Time   `json:"timestamp"`
-    ClientID    string      `json:"client_id"`
+    ID            string      `json:"id"`
+    Symbol        string      `json:"symbol"`
+    Side          OrderSide   `json:"side"`
+    Type          OrderType   `json:"type"`
+    Quantity      float64     `json:"quantity"`
+    Price         float64     `json:"price"`
+    Filled        float64     `json:"filled"`
+    Status        OrderStatus `json:"status"`
+    Timestamp     time.Time   `json:"timestamp"`
+    ClientID      string      `json:"client_id"`
+    ClientOrderID string      `json:"client_order_id,omitempty"`
+
+    arrival uint64 // breaks time priority ties, set by the book
 }
 
 type Trade struct {
@@ -45,23 +64,87 @@ type Trade struct {
     Symbol       string    `json:"symbol"`
     BuyOrderID   string    `json:"buy_order_id"`
     SellOrderID  string    `json:"sell_order_id"`
+    BuyClientID  string    `json:"buy_client_id"`
+    SellClientID string    `json:"sell_client_id"`
+    TakerSide    OrderSide `json:"taker_side"`
     Price        float64   `json:"price"`
     Quantity     float64   `json:"quantity"`
     Timestamp    time.Time `json:"timestamp"`
 }
 
+// ExecutionReport describes a single state change of an order. Order is a
+// copy taken at the time of the event, so it is safe to hold on to. Seq
+// numbers the reports of one order book without gaps.
+type ExecutionReport struct {
+    Type      ExecType  `json:"exec_type"`
+    Order     Order     `json:"order"`
+    TradeID   string    `json:"trade_id,omitempty"`
+    LastPrice float64   `json:"last_price,omitempty"`
+    LastQty   float64   `json:"last_qty,omitempty"`
+    Seq       uint64    `json:"seq"`
+    Timestamp time.Time `json:"timestamp"`
+}
+
+// MarketDataType says what an external market data event reports
+type MarketDataType string
+
+const (
+    MarketDataTicker MarketDataType = "ticker"
+    MarketDataTrade  MarketDataType = "trade"
+    MarketDataDepth  MarketDataType = "depth" // top of a reconstructed exchange book
+    MarketDataNBBO   MarketDataType = "nbbo"  // best bid and offer across exchanges
+)
+
+// MarketData is a market data event from an external exchange, normalized
+// across exchanges. Price and Quantity are the last trade; Side is its
+// taker side where the exchange reports it. Fields an exchange does not
+// send are zero. ExchangeTime is when the exchange produced the event and
+// ReceiveTime when the feeder read it.
 type MarketData struct {
-    Symbol    string    `json:"symbol"`
+    Exchange     string         `json:"exchange"`
+    Symbol       string         `json:"symbol"`
+    Type         MarketDataType `json:"type"`
+    Price        float64        `json:"price"`
+    Quantity     float64        `json:"quantity"`
+    Side         OrderSide      `json:"side"`
+    BidPrice     float64        `json:"bid_price"`
+    BidQty       float64        `json:"bid_qty"`
+    AskPrice     float64        `json:"ask_price"`
+    AskQty       float64        `json:"ask_qty"`
+    Volume       float64        `json:"volume"` // rolling 24h, base currency
+    ExchangeTime time.Time      `json:"exchange_time"`
+    ReceiveTime  time.Time      `json:"receive_time"`
+}
+
+// OrderBookLevel aggregates the orders resting at one price. Cumulative is
+// only set when requested and sums the quantity from the top of the book
+// down to this level.
+type OrderBookLevel struct {
+    Price      float64 `json:"price"`
+    Quantity   float64 `json:"quantity"`
+    Orders     int     `json:"orders"`
+    Cumulative float64 `json:"cumulative,omitempty"`
+}
+
+// L3Order is a resting order as shown publicly: its owner is never
+// included. Position counts the orders ahead of it at the same price.
+type L3Order struct {
+    ID        string    `json:"id"`
+    Side      OrderSide `json:"side"`
     Price     float64   `json:"price"`
     Quantity  float64   `json:"quantity"`
-    Side      OrderSide `json:"side"`
+    Position  int       `json:"position"`
     Timestamp time.Time `json:"timestamp"`
 }
 
-type OrderBookLevel struct {
-    Price    float64 `json:"price"`
-    Quantity float64 `json:"quantity"`
-    Orders   int     `json:"orders"`
+// L3Snapshot lists every resting order in priority order. Seq is the last
+// execution report applied, so report-driven updates continue from Seq+1.
+type L3Snapshot struct {
+    Symbol    string    `json:"symbol"`
+    Seq       uint64    `json:"seq"`
+    Bids      []L3Order `json:"bids"`
+    Asks      []L3Order `json:"asks"`
+    Timestamp time.Time `json:"timestamp"`
 }
 
 type OrderBookSnapshot struct {
@@ -69,4 +152,13 @@ type OrderBookSnapshot struct {
     Bids      []OrderBookLevel `json:"bids"`
     Asks      []OrderBookLevel `json:"asks"`
     Timestamp time.Time        `json:"timestamp"`
+}
+
+type TopOfBook struct {
+    Symbol    string    `json:"symbol"`
+    BidPrice  float64   `json:"bid_price"`
+    BidQty    float64   `json:"bid_qty"`
+    AskPrice  float64   `json:"ask_price"`
+    AskQty    float64   `json:"ask_qty"`
+    Timestamp time.Time `json:"timestamp"`
 }
\ No newline at end of file
@@ -0,0 +1,111 @@
+package fix
+
+import (
+    "bufio"
+    "net"
+    "sync"
+    "time"
+
+    "go.uber.org/zap"
+)
+
+// Acceptor listens for FIX connections and hands each one to the
+// configured session matching the counterparty's CompIDs
+type Acceptor struct {
+    sessions map[string]*Session
+    listener net.Listener
+    logger   *zap.Logger
+    wg       sync.WaitGroup
+}
+
+func NewAcceptor(sessions []*Session, logger *zap.Logger) *Acceptor {
+    a := &Acceptor{
+        sessions: make(map[string]*Session),
+        logger:   logger,
+    }
+    for _, s := range sessions {
+        a.sessions[s.SenderCompID+"|"+s.TargetCompID] = s
+    }
+    return a
+}
+
+func (a *Acceptor) Listen(addr string) error {
+    listener, err := net.Listen("tcp", addr)
+    if err != nil {
+        return err
+    }
+    a.listener = listener
+
+    a.wg.Add(1)
+    go func() {
+        defer a.wg.Done()
+        for {
+            conn, err := listener.Accept()
+            if err != nil {
+                return
+            }
+            go a.handleConn(conn)
+        }
+    }()
+
+    a.logger.Info("FIX acceptor listening", zap.String("addr", listener.Addr().String()))
+    return nil
+}
+
+// Addr returns the listening address, useful when bound to port 0
+func (a *Acceptor) Addr() net.Addr {
+    return a.listener.Addr()
+}
+
+func (a *Acceptor) handleConn(conn net.Conn) {
+    reader := bufio.NewReader(conn)
+
+    conn.SetReadDeadline(time.Now().Add(logonTimeout))
+    data, err := ReadMessage(reader)
+    if err != nil {
+        conn.Close()
+        return
+    }
+    conn.SetReadDeadline(time.Time{})
+
+    msg, err := Parse(data)
+    if err != nil || msg.MsgType() != MsgLogon {
+        a.logger.Warn("Rejecting FIX connection without valid Logon", zap.String("remote", conn.RemoteAddr().String()))
+        conn.Close()
+        return
+    }
+
+    // Our SenderCompID is the counterparty's TargetCompID and vice versa
+    s, exists := a.sessions[msg.Get(TagTargetCompID)+"|"+msg.Get(TagSenderCompID)]
+    if !exists {
+        a.logger.Warn("Rejecting FIX Logon for unknown session",
+            zap.String("sender_comp_id", msg.Get(TagSenderCompID)),
+            zap.String("target_comp_id", msg.Get(TagTargetCompID)))
+        conn.Close()
+        return
+    }
+
+    if err := s.attach(conn); err != nil {
+        a.logger.Warn("Rejecting duplicate FIX connection", zap.Error(err))
+        conn.Close()
+        return
+    }
+    s.run(conn, reader, msg)
+}
+
+// Close stops accepting connections and logs out every session
+func (a *Acceptor) Close() error {
+    var err error
+    if a.listener != nil {
+        err = a.listener.Close()
+    }
+    a.wg.Wait()
+
+    for _, s := range a.sessions {
+        if s.IsLoggedOn() {
+            s.Logout("server shutdown")
+        }
+        s.disconnect("acceptor closed")
+    }
+    return err
+}
@@ -0,0 +1,237 @@
+package fix
+
+import (
+    "testing"
+    "time"
+
+    "go.uber.org/zap"
+
+    "high-frequency-matching-engine/engine"
+)
+
+const testTimeout = 5 * time.Second
+
+// recorder collects the application messages an initiator receives
+type recorder struct {
+    messages chan *Message
+}
+
+func (r *recorder) OnLogon(s *Session) {}
+
+func (r *recorder) OnLogout(s *Session) {}
+
+func (r *recorder) FromApp(s *Session, msg *Message) {
+    r.messages <- msg
+}
+
+func (r *recorder) next(t *testing.T) *Message {
+    t.Helper()
+    select {
+    case msg := <-r.messages:
+        return msg
+    case <-time.After(testTimeout):
+        t.Fatal("timed out waiting for a FIX message")
+        return nil
+    }
+}
+
+// startAcceptor runs an order entry acceptor for one session on a real
+// matching engine, and returns the engine, the server side session and the
+// acceptor's address
+func startAcceptor(t *testing.T) (*engine.MatchingEngine, *Session, string) {
+    t.Helper()
+    logger := zap.NewNop()
+
+    matchingEngine := engine.NewMatchingEngine()
+    gateway := NewOrderGateway(matchingEngine, logger)
+    store, err := OpenMessageStore(t.TempDir(), "HFME-CLIENT")
+    if err != nil {
+        t.Fatal(err)
+    }
+    session := NewSession(SessionConfig{SenderCompID: "HFME", TargetCompID: "CLIENT", ClientID: "c1"}, store, gateway, logger)
+    gateway.Register(session)
+
+    done := make(chan struct{})
+    go gateway.Run(done)
+
+    acceptor := NewAcceptor([]*Session{session}, logger)
+    if err := acceptor.Listen("127.0.0.1:0"); err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() {
+        acceptor.Close()
+        close(done)
+        store.Close()
+    })
+    return matchingEngine, session, acceptor.Addr().String()
+}
+
+func newTestInitiator(t *testing.T) (*Initiator, *recorder) {
+    t.Helper()
+    store, err := OpenMessageStore(t.TempDir(), "CLIENT-HFME")
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { store.Close() })
+
+    app := &recorder{messages: make(chan *Message, 16)}
+    cfg := SessionConfig{SenderCompID: "CLIENT", TargetCompID: "HFME"}
+    return NewInitiator(cfg, store, app, 30*time.Second, zap.NewNop()), app
+}
+
+func waitLoggedOut(t *testing.T, s *Session) {
+    t.Helper()
+    deadline := time.Now().Add(testTimeout)
+    for s.IsLoggedOn() {
+        if time.Now().After(deadline) {
+            t.Fatal("acceptor session still logged on")
+        }
+        time.Sleep(10 * time.Millisecond)
+    }
+}
+
+func expectReport(t *testing.T, msg *Message, execType, ordStatus, clOrdID, origClOrdID string) {
+    t.Helper()
+    if msg.MsgType() != MsgExecutionReport {
+        t.Fatalf("got MsgType %s, want an ExecutionReport: %s", msg.MsgType(), msg)
+    }
+    checks := []struct {
+        tag  int
+        want string
+    }{
+        {TagExecType, execType},
+        {TagOrdStatus, ordStatus},
+        {TagClOrdID, clOrdID},
+        {TagOrigClOrdID, origClOrdID},
+    }
+    for _, check := range checks {
+        if got := msg.Get(check.tag); got != check.want {
+            t.Errorf("tag %d = %q, want %q in %s", check.tag, got, check.want, msg)
+        }
+    }
+}
+
+func newOrderSingle(clOrdID, side string, price, quantity float64) *Message {
+    return NewMessage(MsgNewOrderSingle).
+        Set(TagClOrdID, clOrdID).
+        Set(TagSymbol, "BTCUSDT").
+        Set(TagSide, side).
+        Set(TagOrdType, "2").
+        SetFloat(TagPrice, price).
+        SetFloat(TagOrderQty, quantity).
+        SetTime(TagTransactTime, time.Now())
+}
+
+func TestAcceptorOrderLifecycle(t *testing.T) {
+    _, serverSession, addr := startAcceptor(t)
+    initiator, app := newTestInitiator(t)
+    if err := initiator.Connect(addr, true, testTimeout); err != nil {
+        t.Fatal(err)
+    }
+    defer initiator.Close()
+    client := initiator.Session()
+
+    client.Send(newOrderSingle("1", "1", 100, 1))
+    report := app.next(t)
+    expectReport(t, report, "0", "0", "1", "")
+    orderID := report.Get(TagOrderID)
+
+    client.Send(NewMessage(MsgOrderCancelReplaceRequest).
+        Set(TagClOrdID, "2").
+        Set(TagOrigClOrdID, "1").
+        Set(TagSymbol, "BTCUSDT").
+        Set(TagSide, "1").
+        Set(TagOrdType, "2").
+        SetFloat(TagPrice, 101).
+        SetFloat(TagOrderQty, 2))
+    report = app.next(t)
+    expectReport(t, report, "5", "0", "2", "1")
+    if report.Get(TagOrderID) != orderID || report.Get(TagPrice) != "101" || report.Get(TagOrderQty) != "2" {
+        t.Errorf("replace report %s, want order %s at 101 for 2", report, orderID)
+    }
+
+    client.Send(NewMessage(MsgOrderCancelRequest).
+        Set(TagClOrdID, "3").
+        Set(TagOrigClOrdID, "2").
+        Set(TagSymbol, "BTCUSDT").
+        Set(TagSide, "1"))
+    expectReport(t, app.next(t), "4", "4", "3", "2")
+
+    // A finished order's ClOrdIDs are free again
+    client.Send(newOrderSingle("1", "1", 100, 1))
+    expectReport(t, app.next(t), "0", "0", "1", "")
+
+    // Logon, then four reports, each side counting from 1
+    if got := client.store.NextTargetSeqNum(); got != 6 {
+        t.Errorf("initiator expects seq %d next, want 6", got)
+    }
+    if got := serverSession.store.NextSenderSeqNum(); got != 6 {
+        t.Errorf("acceptor sends seq %d next, want 6", got)
+    }
+    if got, want := serverSession.store.NextTargetSeqNum(), client.store.NextSenderSeqNum(); got != want {
+        t.Errorf("acceptor expects seq %d next, initiator sends %d", got, want)
+    }
+}
+
+func TestAcceptorResendAfterReconnect(t *testing.T) {
+    matchingEngine, serverSession, addr := startAcceptor(t)
+    initiator, app := newTestInitiator(t)
+    if err := initiator.Connect(addr, true, testTimeout); err != nil {
+        t.Fatal(err)
+    }
+    client := initiator.Session()
+
+    client.Send(newOrderSingle("1", "1", 100, 1))
+    expectReport(t, app.next(t), "0", "0", "1", "")
+
+    initiator.Close()
+    waitLoggedOut(t, serverSession)
+
+    // Fill the order while the client is away; its report is stored for it
+    matchingEngine.ProcessOrder(&engine.Order{
+        ID:       "other-1",
+        Symbol:   "BTCUSDT",
+        Side:     engine.SELL,
+        Type:     engine.LIMIT,
+        Price:    100,
+        Quantity: 1,
+        Status:   engine.PENDING,
+        ClientID: "c2",
+    })
+    deadline := time.Now().Add(testTimeout)
+    for serverSession.store.NextSenderSeqNum() <= client.store.NextTargetSeqNum() {
+        if time.Now().After(deadline) {
+            t.Fatal("fill was not sequenced for the offline session")
+        }
+        time.Sleep(10 * time.Millisecond)
+    }
+    missed := client.store.NextTargetSeqNum()
+
+    // The acceptor's Logon is ahead of the initiator, which asks for the gap
+    if err := initiator.Connect(addr, false, testTimeout); err != nil {
+        t.Fatal(err)
+    }
+    defer initiator.Close()
+
+    report := app.next(t)
+    expectReport(t, report, "F", "2", "1", "")
+    if seq, _ := report.GetInt(TagMsgSeqNum); seq < missed {
+        t.Errorf("resent fill has seq %d, want at least %d", seq, missed)
+    }
+    if report.Get(TagPossDupFlag) != "Y" || !report.Has(TagOrigSendingTime) {
+        t.Errorf("resent fill %s lacks PossDupFlag or OrigSendingTime", report)
+    }
+    if report.Get(TagLastQty) != "1" || report.Get(TagLastPx) != "100" {
+        t.Errorf("resent fill %s, want 1 at 100", report)
+    }
+
+    // Gap fills bring the initiator level with the acceptor
+    deadline = time.Now().Add(testTimeout)
+    for client.store.NextTargetSeqNum() != serverSession.store.NextSenderSeqNum() {
+        if time.Now().After(deadline) {
+            t.Fatalf("initiator expects seq %d, acceptor sends %d",
+                client.store.NextTargetSeqNum(), serverSession.store.NextSenderSeqNum())
+        }
+        time.Sleep(10 * time.Millisecond)
+    }
+}
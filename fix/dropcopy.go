@@ -0,0 +1,124 @@
+package fix
+
+import (
+    "sync"
+
+    "go.uber.org/zap"
+
+    "high-frequency-matching-engine/engine"
+)
+
+type dropCopySession struct {
+    session *Session
+    clients map[string]bool
+}
+
+// DropCopy copies every execution report from the engine to read-only
+// sessions. Reports are sequenced and persisted per session whether or not
+// it is connected, so a reconnecting session recovers everything it missed
+// through a ResendRequest. Order messages are rejected.
+type DropCopy struct {
+    events    *engine.EventQueue
+    sessions  []*dropCopySession
+    notionals map[string]float64 // order ID -> filled notional, for AvgPx
+    logger    *zap.Logger
+    execIDs   *idSource
+    mutex     sync.Mutex
+}
+
+// NewDropCopy must be created before orders reach the engine, as it
+// queues the engine's events from then on for Run
+func NewDropCopy(matchingEngine *engine.MatchingEngine, logger *zap.Logger) *DropCopy {
+    return &DropCopy{
+        events:    matchingEngine.Subscribe(),
+        notionals: make(map[string]float64),
+        logger:    logger,
+        execIDs:   newIDSource(),
+    }
+}
+
+// Register adds a session, copying only the given clients' reports unless
+// the list is empty
+func (dc *DropCopy) Register(s *Session, clients []string) {
+    dc.mutex.Lock()
+    defer dc.mutex.Unlock()
+
+    dcs := &dropCopySession{session: s}
+    if len(clients) > 0 {
+        dcs.clients = make(map[string]bool)
+        for _, clientID := range clients {
+            dcs.clients[clientID] = true
+        }
+    }
+    dc.sessions = append(dc.sessions, dcs)
+}
+
+func (dc *DropCopy) OnLogon(s *Session) {}
+
+func (dc *DropCopy) OnLogout(s *Session) {}
+
+// FromApp rejects every application message: drop copy is read-only
+func (dc *DropCopy) FromApp(s *Session, msg *Message) {
+    dc.logger.Warn("Rejected application message on drop copy session",
+        zap.String("session", s.ID()),
+        zap.String("msg_type", msg.MsgType()))
+    sessionReject(s, msg, rejectInvalidMsgType, "drop copy session is read-only")
+}
+
+// Run copies every engine event, in order, until done is closed
+func (dc *DropCopy) Run(done <-chan struct{}) {
+    dc.events.Run(done, func(event engine.BookEvent) {
+        for _, report := range event.Reports {
+            dc.onExecution(report)
+        }
+    })
+}
+
+// onExecution sends a report to every session whose filter includes the
+// order's client
+func (dc *DropCopy) onExecution(report *engine.ExecutionReport) {
+    dc.mutex.Lock()
+    if report.Type == engine.EXEC_TRADE {
+        dc.notionals[report.Order.ID] += report.LastPrice * report.LastQty
+    }
+    avgPx := 0.0
+    if report.Order.Filled > 0 {
+        avgPx = dc.notionals[report.Order.ID] / report.Order.Filled
+    }
+    if report.Order.Status == engine.FILLED || report.Order.Status == engine.CANCELLED {
+        delete(dc.notionals, report.Order.ID)
+    }
+
+    var targets []*Session
+    for _, dcs := range dc.sessions {
+        if dcs.clients == nil || dcs.clients[report.Order.ClientID] {
+            targets = append(targets, dcs.session)
+        }
+    }
+    dc.mutex.Unlock()
+
+    if len(targets) == 0 {
+        return
+    }
+
+    clOrdID := report.Order.ClientOrderID
+    if clOrdID == "" {
+        clOrdID = report.Order.ID
+    }
+
+    for _, s := range targets {
+        msg := BuildExecutionReport(report, dc.execIDs.next(), clOrdID, "", avgPx)
+        if report.Order.ClientID != "" {
+            msg.Set(TagAccount, report.Order.ClientID)
+        }
+        if report.TradeID != "" {
+            msg.Set(TagTrdMatchID, report.TradeID)
+        }
+        if err := s.Send(msg); err != nil {
+            dc.logger.Error("Failed to send drop copy report",
+                zap.String("session", s.ID()),
+                zap.String("order_id", report.Order.ID),
+                zap.Error(err))
+        }
+    }
+}
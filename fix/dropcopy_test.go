@@ -0,0 +1,114 @@
+package fix
+
+import (
+    "testing"
+    "time"
+
+    "go.uber.org/zap"
+
+    "high-frequency-matching-engine/engine"
+)
+
+// startDropCopy runs a drop copy acceptor copying every client's reports
+// from a real matching engine
+func startDropCopy(t *testing.T) (*engine.MatchingEngine, *Session, string) {
+    t.Helper()
+    logger := zap.NewNop()
+
+    matchingEngine := engine.NewMatchingEngine()
+    dropCopy := NewDropCopy(matchingEngine, logger)
+    store, err := OpenMessageStore(t.TempDir(), "HFME-CLIENT")
+    if err != nil {
+        t.Fatal(err)
+    }
+    session := NewSession(SessionConfig{SenderCompID: "HFME", TargetCompID: "CLIENT"}, store, dropCopy, logger)
+    dropCopy.Register(session, nil)
+
+    done := make(chan struct{})
+    go dropCopy.Run(done)
+
+    acceptor := NewAcceptor([]*Session{session}, logger)
+    if err := acceptor.Listen("127.0.0.1:0"); err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() {
+        acceptor.Close()
+        close(done)
+        store.Close()
+    })
+    return matchingEngine, session, acceptor.Addr().String()
+}
+
+func limitOrder(id, clientID string, side engine.OrderSide) *engine.Order {
+    return &engine.Order{
+        ID:       id,
+        Symbol:   "BTCUSDT",
+        Side:     side,
+        Type:     engine.LIMIT,
+        Price:    100,
+        Quantity: 1,
+        Status:   engine.PENDING,
+        ClientID: clientID,
+    }
+}
+
+func TestDropCopyResendAfterReconnect(t *testing.T) {
+    matchingEngine, serverSession, addr := startDropCopy(t)
+    initiator, app := newTestInitiator(t)
+    if err := initiator.Connect(addr, true, testTimeout); err != nil {
+        t.Fatal(err)
+    }
+
+    matchingEngine.ProcessOrder(limitOrder("buy-1", "c1", engine.BUY))
+    report := app.next(t)
+    expectReport(t, report, "0", "0", "buy-1", "")
+    if report.Get(TagAccount) != "c1" {
+        t.Errorf("report %s, want Account c1", report)
+    }
+
+    initiator.Close()
+    waitLoggedOut(t, serverSession)
+
+    // Both sides of a fill while the session is away are stored for it
+    first := serverSession.store.NextSenderSeqNum()
+    matchingEngine.ProcessOrder(limitOrder("sell-1", "c2", engine.SELL))
+    deadline := time.Now().Add(testTimeout)
+    for serverSession.store.NextSenderSeqNum() < first+3 {
+        if time.Now().After(deadline) {
+            t.Fatal("reports were not sequenced for the offline session")
+        }
+        time.Sleep(10 * time.Millisecond)
+    }
+
+    if err := initiator.Connect(addr, false, testTimeout); err != nil {
+        t.Fatal(err)
+    }
+    defer initiator.Close()
+
+    // The seller's NEW, then the fill of each side, in engine order
+    want := []struct {
+        execType, ordStatus, clOrdID, account string
+    }{
+        {"0", "0", "sell-1", "c2"},
+        {"F", "2", "sell-1", "c2"},
+        {"F", "2", "buy-1", "c1"},
+    }
+    var matchID string
+    for i, w := range want {
+        report := app.next(t)
+        expectReport(t, report, w.execType, w.ordStatus, w.clOrdID, "")
+        if seq, _ := report.GetInt(TagMsgSeqNum); seq != first+i {
+            t.Errorf("resent report has seq %d, want %d", seq, first+i)
+        }
+        if report.Get(TagAccount) != w.account || report.Get(TagPossDupFlag) != "Y" {
+            t.Errorf("resent report %s, want Account %s and PossDupFlag", report, w.account)
+        }
+        if w.execType == "F" {
+            if matchID == "" {
+                matchID = report.Get(TagTrdMatchID)
+            } else if report.Get(TagTrdMatchID) != matchID {
+                t.Errorf("fills have TrdMatchID %s and %s, want one match", matchID, report.Get(TagTrdMatchID))
+            }
+        }
+    }
+}
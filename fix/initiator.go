@@ -0,0 +1,86 @@
+package fix
+
+import (
+    "bufio"
+    "errors"
+    "net"
+    "time"
+
+    "go.uber.org/zap"
+)
+
+// Initiator is the client side of a FIX session. The engine itself only
+// accepts connections; the initiator exists for tooling and end-to-end
+// checks against a running acceptor.
+type Initiator struct {
+    session *Session
+}
+
+func NewInitiator(cfg SessionConfig, store *MessageStore, app Application, heartBtInt time.Duration, logger *zap.Logger) *Initiator {
+    s := NewSession(cfg, store, app, logger)
+    if heartBtInt > 0 {
+        s.heartBtInt = heartBtInt
+    }
+    return &Initiator{session: s}
+}
+
+func (i *Initiator) Session() *Session {
+    return i.session
+}
+
+// Connect dials the acceptor, sends Logon and waits for the response.
+// With resetSeqNum both sides start over at sequence number 1.
+func (i *Initiator) Connect(addr string, resetSeqNum bool, timeout time.Duration) error {
+    s := i.session
+
+    conn, err := net.DialTimeout("tcp", addr, timeout)
+    if err != nil {
+        return err
+    }
+    if err := s.attach(conn); err != nil {
+        conn.Close()
+        return err
+    }
+
+    if resetSeqNum {
+        if err := s.store.Reset(); err != nil {
+            s.disconnect(err.Error())
+            return err
+        }
+    }
+
+    loggedOn := make(chan struct{})
+    s.mutex.Lock()
+    s.loggedOnChan = loggedOn
+    s.mutex.Unlock()
+
+    logon := NewMessage(MsgLogon).SetInt(TagEncryptMethod, 0).SetInt(TagHeartBtInt, int(s.heartBtInt/time.Second))
+    if resetSeqNum {
+        logon.Set(TagResetSeqNumFlag, "Y")
+    }
+    if err := s.Send(logon); err != nil {
+        s.disconnect(err.Error())
+        return err
+    }
+
+    go s.run(conn, bufio.NewReader(conn), nil)
+
+    select {
+    case <-loggedOn:
+        return nil
+    case <-time.After(timeout):
+        s.mutex.Lock()
+        s.loggedOnChan = nil
+        s.mutex.Unlock()
+        s.disconnect("logon timeout")
+        return errors.New("FIX logon timed out")
+    }
+}
+
+// Close logs out and drops the connection
+func (i *Initiator) Close() {
+    if i.session.IsLoggedOn() {
+        i.session.Logout("")
+    }
+    i.session.disconnect("initiator closed")
+}
@@ -0,0 +1,296 @@
+package fix
+
+import (
+    "bufio"
+    "bytes"
+    "errors"
+    "fmt"
+    "io"
+    "strconv"
+    "time"
+)
+
+const (
+    BeginString = "FIX.4.4"
+    soh         = '\x01'
+    timeFormat  = "20060102-15:04:05.000"
+)
+
+// Tags used by the session and application layers
+const (
+    TagAccount                = 1
+    TagAvgPx                  = 6
+    TagBeginSeqNo             = 7
+    TagBeginString            = 8
+    TagBodyLength             = 9
+    TagCheckSum               = 10
+    TagClOrdID                = 11
+    TagCumQty                 = 14
+    TagEndSeqNo               = 16
+    TagExecID                 = 17
+    TagLastPx                 = 31
+    TagLastQty                = 32
+    TagMsgSeqNum              = 34
+    TagMsgType                = 35
+    TagNewSeqNo               = 36
+    TagOrderID                = 37
+    TagOrderQty               = 38
+    TagOrdStatus              = 39
+    TagOrdType                = 40
+    TagOrigClOrdID            = 41
+    TagPossDupFlag            = 43
+    TagPrice                  = 44
+    TagRefSeqNum              = 45
+    TagSenderCompID           = 49
+    TagSendingTime            = 52
+    TagSide                   = 54
+    TagSymbol                 = 55
+    TagTargetCompID           = 56
+    TagText                   = 58
+    TagTransactTime           = 60
+    TagEncryptMethod          = 98
+    TagCxlRejReason           = 102
+    TagHeartBtInt             = 108
+    TagTestReqID              = 112
+    TagOrigSendingTime        = 122
+    TagGapFillFlag            = 123
+    TagResetSeqNumFlag        = 141
+    TagExecType               = 150
+    TagLeavesQty              = 151
+    TagSessionRejectReason    = 373
+    TagCxlRejResponseTo       = 434
+    TagMassCancelRequestType  = 530
+    TagMassCancelResponse     = 531
+    TagMassCancelRejectReason = 532
+    TagTotalAffectedOrders    = 533
+    TagTrdMatchID             = 880
+)
+
+// Message types
+const (
+    MsgHeartbeat                 = "0"
+    MsgTestRequest               = "1"
+    MsgResendRequest             = "2"
+    MsgReject                    = "3"
+    MsgSequenceReset             = "4"
+    MsgLogout                    = "5"
+    MsgExecutionReport           = "8"
+    MsgOrderCancelReject         = "9"
+    MsgLogon                     = "A"
+    MsgNewOrderSingle            = "D"
+    MsgOrderCancelRequest        = "F"
+    MsgOrderCancelReplaceRequest = "G"
+    MsgOrderMassCancelRequest    = "q"
+    MsgOrderMassCancelReport     = "r"
+)
+
+var ErrGarbled = errors.New("garbled FIX message")
+
+type Field struct {
+    Tag   int
+    Value string
+}
+
+// Message holds every field after BodyLength and before CheckSum, in wire
+// order. Header fields are stored alongside body fields.
+type Message struct {
+    Fields []Field
+}
+
+func NewMessage(msgType string) *Message {
+    return &Message{Fields: []Field{{Tag: TagMsgType, Value: msgType}}}
+}
+
+func (m *Message) MsgType() string {
+    return m.Get(TagMsgType)
+}
+
+func (m *Message) Has(tag int) bool {
+    for _, f := range m.Fields {
+        if f.Tag == tag {
+            return true
+        }
+    }
+    return false
+}
+
+func (m *Message) Get(tag int) string {
+    for _, f := range m.Fields {
+        if f.Tag == tag {
+            return f.Value
+        }
+    }
+    return ""
+}
+
+func (m *Message) GetInt(tag int) (int, error) {
+    return strconv.Atoi(m.Get(tag))
+}
+
+func (m *Message) GetFloat(tag int) (float64, error) {
+    return strconv.ParseFloat(m.Get(tag), 64)
+}
+
+// Set replaces the first occurrence of tag or appends it
+func (m *Message) Set(tag int, value string) *Message {
+    for i := range m.Fields {
+        if m.Fields[i].Tag == tag {
+            m.Fields[i].Value = value
+            return m
+        }
+    }
+    m.Fields = append(m.Fields, Field{Tag: tag, Value: value})
+    return m
+}
+
+func (m *Message) SetInt(tag int, value int) *Message {
+    return m.Set(tag, strconv.Itoa(value))
+}
+
+func (m *Message) SetFloat(tag int, value float64) *Message {
+    return m.Set(tag, strconv.FormatFloat(value, 'f', -1, 64))
+}
+
+func (m *Message) SetTime(tag int, value time.Time) *Message {
+    return m.Set(tag, value.UTC().Format(timeFormat))
+}
+
+func (m *Message) Remove(tag int) {
+    for i := range m.Fields {
+        if m.Fields[i].Tag == tag {
+            m.Fields = append(m.Fields[:i], m.Fields[i+1:]...)
+            return
+        }
+    }
+}
+
+// Bytes encodes the message with BeginString, BodyLength and CheckSum
+func (m *Message) Bytes() []byte {
+    var body bytes.Buffer
+    for _, f := range m.Fields {
+        body.WriteString(strconv.Itoa(f.Tag))
+        body.WriteByte('=')
+        body.WriteString(f.Value)
+        body.WriteByte(soh)
+    }
+
+    var out bytes.Buffer
+    fmt.Fprintf(&out, "8=%s%c9=%d%c", BeginString, soh, body.Len(), soh)
+    out.Write(body.Bytes())
+    fmt.Fprintf(&out, "10=%03d%c", checksum(out.Bytes()), soh)
+    return out.Bytes()
+}
+
+// String renders the message with '|' separators for logging
+func (m *Message) String() string {
+    return string(bytes.ReplaceAll(m.Bytes(), []byte{soh}, []byte{'|'}))
+}
+
+func checksum(data []byte) int {
+    var sum int
+    for _, b := range data {
+        sum += int(b)
+    }
+    return sum % 256
+}
+
+// Parse decodes one complete FIX message, validating length and checksum
+func Parse(data []byte) (*Message, error) {
+    if len(data) < 7 || data[len(data)-1] != soh {
+        return nil, ErrGarbled
+    }
+
+    trailer := bytes.LastIndex(data[:len(data)-1], []byte{soh})
+    if trailer < 0 || !bytes.HasPrefix(data[trailer+1:], []byte("10=")) {
+        return nil, ErrGarbled
+    }
+    sum, err := strconv.Atoi(string(data[trailer+4 : len(data)-1]))
+    if err != nil || sum != checksum(data[:trailer+1]) {
+        return nil, ErrGarbled
+    }
+
+    msg := &Message{}
+    var bodyLength, bodyStart int
+    for pos, index := 0, 0; pos <= trailer; index++ {
+        end := bytes.IndexByte(data[pos:], soh)
+        if end < 0 {
+            return nil, ErrGarbled
+        }
+        field := data[pos : pos+end]
+        eq := bytes.IndexByte(field, '=')
+        if eq <= 0 {
+            return nil, ErrGarbled
+        }
+        tag, err := strconv.Atoi(string(field[:eq]))
+        if err != nil {
+            return nil, ErrGarbled
+        }
+        value := string(field[eq+1:])
+        pos += end + 1
+
+        switch {
+        case index == 0:
+            if tag != TagBeginString || value != BeginString {
+                return nil, ErrGarbled
+            }
+        case index == 1:
+            if tag != TagBodyLength {
+                return nil, ErrGarbled
+            }
+            if bodyLength, err = strconv.Atoi(value); err != nil {
+                return nil, ErrGarbled
+            }
+            bodyStart = pos
+        case tag == TagCheckSum:
+        default:
+            msg.Fields = append(msg.Fields, Field{Tag: tag, Value: value})
+        }
+    }
+
+    if trailer+1-bodyStart != bodyLength || msg.MsgType() == "" {
+        return nil, ErrGarbled
+    }
+    return msg, nil
+}
+
+// ReadMessage reads the next framed message from a stream
+func ReadMessage(r *bufio.Reader) ([]byte, error) {
+    header, err := r.ReadBytes(soh)
+    if err != nil {
+        return nil, err
+    }
+    if !bytes.Equal(header, []byte("8="+BeginString+"\x01")) {
+        return nil, ErrGarbled
+    }
+
+    lengthField, err := r.ReadBytes(soh)
+    if err != nil {
+        return nil, err
+    }
+    if !bytes.HasPrefix(lengthField, []byte("9=")) {
+        return nil, ErrGarbled
+    }
+    bodyLength, err := strconv.Atoi(string(lengthField[2 : len(lengthField)-1]))
+    if err != nil || bodyLength <= 0 || bodyLength > 1<<20 {
+        return nil, ErrGarbled
+    }
+
+    // Body plus the fixed-width "10=NNN<SOH>" trailer
+    rest := make([]byte, bodyLength+7)
+    if _, err := io.ReadFull(r, rest); err != nil {
+        return nil, err
+    }
+
+    data := make([]byte, 0, len(header)+len(lengthField)+len(rest))
+    data = append(data, header...)
+    data = append(data, lengthField...)
+    data = append(data, rest...)
+    return data, nil
+}
+
+func parseTime(value string) (time.Time, error) {
+    if t, err := time.Parse(timeFormat, value); err == nil {
+        return t, nil
+    }
+    return time.Parse("20060102-15:04:05", value)
+}
@@ -0,0 +1,467 @@
+package fix
+
+import (
+    "fmt"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    "go.uber.org/zap"
+
+    "high-frequency-matching-engine/engine"
+)
+
+// Session reject reasons (tag 373)
+const (
+    rejectRequiredTagMissing = 1
+    rejectInvalidMsgType     = 11
+)
+
+type orderState struct {
+    session     *Session
+    clOrdID     string
+    origClOrdID string
+    notional    float64
+    keys        []string // clOrdIDs entries for the order, removed with it
+}
+
+// OrderGateway maps FIX order entry messages onto the matching engine and
+// turns engine execution reports back into FIX ExecutionReports
+type OrderGateway struct {
+    engine   *engine.MatchingEngine
+    events   *engine.EventQueue
+    logger   *zap.Logger
+    sessions map[string]*Session    // session ID -> session
+    orders   map[string]*orderState // engine order ID -> open order state
+    clOrdIDs map[string]string      // session ID + ClOrdID -> engine order ID
+    execIDs  *idSource
+    orderSeq int64
+    mutex    sync.Mutex
+}
+
+// idSource generates IDs unique across restarts by prefixing a counter
+// with the process start time
+type idSource struct {
+    epoch int64
+    seq   int64
+}
+
+func newIDSource() *idSource {
+    return &idSource{epoch: time.Now().Unix()}
+}
+
+func (ids *idSource) next() string {
+    return fmt.Sprintf("E%d-%d", ids.epoch, atomic.AddInt64(&ids.seq, 1))
+}
+
+// NewOrderGateway must be created before orders reach the engine, as it
+// queues the engine's events from then on for Run
+func NewOrderGateway(matchingEngine *engine.MatchingEngine, logger *zap.Logger) *OrderGateway {
+    return &OrderGateway{
+        engine:   matchingEngine,
+        events:   matchingEngine.Subscribe(),
+        logger:   logger,
+        sessions: make(map[string]*Session),
+        orders:   make(map[string]*orderState),
+        clOrdIDs: make(map[string]string),
+        execIDs:  newIDSource(),
+    }
+}
+
+// Register routes execution reports to the session for the orders it
+// entered, and for its client's orders entered elsewhere, even while it is
+// logged out so they can be resent later
+func (og *OrderGateway) Register(s *Session) {
+    og.mutex.Lock()
+    defer og.mutex.Unlock()
+    og.sessions[s.ID()] = s
+}
+
+func clOrdIDKey(s *Session, clOrdID string) string {
+    return s.ID() + "|" + clOrdID
+}
+
+// addClOrdID maps a ClOrdID of the session's to an open order
+func (og *OrderGateway) addClOrdID(state *orderState, orderID, clOrdID string) {
+    key := clOrdIDKey(state.session, clOrdID)
+    og.clOrdIDs[key] = orderID
+    state.keys = append(state.keys, key)
+}
+
+// forget drops an order that is done, with every ClOrdID it went by
+func (og *OrderGateway) forget(orderID string, state *orderState) {
+    for _, key := range state.keys {
+        delete(og.clOrdIDs, key)
+    }
+    delete(og.orders, orderID)
+}
+
+func (og *OrderGateway) OnLogon(s *Session) {}
+
+func (og *OrderGateway) OnLogout(s *Session) {}
+
+func (og *OrderGateway) FromApp(s *Session, msg *Message) {
+    switch msg.MsgType() {
+    case MsgNewOrderSingle:
+        og.newOrder(s, msg)
+    case MsgOrderCancelRequest:
+        og.cancelOrder(s, msg)
+    case MsgOrderCancelReplaceRequest:
+        og.replaceOrder(s, msg)
+    case MsgOrderMassCancelRequest:
+        og.massCancel(s, msg)
+    default:
+        sessionReject(s, msg, rejectInvalidMsgType, "unsupported message type")
+    }
+}
+
+func sessionReject(s *Session, msg *Message, reason int, text string) {
+    s.Send(NewMessage(MsgReject).
+        Set(TagRefSeqNum, msg.Get(TagMsgSeqNum)).
+        SetInt(TagSessionRejectReason, reason).
+        Set(TagText, text))
+}
+
+func parseSide(value string) (engine.OrderSide, bool) {
+    switch value {
+    case "1":
+        return engine.BUY, true
+    case "2":
+        return engine.SELL, true
+    }
+    return 0, false
+}
+
+func parseOrdType(value string) (engine.OrderType, bool) {
+    switch value {
+    case "1":
+        return engine.MARKET, true
+    case "2":
+        return engine.LIMIT, true
+    }
+    return 0, false
+}
+
+func (og *OrderGateway) newOrder(s *Session, msg *Message) {
+    clOrdID := msg.Get(TagClOrdID)
+    symbol := msg.Get(TagSymbol)
+    if clOrdID == "" || symbol == "" {
+        sessionReject(s, msg, rejectRequiredTagMissing, "ClOrdID and Symbol are required")
+        return
+    }
+
+    side, validSide := parseSide(msg.Get(TagSide))
+    ordType, validType := parseOrdType(msg.Get(TagOrdType))
+    quantity, qtyErr := msg.GetFloat(TagOrderQty)
+    price, priceErr := msg.GetFloat(TagPrice)
+
+    var reason string
+    switch {
+    case !validSide:
+        reason = "unsupported Side"
+    case !validType:
+        reason = "unsupported OrdType"
+    case qtyErr != nil || quantity <= 0:
+        reason = "invalid OrderQty"
+    case ordType == engine.LIMIT && (priceErr != nil || price <= 0):
+        reason = "invalid Price"
+    }
+
+    og.mutex.Lock()
+    if _, duplicate := og.clOrdIDs[clOrdIDKey(s, clOrdID)]; duplicate && reason == "" {
+        reason = "duplicate ClOrdID"
+    }
+    og.mutex.Unlock()
+
+    if reason != "" {
+        s.Send(og.rejectReport(msg, reason))
+        return
+    }
+
+    order := &engine.Order{
+        ID:            fmt.Sprintf("FIX_%d_%d", time.Now().UnixNano(), atomic.AddInt64(&og.orderSeq, 1)),
+        Symbol:        symbol,
+        Side:          side,
+        Type:          ordType,
+        Quantity:      quantity,
+        Status:        engine.PENDING,
+        ClientID:      s.ClientID,
+        ClientOrderID: clOrdID,
+    }
+    if ordType == engine.LIMIT {
+        order.Price = price
+    }
+
+    // Register before submitting so the engine's reports find their ClOrdID
+    og.mutex.Lock()
+    state := &orderState{session: s, clOrdID: clOrdID}
+    og.orders[order.ID] = state
+    og.addClOrdID(state, order.ID, clOrdID)
+    og.mutex.Unlock()
+
+    og.engine.ProcessOrder(order)
+}
+
+// rejectReport builds an ExecutionReport rejecting a NewOrderSingle
+func (og *OrderGateway) rejectReport(msg *Message, text string) *Message {
+    report := NewMessage(MsgExecutionReport).
+        Set(TagOrderID, "NONE").
+        Set(TagClOrdID, msg.Get(TagClOrdID)).
+        Set(TagExecID, og.execIDs.next()).
+        Set(TagExecType, "8").
+        Set(TagOrdStatus, "8").
+        Set(TagSymbol, msg.Get(TagSymbol)).
+        Set(TagSide, msg.Get(TagSide)).
+        Set(TagLeavesQty, "0").
+        Set(TagCumQty, "0").
+        Set(TagAvgPx, "0").
+        SetTime(TagTransactTime, time.Now()).
+        Set(TagText, text)
+    if msg.Has(TagOrderQty) {
+        report.Set(TagOrderQty, msg.Get(TagOrderQty))
+    }
+    return report
+}
+
+// lookup resolves the order a cancel or replace refers to, by OrderID if
+// given and otherwise by OrigClOrdID
+func (og *OrderGateway) lookup(s *Session, msg *Message) (string, *orderState) {
+    og.mutex.Lock()
+    defer og.mutex.Unlock()
+
+    orderID := msg.Get(TagOrderID)
+    if orderID == "" {
+        orderID = og.clOrdIDs[clOrdIDKey(s, msg.Get(TagOrigClOrdID))]
+    }
+    state, exists := og.orders[orderID]
+    if !exists || state.session != s {
+        return "", nil
+    }
+    return orderID, state
+}
+
+// rename moves an order to the ClOrdID of a cancel or replace, returning
+// its state before for restore if the engine refuses the request
+func (og *OrderGateway) rename(state *orderState, orderID, clOrdID string) orderState {
+    previous := *state
+    previous.keys = state.keys[:len(state.keys):len(state.keys)]
+    state.origClOrdID = state.clOrdID
+    state.clOrdID = clOrdID
+    og.addClOrdID(state, orderID, clOrdID)
+    return previous
+}
+
+func (og *OrderGateway) restore(state *orderState, previous orderState) {
+    for _, key := range state.keys[len(previous.keys):] {
+        delete(og.clOrdIDs, key)
+    }
+    state.clOrdID, state.origClOrdID, state.keys = previous.clOrdID, previous.origClOrdID, previous.keys
+}
+
+func (og *OrderGateway) cancelOrder(s *Session, msg *Message) {
+    orderID, state := og.lookup(s, msg)
+    if state == nil {
+        og.cancelReject(s, msg, "1", "unknown order")
+        return
+    }
+
+    og.mutex.Lock()
+    previous := og.rename(state, orderID, msg.Get(TagClOrdID))
+    og.mutex.Unlock()
+
+    if !og.engine.CancelOrder(msg.Get(TagSymbol), orderID) {
+        og.mutex.Lock()
+        og.restore(state, previous)
+        og.mutex.Unlock()
+        og.cancelReject(s, msg, "1", "order not open")
+    }
+}
+
+func (og *OrderGateway) replaceOrder(s *Session, msg *Message) {
+    orderID, state := og.lookup(s, msg)
+    if state == nil {
+        og.cancelReject(s, msg, "2", "unknown order")
+        return
+    }
+
+    quantity, qtyErr := msg.GetFloat(TagOrderQty)
+    price, priceErr := msg.GetFloat(TagPrice)
+    if qtyErr != nil || priceErr != nil || quantity <= 0 || price <= 0 {
+        og.cancelReject(s, msg, "2", "invalid OrderQty or Price")
+        return
+    }
+
+    og.mutex.Lock()
+    previous := og.rename(state, orderID, msg.Get(TagClOrdID))
+    og.mutex.Unlock()
+
+    if _, _, err := og.engine.AmendOrder(msg.Get(TagSymbol), orderID, price, quantity); err != nil {
+        og.mutex.Lock()
+        og.restore(state, previous)
+        og.mutex.Unlock()
+        og.cancelReject(s, msg, "2", err.Error())
+    }
+}
+
+// cancelReject answers a failed cancel (responseTo "1") or cancel/replace
+// (responseTo "2") with an OrderCancelReject
+func (og *OrderGateway) cancelReject(s *Session, msg *Message, responseTo, text string) {
+    orderID := msg.Get(TagOrderID)
+    if orderID == "" {
+        orderID = "NONE"
+    }
+    s.Send(NewMessage(MsgOrderCancelReject).
+        Set(TagOrderID, orderID).
+        Set(TagClOrdID, msg.Get(TagClOrdID)).
+        Set(TagOrigClOrdID, msg.Get(TagOrigClOrdID)).
+        Set(TagOrdStatus, "8").
+        Set(TagCxlRejResponseTo, responseTo).
+        SetInt(TagCxlRejReason, 1).
+        Set(TagText, text))
+}
+
+func (og *OrderGateway) massCancel(s *Session, msg *Message) {
+    requestType := msg.Get(TagMassCancelRequestType)
+    symbol := ""
+    switch requestType {
+    case "1":
+        symbol = msg.Get(TagSymbol)
+        if symbol == "" {
+            sessionReject(s, msg, rejectRequiredTagMissing, "Symbol required for MassCancelRequestType 1")
+            return
+        }
+    case "7":
+    default:
+        s.Send(NewMessage(MsgOrderMassCancelReport).
+            Set(TagClOrdID, msg.Get(TagClOrdID)).
+            Set(TagOrderID, "NONE").
+            Set(TagMassCancelRequestType, requestType).
+            Set(TagMassCancelResponse, "0").
+            Set(TagMassCancelRejectReason, "1"))
+        return
+    }
+
+    cancelled := og.engine.CancelClientOrders(s.ClientID, symbol)
+    report := NewMessage(MsgOrderMassCancelReport).
+        Set(TagClOrdID, msg.Get(TagClOrdID)).
+        Set(TagOrderID, og.execIDs.next()).
+        Set(TagMassCancelRequestType, requestType).
+        Set(TagMassCancelResponse, requestType).
+        SetInt(TagTotalAffectedOrders, cancelled)
+    if symbol != "" {
+        report.Set(TagSymbol, symbol)
+    }
+    s.Send(report)
+}
+
+var execTypes = map[engine.ExecType]string{
+    engine.EXEC_NEW:       "0",
+    engine.EXEC_TRADE:     "F",
+    engine.EXEC_CANCELLED: "4",
+    engine.EXEC_REPLACED:  "5",
+}
+
+var ordStatuses = map[engine.OrderStatus]string{
+    engine.PENDING:   "0",
+    engine.PARTIAL:   "1",
+    engine.FILLED:    "2",
+    engine.CANCELLED: "4",
+}
+
+// Run sends ExecutionReports for every engine event, in order, until done
+// is closed
+func (og *OrderGateway) Run(done <-chan struct{}) {
+    og.events.Run(done, func(event engine.BookEvent) {
+        for _, report := range event.Reports {
+            og.onExecution(report)
+        }
+    })
+}
+
+// onExecution sends an ExecutionReport for an engine event to the session
+// that entered the order, or for orders entered elsewhere to every session
+// of the order's client
+func (og *OrderGateway) onExecution(report *engine.ExecutionReport) {
+    og.mutex.Lock()
+    var sessions []*Session
+    clOrdID := report.Order.ClientOrderID
+    origClOrdID := ""
+    avgPx := 0.0
+    if state, tracked := og.orders[report.Order.ID]; tracked {
+        sessions = []*Session{state.session}
+        clOrdID = state.clOrdID
+        if report.Type == engine.EXEC_CANCELLED || report.Type == engine.EXEC_REPLACED {
+            origClOrdID = state.origClOrdID
+        }
+        if report.Type == engine.EXEC_TRADE {
+            state.notional += report.LastPrice * report.LastQty
+        }
+        if report.Order.Filled > 0 {
+            avgPx = state.notional / report.Order.Filled
+        }
+        if report.Order.Status == engine.FILLED || report.Order.Status == engine.CANCELLED {
+            og.forget(report.Order.ID, state)
+        }
+    } else {
+        for _, s := range og.sessions {
+            if s.ClientID == report.Order.ClientID {
+                sessions = append(sessions, s)
+            }
+        }
+    }
+    og.mutex.Unlock()
+
+    if clOrdID == "" {
+        clOrdID = report.Order.ID
+    }
+
+    for _, s := range sessions {
+        if err := s.Send(BuildExecutionReport(report, og.execIDs.next(), clOrdID, origClOrdID, avgPx)); err != nil {
+            og.logger.Error("Failed to send FIX execution report", zap.String("order_id", report.Order.ID), zap.Error(err))
+        }
+    }
+}
+
+// BuildExecutionReport renders an engine execution report as FIX
+func BuildExecutionReport(report *engine.ExecutionReport, execID, clOrdID, origClOrdID string, avgPx float64) *Message {
+    order := &report.Order
+
+    side := "1"
+    if order.Side == engine.SELL {
+        side = "2"
+    }
+    ordType := "2"
+    if order.Type == engine.MARKET {
+        ordType = "1"
+    }
+    leaves := order.Quantity - order.Filled
+    if order.Status == engine.FILLED || order.Status == engine.CANCELLED {
+        leaves = 0
+    }
+
+    msg := NewMessage(MsgExecutionReport).
+        Set(TagOrderID, order.ID).
+        Set(TagClOrdID, clOrdID).
+        Set(TagExecID, execID).
+        Set(TagExecType, execTypes[report.Type]).
+        Set(TagOrdStatus, ordStatuses[order.Status]).
+        Set(TagSymbol, order.Symbol).
+        Set(TagSide, side).
+        Set(TagOrdType, ordType).
+        SetFloat(TagOrderQty, order.Quantity).
+        SetFloat(TagCumQty, order.Filled).
+        SetFloat(TagLeavesQty, leaves).
+        SetFloat(TagAvgPx, avgPx).
+        SetTime(TagTransactTime, report.Timestamp)
+    if origClOrdID != "" {
+        msg.Set(TagOrigClOrdID, origClOrdID)
+    }
+    if order.Type == engine.LIMIT {
+        msg.SetFloat(TagPrice, order.Price)
+    }
+    if report.Type == engine.EXEC_TRADE {
+        msg.SetFloat(TagLastPx, report.LastPrice)
+        msg.SetFloat(TagLastQty, report.LastQty)
+    }
+    return msg
+}
@@ -0,0 +1,514 @@
+package fix
+
+import (
+    "bufio"
+    "errors"
+    "fmt"
+    "net"
+    "strconv"
+    "sync"
+    "time"
+
+    "go.uber.org/zap"
+)
+
+const (
+    logonTimeout = 10 * time.Second
+    writeTimeout = 5 * time.Second
+)
+
+var ErrNotLoggedOn = errors.New("FIX session not logged on")
+
+// Application receives session events and inbound application messages
+type Application interface {
+    OnLogon(s *Session)
+    OnLogout(s *Session)
+    FromApp(s *Session, msg *Message)
+}
+
+type SessionConfig struct {
+    SenderCompID string
+    TargetCompID string
+    ClientID     string
+}
+
+// Session implements the FIX session layer for one counterparty: logon,
+// heartbeats and test requests, sequence number checks, resend requests
+// and gap fills. Outgoing application messages are persisted so they can
+// be resent, including those generated while the counterparty is offline.
+type Session struct {
+    SenderCompID string
+    TargetCompID string
+    ClientID     string
+
+    store      *MessageStore
+    app        Application
+    logger     *zap.Logger
+    heartBtInt time.Duration
+
+    conn            net.Conn
+    loggedOn        bool
+    logoutSent      bool
+    lastSent        time.Time
+    lastReceived    time.Time
+    testRequestSent bool
+    mutex           sync.Mutex
+
+    // Reader goroutine state
+    pending         map[int]*Message
+    resendRequested bool
+
+    loggedOnChan chan struct{}
+}
+
+func NewSession(cfg SessionConfig, store *MessageStore, app Application, logger *zap.Logger) *Session {
+    return &Session{
+        SenderCompID: cfg.SenderCompID,
+        TargetCompID: cfg.TargetCompID,
+        ClientID:     cfg.ClientID,
+        store:        store,
+        app:          app,
+        logger:       logger.With(zap.String("fix_session", cfg.SenderCompID+"->"+cfg.TargetCompID)),
+        heartBtInt:   30 * time.Second,
+    }
+}
+
+func (s *Session) ID() string {
+    return s.SenderCompID + "-" + s.TargetCompID
+}
+
+func (s *Session) IsLoggedOn() bool {
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+    return s.loggedOn
+}
+
+func isAdmin(msgType string) bool {
+    switch msgType {
+    case MsgHeartbeat, MsgTestRequest, MsgResendRequest, MsgReject, MsgSequenceReset, MsgLogout, MsgLogon:
+        return true
+    }
+    return false
+}
+
+// Send sequences, persists and transmits a message. Application messages
+// sent while the counterparty is disconnected are stored and delivered by
+// resend after the next logon.
+func (s *Session) Send(msg *Message) error {
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+    return s.sendLocked(msg)
+}
+
+func (s *Session) sendLocked(msg *Message) error {
+    msgType := msg.MsgType()
+    if isAdmin(msgType) && s.conn == nil {
+        return ErrNotLoggedOn
+    }
+
+    seq := s.store.NextSenderSeqNum()
+    now := time.Now()
+    s.setHeader(msg, seq, now)
+    data := msg.Bytes()
+
+    if !isAdmin(msgType) {
+        if err := s.store.Save(seq, data); err != nil {
+            return err
+        }
+    }
+    if err := s.store.SetNextSenderSeqNum(seq + 1); err != nil {
+        return err
+    }
+
+    if s.conn == nil || (!s.loggedOn && msgType != MsgLogon && msgType != MsgLogout) {
+        return nil
+    }
+    return s.writeLocked(data, now)
+}
+
+func (s *Session) writeLocked(data []byte, now time.Time) error {
+    s.conn.SetWriteDeadline(now.Add(writeTimeout))
+    if _, err := s.conn.Write(data); err != nil {
+        return err
+    }
+    s.lastSent = now
+    return nil
+}
+
+// setHeader places the standard header fields right after MsgType
+func (s *Session) setHeader(msg *Message, seq int, now time.Time) {
+    header := []Field{
+        {Tag: TagMsgType, Value: msg.MsgType()},
+        {Tag: TagSenderCompID, Value: s.SenderCompID},
+        {Tag: TagTargetCompID, Value: s.TargetCompID},
+        {Tag: TagMsgSeqNum, Value: strconv.Itoa(seq)},
+        {Tag: TagSendingTime, Value: now.UTC().Format(timeFormat)},
+    }
+    for _, tag := range []int{TagPossDupFlag, TagOrigSendingTime} {
+        if msg.Has(tag) {
+            header = append(header, Field{Tag: tag, Value: msg.Get(tag)})
+        }
+    }
+
+    fields := header
+    for _, f := range msg.Fields {
+        switch f.Tag {
+        case TagMsgType, TagSenderCompID, TagTargetCompID, TagMsgSeqNum, TagSendingTime, TagPossDupFlag, TagOrigSendingTime:
+            continue
+        }
+        fields = append(fields, f)
+    }
+    msg.Fields = fields
+}
+
+// attach binds a connection to the session; only one may be active
+func (s *Session) attach(conn net.Conn) error {
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+
+    if s.conn != nil {
+        return fmt.Errorf("session %s already connected", s.ID())
+    }
+    s.conn = conn
+    s.loggedOn = false
+    s.logoutSent = false
+    s.testRequestSent = false
+    s.lastReceived = time.Now()
+    s.lastSent = time.Now()
+    s.pending = make(map[int]*Message)
+    s.resendRequested = false
+    return nil
+}
+
+func (s *Session) disconnect(reason string) {
+    s.mutex.Lock()
+    conn := s.conn
+    wasLoggedOn := s.loggedOn
+    s.conn = nil
+    s.loggedOn = false
+    s.mutex.Unlock()
+
+    if conn == nil {
+        return
+    }
+    conn.Close()
+    s.logger.Info("FIX session disconnected", zap.String("reason", reason))
+    if wasLoggedOn {
+        s.app.OnLogout(s)
+    }
+}
+
+// Logout starts a graceful logout; the session disconnects when the
+// counterparty confirms or the connection drops
+func (s *Session) Logout(text string) error {
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+
+    if s.conn == nil {
+        return ErrNotLoggedOn
+    }
+    s.logoutSent = true
+    msg := NewMessage(MsgLogout)
+    if text != "" {
+        msg.Set(TagText, text)
+    }
+    return s.sendLocked(msg)
+}
+
+// run reads messages from the attached connection until it closes
+func (s *Session) run(conn net.Conn, reader *bufio.Reader, first *Message) {
+    done := make(chan struct{})
+    defer close(done)
+    go s.heartbeatLoop(done)
+
+    if first != nil {
+        s.process(first)
+    }
+
+    for {
+        data, err := ReadMessage(reader)
+        if err != nil {
+            if err == ErrGarbled {
+                s.logger.Warn("Dropping garbled FIX message")
+                continue
+            }
+            s.disconnect(err.Error())
+            return
+        }
+
+        msg, err := Parse(data)
+        if err != nil {
+            s.logger.Warn("Dropping garbled FIX message")
+            continue
+        }
+        s.process(msg)
+
+        s.mutex.Lock()
+        closed := s.conn != conn
+        s.mutex.Unlock()
+        if closed {
+            return
+        }
+    }
+}
+
+func (s *Session) heartbeatLoop(done <-chan struct{}) {
+    ticker := time.NewTicker(time.Second)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-done:
+            return
+        case now := <-ticker.C:
+            s.mutex.Lock()
+            if s.conn == nil {
+                s.mutex.Unlock()
+                return
+            }
+            if !s.loggedOn {
+                timedOut := now.Sub(s.lastReceived) > logonTimeout
+                s.mutex.Unlock()
+                if timedOut {
+                    s.disconnect("logon timeout")
+                }
+                continue
+            }
+
+            silence := now.Sub(s.lastReceived)
+            switch {
+            case silence > s.heartBtInt*12/5:
+                s.mutex.Unlock()
+                s.disconnect("heartbeat timeout")
+                continue
+            case silence > s.heartBtInt*6/5 && !s.testRequestSent:
+                s.testRequestSent = true
+                s.sendLocked(NewMessage(MsgTestRequest).Set(TagTestReqID, strconv.FormatInt(now.UnixNano(), 10)))
+            case now.Sub(s.lastSent) >= s.heartBtInt:
+                s.sendLocked(NewMessage(MsgHeartbeat))
+            }
+            s.mutex.Unlock()
+        }
+    }
+}
+
+// process applies the session rules to one inbound message
+func (s *Session) process(msg *Message) {
+    s.mutex.Lock()
+    s.lastReceived = time.Now()
+    s.testRequestSent = false
+    loggedOn := s.loggedOn
+    s.mutex.Unlock()
+
+    if msg.Get(TagSenderCompID) != s.TargetCompID || msg.Get(TagTargetCompID) != s.SenderCompID {
+        s.Logout("CompID problem")
+        s.disconnect("CompID mismatch")
+        return
+    }
+
+    seq, err := msg.GetInt(TagMsgSeqNum)
+    if err != nil {
+        s.Logout("MsgSeqNum missing")
+        s.disconnect("MsgSeqNum missing")
+        return
+    }
+
+    msgType := msg.MsgType()
+    if !loggedOn {
+        if msgType != MsgLogon {
+            s.disconnect("first message was not Logon")
+            return
+        }
+        if !s.handleLogon(msg) {
+            return
+        }
+    }
+
+    // A SequenceReset in reset mode bypasses sequence checks entirely
+    if msgType == MsgSequenceReset && msg.Get(TagGapFillFlag) != "Y" {
+        if newSeq, err := msg.GetInt(TagNewSeqNo); err == nil {
+            s.store.SetNextTargetSeqNum(newSeq)
+        }
+        return
+    }
+
+    expected := s.store.NextTargetSeqNum()
+    switch {
+    case seq > expected:
+        if msgType == MsgLogout {
+            s.handle(msg)
+            return
+        }
+        if msgType != MsgLogon {
+            s.pending[seq] = msg
+        }
+        if !s.resendRequested {
+            s.resendRequested = true
+            s.Send(NewMessage(MsgResendRequest).SetInt(TagBeginSeqNo, expected).SetInt(TagEndSeqNo, 0))
+        }
+        return
+    case seq < expected:
+        if msg.Get(TagPossDupFlag) == "Y" {
+            return
+        }
+        text := fmt.Sprintf("MsgSeqNum too low, expecting %d but received %d", expected, seq)
+        s.Logout(text)
+        s.disconnect(text)
+        return
+    }
+
+    s.handle(msg)
+
+    // Replay anything that arrived ahead of a gap now being filled
+    for {
+        next, exists := s.pending[s.store.NextTargetSeqNum()]
+        if !exists {
+            break
+        }
+        delete(s.pending, s.store.NextTargetSeqNum())
+        s.handle(next)
+    }
+    if len(s.pending) == 0 {
+        s.resendRequested = false
+    }
+}
+
+// handleLogon authenticates the counterparty's Logon and answers it.
+// It reports whether the session is now logged on.
+func (s *Session) handleLogon(msg *Message) bool {
+    s.mutex.Lock()
+    if hb, err := msg.GetInt(TagHeartBtInt); err == nil && hb > 0 {
+        s.heartBtInt = time.Duration(hb) * time.Second
+    }
+    heartBtInt := s.heartBtInt
+    initiatedLogon := s.loggedOnChan != nil
+    s.mutex.Unlock()
+
+    if msg.Get(TagResetSeqNumFlag) == "Y" && !initiatedLogon {
+        if err := s.store.Reset(); err != nil {
+            s.logger.Error("Failed to reset FIX message store", zap.Error(err))
+        }
+    }
+
+    if !initiatedLogon {
+        response := NewMessage(MsgLogon).SetInt(TagEncryptMethod, 0).SetInt(TagHeartBtInt, int(heartBtInt/time.Second))
+        if msg.Get(TagResetSeqNumFlag) == "Y" {
+            response.Set(TagResetSeqNumFlag, "Y")
+        }
+        if err := s.Send(response); err != nil {
+            s.disconnect(err.Error())
+            return false
+        }
+    }
+
+    s.mutex.Lock()
+    s.loggedOn = true
+    if s.loggedOnChan != nil {
+        close(s.loggedOnChan)
+        s.loggedOnChan = nil
+    }
+    s.mutex.Unlock()
+
+    s.logger.Info("FIX session logged on")
+    s.app.OnLogon(s)
+    return true
+}
+
+// handle processes an in-sequence message and advances the expected
+// inbound sequence number
+func (s *Session) handle(msg *Message) {
+    seq, _ := msg.GetInt(TagMsgSeqNum)
+    next := seq + 1
+
+    switch msg.MsgType() {
+    case MsgLogon, MsgHeartbeat, MsgReject:
+    case MsgTestRequest:
+        s.Send(NewMessage(MsgHeartbeat).Set(TagTestReqID, msg.Get(TagTestReqID)))
+    case MsgResendRequest:
+        begin, _ := msg.GetInt(TagBeginSeqNo)
+        end, _ := msg.GetInt(TagEndSeqNo)
+        if err := s.resend(begin, end); err != nil {
+            s.logger.Error("FIX resend failed", zap.Error(err))
+        }
+    case MsgSequenceReset:
+        if newSeq, err := msg.GetInt(TagNewSeqNo); err == nil && newSeq > next {
+            next = newSeq
+        }
+    case MsgLogout:
+        s.mutex.Lock()
+        logoutSent := s.logoutSent
+        s.mutex.Unlock()
+        s.store.SetNextTargetSeqNum(next)
+        if !logoutSent {
+            s.Send(NewMessage(MsgLogout))
+        }
+        s.disconnect("logout")
+        return
+    default:
+        s.app.FromApp(s, msg)
+    }
+
+    s.store.SetNextTargetSeqNum(next)
+}
+
+// resend retransmits stored application messages in [begin, end] with
+// PossDupFlag set and replaces everything else with gap fills
+func (s *Session) resend(begin, end int) error {
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+
+    if s.conn == nil {
+        return ErrNotLoggedOn
+    }
+
+    last := s.store.NextSenderSeqNum() - 1
+    if end == 0 || end > last {
+        end = last
+    }
+    if begin < 1 {
+        begin = 1
+    }
+
+    stored, err := s.store.Get(begin, end)
+    if err != nil {
+        return err
+    }
+
+    gapStart := 0
+    flushGap := func(newSeq int) error {
+        if gapStart == 0 {
+            return nil
+        }
+        gap := NewMessage(MsgSequenceReset).Set(TagPossDupFlag, "Y").Set(TagGapFillFlag, "Y").SetInt(TagNewSeqNo, newSeq)
+        now := time.Now()
+        s.setHeader(gap, gapStart, now)
+        gapStart = 0
+        return s.writeLocked(gap.Bytes(), now)
+    }
+
+    for seq := begin; seq <= end; seq++ {
+        data, exists := stored[seq]
+        if !exists {
+            if gapStart == 0 {
+                gapStart = seq
+            }
+            continue
+        }
+        if err := flushGap(seq); err != nil {
+            return err
+        }
+
+        msg, err := Parse(data)
+        if err != nil {
+            return err
+        }
+        now := time.Now()
+        msg.Set(TagPossDupFlag, "Y")
+        msg.Set(TagOrigSendingTime, msg.Get(TagSendingTime))
+        s.setHeader(msg, seq, now)
+        if err := s.writeLocked(msg.Bytes(), now); err != nil {
+            return err
+        }
+    }
+    return flushGap(end + 1)
+}
@@ -0,0 +1,273 @@
+package fix
+
+import (
+    "bufio"
+    "encoding/binary"
+    "io"
+    "os"
+    "path/filepath"
+    "sort"
+    "sync"
+)
+
+const (
+    seqNumsRecordSize = 16
+    compactMinBytes   = 64 * 1024
+)
+
+// MessageStore persists a session's outgoing application messages and its
+// sequence numbers so that resend requests can be served after a restart.
+// Both go in one append-only log; sequence numbers are records under seq 0,
+// which FIX never uses, and the last one read on open wins. Once superseded
+// sequence number records outweigh the rest, the log is rewritten without
+// them.
+type MessageStore struct {
+    path     string
+    messages *os.File
+    size     int64
+    stale    int64 // bytes of superseded sequence number records
+    offsets  map[int]int64
+    nextOut  int
+    nextIn   int
+    mutex    sync.Mutex
+}
+
+func OpenMessageStore(dir, sessionID string) (*MessageStore, error) {
+    if err := os.MkdirAll(dir, 0755); err != nil {
+        return nil, err
+    }
+
+    path := filepath.Join(dir, sessionID+".messages")
+    messages, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+    if err != nil {
+        return nil, err
+    }
+
+    ms := &MessageStore{
+        path:     path,
+        messages: messages,
+        offsets:  make(map[int]int64),
+        nextOut:  1,
+        nextIn:   1,
+    }
+
+    // Records are an 8-byte header (seq, length) followed by the raw message,
+    // or for seq 0 the next sender and target sequence numbers
+    reader := bufio.NewReader(io.NewSectionReader(messages, 0, 1<<62))
+    header := make([]byte, 8)
+    seqNums := make([]byte, 8)
+    for {
+        if _, err := io.ReadFull(reader, header); err != nil {
+            break
+        }
+        seq := int(binary.BigEndian.Uint32(header[0:4]))
+        length := int64(binary.BigEndian.Uint32(header[4:8]))
+        if seq == 0 && length == 8 {
+            if _, err := io.ReadFull(reader, seqNums); err != nil {
+                break
+            }
+            ms.nextOut = int(binary.BigEndian.Uint32(seqNums[0:4]))
+            ms.nextIn = int(binary.BigEndian.Uint32(seqNums[4:8]))
+            ms.stale += seqNumsRecordSize
+        } else {
+            if _, err := reader.Discard(int(length)); err != nil {
+                break
+            }
+            ms.offsets[seq] = ms.size
+        }
+        ms.size += 8 + length
+    }
+    if err := messages.Truncate(ms.size); err != nil {
+        messages.Close()
+        return nil, err
+    }
+    return ms, nil
+}
+
+func (ms *MessageStore) NextSenderSeqNum() int {
+    ms.mutex.Lock()
+    defer ms.mutex.Unlock()
+    return ms.nextOut
+}
+
+func (ms *MessageStore) NextTargetSeqNum() int {
+    ms.mutex.Lock()
+    defer ms.mutex.Unlock()
+    return ms.nextIn
+}
+
+func (ms *MessageStore) SetNextSenderSeqNum(seq int) error {
+    ms.mutex.Lock()
+    defer ms.mutex.Unlock()
+    if seq == ms.nextOut {
+        return nil
+    }
+    ms.nextOut = seq
+    return ms.appendSeqNumsRecord()
+}
+
+func (ms *MessageStore) SetNextTargetSeqNum(seq int) error {
+    ms.mutex.Lock()
+    defer ms.mutex.Unlock()
+    if seq == ms.nextIn {
+        return nil
+    }
+    ms.nextIn = seq
+    return ms.appendSeqNumsRecord()
+}
+
+// Save stores an outgoing message under its sequence number and moves the
+// next sender sequence number past it, in a single write
+func (ms *MessageStore) Save(seq int, data []byte) error {
+    ms.mutex.Lock()
+    defer ms.mutex.Unlock()
+
+    record := make([]byte, 8+len(data), 8+len(data)+16)
+    binary.BigEndian.PutUint32(record[0:4], uint32(seq))
+    binary.BigEndian.PutUint32(record[4:8], uint32(len(data)))
+    copy(record[8:], data)
+
+    offset := ms.size
+    if seq >= ms.nextOut {
+        ms.nextOut = seq + 1
+        record = ms.appendSeqNums(record)
+        ms.stale += seqNumsRecordSize
+    }
+    if err := ms.append(record); err != nil {
+        return err
+    }
+    ms.offsets[seq] = offset
+    return nil
+}
+
+// appendSeqNumsRecord logs the current sequence numbers on their own,
+// compacting the log when enough earlier records have piled up
+func (ms *MessageStore) appendSeqNumsRecord() error {
+    if err := ms.append(ms.appendSeqNums(nil)); err != nil {
+        return err
+    }
+    ms.stale += seqNumsRecordSize
+    if ms.stale < compactMinBytes || ms.stale < ms.size-ms.stale {
+        return nil
+    }
+    return ms.compact()
+}
+
+// appendSeqNums appends a record of the current sequence numbers to buf
+func (ms *MessageStore) appendSeqNums(buf []byte) []byte {
+    buf = binary.BigEndian.AppendUint32(buf, 0)
+    buf = binary.BigEndian.AppendUint32(buf, 8)
+    buf = binary.BigEndian.AppendUint32(buf, uint32(ms.nextOut))
+    return binary.BigEndian.AppendUint32(buf, uint32(ms.nextIn))
+}
+
+func (ms *MessageStore) append(records []byte) error {
+    if _, err := ms.messages.Write(records); err != nil {
+        return err
+    }
+    ms.size += int64(len(records))
+    return nil
+}
+
+// Get returns the stored messages with sequence numbers in [begin, end],
+// keyed by sequence number. Gaps are admin messages that were not stored.
+func (ms *MessageStore) Get(begin, end int) (map[int][]byte, error) {
+    ms.mutex.Lock()
+    defer ms.mutex.Unlock()
+
+    result := make(map[int][]byte)
+    for seq := begin; seq <= end; seq++ {
+        offset, exists := ms.offsets[seq]
+        if !exists {
+            continue
+        }
+
+        header := make([]byte, 8)
+        if _, err := ms.messages.ReadAt(header, offset); err != nil {
+            return nil, err
+        }
+        data := make([]byte, binary.BigEndian.Uint32(header[4:8]))
+        if _, err := ms.messages.ReadAt(data, offset+8); err != nil {
+            return nil, err
+        }
+        result[seq] = data
+    }
+    return result, nil
+}
+
+// Reset clears stored messages and restarts both sequences at 1
+func (ms *MessageStore) Reset() error {
+    ms.mutex.Lock()
+    defer ms.mutex.Unlock()
+
+    if err := ms.messages.Truncate(0); err != nil {
+        return err
+    }
+    ms.size = 0
+    ms.stale = 0
+    ms.offsets = make(map[int]int64)
+    ms.nextOut = 1
+    ms.nextIn = 1
+    return ms.append(ms.appendSeqNums(nil))
+}
+
+// compact rewrites the log with its messages and one record of the current
+// sequence numbers, and swaps it in for the old one
+func (ms *MessageStore) compact() error {
+    tmpPath := ms.path + ".tmp"
+    tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_RDWR|os.O_APPEND, 0644)
+    if err != nil {
+        return err
+    }
+    fail := func(err error) error {
+        tmp.Close()
+        os.Remove(tmpPath)
+        return err
+    }
+
+    seqs := make([]int, 0, len(ms.offsets))
+    for seq := range ms.offsets {
+        seqs = append(seqs, seq)
+    }
+    sort.Ints(seqs)
+
+    writer := bufio.NewWriterSize(tmp, 64*1024)
+    offsets := make(map[int]int64, len(seqs))
+    var size int64
+    header := make([]byte, 8)
+    for _, seq := range seqs {
+        if _, err := ms.messages.ReadAt(header, ms.offsets[seq]); err != nil {
+            return fail(err)
+        }
+        length := 8 + int64(binary.BigEndian.Uint32(header[4:8]))
+        if _, err := io.Copy(writer, io.NewSectionReader(ms.messages, ms.offsets[seq], length)); err != nil {
+            return fail(err)
+        }
+        offsets[seq] = size
+        size += length
+    }
+    if _, err := writer.Write(ms.appendSeqNums(nil)); err != nil {
+        return fail(err)
+    }
+    size += seqNumsRecordSize
+    if err := writer.Flush(); err != nil {
+        return fail(err)
+    }
+    if err := tmp.Sync(); err != nil {
+        return fail(err)
+    }
+    if err := os.Rename(tmpPath, ms.path); err != nil {
+        return fail(err)
+    }
+
+    ms.messages.Close()
+    ms.messages = tmp
+    ms.offsets = offsets
+    ms.size = size
+    ms.stale = 0
+    return nil
+}
+
+func (ms *MessageStore) Close() error {
+    return ms.messages.Close()
+}
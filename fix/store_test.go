@@ -0,0 +1,86 @@
+package fix
+
+import (
+    "fmt"
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+func TestMessageStoreReopen(t *testing.T) {
+    dir := t.TempDir()
+    store, err := OpenMessageStore(dir, "S-T")
+    if err != nil {
+        t.Fatal(err)
+    }
+    for seq := 1; seq <= 3; seq++ {
+        if err := store.Save(seq, []byte(fmt.Sprintf("msg %d", seq))); err != nil {
+            t.Fatal(err)
+        }
+    }
+    store.SetNextSenderSeqNum(5) // a heartbeat took seq 4
+    store.SetNextTargetSeqNum(7)
+    store.Close()
+
+    store, err = OpenMessageStore(dir, "S-T")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer store.Close()
+    if store.NextSenderSeqNum() != 5 || store.NextTargetSeqNum() != 7 {
+        t.Errorf("reopened at %d/%d, want 5/7", store.NextSenderSeqNum(), store.NextTargetSeqNum())
+    }
+    messages, err := store.Get(1, 5)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(messages) != 3 || string(messages[2]) != "msg 2" {
+        t.Errorf("got messages %q", messages)
+    }
+}
+
+// Sequence numbers moved on by heartbeats and inbound messages alone must
+// not grow the log without bound
+func TestMessageStoreCompacts(t *testing.T) {
+    dir := t.TempDir()
+    store, err := OpenMessageStore(dir, "S-T")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := store.Save(1, []byte("first")); err != nil {
+        t.Fatal(err)
+    }
+    for seq := 2; seq <= 100000; seq++ {
+        if err := store.SetNextTargetSeqNum(seq); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if err := store.Save(2, []byte("second")); err != nil {
+        t.Fatal(err)
+    }
+    store.Close()
+
+    info, err := os.Stat(filepath.Join(dir, "S-T.messages"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if info.Size() > 2*compactMinBytes {
+        t.Errorf("log is %d bytes after 100000 sequence number updates", info.Size())
+    }
+
+    store, err = OpenMessageStore(dir, "S-T")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer store.Close()
+    if store.NextSenderSeqNum() != 3 || store.NextTargetSeqNum() != 100000 {
+        t.Errorf("reopened at %d/%d, want 3/100000", store.NextSenderSeqNum(), store.NextTargetSeqNum())
+    }
+    messages, err := store.Get(1, 2)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if string(messages[1]) != "first" || string(messages[2]) != "second" {
+        t.Errorf("got messages %q after compacting", messages)
+    }
+}
@@ -0,0 +1,107 @@
+package gateway
+
+import (
+    "bufio"
+    "bytes"
+    "fmt"
+    "testing"
+    "time"
+
+    "go.uber.org/zap"
+
+    "high-frequency-matching-engine/engine"
+)
+
+const benchSymbol = "BENCH"
+
+// benchSide alternates buys and sells at one price, so each pair matches
+// and the book stays empty
+func benchSide(i int) engine.OrderSide {
+    if i%2 == 0 {
+        return engine.BUY
+    }
+    return engine.SELL
+}
+
+// startServer runs a gateway on :0 in front of its own engine and returns
+// a client logged in to it
+func startServer(tb testing.TB) (*engine.MatchingEngine, *Client) {
+    tb.Helper()
+    matchingEngine := engine.NewMatchingEngine()
+    server := NewServer(matchingEngine, map[string]string{"bench-key": "bench"}, zap.NewNop())
+    if err := server.Listen("127.0.0.1:0"); err != nil {
+        tb.Fatal(err)
+    }
+    tb.Cleanup(func() { server.Close() })
+
+    client, err := Dial(server.Addr().String(), "bench-key", 5*time.Second)
+    if err != nil {
+        tb.Fatal(err)
+    }
+    tb.Cleanup(func() { client.Close() })
+    return matchingEngine, client
+}
+
+// awaitAccepted waits for the response to an EnterOrder, skipping fills
+func awaitAccepted(tb testing.TB, client *Client, token string) Accepted {
+    tb.Helper()
+    for {
+        select {
+        case msg, ok := <-client.Responses():
+            if !ok {
+                tb.Fatalf("connection closed: %v", client.Err())
+            }
+            switch m := msg.(type) {
+            case Accepted:
+                if m.Token == token {
+                    return m
+                }
+            case Rejected:
+                if m.Token == token {
+                    tb.Fatalf("order %s rejected: %c", token, m.Reason)
+                }
+            }
+        case <-time.After(5 * time.Second):
+            tb.Fatalf("no response to order %s", token)
+        }
+    }
+}
+
+// BenchmarkGatewayRoundTrip times EnterOrder to Accepted over TCP; its REST
+// counterpart is BenchmarkRESTRoundTrip in cmd
+func BenchmarkGatewayRoundTrip(b *testing.B) {
+    _, client := startServer(b)
+
+    b.ResetTimer()
+    for i := 0; i < b.N; i++ {
+        token := fmt.Sprintf("B%d", i)
+        if err := client.Enter(token, benchSymbol, benchSide(i), engine.LIMIT, 1, 100); err != nil {
+            b.Fatal(err)
+        }
+        awaitAccepted(b, client, token)
+    }
+}
+
+func BenchmarkAppendMessage(b *testing.B) {
+    msg := EnterOrder{Token: "B1234567", Side: engine.BUY, OrdType: engine.LIMIT, Symbol: benchSymbol, Quantity: 1, Price: 100}
+    buf := make([]byte, 0, 64)
+    b.ReportAllocs()
+    for i := 0; i < b.N; i++ {
+        buf, _ = AppendMessage(buf[:0], msg)
+    }
+}
+
+func BenchmarkReadRequest(b *testing.B) {
+    msg := EnterOrder{Token: "B1234567", Side: engine.BUY, OrdType: engine.LIMIT, Symbol: benchSymbol, Quantity: 1, Price: 100}
+    frame, _ := AppendMessage(nil, msg)
+    reader := bytes.NewReader(nil)
+    buffered := bufio.NewReader(reader)
+    b.ReportAllocs()
+    for i := 0; i < b.N; i++ {
+        reader.Reset(frame)
+        buffered.Reset(reader)
+        if _, err := ReadRequest(buffered); err != nil {
+            b.Fatal(err)
+        }
+    }
+}
@@ -0,0 +1,119 @@
+package gateway
+
+import (
+    "bufio"
+    "errors"
+    "fmt"
+    "net"
+    "sync"
+    "time"
+
+    "high-frequency-matching-engine/engine"
+)
+
+var ErrLoginRejected = errors.New("gateway login rejected")
+
+// Client is a binary order entry connection. Requests are written
+// immediately; every response, including fills of resting orders, is
+// delivered on the Responses channel in the order the server sent it.
+type Client struct {
+    conn      net.Conn
+    writer    *bufio.Writer
+    buf       []byte
+    responses chan Message
+    err       error
+    mutex     sync.Mutex
+}
+
+// Dial connects and logs in with an API key
+func Dial(addr, apiKey string, timeout time.Duration) (*Client, error) {
+    conn, err := net.DialTimeout("tcp", addr, timeout)
+    if err != nil {
+        return nil, err
+    }
+    if tcp, ok := conn.(*net.TCPConn); ok {
+        tcp.SetNoDelay(true)
+    }
+
+    c := &Client{
+        conn:      conn,
+        writer:    bufio.NewWriter(conn),
+        responses: make(chan Message, 1024),
+    }
+    reader := bufio.NewReader(conn)
+
+    conn.SetDeadline(time.Now().Add(timeout))
+    if err := c.send(LoginRequest{APIKey: apiKey}); err != nil {
+        conn.Close()
+        return nil, err
+    }
+    response, err := ReadResponse(reader)
+    if err != nil {
+        conn.Close()
+        return nil, err
+    }
+    if rejected, isRejected := response.(LoginRejected); isRejected {
+        conn.Close()
+        return nil, fmt.Errorf("%w: reason %c", ErrLoginRejected, rejected.Reason)
+    }
+    conn.SetDeadline(time.Time{})
+
+    go c.readLoop(reader)
+    return c, nil
+}
+
+func (c *Client) readLoop(reader *bufio.Reader) {
+    defer close(c.responses)
+    for {
+        msg, err := ReadResponse(reader)
+        if err != nil {
+            c.mutex.Lock()
+            c.err = err
+            c.mutex.Unlock()
+            return
+        }
+        c.responses <- msg
+    }
+}
+
+// Responses returns the response channel, closed when the connection ends
+func (c *Client) Responses() <-chan Message {
+    return c.responses
+}
+
+// Err returns the error that ended the connection, if any
+func (c *Client) Err() error {
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+    return c.err
+}
+
+func (c *Client) send(msg Message) error {
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+
+    var err error
+    if c.buf, err = AppendMessage(c.buf[:0], msg); err != nil {
+        return err
+    }
+    if _, err := c.writer.Write(c.buf); err != nil {
+        return err
+    }
+    return c.writer.Flush()
+}
+
+func (c *Client) Enter(token, symbol string, side engine.OrderSide, ordType engine.OrderType, quantity, price float64) error {
+    return c.send(EnterOrder{Token: token, Side: side, OrdType: ordType, Symbol: symbol, Quantity: quantity, Price: price})
+}
+
+func (c *Client) Replace(existingToken, newToken string, quantity, price float64) error {
+    return c.send(ReplaceOrder{ExistingToken: existingToken, NewToken: newToken, Quantity: quantity, Price: price})
+}
+
+func (c *Client) Cancel(token string) error {
+    return c.send(CancelOrder{Token: token})
+}
+
+func (c *Client) Close() error {
+    return c.conn.Close()
+}
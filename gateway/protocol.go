@@ -0,0 +1,509 @@
+package gateway
+
+import (
+    "bufio"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "io"
+    "math"
+    "strings"
+    "time"
+
+    "high-frequency-matching-engine/engine"
+)
+
+// Every message is framed as a big-endian uint16 length, covering the type
+// byte and payload, followed by a one-byte type and a fixed-layout payload.
+// Integers are big-endian; prices and quantities are fixed point with eight
+// decimal places; tokens, keys and symbols are space-padded ASCII.
+const (
+    TokenLength  = 14
+    SymbolLength = 8
+    APIKeyLength = 32
+
+    priceScale = 1e8
+)
+
+// Session message types
+const (
+    TypeLoginRequest  byte = 'L'
+    TypeLoginAccepted byte = 'a'
+    TypeLoginRejected byte = 'j'
+)
+
+// Inbound order message types
+const (
+    TypeEnterOrder   byte = 'O'
+    TypeReplaceOrder byte = 'U'
+    TypeCancelOrder  byte = 'X'
+)
+
+// Outbound order message types
+const (
+    TypeAccepted  byte = 'A'
+    TypeReplaced  byte = 'U'
+    TypeExecuted  byte = 'E'
+    TypeCancelled byte = 'C'
+    TypeRejected  byte = 'J'
+)
+
+// Reject reasons
+const (
+    RejectNotLoggedIn     byte = 'L'
+    RejectInvalidQuantity byte = 'Q'
+    RejectInvalidPrice    byte = 'P'
+    RejectInvalidOrder    byte = 'S'
+    RejectDuplicateToken  byte = 'D'
+    RejectUnknownOrder    byte = 'U'
+    RejectInvalidAPIKey   byte = 'K'
+)
+
+// Cancel reasons
+const (
+    CancelUserRequested byte = 'U'
+    CancelImmediate     byte = 'I'
+)
+
+var (
+    ErrUnknownMessage = errors.New("unknown gateway message type")
+    ErrMessageLength  = errors.New("invalid gateway message length")
+    ErrFieldLength    = errors.New("gateway field too long")
+)
+
+// Message is any protocol message
+type Message interface {
+    Type() byte
+    appendPayload(buf []byte) []byte
+}
+
+type LoginRequest struct {
+    APIKey string
+}
+
+type LoginAccepted struct{}
+
+type LoginRejected struct {
+    Reason byte
+}
+
+type EnterOrder struct {
+    Token    string
+    Side     engine.OrderSide
+    OrdType  engine.OrderType
+    Symbol   string
+    Quantity float64
+    Price    float64
+}
+
+type ReplaceOrder struct {
+    ExistingToken string
+    NewToken      string
+    Quantity      float64
+    Price         float64
+}
+
+type CancelOrder struct {
+    Token string
+}
+
+type Accepted struct {
+    Timestamp time.Time
+    Token     string
+    Side      engine.OrderSide
+    OrdType   engine.OrderType
+    Symbol    string
+    Quantity  float64
+    Price     float64
+    OrderRef  uint64
+}
+
+type Replaced struct {
+    Timestamp     time.Time
+    NewToken      string
+    PreviousToken string
+    Quantity      float64
+    Price         float64
+    OrderRef      uint64
+}
+
+type Executed struct {
+    Timestamp   time.Time
+    Token       string
+    Quantity    float64
+    Price       float64
+    LeavesQty   float64
+    MatchNumber uint64
+}
+
+type Cancelled struct {
+    Timestamp    time.Time
+    Token        string
+    DecrementQty float64
+    Reason       byte
+}
+
+type Rejected struct {
+    Timestamp time.Time
+    Token     string
+    Reason    byte
+}
+
+func (LoginRequest) Type() byte  { return TypeLoginRequest }
+func (LoginAccepted) Type() byte { return TypeLoginAccepted }
+func (LoginRejected) Type() byte { return TypeLoginRejected }
+func (EnterOrder) Type() byte    { return TypeEnterOrder }
+func (ReplaceOrder) Type() byte  { return TypeReplaceOrder }
+func (CancelOrder) Type() byte   { return TypeCancelOrder }
+func (Accepted) Type() byte      { return TypeAccepted }
+func (Replaced) Type() byte      { return TypeReplaced }
+func (Executed) Type() byte      { return TypeExecuted }
+func (Cancelled) Type() byte     { return TypeCancelled }
+func (Rejected) Type() byte      { return TypeRejected }
+
+// Payload lengths, excluding the type byte
+var requestLengths = map[byte]int{
+    TypeLoginRequest: APIKeyLength,
+    TypeEnterOrder:   TokenLength + 2 + SymbolLength + 16,
+    TypeReplaceOrder: 2*TokenLength + 16,
+    TypeCancelOrder:  TokenLength,
+}
+
+var responseLengths = map[byte]int{
+    TypeLoginAccepted: 0,
+    TypeLoginRejected: 1,
+    TypeAccepted:      8 + TokenLength + 2 + SymbolLength + 24,
+    TypeReplaced:      8 + 2*TokenLength + 24,
+    TypeExecuted:      8 + TokenLength + 32,
+    TypeCancelled:     8 + TokenLength + 9,
+    TypeRejected:      8 + TokenLength + 1,
+}
+
+// checkAlpha returns ErrFieldLength for a value that would not fit its
+// field, rather than let it go out cut short
+func checkAlpha(name, value string, length int) error {
+    if len(value) > length {
+        return fmt.Errorf("%w: %s %q is over %d characters", ErrFieldLength, name, value, length)
+    }
+    return nil
+}
+
+// checkFields checks the tokens, symbols and key of a message fit
+func checkFields(msg Message) error {
+    switch m := msg.(type) {
+    case LoginRequest:
+        return checkAlpha("API key", m.APIKey, APIKeyLength)
+    case EnterOrder:
+        return errors.Join(checkAlpha("token", m.Token, TokenLength), checkAlpha("symbol", m.Symbol, SymbolLength))
+    case ReplaceOrder:
+        return errors.Join(checkAlpha("token", m.ExistingToken, TokenLength), checkAlpha("token", m.NewToken, TokenLength))
+    case CancelOrder:
+        return checkAlpha("token", m.Token, TokenLength)
+    case Accepted:
+        return errors.Join(checkAlpha("token", m.Token, TokenLength), checkAlpha("symbol", m.Symbol, SymbolLength))
+    case Replaced:
+        return errors.Join(checkAlpha("token", m.NewToken, TokenLength), checkAlpha("token", m.PreviousToken, TokenLength))
+    case Executed:
+        return checkAlpha("token", m.Token, TokenLength)
+    case Cancelled:
+        return checkAlpha("token", m.Token, TokenLength)
+    case Rejected:
+        return checkAlpha("token", m.Token, TokenLength)
+    }
+    return nil
+}
+
+// appendAlpha pads a value checked by checkFields to its field length
+func appendAlpha(buf []byte, value string, length int) []byte {
+    buf = append(buf, value...)
+    for i := len(value); i < length; i++ {
+        buf = append(buf, ' ')
+    }
+    return buf
+}
+
+func appendUint(buf []byte, value uint64) []byte {
+    return binary.BigEndian.AppendUint64(buf, value)
+}
+
+func appendFixed(buf []byte, value float64) []byte {
+    return appendUint(buf, uint64(math.Round(value*priceScale)))
+}
+
+func appendTime(buf []byte, value time.Time) []byte {
+    return appendUint(buf, uint64(value.UnixNano()))
+}
+
+func appendSide(buf []byte, side engine.OrderSide) []byte {
+    if side == engine.SELL {
+        return append(buf, 'S')
+    }
+    return append(buf, 'B')
+}
+
+func appendOrdType(buf []byte, ordType engine.OrderType) []byte {
+    if ordType == engine.MARKET {
+        return append(buf, 'M')
+    }
+    return append(buf, 'L')
+}
+
+func (m LoginRequest) appendPayload(buf []byte) []byte {
+    return appendAlpha(buf, m.APIKey, APIKeyLength)
+}
+
+func (m LoginAccepted) appendPayload(buf []byte) []byte {
+    return buf
+}
+
+func (m LoginRejected) appendPayload(buf []byte) []byte {
+    return append(buf, m.Reason)
+}
+
+func (m EnterOrder) appendPayload(buf []byte) []byte {
+    buf = appendAlpha(buf, m.Token, TokenLength)
+    buf = appendSide(buf, m.Side)
+    buf = appendOrdType(buf, m.OrdType)
+    buf = appendAlpha(buf, m.Symbol, SymbolLength)
+    buf = appendFixed(buf, m.Quantity)
+    return appendFixed(buf, m.Price)
+}
+
+func (m ReplaceOrder) appendPayload(buf []byte) []byte {
+    buf = appendAlpha(buf, m.ExistingToken, TokenLength)
+    buf = appendAlpha(buf, m.NewToken, TokenLength)
+    buf = appendFixed(buf, m.Quantity)
+    return appendFixed(buf, m.Price)
+}
+
+func (m CancelOrder) appendPayload(buf []byte) []byte {
+    return appendAlpha(buf, m.Token, TokenLength)
+}
+
+func (m Accepted) appendPayload(buf []byte) []byte {
+    buf = appendTime(buf, m.Timestamp)
+    buf = appendAlpha(buf, m.Token, TokenLength)
+    buf = appendSide(buf, m.Side)
+    buf = appendOrdType(buf, m.OrdType)
+    buf = appendAlpha(buf, m.Symbol, SymbolLength)
+    buf = appendFixed(buf, m.Quantity)
+    buf = appendFixed(buf, m.Price)
+    return appendUint(buf, m.OrderRef)
+}
+
+func (m Replaced) appendPayload(buf []byte) []byte {
+    buf = appendTime(buf, m.Timestamp)
+    buf = appendAlpha(buf, m.NewToken, TokenLength)
+    buf = appendAlpha(buf, m.PreviousToken, TokenLength)
+    buf = appendFixed(buf, m.Quantity)
+    buf = appendFixed(buf, m.Price)
+    return appendUint(buf, m.OrderRef)
+}
+
+func (m Executed) appendPayload(buf []byte) []byte {
+    buf = appendTime(buf, m.Timestamp)
+    buf = appendAlpha(buf, m.Token, TokenLength)
+    buf = appendFixed(buf, m.Quantity)
+    buf = appendFixed(buf, m.Price)
+    buf = appendFixed(buf, m.LeavesQty)
+    return appendUint(buf, m.MatchNumber)
+}
+
+func (m Cancelled) appendPayload(buf []byte) []byte {
+    buf = appendTime(buf, m.Timestamp)
+    buf = appendAlpha(buf, m.Token, TokenLength)
+    buf = appendFixed(buf, m.DecrementQty)
+    return append(buf, m.Reason)
+}
+
+func (m Rejected) appendPayload(buf []byte) []byte {
+    buf = appendTime(buf, m.Timestamp)
+    buf = appendAlpha(buf, m.Token, TokenLength)
+    return append(buf, m.Reason)
+}
+
+// AppendMessage appends the framed encoding of msg to buf. A token, symbol
+// or key too long for its field is an ErrFieldLength, and leaves buf as it
+// was.
+func AppendMessage(buf []byte, msg Message) ([]byte, error) {
+    if err := checkFields(msg); err != nil {
+        return buf, err
+    }
+    start := len(buf)
+    buf = append(buf, 0, 0, msg.Type())
+    buf = msg.appendPayload(buf)
+    binary.BigEndian.PutUint16(buf[start:], uint16(len(buf)-start-2))
+    return buf, nil
+}
+
+// WriteMessage writes one framed message
+func WriteMessage(w io.Writer, msg Message) error {
+    data, err := AppendMessage(make([]byte, 0, 64), msg)
+    if err != nil {
+        return err
+    }
+    _, err = w.Write(data)
+    return err
+}
+
+// payload is a cursor over a fixed-layout payload
+type payload []byte
+
+func (p *payload) alpha(length int) string {
+    value := strings.TrimRight(string((*p)[:length]), " ")
+    *p = (*p)[length:]
+    return value
+}
+
+func (p *payload) uint() uint64 {
+    value := binary.BigEndian.Uint64(*p)
+    *p = (*p)[8:]
+    return value
+}
+
+func (p *payload) fixed() float64 {
+    return float64(p.uint()) / priceScale
+}
+
+func (p *payload) time() time.Time {
+    return time.Unix(0, int64(p.uint()))
+}
+
+func (p *payload) byte() byte {
+    value := (*p)[0]
+    *p = (*p)[1:]
+    return value
+}
+
+func (p *payload) side() (engine.OrderSide, error) {
+    switch p.byte() {
+    case 'B':
+        return engine.BUY, nil
+    case 'S':
+        return engine.SELL, nil
+    }
+    return 0, fmt.Errorf("invalid side")
+}
+
+func (p *payload) ordType() (engine.OrderType, error) {
+    switch p.byte() {
+    case 'L':
+        return engine.LIMIT, nil
+    case 'M':
+        return engine.MARKET, nil
+    }
+    return 0, fmt.Errorf("invalid order type")
+}
+
+func readFrame(r *bufio.Reader, lengths map[byte]int) (byte, payload, error) {
+    header := make([]byte, 3)
+    if _, err := io.ReadFull(r, header); err != nil {
+        return 0, nil, err
+    }
+    msgType := header[2]
+    expected, known := lengths[msgType]
+    if !known {
+        return 0, nil, ErrUnknownMessage
+    }
+    if int(binary.BigEndian.Uint16(header)) != expected+1 {
+        return 0, nil, ErrMessageLength
+    }
+    data := make([]byte, expected)
+    if _, err := io.ReadFull(r, data); err != nil {
+        return 0, nil, err
+    }
+    return msgType, data, nil
+}
+
+// ReadRequest reads one client-to-server message
+func ReadRequest(r *bufio.Reader) (Message, error) {
+    msgType, p, err := readFrame(r, requestLengths)
+    if err != nil {
+        return nil, err
+    }
+
+    switch msgType {
+    case TypeLoginRequest:
+        return LoginRequest{APIKey: p.alpha(APIKeyLength)}, nil
+    case TypeEnterOrder:
+        m := EnterOrder{Token: p.alpha(TokenLength)}
+        if m.Side, err = p.side(); err != nil {
+            return nil, err
+        }
+        if m.OrdType, err = p.ordType(); err != nil {
+            return nil, err
+        }
+        m.Symbol = p.alpha(SymbolLength)
+        m.Quantity = p.fixed()
+        m.Price = p.fixed()
+        return m, nil
+    case TypeReplaceOrder:
+        return ReplaceOrder{
+            ExistingToken: p.alpha(TokenLength),
+            NewToken:      p.alpha(TokenLength),
+            Quantity:      p.fixed(),
+            Price:         p.fixed(),
+        }, nil
+    default:
+        return CancelOrder{Token: p.alpha(TokenLength)}, nil
+    }
+}
+
+// ReadResponse reads one server-to-client message
+func ReadResponse(r *bufio.Reader) (Message, error) {
+    msgType, p, err := readFrame(r, responseLengths)
+    if err != nil {
+        return nil, err
+    }
+
+    switch msgType {
+    case TypeLoginAccepted:
+        return LoginAccepted{}, nil
+    case TypeLoginRejected:
+        return LoginRejected{Reason: p.byte()}, nil
+    case TypeAccepted:
+        m := Accepted{Timestamp: p.time(), Token: p.alpha(TokenLength)}
+        if m.Side, err = p.side(); err != nil {
+            return nil, err
+        }
+        if m.OrdType, err = p.ordType(); err != nil {
+            return nil, err
+        }
+        m.Symbol = p.alpha(SymbolLength)
+        m.Quantity = p.fixed()
+        m.Price = p.fixed()
+        m.OrderRef = p.uint()
+        return m, nil
+    case TypeReplaced:
+        return Replaced{
+            Timestamp:     p.time(),
+            NewToken:      p.alpha(TokenLength),
+            PreviousToken: p.alpha(TokenLength),
+            Quantity:      p.fixed(),
+            Price:         p.fixed(),
+            OrderRef:      p.uint(),
+        }, nil
+    case TypeExecuted:
+        return Executed{
+            Timestamp:   p.time(),
+            Token:       p.alpha(TokenLength),
+            Quantity:    p.fixed(),
+            Price:       p.fixed(),
+            LeavesQty:   p.fixed(),
+            MatchNumber: p.uint(),
+        }, nil
+    case TypeCancelled:
+        return Cancelled{
+            Timestamp:    p.time(),
+            Token:        p.alpha(TokenLength),
+            DecrementQty: p.fixed(),
+            Reason:       p.byte(),
+        }, nil
+    default:
+        return Rejected{
+            Timestamp: p.time(),
+            Token:     p.alpha(TokenLength),
+            Reason:    p.byte(),
+        }, nil
+    }
+}
@@ -0,0 +1,415 @@
+package gateway
+
+import (
+    "bufio"
+    "fmt"
+    "net"
+    "strconv"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    "go.uber.org/zap"
+
+    "high-frequency-matching-engine/engine"
+    "high-frequency-matching-engine/utils"
+)
+
+const (
+    loginTimeout = 5 * time.Second
+    writeTimeout = 5 * time.Second
+)
+
+const sendBufferSize = 4096
+
+type conn struct {
+    net.Conn
+    clientID string
+    out      chan []byte
+    closed   bool
+    mutex    sync.Mutex
+}
+
+func newConn(c net.Conn) *conn {
+    return &conn{Conn: c, out: make(chan []byte, sendBufferSize)}
+}
+
+// send queues a message without blocking the engine. A connection whose
+// queue is full is closed, like a slow WebSocket client, as is one sent a
+// message that would go out cut short.
+func (c *conn) send(msg Message) {
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+
+    if c.closed {
+        return
+    }
+    data, err := AppendMessage(make([]byte, 0, 64), msg)
+    if err != nil {
+        c.closed = true
+        close(c.out)
+        return
+    }
+    select {
+    case c.out <- data:
+    default:
+        c.closed = true
+        close(c.out)
+        c.Close()
+    }
+}
+
+// close stops accepting messages; the write loop closes the socket once
+// the queue has been written
+func (c *conn) close() {
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+
+    if !c.closed {
+        c.closed = true
+        close(c.out)
+    }
+}
+
+// writeLoop writes queued messages, flushing whenever the queue drains so
+// bursts go out in as few writes as possible
+func (c *conn) writeLoop() {
+    writer := bufio.NewWriter(c.Conn)
+    for data := range c.out {
+        c.SetWriteDeadline(time.Now().Add(writeTimeout))
+        if _, err := writer.Write(data); err != nil {
+            break
+        }
+        if len(c.out) == 0 && writer.Flush() != nil {
+            break
+        }
+    }
+    c.Close()
+    for range c.out {
+    }
+}
+
+// route ties an engine order to the client and token it was entered with
+type route struct {
+    clientID      string
+    symbol        string
+    token         string
+    previousToken string
+    orderRef      uint64
+    keys          []string // tokens entries for the order, removed with it
+}
+
+// Server accepts binary order entry connections. Each connection logs in
+// with an API key and then enters, replaces and cancels orders by
+// client-chosen token; responses are driven by the engine's execution
+// reports and delivered to the client's current connection.
+type Server struct {
+    engine   *engine.MatchingEngine
+    apiKeys  map[string]string // API key -> client ID
+    logger   *zap.Logger
+    listener net.Listener
+
+    conns    map[string]*conn  // client ID -> connection
+    routes   map[string]*route // engine order ID -> route
+    tokens   map[string]string // client ID + token -> engine order ID
+    orderRef uint64
+    mutex    sync.Mutex
+}
+
+func NewServer(matchingEngine *engine.MatchingEngine, apiKeys map[string]string, logger *zap.Logger) *Server {
+    s := &Server{
+        engine:   matchingEngine,
+        apiKeys:  apiKeys,
+        logger:   logger,
+        conns:    make(map[string]*conn),
+        routes:   make(map[string]*route),
+        tokens:   make(map[string]string),
+        orderRef: uint64(time.Now().UnixNano()),
+    }
+    matchingEngine.OnExecution(func(reports []*engine.ExecutionReport) {
+        for _, report := range reports {
+            s.onExecution(report)
+        }
+    })
+    return s
+}
+
+func (s *Server) Listen(addr string) error {
+    listener, err := net.Listen("tcp", addr)
+    if err != nil {
+        return err
+    }
+    s.listener = listener
+
+    go func() {
+        for {
+            c, err := listener.Accept()
+            if err != nil {
+                return
+            }
+            if tcp, ok := c.(*net.TCPConn); ok {
+                tcp.SetNoDelay(true)
+            }
+            go s.handleConn(newConn(c))
+        }
+    }()
+
+    s.logger.Info("Order entry gateway listening", zap.String("addr", listener.Addr().String()))
+    return nil
+}
+
+// Addr returns the listening address, useful when bound to port 0
+func (s *Server) Addr() net.Addr {
+    return s.listener.Addr()
+}
+
+func (s *Server) Close() error {
+    s.mutex.Lock()
+    for _, c := range s.conns {
+        c.close()
+    }
+    s.mutex.Unlock()
+    return s.listener.Close()
+}
+
+func (s *Server) handleConn(c *conn) {
+    defer c.close()
+    go c.writeLoop()
+    reader := bufio.NewReader(c)
+
+    c.SetReadDeadline(time.Now().Add(loginTimeout))
+    msg, err := ReadRequest(reader)
+    if err != nil {
+        return
+    }
+    login, isLogin := msg.(LoginRequest)
+    clientID, valid := s.apiKeys[login.APIKey]
+    if !isLogin || !valid {
+        c.send(LoginRejected{Reason: RejectInvalidAPIKey})
+        return
+    }
+    c.SetReadDeadline(time.Time{})
+    c.clientID = clientID
+
+    // A new login takes over the client's execution stream
+    s.mutex.Lock()
+    if previous, exists := s.conns[clientID]; exists {
+        previous.close()
+    }
+    s.conns[clientID] = c
+    s.mutex.Unlock()
+
+    defer func() {
+        s.mutex.Lock()
+        if s.conns[clientID] == c {
+            delete(s.conns, clientID)
+        }
+        s.mutex.Unlock()
+    }()
+
+    s.logger.Info("Gateway session logged in", zap.String("client_id", clientID), zap.String("remote", c.RemoteAddr().String()))
+    c.send(LoginAccepted{})
+
+    for {
+        msg, err := ReadRequest(reader)
+        if err != nil {
+            return
+        }
+
+        switch m := msg.(type) {
+        case EnterOrder:
+            s.enter(c, m)
+        case ReplaceOrder:
+            s.replace(c, m)
+        case CancelOrder:
+            s.cancel(c, m)
+        default:
+            c.send(Rejected{Timestamp: time.Now(), Reason: RejectInvalidOrder})
+        }
+    }
+}
+
+func (s *Server) reject(c *conn, token string, reason byte) {
+    c.send(Rejected{Timestamp: time.Now(), Token: token, Reason: reason})
+}
+
+func (s *Server) enter(c *conn, m EnterOrder) {
+    switch {
+    case m.Token == "" || !utils.ValidSymbol(m.Symbol):
+        s.reject(c, m.Token, RejectInvalidOrder)
+        return
+    case m.Quantity <= 0:
+        s.reject(c, m.Token, RejectInvalidQuantity)
+        return
+    case m.OrdType == engine.LIMIT && m.Price <= 0:
+        s.reject(c, m.Token, RejectInvalidPrice)
+        return
+    }
+
+    orderRef := atomic.AddUint64(&s.orderRef, 1)
+    order := &engine.Order{
+        ID:            fmt.Sprintf("GW_%d", orderRef),
+        Symbol:        m.Symbol,
+        Side:          m.Side,
+        Type:          m.OrdType,
+        Quantity:      m.Quantity,
+        Status:        engine.PENDING,
+        ClientID:      c.clientID,
+        ClientOrderID: m.Token,
+    }
+    if m.OrdType == engine.LIMIT {
+        order.Price = m.Price
+    }
+
+    // Register before submitting so the engine's reports find their route
+    s.mutex.Lock()
+    key := c.clientID + "|" + m.Token
+    if _, duplicate := s.tokens[key]; duplicate {
+        s.mutex.Unlock()
+        s.reject(c, m.Token, RejectDuplicateToken)
+        return
+    }
+    s.tokens[key] = order.ID
+    s.routes[order.ID] = &route{clientID: c.clientID, symbol: m.Symbol, token: m.Token, orderRef: orderRef, keys: []string{key}}
+    s.mutex.Unlock()
+
+    s.engine.ProcessOrder(order)
+}
+
+func (s *Server) replace(c *conn, m ReplaceOrder) {
+    s.mutex.Lock()
+    orderID, exists := s.tokens[c.clientID+"|"+m.ExistingToken]
+    r := s.routes[orderID]
+    _, duplicate := s.tokens[c.clientID+"|"+m.NewToken]
+    if !exists || r == nil || r.token != m.ExistingToken {
+        s.mutex.Unlock()
+        s.reject(c, m.NewToken, RejectUnknownOrder)
+        return
+    }
+    if duplicate || m.NewToken == "" {
+        s.mutex.Unlock()
+        s.reject(c, m.NewToken, RejectDuplicateToken)
+        return
+    }
+    if m.Quantity <= 0 {
+        s.mutex.Unlock()
+        s.reject(c, m.NewToken, RejectInvalidQuantity)
+        return
+    }
+    if m.Price <= 0 {
+        s.mutex.Unlock()
+        s.reject(c, m.NewToken, RejectInvalidPrice)
+        return
+    }
+    previousToken := r.previousToken
+    r.previousToken, r.token = r.token, m.NewToken
+    newKey := c.clientID + "|" + m.NewToken
+    s.tokens[newKey] = orderID
+    r.keys = append(r.keys, newKey)
+    symbol := r.symbol
+    s.mutex.Unlock()
+
+    if _, _, err := s.engine.AmendOrder(symbol, orderID, m.Price, m.Quantity); err != nil {
+        s.mutex.Lock()
+        r.token, r.previousToken = m.ExistingToken, previousToken
+        delete(s.tokens, newKey)
+        r.keys = r.keys[:len(r.keys)-1]
+        s.mutex.Unlock()
+
+        reason := RejectUnknownOrder
+        switch err {
+        case engine.ErrInvalidAmend:
+            reason = RejectInvalidQuantity
+        case engine.ErrInvalidPrice:
+            reason = RejectInvalidPrice
+        }
+        s.reject(c, m.NewToken, reason)
+    }
+}
+
+func (s *Server) cancel(c *conn, m CancelOrder) {
+    s.mutex.Lock()
+    orderID := s.tokens[c.clientID+"|"+m.Token]
+    r := s.routes[orderID]
+    current := r != nil && r.token == m.Token
+    s.mutex.Unlock()
+
+    if !current || !s.engine.CancelOrder(r.symbol, orderID) {
+        s.reject(c, m.Token, RejectUnknownOrder)
+    }
+}
+
+// onExecution translates an engine execution report for a gateway order
+// into the matching response on the owning client's connection. It runs
+// synchronously on the engine's order path, ahead of the event loop.
+func (s *Server) onExecution(report *engine.ExecutionReport) {
+    s.mutex.Lock()
+    r, exists := s.routes[report.Order.ID]
+    if !exists {
+        s.mutex.Unlock()
+        return
+    }
+    c := s.conns[r.clientID]
+    token, previousToken := r.token, r.previousToken
+
+    // A finished order frees its tokens for reuse
+    if report.Order.Status == engine.FILLED || report.Order.Status == engine.CANCELLED {
+        delete(s.routes, report.Order.ID)
+        for _, key := range r.keys {
+            delete(s.tokens, key)
+        }
+    }
+    s.mutex.Unlock()
+
+    if c == nil {
+        return
+    }
+
+    order := &report.Order
+    switch report.Type {
+    case engine.EXEC_NEW:
+        c.send(Accepted{
+            Timestamp: report.Timestamp,
+            Token:     token,
+            Side:      order.Side,
+            OrdType:   order.Type,
+            Symbol:    order.Symbol,
+            Quantity:  order.Quantity,
+            Price:     order.Price,
+            OrderRef:  r.orderRef,
+        })
+    case engine.EXEC_REPLACED:
+        c.send(Replaced{
+            Timestamp:     report.Timestamp,
+            NewToken:      token,
+            PreviousToken: previousToken,
+            Quantity:      order.Quantity,
+            Price:         order.Price,
+            OrderRef:      r.orderRef,
+        })
+    case engine.EXEC_TRADE:
+        // Trade IDs are numbered across the engine, so match numbers are
+        // unique across symbols and shared by both sides of a fill
+        matchNumber, _ := strconv.ParseUint(strings.TrimPrefix(report.TradeID, "T"), 10, 64)
+        c.send(Executed{
+            Timestamp:   report.Timestamp,
+            Token:       token,
+            Quantity:    report.LastQty,
+            Price:       report.LastPrice,
+            LeavesQty:   order.Quantity - order.Filled,
+            MatchNumber: matchNumber,
+        })
+    case engine.EXEC_CANCELLED:
+        reason := CancelUserRequested
+        if order.Type == engine.MARKET {
+            reason = CancelImmediate
+        }
+        c.send(Cancelled{
+            Timestamp:    report.Timestamp,
+            Token:        token,
+            DecrementQty: order.Quantity - order.Filled,
+            Reason:       reason,
+        })
+    }
+}
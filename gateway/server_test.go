@@ -0,0 +1,153 @@
+package gateway
+
+import (
+    "errors"
+    "testing"
+    "time"
+
+    "high-frequency-matching-engine/engine"
+)
+
+func TestAppendMessageRejectsLongFields(t *testing.T) {
+    tests := []Message{
+        LoginRequest{APIKey: "k123456789012345678901234567890123"},
+        EnterOrder{Token: "T12345678901234", Symbol: "BTCUSDT", Quantity: 1, Price: 1},
+        EnterOrder{Token: "T1", Symbol: "BTCUSDTPERP", Quantity: 1, Price: 1},
+        ReplaceOrder{ExistingToken: "T1", NewToken: "T12345678901234", Quantity: 1, Price: 1},
+        CancelOrder{Token: "T12345678901234"},
+        Executed{Token: "T12345678901234"},
+    }
+    for _, msg := range tests {
+        if _, err := AppendMessage(nil, msg); !errors.Is(err, ErrFieldLength) {
+            t.Errorf("%+v: error %v, want ErrFieldLength", msg, err)
+        }
+    }
+
+    if _, err := AppendMessage(nil, EnterOrder{Token: "T1234567890123", Symbol: "BTCUSDT1", Quantity: 1, Price: 1}); err != nil {
+        t.Errorf("fields at their full length: %v", err)
+    }
+}
+
+func TestServerRejectsInvalidSymbol(t *testing.T) {
+    _, client := startServer(t)
+    if err := client.Enter("T1", "BTC/USD", engine.BUY, engine.LIMIT, 1, 100); err != nil {
+        t.Fatal(err)
+    }
+    select {
+    case msg := <-client.Responses():
+        if rejected, ok := msg.(Rejected); !ok || rejected.Token != "T1" || rejected.Reason != RejectInvalidOrder {
+            t.Errorf("got %+v, want T1 rejected as invalid", msg)
+        }
+    case <-time.After(5 * time.Second):
+        t.Fatal("no response to the order")
+    }
+}
+
+// Trades in different books must not share a match number
+func TestMatchNumbersUniqueAcrossSymbols(t *testing.T) {
+    _, client := startServer(t)
+    orders := []struct {
+        token  string
+        symbol string
+        side   engine.OrderSide
+    }{
+        {"A1", "BTCUSDT", engine.BUY},
+        {"A2", "BTCUSDT", engine.SELL},
+        {"B1", "ETHUSDT", engine.BUY},
+        {"B2", "ETHUSDT", engine.SELL},
+    }
+
+    matches := make(map[string]uint64)
+    for _, order := range orders {
+        if err := client.Enter(order.token, order.symbol, order.side, engine.LIMIT, 1, 100); err != nil {
+            t.Fatal(err)
+        }
+    }
+    for len(matches) < len(orders) {
+        select {
+        case msg := <-client.Responses():
+            if executed, ok := msg.(Executed); ok {
+                matches[executed.Token] = executed.MatchNumber
+            }
+        case <-time.After(5 * time.Second):
+            t.Fatalf("fills received %v, want all four orders filled", matches)
+        }
+    }
+
+    if matches["A1"] != matches["A2"] || matches["B1"] != matches["B2"] {
+        t.Errorf("match numbers %v, want both sides of a fill to share one", matches)
+    }
+    if matches["A1"] == matches["B1"] {
+        t.Errorf("match numbers %v, want BTCUSDT and ETHUSDT fills numbered apart", matches)
+    }
+}
+
+// awaitResponse returns the next response for a token, skipping others
+func awaitResponse(t *testing.T, client *Client, token string) Message {
+    t.Helper()
+    for {
+        select {
+        case msg := <-client.Responses():
+            switch m := msg.(type) {
+            case Accepted:
+                if m.Token == token {
+                    return m
+                }
+            case Replaced:
+                if m.NewToken == token {
+                    return m
+                }
+            case Executed:
+                if m.Token == token {
+                    return m
+                }
+            case Cancelled:
+                if m.Token == token {
+                    return m
+                }
+            case Rejected:
+                if m.Token == token {
+                    return m
+                }
+            }
+        case <-time.After(5 * time.Second):
+            t.Fatalf("no response for %s", token)
+        }
+    }
+}
+
+func TestReplaceRejectsInvalidPrice(t *testing.T) {
+    _, client := startServer(t)
+    client.Enter("T1", "BTCUSDT", engine.BUY, engine.LIMIT, 1, 100)
+    awaitResponse(t, client, "T1")
+
+    client.Replace("T1", "T2", 1, 0)
+    if msg, ok := awaitResponse(t, client, "T2").(Rejected); !ok || msg.Reason != RejectInvalidPrice {
+        t.Errorf("got %+v, want T2 rejected for its price", msg)
+    }
+    client.Replace("T1", "T3", 0, 100)
+    if msg, ok := awaitResponse(t, client, "T3").(Rejected); !ok || msg.Reason != RejectInvalidQuantity {
+        t.Errorf("got %+v, want T3 rejected for its quantity", msg)
+    }
+}
+
+// Tokens are freed when their order finishes, so they neither pile up
+// nor stay taken
+func TestTokensFreedWhenOrderFinishes(t *testing.T) {
+    _, client := startServer(t)
+    client.Enter("T1", "BTCUSDT", engine.BUY, engine.LIMIT, 1, 100)
+    awaitResponse(t, client, "T1")
+    client.Replace("T1", "T2", 2, 100)
+    awaitResponse(t, client, "T2")
+    client.Cancel("T2")
+    if _, ok := awaitResponse(t, client, "T2").(Cancelled); !ok {
+        t.Fatal("T2 was not cancelled")
+    }
+
+    for _, token := range []string{"T1", "T2"} {
+        client.Enter(token, "BTCUSDT", engine.BUY, engine.LIMIT, 1, 100)
+        if _, ok := awaitResponse(t, client, token).(Accepted); !ok {
+            t.Errorf("token %s of a cancelled order was not reusable", token)
+        }
+    }
+}
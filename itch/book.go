@@ -0,0 +1,122 @@
+package itch
+
+import (
+    "sort"
+    "sync"
+
+    "high-frequency-matching-engine/engine"
+)
+
+type bookOrder struct {
+    ref      uint64
+    side     engine.OrderSide
+    symbol   string
+    price    float64
+    quantity float64
+}
+
+// Book is the reference decoder's view of the market: every displayed
+// order, rebuilt from AddOrder, OrderExecuted, OrderCancel, OrderDelete
+// and OrderReplace messages
+type Book struct {
+    orders map[uint64]*bookOrder
+    mutex  sync.RWMutex
+}
+
+func NewBook() *Book {
+    return &Book{orders: make(map[uint64]*bookOrder)}
+}
+
+// Reset clears the book before a snapshot is applied
+func (b *Book) Reset() {
+    b.mutex.Lock()
+    defer b.mutex.Unlock()
+    b.orders = make(map[uint64]*bookOrder)
+}
+
+func (b *Book) Apply(msg Message) {
+    b.mutex.Lock()
+    defer b.mutex.Unlock()
+
+    switch m := msg.(type) {
+    case AddOrder:
+        b.orders[m.OrderRef] = &bookOrder{ref: m.OrderRef, side: m.Side, symbol: m.Symbol, price: m.Price, quantity: m.Quantity}
+    case OrderExecuted:
+        b.reduce(m.OrderRef, m.Quantity)
+    case OrderCancel:
+        b.reduce(m.OrderRef, m.Quantity)
+    case OrderDelete:
+        delete(b.orders, m.OrderRef)
+    case OrderReplace:
+        if order, exists := b.orders[m.OriginalRef]; exists {
+            delete(b.orders, m.OriginalRef)
+            b.orders[m.NewRef] = &bookOrder{ref: m.NewRef, side: order.side, symbol: order.symbol, price: m.Price, quantity: m.Quantity}
+        }
+    }
+}
+
+func (b *Book) reduce(ref uint64, quantity float64) {
+    order, exists := b.orders[ref]
+    if !exists {
+        return
+    }
+    order.quantity -= quantity
+    if order.quantity <= 1/priceScale {
+        delete(b.orders, ref)
+    }
+}
+
+// Level is an aggregated price level
+type Level struct {
+    Price    float64
+    Quantity float64
+    Orders   int
+}
+
+// Depth returns up to depth aggregated levels per side, best first;
+// depth <= 0 returns every level
+func (b *Book) Depth(symbol string, depth int) (bids, asks []Level) {
+    b.mutex.RLock()
+    bidLevels := make(map[float64]*Level)
+    askLevels := make(map[float64]*Level)
+    for _, order := range b.orders {
+        if order.symbol != symbol {
+            continue
+        }
+        levels := bidLevels
+        if order.side == engine.SELL {
+            levels = askLevels
+        }
+        level, exists := levels[order.price]
+        if !exists {
+            level = &Level{Price: order.price}
+            levels[order.price] = level
+        }
+        level.Quantity += order.quantity
+        level.Orders++
+    }
+    b.mutex.RUnlock()
+
+    bids = flatten(bidLevels, func(a, b float64) bool { return a > b }, depth)
+    asks = flatten(askLevels, func(a, b float64) bool { return a < b }, depth)
+    return bids, asks
+}
+
+func flatten(levels map[float64]*Level, better func(a, b float64) bool, depth int) []Level {
+    result := make([]Level, 0, len(levels))
+    for _, level := range levels {
+        result = append(result, *level)
+    }
+    sort.Slice(result, func(i, j int) bool { return better(result[i].Price, result[j].Price) })
+    if depth > 0 && len(result) > depth {
+        result = result[:depth]
+    }
+    return result
+}
+
+// Orders returns the number of displayed orders across all symbols
+func (b *Book) Orders() int {
+    b.mutex.RLock()
+    defer b.mutex.RUnlock()
+    return len(b.orders)
+}
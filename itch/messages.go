@@ -0,0 +1,314 @@
+package itch
+
+import (
+    "encoding/binary"
+    "errors"
+    "math"
+    "strings"
+    "time"
+
+    "high-frequency-matching-engine/engine"
+)
+
+// Messages have a one-byte type followed by a fixed-layout payload.
+// Integers are big-endian, timestamps are unix nanoseconds, prices and
+// quantities are fixed point with eight decimals and symbols are
+// space-padded to eight bytes. Orders are identified by a numeric
+// reference assigned when they are first displayed.
+const (
+    SymbolLength = 8
+
+    priceScale = 1e8
+)
+
+const (
+    TypeSystemEvent   byte = 'S'
+    TypeAddOrder      byte = 'A'
+    TypeOrderExecuted byte = 'E'
+    TypeOrderCancel   byte = 'X'
+    TypeOrderDelete   byte = 'D'
+    TypeOrderReplace  byte = 'U'
+    TypeTrade         byte = 'P'
+    TypeSnapshotEnd   byte = 'G'
+)
+
+// System event codes
+const (
+    EventStartOfMessages byte = 'O'
+    EventEndOfMessages   byte = 'C'
+)
+
+var ErrInvalidMessage = errors.New("invalid ITCH message")
+
+type Message interface {
+    Type() byte
+    appendPayload(buf []byte) []byte
+}
+
+// SystemEvent signals a feed state change
+type SystemEvent struct {
+    Timestamp time.Time
+    Event     byte
+}
+
+// AddOrder displays a new resting order
+type AddOrder struct {
+    Timestamp time.Time
+    OrderRef  uint64
+    Side      engine.OrderSide
+    Quantity  float64
+    Symbol    string
+    Price     float64
+}
+
+// OrderExecuted reduces a displayed order by a fill
+type OrderExecuted struct {
+    Timestamp   time.Time
+    OrderRef    uint64
+    Quantity    float64
+    Price       float64
+    MatchNumber uint64
+}
+
+// OrderCancel reduces a resting order's quantity, keeping its priority
+type OrderCancel struct {
+    Timestamp time.Time
+    OrderRef  uint64
+    Quantity  float64
+}
+
+// OrderDelete removes a resting order
+type OrderDelete struct {
+    Timestamp time.Time
+    OrderRef  uint64
+}
+
+// OrderReplace removes a resting order and displays its replacement under
+// a new reference at the back of the queue
+type OrderReplace struct {
+    Timestamp   time.Time
+    OriginalRef uint64
+    NewRef      uint64
+    Quantity    float64
+    Price       float64
+}
+
+// Trade reports a match against an order the feed does not display, with
+// that order's side. Volume is the sum of OrderExecuted and Trade.
+type Trade struct {
+    Timestamp   time.Time
+    Side        engine.OrderSide
+    Quantity    float64
+    Symbol      string
+    Price       float64
+    MatchNumber uint64
+}
+
+// SnapshotEnd terminates a snapshot; the feed continues at Seq+1
+type SnapshotEnd struct {
+    Timestamp time.Time
+    Seq       uint64
+}
+
+func (SystemEvent) Type() byte   { return TypeSystemEvent }
+func (AddOrder) Type() byte      { return TypeAddOrder }
+func (OrderExecuted) Type() byte { return TypeOrderExecuted }
+func (OrderCancel) Type() byte   { return TypeOrderCancel }
+func (OrderDelete) Type() byte   { return TypeOrderDelete }
+func (OrderReplace) Type() byte  { return TypeOrderReplace }
+func (Trade) Type() byte         { return TypeTrade }
+func (SnapshotEnd) Type() byte   { return TypeSnapshotEnd }
+
+var payloadLengths = map[byte]int{
+    TypeSystemEvent:   9,
+    TypeAddOrder:      8 + 8 + 1 + 8 + SymbolLength + 8,
+    TypeOrderExecuted: 8 + 8 + 8 + 8 + 8,
+    TypeOrderCancel:   8 + 8 + 8,
+    TypeOrderDelete:   8 + 8,
+    TypeOrderReplace:  8 + 8 + 8 + 8 + 8,
+    TypeTrade:         8 + 1 + 8 + SymbolLength + 8 + 8,
+    TypeSnapshotEnd:   8 + 8,
+}
+
+func appendUint(buf []byte, value uint64) []byte {
+    return binary.BigEndian.AppendUint64(buf, value)
+}
+
+func appendFixed(buf []byte, value float64) []byte {
+    return appendUint(buf, uint64(math.Round(value*priceScale)))
+}
+
+func appendTime(buf []byte, value time.Time) []byte {
+    return appendUint(buf, uint64(value.UnixNano()))
+}
+
+func appendSide(buf []byte, side engine.OrderSide) []byte {
+    if side == engine.SELL {
+        return append(buf, 'S')
+    }
+    return append(buf, 'B')
+}
+
+func appendSymbol(buf []byte, symbol string) []byte {
+    if len(symbol) > SymbolLength {
+        symbol = symbol[:SymbolLength]
+    }
+    buf = append(buf, symbol...)
+    for i := len(symbol); i < SymbolLength; i++ {
+        buf = append(buf, ' ')
+    }
+    return buf
+}
+
+func (m SystemEvent) appendPayload(buf []byte) []byte {
+    return append(appendTime(buf, m.Timestamp), m.Event)
+}
+
+func (m AddOrder) appendPayload(buf []byte) []byte {
+    buf = appendTime(buf, m.Timestamp)
+    buf = appendUint(buf, m.OrderRef)
+    buf = appendSide(buf, m.Side)
+    buf = appendFixed(buf, m.Quantity)
+    buf = appendSymbol(buf, m.Symbol)
+    return appendFixed(buf, m.Price)
+}
+
+func (m OrderExecuted) appendPayload(buf []byte) []byte {
+    buf = appendTime(buf, m.Timestamp)
+    buf = appendUint(buf, m.OrderRef)
+    buf = appendFixed(buf, m.Quantity)
+    buf = appendFixed(buf, m.Price)
+    return appendUint(buf, m.MatchNumber)
+}
+
+func (m OrderCancel) appendPayload(buf []byte) []byte {
+    buf = appendTime(buf, m.Timestamp)
+    buf = appendUint(buf, m.OrderRef)
+    return appendFixed(buf, m.Quantity)
+}
+
+func (m OrderDelete) appendPayload(buf []byte) []byte {
+    buf = appendTime(buf, m.Timestamp)
+    return appendUint(buf, m.OrderRef)
+}
+
+func (m OrderReplace) appendPayload(buf []byte) []byte {
+    buf = appendTime(buf, m.Timestamp)
+    buf = appendUint(buf, m.OriginalRef)
+    buf = appendUint(buf, m.NewRef)
+    buf = appendFixed(buf, m.Quantity)
+    return appendFixed(buf, m.Price)
+}
+
+func (m Trade) appendPayload(buf []byte) []byte {
+    buf = appendTime(buf, m.Timestamp)
+    buf = appendSide(buf, m.Side)
+    buf = appendFixed(buf, m.Quantity)
+    buf = appendSymbol(buf, m.Symbol)
+    buf = appendFixed(buf, m.Price)
+    return appendUint(buf, m.MatchNumber)
+}
+
+func (m SnapshotEnd) appendPayload(buf []byte) []byte {
+    buf = appendTime(buf, m.Timestamp)
+    return appendUint(buf, m.Seq)
+}
+
+// Encode returns the type byte followed by the payload
+func Encode(msg Message) []byte {
+    buf := make([]byte, 1, 1+payloadLengths[msg.Type()])
+    buf[0] = msg.Type()
+    return msg.appendPayload(buf)
+}
+
+type payload []byte
+
+func (p *payload) uint() uint64 {
+    value := binary.BigEndian.Uint64(*p)
+    *p = (*p)[8:]
+    return value
+}
+
+func (p *payload) fixed() float64 {
+    return float64(p.uint()) / priceScale
+}
+
+func (p *payload) time() time.Time {
+    return time.Unix(0, int64(p.uint()))
+}
+
+func (p *payload) byte() byte {
+    value := (*p)[0]
+    *p = (*p)[1:]
+    return value
+}
+
+func (p *payload) side() engine.OrderSide {
+    if p.byte() == 'S' {
+        return engine.SELL
+    }
+    return engine.BUY
+}
+
+func (p *payload) symbol() string {
+    value := strings.TrimRight(string((*p)[:SymbolLength]), " ")
+    *p = (*p)[SymbolLength:]
+    return value
+}
+
+// Decode parses one message produced by Encode
+func Decode(data []byte) (Message, error) {
+    if len(data) == 0 {
+        return nil, ErrInvalidMessage
+    }
+    length, known := payloadLengths[data[0]]
+    if !known || len(data) != 1+length {
+        return nil, ErrInvalidMessage
+    }
+
+    p := payload(data[1:])
+    switch data[0] {
+    case TypeSystemEvent:
+        return SystemEvent{Timestamp: p.time(), Event: p.byte()}, nil
+    case TypeAddOrder:
+        return AddOrder{
+            Timestamp: p.time(),
+            OrderRef:  p.uint(),
+            Side:      p.side(),
+            Quantity:  p.fixed(),
+            Symbol:    p.symbol(),
+            Price:     p.fixed(),
+        }, nil
+    case TypeOrderExecuted:
+        return OrderExecuted{
+            Timestamp:   p.time(),
+            OrderRef:    p.uint(),
+            Quantity:    p.fixed(),
+            Price:       p.fixed(),
+            MatchNumber: p.uint(),
+        }, nil
+    case TypeOrderCancel:
+        return OrderCancel{Timestamp: p.time(), OrderRef: p.uint(), Quantity: p.fixed()}, nil
+    case TypeOrderDelete:
+        return OrderDelete{Timestamp: p.time(), OrderRef: p.uint()}, nil
+    case TypeOrderReplace:
+        return OrderReplace{
+            Timestamp:   p.time(),
+            OriginalRef: p.uint(),
+            NewRef:      p.uint(),
+            Quantity:    p.fixed(),
+            Price:       p.fixed(),
+        }, nil
+    case TypeTrade:
+        return Trade{
+            Timestamp:   p.time(),
+            Side:        p.side(),
+            Quantity:    p.fixed(),
+            Symbol:      p.symbol(),
+            Price:       p.fixed(),
+            MatchNumber: p.uint(),
+        }, nil
+    default:
+        return SnapshotEnd{Timestamp: p.time(), Seq: p.uint()}, nil
+    }
+}
@@ -0,0 +1,108 @@
+package itch
+
+import (
+    "bufio"
+    "encoding/binary"
+    "errors"
+    "io"
+    "strings"
+)
+
+// Packets follow MoldUDP64: a header of a 10-byte session, the sequence
+// number of the first message and a message count, then each message
+// prefixed by its uint16 length. A packet with no messages is a heartbeat
+// carrying the next sequence number; a count of EndOfSession marks the end
+// of the feed.
+const (
+    SessionLength = 10
+    HeaderLength  = SessionLength + 8 + 2
+    MaxPacketSize = 1400
+
+    EndOfSession = 0xFFFF
+)
+
+var ErrInvalidPacket = errors.New("invalid ITCH packet")
+
+type Packet struct {
+    Session  string
+    Seq      uint64
+    Count    uint16
+    Messages [][]byte
+}
+
+func appendHeader(buf []byte, session string, seq uint64, count uint16) []byte {
+    if len(session) > SessionLength {
+        session = session[:SessionLength]
+    }
+    buf = append(buf, session...)
+    for i := len(session); i < SessionLength; i++ {
+        buf = append(buf, ' ')
+    }
+    buf = binary.BigEndian.AppendUint64(buf, seq)
+    return binary.BigEndian.AppendUint16(buf, count)
+}
+
+// AppendPacket encodes a packet of consecutive messages starting at seq
+func AppendPacket(buf []byte, session string, seq uint64, messages [][]byte) []byte {
+    buf = appendHeader(buf, session, seq, uint16(len(messages)))
+    for _, msg := range messages {
+        buf = binary.BigEndian.AppendUint16(buf, uint16(len(msg)))
+        buf = append(buf, msg...)
+    }
+    return buf
+}
+
+func ParsePacket(data []byte) (*Packet, error) {
+    if len(data) < HeaderLength {
+        return nil, ErrInvalidPacket
+    }
+
+    pkt := &Packet{
+        Session: strings.TrimRight(string(data[:SessionLength]), " "),
+        Seq:     binary.BigEndian.Uint64(data[SessionLength:]),
+        Count:   binary.BigEndian.Uint16(data[SessionLength+8:]),
+    }
+    if pkt.Count == EndOfSession {
+        return pkt, nil
+    }
+
+    rest := data[HeaderLength:]
+    for i := 0; i < int(pkt.Count); i++ {
+        if len(rest) < 2 {
+            return nil, ErrInvalidPacket
+        }
+        length := int(binary.BigEndian.Uint16(rest))
+        if len(rest) < 2+length {
+            return nil, ErrInvalidPacket
+        }
+        pkt.Messages = append(pkt.Messages, rest[2:2+length])
+        rest = rest[2+length:]
+    }
+    return pkt, nil
+}
+
+// Retransmission requests use the packet header layout: the session, the
+// first sequence number wanted and how many messages
+func appendRequest(buf []byte, session string, seq uint64, count uint16) []byte {
+    return appendHeader(buf, session, seq, count)
+}
+
+// writeFrame writes a uint16 length-prefixed frame, used on TCP channels
+func writeFrame(w io.Writer, data []byte) error {
+    frame := make([]byte, 2, 2+len(data))
+    binary.BigEndian.PutUint16(frame, uint16(len(data)))
+    _, err := w.Write(append(frame, data...))
+    return err
+}
+
+func readFrame(r *bufio.Reader) ([]byte, error) {
+    header := make([]byte, 2)
+    if _, err := io.ReadFull(r, header); err != nil {
+        return nil, err
+    }
+    data := make([]byte, binary.BigEndian.Uint16(header))
+    if _, err := io.ReadFull(r, data); err != nil {
+        return nil, err
+    }
+    return data, nil
+}
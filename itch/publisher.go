@@ -0,0 +1,476 @@
+package itch
+
+import (
+    "bufio"
+    "encoding/binary"
+    "io"
+    "net"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "go.uber.org/zap"
+
+    "high-frequency-matching-engine/engine"
+)
+
+const (
+    heartbeatInterval = time.Second
+    packetQueueSize   = 65536
+    maxRetransmit     = 1000
+)
+
+type PublisherConfig struct {
+    Session        string
+    FeedAddr       string // UDP destination, unicast or multicast group
+    RetransmitAddr string // TCP listen address for gap requests
+    SnapshotAddr   string // TCP listen address for book snapshots
+    Retain         int    // messages kept for retransmission
+}
+
+// displayedOrder is a resting order as consumers of the feed know it
+type displayedOrder struct {
+    ref      uint64
+    side     engine.OrderSide
+    symbol   string
+    price    float64
+    quantity float64 // total quantity, to detect in-place reductions
+    leaves   float64
+}
+
+// Publisher translates the engine's execution reports into a sequenced
+// market-by-order feed sent over UDP. Recent messages are retained for a
+// TCP retransmission server, and a TCP snapshot server sends the book of
+// displayed orders together with the sequence number it is current to.
+type Publisher struct {
+    cfg    PublisherConfig
+    logger *zap.Logger
+
+    udp                net.Conn
+    packets            chan []byte
+    retransmitListener net.Listener
+    snapshotListener   net.Listener
+    done               chan struct{}
+    wg                 sync.WaitGroup
+
+    nextSeq  uint64
+    retained [][]byte // ring indexed by (seq-1) % len
+    orders   map[string]*displayedOrder
+    nextRef  uint64
+    lastSent time.Time
+    mutex    sync.Mutex
+}
+
+// NewPublisher subscribes to the engine's execution reports. Call Start to
+// open the sockets; reports before then are sequenced and retained but
+// not sent.
+func NewPublisher(matchingEngine *engine.MatchingEngine, cfg PublisherConfig, logger *zap.Logger) *Publisher {
+    if cfg.Retain <= 0 {
+        cfg.Retain = 1000000
+    }
+    p := &Publisher{
+        cfg:      cfg,
+        logger:   logger,
+        packets:  make(chan []byte, packetQueueSize),
+        done:     make(chan struct{}),
+        nextSeq:  1,
+        retained: make([][]byte, cfg.Retain),
+        orders:   make(map[string]*displayedOrder),
+    }
+    matchingEngine.OnExecution(p.onReports)
+    return p
+}
+
+func (p *Publisher) Start() error {
+    udp, err := net.Dial("udp", p.cfg.FeedAddr)
+    if err != nil {
+        return err
+    }
+    p.udp = udp
+
+    if p.retransmitListener, err = net.Listen("tcp", p.cfg.RetransmitAddr); err != nil {
+        udp.Close()
+        return err
+    }
+    if p.snapshotListener, err = net.Listen("tcp", p.cfg.SnapshotAddr); err != nil {
+        udp.Close()
+        p.retransmitListener.Close()
+        return err
+    }
+
+    p.wg.Add(4)
+    go p.sendLoop()
+    go p.heartbeatLoop()
+    go p.acceptLoop(p.retransmitListener, p.serveRetransmit)
+    go p.acceptLoop(p.snapshotListener, p.serveSnapshot)
+
+    p.publish([]Message{SystemEvent{Timestamp: time.Now(), Event: EventStartOfMessages}})
+
+    p.logger.Info("ITCH feed publishing",
+        zap.String("feed", p.cfg.FeedAddr),
+        zap.String("retransmit", p.retransmitListener.Addr().String()),
+        zap.String("snapshot", p.snapshotListener.Addr().String()))
+    return nil
+}
+
+// RetransmitAddr and SnapshotAddr return the bound TCP addresses
+func (p *Publisher) RetransmitAddr() net.Addr {
+    return p.retransmitListener.Addr()
+}
+
+func (p *Publisher) SnapshotAddr() net.Addr {
+    return p.snapshotListener.Addr()
+}
+
+// Close sends the end-of-messages event and an end-of-session packet
+func (p *Publisher) Close() error {
+    p.publish([]Message{SystemEvent{Timestamp: time.Now(), Event: EventEndOfMessages}})
+
+    p.mutex.Lock()
+    p.queue(appendHeader(nil, p.cfg.Session, p.nextSeq, EndOfSession))
+    p.mutex.Unlock()
+
+    close(p.done)
+    p.retransmitListener.Close()
+    p.snapshotListener.Close()
+    p.wg.Wait()
+    return p.udp.Close()
+}
+
+func matchNumber(tradeID string) uint64 {
+    n, _ := strconv.ParseUint(strings.TrimPrefix(tradeID, "T"), 10, 64)
+    return n
+}
+
+// onReports runs under the order book lock with the reports of one book
+// operation
+func (p *Publisher) onReports(reports []*engine.ExecutionReport) {
+    p.mutex.Lock()
+    defer p.mutex.Unlock()
+    p.publishLocked(p.translate(reports))
+}
+
+// translate turns one book operation into feed messages. The incoming
+// order of a submit or a repricing amend is the aggressor: it is displayed
+// only if it comes to rest, and its fills are seen as executions of the
+// resting orders it hits. A resting order the feed never displayed, such
+// as one placed before the publisher subscribed, trades as a Trade.
+func (p *Publisher) translate(reports []*engine.ExecutionReport) []Message {
+    var msgs []Message
+
+    var aggressor *engine.Order
+    first := reports[0]
+    switch first.Type {
+    case engine.EXEC_NEW:
+        aggressor = &first.Order
+        reports = reports[1:]
+    case engine.EXEC_REPLACED:
+        order := &first.Order
+        displayed, exists := p.orders[order.ID]
+        if !exists {
+            break
+        }
+        reports = reports[1:]
+
+        // A same-price reduction keeps priority
+        if order.Price == displayed.price && order.Quantity <= displayed.quantity {
+            if reduced := displayed.quantity - order.Quantity; reduced > 0 {
+                msgs = append(msgs, OrderCancel{Timestamp: first.Timestamp, OrderRef: displayed.ref, Quantity: reduced})
+                displayed.quantity = order.Quantity
+                displayed.leaves -= reduced
+            }
+            break
+        }
+
+        // A repricing without fills is a replace; with fills the old order
+        // is deleted and the amended one re-enters as an aggressor
+        if len(reports) == 0 {
+            p.nextRef++
+            msgs = append(msgs, OrderReplace{
+                Timestamp:   first.Timestamp,
+                OriginalRef: displayed.ref,
+                NewRef:      p.nextRef,
+                Quantity:    order.Quantity - order.Filled,
+                Price:       order.Price,
+            })
+            displayed.ref = p.nextRef
+            displayed.price = order.Price
+            displayed.quantity = order.Quantity
+            displayed.leaves = order.Quantity - order.Filled
+            break
+        }
+        msgs = append(msgs, OrderDelete{Timestamp: first.Timestamp, OrderRef: displayed.ref})
+        delete(p.orders, order.ID)
+        aggressor = order
+    }
+
+    for _, report := range reports {
+        order := &report.Order
+        switch report.Type {
+        case engine.EXEC_TRADE:
+            if aggressor != nil && order.ID == aggressor.ID {
+                aggressor = order
+                continue
+            }
+            displayed, exists := p.orders[order.ID]
+            if !exists {
+                msgs = append(msgs, Trade{
+                    Timestamp:   report.Timestamp,
+                    Side:        order.Side,
+                    Quantity:    report.LastQty,
+                    Symbol:      order.Symbol,
+                    Price:       report.LastPrice,
+                    MatchNumber: matchNumber(report.TradeID),
+                })
+                continue
+            }
+            msgs = append(msgs, OrderExecuted{
+                Timestamp:   report.Timestamp,
+                OrderRef:    displayed.ref,
+                Quantity:    report.LastQty,
+                Price:       report.LastPrice,
+                MatchNumber: matchNumber(report.TradeID),
+            })
+            displayed.leaves -= report.LastQty
+            if order.Status == engine.FILLED {
+                delete(p.orders, order.ID)
+            }
+        case engine.EXEC_CANCELLED:
+            if aggressor != nil && order.ID == aggressor.ID {
+                aggressor = order
+                continue
+            }
+            if displayed, exists := p.orders[order.ID]; exists {
+                msgs = append(msgs, OrderDelete{Timestamp: report.Timestamp, OrderRef: displayed.ref})
+                delete(p.orders, order.ID)
+            }
+        }
+    }
+
+    if aggressor != nil && aggressor.Type == engine.LIMIT &&
+        aggressor.Status != engine.FILLED && aggressor.Status != engine.CANCELLED {
+        p.nextRef++
+        displayed := &displayedOrder{
+            ref:      p.nextRef,
+            side:     aggressor.Side,
+            symbol:   aggressor.Symbol,
+            price:    aggressor.Price,
+            quantity: aggressor.Quantity,
+            leaves:   aggressor.Quantity - aggressor.Filled,
+        }
+        p.orders[aggressor.ID] = displayed
+        msgs = append(msgs, AddOrder{
+            Timestamp: first.Timestamp,
+            OrderRef:  displayed.ref,
+            Side:      displayed.side,
+            Quantity:  displayed.leaves,
+            Symbol:    displayed.symbol,
+            Price:     displayed.price,
+        })
+    }
+    return msgs
+}
+
+func (p *Publisher) publish(msgs []Message) {
+    p.mutex.Lock()
+    defer p.mutex.Unlock()
+    p.publishLocked(msgs)
+}
+
+// publishLocked sequences and retains messages and queues them in packets
+// no larger than MaxPacketSize
+func (p *Publisher) publishLocked(msgs []Message) {
+    if len(msgs) == 0 {
+        return
+    }
+
+    start := p.nextSeq
+    var batch [][]byte
+    size := HeaderLength
+    for _, msg := range msgs {
+        data := Encode(msg)
+        p.retained[(p.nextSeq-1)%uint64(len(p.retained))] = data
+        p.nextSeq++
+
+        if size+2+len(data) > MaxPacketSize {
+            p.queue(AppendPacket(nil, p.cfg.Session, start, batch))
+            start += uint64(len(batch))
+            batch = nil
+            size = HeaderLength
+        }
+        batch = append(batch, data)
+        size += 2 + len(data)
+    }
+    p.queue(AppendPacket(nil, p.cfg.Session, start, batch))
+}
+
+// queue hands a packet to the sender without blocking the engine. Dropped
+// packets are recovered by consumers through retransmission.
+func (p *Publisher) queue(pkt []byte) {
+    p.lastSent = time.Now()
+    select {
+    case p.packets <- pkt:
+    default:
+    }
+}
+
+func (p *Publisher) sendLoop() {
+    defer p.wg.Done()
+    for {
+        select {
+        case <-p.done:
+            // Flush what is queued, including the end of session
+            for {
+                select {
+                case pkt := <-p.packets:
+                    p.send(pkt)
+                default:
+                    return
+                }
+            }
+        case pkt := <-p.packets:
+            p.send(pkt)
+        }
+    }
+}
+
+func (p *Publisher) send(pkt []byte) {
+    if p.udp == nil {
+        return
+    }
+    if _, err := p.udp.Write(pkt); err != nil {
+        p.logger.Debug("ITCH packet send failed", zap.Error(err))
+    }
+}
+
+// heartbeatLoop tells idle consumers the next sequence number so they can
+// detect trailing gaps
+func (p *Publisher) heartbeatLoop() {
+    defer p.wg.Done()
+    ticker := time.NewTicker(heartbeatInterval)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-p.done:
+            return
+        case now := <-ticker.C:
+            p.mutex.Lock()
+            if now.Sub(p.lastSent) >= heartbeatInterval {
+                p.queue(appendHeader(nil, p.cfg.Session, p.nextSeq, 0))
+            }
+            p.mutex.Unlock()
+        }
+    }
+}
+
+func (p *Publisher) acceptLoop(listener net.Listener, serve func(net.Conn)) {
+    defer p.wg.Done()
+    for {
+        conn, err := listener.Accept()
+        if err != nil {
+            return
+        }
+        go func() {
+            defer conn.Close()
+            serve(conn)
+        }()
+    }
+}
+
+// serveRetransmit answers requests of the packet header layout with one
+// framed packet each. Requests older than the retention window are
+// answered with an empty packet whose sequence is the oldest available,
+// telling the consumer to recover from a snapshot instead.
+func (p *Publisher) serveRetransmit(conn net.Conn) {
+    reader := bufio.NewReader(conn)
+    request := make([]byte, HeaderLength)
+    for {
+        conn.SetReadDeadline(time.Now().Add(time.Minute))
+        if _, err := io.ReadFull(reader, request); err != nil {
+            return
+        }
+        seq := binary.BigEndian.Uint64(request[SessionLength:])
+        count := int(binary.BigEndian.Uint16(request[SessionLength+8:]))
+        if count > maxRetransmit {
+            count = maxRetransmit
+        }
+
+        p.mutex.Lock()
+        oldest := uint64(1)
+        if p.nextSeq > uint64(len(p.retained)) {
+            oldest = p.nextSeq - uint64(len(p.retained))
+        }
+        var messages [][]byte
+        start := seq
+        if seq < oldest || seq == 0 {
+            start = oldest
+        } else {
+            size := HeaderLength
+            for s := seq; s < p.nextSeq && len(messages) < count; s++ {
+                data := p.retained[(s-1)%uint64(len(p.retained))]
+                if size+2+len(data) > 65535 {
+                    break
+                }
+                messages = append(messages, data)
+                size += 2 + len(data)
+            }
+        }
+        pkt := AppendPacket(nil, p.cfg.Session, start, messages)
+        p.mutex.Unlock()
+
+        conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+        if err := writeFrame(conn, pkt); err != nil {
+            return
+        }
+    }
+}
+
+// serveSnapshot writes an AddOrder for every displayed order, by symbol,
+// side and priority, followed by a SnapshotEnd carrying the last sequence number the
+// snapshot includes
+func (p *Publisher) serveSnapshot(conn net.Conn) {
+    p.mutex.Lock()
+    now := time.Now()
+    msgs := make([]Message, 0, len(p.orders)+1)
+    for _, order := range p.orders {
+        msgs = append(msgs, AddOrder{
+            Timestamp: now,
+            OrderRef:  order.ref,
+            Side:      order.side,
+            Quantity:  order.leaves,
+            Symbol:    order.symbol,
+            Price:     order.price,
+        })
+    }
+    seq := p.nextSeq - 1
+    p.mutex.Unlock()
+
+    // A new ref is assigned whenever an order loses priority, so within a
+    // price level ref order is time priority
+    sort.Slice(msgs, func(i, j int) bool {
+        a, b := msgs[i].(AddOrder), msgs[j].(AddOrder)
+        if a.Symbol != b.Symbol {
+            return a.Symbol < b.Symbol
+        }
+        if a.Side != b.Side {
+            return a.Side == engine.BUY
+        }
+        if a.Price != b.Price {
+            return (a.Price > b.Price) == (a.Side == engine.BUY)
+        }
+        return a.OrderRef < b.OrderRef
+    })
+    msgs = append(msgs, SnapshotEnd{Timestamp: now, Seq: seq})
+
+    conn.SetWriteDeadline(time.Now().Add(30 * time.Second))
+    writer := bufio.NewWriter(conn)
+    for _, msg := range msgs {
+        if err := writeFrame(writer, Encode(msg)); err != nil {
+            return
+        }
+    }
+    writer.Flush()
+}
@@ -0,0 +1,217 @@
+package itch
+
+import (
+    "bufio"
+    "fmt"
+    "net"
+    "reflect"
+    "testing"
+    "time"
+
+    "go.uber.org/zap"
+
+    "high-frequency-matching-engine/engine"
+)
+
+const testTimeout = 5 * time.Second
+
+func limitOrder(id string, side engine.OrderSide, price, quantity float64) *engine.Order {
+    return &engine.Order{
+        ID:       id,
+        Symbol:   "BTCUSDT",
+        Side:     side,
+        Type:     engine.LIMIT,
+        Price:    price,
+        Quantity: quantity,
+        Status:   engine.PENDING,
+    }
+}
+
+// freeUDPAddr returns a loopback address nothing is listening on
+func freeUDPAddr(t *testing.T) string {
+    t.Helper()
+    conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer conn.Close()
+    return conn.LocalAddr().String()
+}
+
+func startPublisher(t *testing.T, matchingEngine *engine.MatchingEngine, retain int) *Publisher {
+    t.Helper()
+    publisher := NewPublisher(matchingEngine, PublisherConfig{
+        Session:        "TEST",
+        FeedAddr:       freeUDPAddr(t),
+        RetransmitAddr: "127.0.0.1:0",
+        SnapshotAddr:   "127.0.0.1:0",
+        Retain:         retain,
+    }, zap.NewNop())
+    if err := publisher.Start(); err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { publisher.Close() })
+    return publisher
+}
+
+// retained decodes the messages the publisher has sequenced so far
+func retained(t *testing.T, p *Publisher) []Message {
+    t.Helper()
+    p.mutex.Lock()
+    defer p.mutex.Unlock()
+    var msgs []Message
+    for seq := uint64(1); seq < p.nextSeq; seq++ {
+        msg, err := Decode(p.retained[(seq-1)%uint64(len(p.retained))])
+        if err != nil {
+            t.Fatal(err)
+        }
+        msgs = append(msgs, msg)
+    }
+    return msgs
+}
+
+func TestTradeOnlyForUndisplayedOrders(t *testing.T) {
+    matchingEngine := engine.NewMatchingEngine()
+    // Rests before the publisher subscribes, so it is never displayed
+    matchingEngine.ProcessOrder(limitOrder("hidden", engine.SELL, 101, 1))
+
+    publisher := NewPublisher(matchingEngine, PublisherConfig{Session: "TEST", Retain: 100}, zap.NewNop())
+    matchingEngine.ProcessOrder(limitOrder("shown", engine.SELL, 100, 1))
+    matchingEngine.ProcessOrder(limitOrder("buy", engine.BUY, 101, 3))
+
+    var types []byte
+    for _, msg := range retained(t, publisher) {
+        types = append(types, msg.Type())
+        if trade, isTrade := msg.(Trade); isTrade && (trade.Side != engine.SELL || trade.Price != 101) {
+            t.Errorf("trade %+v, want the hidden sell at 101", trade)
+        }
+    }
+    // The shown sell, its execution, the trade with the hidden sell and the
+    // rest of the buy
+    want := []byte{TypeAddOrder, TypeOrderExecuted, TypeTrade, TypeAddOrder}
+    if !reflect.DeepEqual(types, want) {
+        t.Errorf("published %q, want %q", types, want)
+    }
+}
+
+// The receiver rebuilds the engine's book from the UDP feed
+func TestReceiverLoopback(t *testing.T) {
+    matchingEngine := engine.NewMatchingEngine()
+    publisher := startPublisher(t, matchingEngine, 1000)
+
+    // Displayed before the receiver starts, so they come from the snapshot
+    matchingEngine.ProcessOrder(limitOrder("b1", engine.BUY, 99, 2))
+    matchingEngine.ProcessOrder(limitOrder("b2", engine.BUY, 99, 1))
+
+    receiver := NewReceiver(ReceiverConfig{
+        FeedAddr:       publisher.cfg.FeedAddr,
+        RetransmitAddr: publisher.RetransmitAddr().String(),
+        SnapshotAddr:   publisher.SnapshotAddr().String(),
+    }, zap.NewNop())
+    done := make(chan struct{})
+    result := make(chan error, 1)
+    go func() { result <- receiver.Run(done) }()
+    defer func() {
+        close(done)
+        <-result
+    }()
+
+    matchingEngine.ProcessOrder(limitOrder("s1", engine.SELL, 101, 3))
+    matchingEngine.ProcessOrder(limitOrder("s2", engine.SELL, 99, 2.5))
+    matchingEngine.CancelOrder("BTCUSDT", "s1")
+    matchingEngine.ProcessOrder(limitOrder("s3", engine.SELL, 102, 1))
+    if _, _, err := matchingEngine.AmendOrder("BTCUSDT", "s3", 103, 1); err != nil {
+        t.Fatal(err)
+    }
+
+    wantBids := []Level{{Price: 99, Quantity: 0.5, Orders: 1}}
+    wantAsks := []Level{{Price: 103, Quantity: 1, Orders: 1}}
+    deadline := time.Now().Add(testTimeout)
+    for {
+        bids, asks := receiver.Book().Depth("BTCUSDT", 0)
+        if reflect.DeepEqual(bids, wantBids) && reflect.DeepEqual(asks, wantAsks) {
+            break
+        }
+        if time.Now().After(deadline) {
+            t.Fatalf("book is %+v / %+v, want %+v / %+v", bids, asks, wantBids, wantAsks)
+        }
+        time.Sleep(10 * time.Millisecond)
+    }
+}
+
+func TestRetransmission(t *testing.T) {
+    matchingEngine := engine.NewMatchingEngine()
+    publisher := startPublisher(t, matchingEngine, 4)
+    for i, price := range []float64{95, 96, 97, 98, 99} {
+        matchingEngine.ProcessOrder(limitOrder(fmt.Sprint("b", i), engine.BUY, price, 1))
+    }
+    // Start of messages and five adds; the last four are retained
+    want := retained(t, publisher)[2:]
+
+    conn, err := net.DialTimeout("tcp", publisher.RetransmitAddr().String(), testTimeout)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer conn.Close()
+    conn.SetDeadline(time.Now().Add(testTimeout))
+    reader := bufio.NewReader(conn)
+    request := func(seq uint64, count uint16) *Packet {
+        t.Helper()
+        if _, err := conn.Write(appendRequest(nil, "TEST", seq, count)); err != nil {
+            t.Fatal(err)
+        }
+        frame, err := readFrame(reader)
+        if err != nil {
+            t.Fatal(err)
+        }
+        pkt, err := ParsePacket(frame)
+        if err != nil {
+            t.Fatal(err)
+        }
+        return pkt
+    }
+
+    pkt := request(3, 10)
+    if pkt.Seq != 3 || len(pkt.Messages) != len(want) {
+        t.Fatalf("got %d messages from %d, want %d from 3", len(pkt.Messages), pkt.Seq, len(want))
+    }
+    for i, data := range pkt.Messages {
+        if msg, err := Decode(data); err != nil || !reflect.DeepEqual(msg, want[i]) {
+            t.Errorf("message %d is %+v (%v), want %+v", pkt.Seq+uint64(i), msg, err, want[i])
+        }
+    }
+
+    // Older than retained: no messages and the oldest sequence available
+    if pkt := request(1, 10); pkt.Seq != 3 || len(pkt.Messages) != 0 {
+        t.Errorf("stale request got %d messages from %d, want none from 3", len(pkt.Messages), pkt.Seq)
+    }
+}
+
+// A receiver that misses packets fills the gap over TCP before applying
+// the packet that revealed it
+func TestReceiverFillsGap(t *testing.T) {
+    matchingEngine := engine.NewMatchingEngine()
+    publisher := startPublisher(t, matchingEngine, 1000)
+    matchingEngine.ProcessOrder(limitOrder("b1", engine.BUY, 99, 1))
+    matchingEngine.ProcessOrder(limitOrder("s1", engine.SELL, 101, 1))
+    matchingEngine.ProcessOrder(limitOrder("s2", engine.SELL, 102, 1))
+
+    msgs := retained(t, publisher)
+    receiver := NewReceiver(ReceiverConfig{RetransmitAddr: publisher.RetransmitAddr().String()}, zap.NewNop())
+    receiver.nextSeq = 1
+    var seqs []uint64
+    receiver.OnMessage = func(seq uint64, msg Message) { seqs = append(seqs, seq) }
+
+    last := uint64(len(msgs))
+    pkt := &Packet{Session: "TEST", Seq: last, Count: 1, Messages: [][]byte{Encode(msgs[last-1])}}
+    if err := receiver.handlePacket(pkt); err != nil {
+        t.Fatal(err)
+    }
+    if !reflect.DeepEqual(seqs, []uint64{1, 2, 3, 4}) {
+        t.Errorf("applied %v, want 1 to 4 in order", seqs)
+    }
+    bids, asks := receiver.Book().Depth("BTCUSDT", 0)
+    if len(bids) != 1 || len(asks) != 2 {
+        t.Errorf("book is %+v / %+v, want one bid and two asks", bids, asks)
+    }
+}
@@ -0,0 +1,242 @@
+package itch
+
+import (
+    "bufio"
+    "errors"
+    "fmt"
+    "net"
+    "time"
+
+    "go.uber.org/zap"
+)
+
+const (
+    receiveBufferSize = 65536
+    tcpTimeout        = 5 * time.Second
+)
+
+var ErrEndOfSession = errors.New("ITCH session ended")
+
+type ReceiverConfig struct {
+    FeedAddr       string // UDP address to listen on; joined if multicast
+    Interface      string // network interface for multicast, optional
+    RetransmitAddr string
+    SnapshotAddr   string
+}
+
+// Receiver is the reference consumer of the feed. It starts from a
+// snapshot, applies UDP packets in sequence, fills gaps from the
+// retransmission server and falls back to a new snapshot when a gap is
+// older than the server retains.
+type Receiver struct {
+    cfg     ReceiverConfig
+    book    *Book
+    logger  *zap.Logger
+    conn    *net.UDPConn
+    session string
+    nextSeq uint64
+
+    // OnMessage, if set, is called for every message after it is applied
+    OnMessage func(seq uint64, msg Message)
+}
+
+func NewReceiver(cfg ReceiverConfig, logger *zap.Logger) *Receiver {
+    return &Receiver{cfg: cfg, book: NewBook(), logger: logger}
+}
+
+func (r *Receiver) Book() *Book {
+    return r.book
+}
+
+// Run consumes the feed until done is closed, the session ends or an
+// unrecoverable error occurs
+func (r *Receiver) Run(done <-chan struct{}) error {
+    addr, err := net.ResolveUDPAddr("udp", r.cfg.FeedAddr)
+    if err != nil {
+        return err
+    }
+    if addr.IP != nil && addr.IP.IsMulticast() {
+        var iface *net.Interface
+        if r.cfg.Interface != "" {
+            if iface, err = net.InterfaceByName(r.cfg.Interface); err != nil {
+                return err
+            }
+        }
+        r.conn, err = net.ListenMulticastUDP("udp", iface, addr)
+    } else {
+        r.conn, err = net.ListenUDP("udp", addr)
+    }
+    if err != nil {
+        return err
+    }
+    defer r.conn.Close()
+    r.conn.SetReadBuffer(4 << 20)
+
+    // Buffer packets while the snapshot loads
+    packets := make(chan *Packet, receiveBufferSize)
+    readErr := make(chan error, 1)
+    go func() {
+        buf := make([]byte, 65536)
+        for {
+            n, err := r.conn.Read(buf)
+            if err != nil {
+                readErr <- err
+                return
+            }
+            pkt, err := ParsePacket(append([]byte(nil), buf[:n]...))
+            if err != nil {
+                r.logger.Warn("Discarding invalid ITCH packet", zap.Error(err))
+                continue
+            }
+            packets <- pkt
+        }
+    }()
+    go func() {
+        <-done
+        r.conn.Close()
+    }()
+
+    if err := r.loadSnapshot(); err != nil {
+        return err
+    }
+
+    for {
+        select {
+        case <-done:
+            return nil
+        case err := <-readErr:
+            select {
+            case <-done:
+                return nil
+            default:
+                return err
+            }
+        case pkt := <-packets:
+            if err := r.handlePacket(pkt); err != nil {
+                return err
+            }
+        }
+    }
+}
+
+func (r *Receiver) handlePacket(pkt *Packet) error {
+    if r.session == "" {
+        r.session = pkt.Session
+    }
+    if pkt.Count == EndOfSession {
+        return ErrEndOfSession
+    }
+
+    // Heartbeats carry the next sequence number
+    end := pkt.Seq + uint64(len(pkt.Messages))
+    if end <= r.nextSeq {
+        return nil
+    }
+    if pkt.Seq > r.nextSeq {
+        if err := r.recover(pkt.Seq); err != nil {
+            return err
+        }
+    }
+
+    for i, data := range pkt.Messages {
+        seq := pkt.Seq + uint64(i)
+        if seq < r.nextSeq {
+            continue
+        }
+        if err := r.apply(seq, data); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (r *Receiver) apply(seq uint64, data []byte) error {
+    msg, err := Decode(data)
+    if err != nil {
+        return fmt.Errorf("message %d: %w", seq, err)
+    }
+    r.book.Apply(msg)
+    r.nextSeq = seq + 1
+    if r.OnMessage != nil {
+        r.OnMessage(seq, msg)
+    }
+    return nil
+}
+
+// recover fills the gap up to (not including) until from the
+// retransmission server, reloading a snapshot if it is too old
+func (r *Receiver) recover(until uint64) error {
+    r.logger.Info("ITCH gap detected", zap.Uint64("from", r.nextSeq), zap.Uint64("to", until-1))
+
+    conn, err := net.DialTimeout("tcp", r.cfg.RetransmitAddr, tcpTimeout)
+    if err != nil {
+        return err
+    }
+    defer conn.Close()
+    reader := bufio.NewReader(conn)
+
+    for r.nextSeq < until {
+        count := until - r.nextSeq
+        if count > maxRetransmit {
+            count = maxRetransmit
+        }
+        conn.SetDeadline(time.Now().Add(tcpTimeout))
+        if _, err := conn.Write(appendRequest(nil, r.session, r.nextSeq, uint16(count))); err != nil {
+            return err
+        }
+        frame, err := readFrame(reader)
+        if err != nil {
+            return err
+        }
+        pkt, err := ParsePacket(frame)
+        if err != nil {
+            return err
+        }
+
+        if len(pkt.Messages) == 0 {
+            if pkt.Seq > r.nextSeq {
+                r.logger.Info("ITCH gap no longer retained, reloading snapshot")
+                if err := r.loadSnapshot(); err != nil {
+                    return err
+                }
+                continue
+            }
+            return fmt.Errorf("retransmission of %d returned nothing", r.nextSeq)
+        }
+        for i, data := range pkt.Messages {
+            if err := r.apply(pkt.Seq+uint64(i), data); err != nil {
+                return err
+            }
+        }
+    }
+    return nil
+}
+
+// loadSnapshot replaces the book with a snapshot and resumes after it
+func (r *Receiver) loadSnapshot() error {
+    conn, err := net.DialTimeout("tcp", r.cfg.SnapshotAddr, tcpTimeout)
+    if err != nil {
+        return err
+    }
+    defer conn.Close()
+    conn.SetDeadline(time.Now().Add(30 * time.Second))
+    reader := bufio.NewReader(conn)
+
+    r.book.Reset()
+    for {
+        frame, err := readFrame(reader)
+        if err != nil {
+            return err
+        }
+        msg, err := Decode(frame)
+        if err != nil {
+            return err
+        }
+        if end, isEnd := msg.(SnapshotEnd); isEnd {
+            r.nextSeq = end.Seq + 1
+            r.logger.Info("ITCH snapshot loaded", zap.Int("orders", r.book.Orders()), zap.Uint64("seq", end.Seq))
+            return nil
+        }
+        r.book.Apply(msg)
+    }
+}
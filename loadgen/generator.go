@@ -0,0 +1,438 @@
+// Package loadgen generates synthetic order flow for load testing and
+// simulation. Orders arrive as a Poisson process around a simulated mid
+// price per symbol, with a configurable mix of limit and market orders,
+// cancels and amends from many clients, against the engine in-process or
+// over its API.
+package loadgen
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "math/rand"
+    "sort"
+    "sync"
+    "time"
+
+    "high-frequency-matching-engine/engine"
+)
+
+// Action is one kind of generated order flow
+type Action string
+
+const (
+    ActionLimit  Action = "limit"
+    ActionMarket Action = "market"
+    ActionCancel Action = "cancel"
+    ActionAmend  Action = "amend"
+)
+
+var actions = []Action{ActionLimit, ActionMarket, ActionCancel, ActionAmend}
+
+// Mix weighs the kinds of action generated. Cancels and amends pick one
+// of the worker's resting orders and become limit orders when it has none.
+type Mix struct {
+    Limit  float64
+    Market float64
+    Cancel float64
+    Amend  float64
+}
+
+// Config sets up a load run. Rate is the mean arrival rate per second; at
+// zero workers send back to back as fast as the target allows. The run
+// ends after Duration or once Orders actions have been generated,
+// whichever comes first.
+type Config struct {
+    Symbols  []string
+    Rate     float64
+    Duration time.Duration
+    Orders   int
+    Workers  int
+    Clients  int
+    Mix      Mix
+    Price    PriceConfig
+
+    Spread      int     // limit prices fall within this many ticks of the mid
+    MinQuantity float64 // order sizes are uniform in [MinQuantity, MaxQuantity]
+    MaxQuantity float64
+    LotSize     float64
+    MaxOpen     int   // resting orders a worker tracks before it cancels rather than places
+    Seed        int64 // 0 seeds from the clock
+}
+
+func (cfg *Config) setDefaults() error {
+    if len(cfg.Symbols) == 0 {
+        cfg.Symbols = []string{"LOADTEST"}
+    }
+    if cfg.Duration <= 0 && cfg.Orders <= 0 {
+        cfg.Duration = 10 * time.Second
+    }
+    if cfg.Workers <= 0 {
+        cfg.Workers = 1
+    }
+    if cfg.Clients < cfg.Workers {
+        cfg.Clients = cfg.Workers
+    }
+    if cfg.Mix == (Mix{}) {
+        cfg.Mix = Mix{Limit: 0.6, Market: 0.1, Cancel: 0.2, Amend: 0.1}
+    }
+    if cfg.Mix.Limit < 0 || cfg.Mix.Market < 0 || cfg.Mix.Cancel < 0 || cfg.Mix.Amend < 0 {
+        return errors.New("order mix weights must not be negative")
+    }
+    if cfg.Price.Model != "" && cfg.Price.Model != "walk" && cfg.Price.Model != "gbm" {
+        return fmt.Errorf("unknown price model %q", cfg.Price.Model)
+    }
+    if cfg.Price.TickSize <= 0 {
+        cfg.Price.TickSize = 0.01
+    }
+    if cfg.Price.Start <= 0 {
+        cfg.Price.Start = 100
+    }
+    if cfg.Spread <= 0 {
+        cfg.Spread = 10
+    }
+    if cfg.LotSize <= 0 {
+        cfg.LotSize = 0.001
+    }
+    if cfg.MinQuantity <= 0 {
+        cfg.MinQuantity = cfg.LotSize
+    }
+    if cfg.MaxQuantity < cfg.MinQuantity {
+        cfg.MaxQuantity = cfg.MinQuantity
+    }
+    if cfg.MaxOpen <= 0 {
+        cfg.MaxOpen = 1000
+    }
+    if cfg.Seed == 0 {
+        cfg.Seed = time.Now().UnixNano()
+    }
+    return nil
+}
+
+// job is one generated action, priced by the generator and carried out by
+// a worker
+type job struct {
+    action    Action
+    symbol    string
+    side      engine.OrderSide
+    price     float64
+    mid       float64
+    quantity  float64
+    scheduled time.Time
+}
+
+// restingOrder is an order a worker placed and believes is still resting
+type restingOrder struct {
+    symbol   string
+    id       string
+    side     engine.OrderSide
+    quantity float64
+}
+
+// ActionReport summarizes one kind of action. Latency is the target's
+// response time; Response adds any time spent queued behind schedule,
+// so it is not hidden when the target falls behind an open-loop rate.
+type ActionReport struct {
+    Action   Action       `json:"action"`
+    Errors   int64        `json:"errors"`
+    Missed   int64        `json:"missed"` // cancels and amends of orders already filled
+    Latency  LatencyStats `json:"latency"`
+    Response LatencyStats `json:"response"`
+}
+
+// Report is the outcome of a load run
+type Report struct {
+    Elapsed    time.Duration  `json:"elapsed"`
+    Actions    int64          `json:"actions"`
+    Throughput float64        `json:"throughput"` // actions per second
+    TargetRate float64        `json:"target_rate"`
+    Trades     int64          `json:"trades"`
+    Errors     int64          `json:"errors"`
+    ByAction   []ActionReport `json:"by_action"`
+    Total      ActionReport   `json:"total"`
+    FirstError string         `json:"first_error,omitempty"`
+}
+
+// workerStats is kept per worker and merged at the end, so recording
+// never contends
+type workerStats struct {
+    latency  map[Action]*histogram
+    response map[Action]*histogram
+    errors   map[Action]int64
+    missed   map[Action]int64
+    trades   int64
+    firstErr error
+}
+
+func newWorkerStats() *workerStats {
+    ws := &workerStats{
+        latency:  make(map[Action]*histogram),
+        response: make(map[Action]*histogram),
+        errors:   make(map[Action]int64),
+        missed:   make(map[Action]int64),
+    }
+    for _, action := range actions {
+        ws.latency[action] = &histogram{}
+        ws.response[action] = &histogram{}
+    }
+    return ws
+}
+
+// Generator runs synthetic order flow against a target
+type Generator struct {
+    cfg    Config
+    target Target
+}
+
+func NewGenerator(target Target, cfg Config) (*Generator, error) {
+    if err := cfg.setDefaults(); err != nil {
+        return nil, err
+    }
+    return &Generator{cfg: cfg, target: target}, nil
+}
+
+// Run generates order flow until the configured duration or order count
+// is reached or ctx is cancelled, waits for the workers to finish and
+// reports what was achieved
+func (g *Generator) Run(ctx context.Context) *Report {
+    if g.cfg.Duration > 0 {
+        var cancel context.CancelFunc
+        ctx, cancel = context.WithTimeout(ctx, g.cfg.Duration)
+        defer cancel()
+    }
+
+    jobs := make(chan job, 4096)
+    stats := make([]*workerStats, g.cfg.Workers)
+    run := time.Now().UnixNano() % 1e9
+
+    var wg sync.WaitGroup
+    start := time.Now()
+    for w := range stats {
+        stats[w] = newWorkerStats()
+        wg.Add(1)
+        go func(w int) {
+            defer wg.Done()
+            g.work(w, run, jobs, stats[w])
+        }(w)
+    }
+
+    g.schedule(ctx, jobs)
+    close(jobs)
+    wg.Wait()
+
+    return g.report(time.Since(start), stats)
+}
+
+// schedule generates jobs with exponential gaps between arrivals, sleeping
+// only when more than a millisecond ahead so high rates are reachable
+func (g *Generator) schedule(ctx context.Context, jobs chan<- job) {
+    rng := rand.New(rand.NewSource(g.cfg.Seed))
+    mids := make(map[string]*midPrice, len(g.cfg.Symbols))
+    for _, symbol := range g.cfg.Symbols {
+        mids[symbol] = newMidPrice(g.cfg.Price)
+    }
+
+    next := time.Now()
+    for n := 0; g.cfg.Orders <= 0 || n < g.cfg.Orders; n++ {
+        if g.cfg.Rate > 0 {
+            next = next.Add(time.Duration(rng.ExpFloat64() / g.cfg.Rate * float64(time.Second)))
+            if wait := time.Until(next); wait > time.Millisecond {
+                timer := time.NewTimer(wait)
+                select {
+                case <-ctx.Done():
+                    timer.Stop()
+                    return
+                case <-timer.C:
+                }
+            }
+        } else {
+            next = time.Now()
+        }
+
+        // Prices move on by arrival time in open loop and by wall time
+        // when closed
+        symbol := g.cfg.Symbols[rng.Intn(len(g.cfg.Symbols))]
+        mid := mids[symbol].step(rng, next)
+
+        j := job{
+            action:    g.pickAction(rng),
+            symbol:    symbol,
+            side:      engine.OrderSide(rng.Intn(2)),
+            mid:       mid,
+            quantity:  g.quantity(rng),
+            scheduled: next,
+        }
+        // Buys go below the mid and sells above it by up to Spread ticks;
+        // about one in five crosses it by up to a quarter of that
+        distance := float64(rng.Intn(g.cfg.Spread+g.cfg.Spread/4+1)-g.cfg.Spread/4) * g.cfg.Price.TickSize
+        if j.side == engine.BUY {
+            distance = -distance
+        }
+        j.price = max(roundTo(mid+distance, g.cfg.Price.TickSize), g.cfg.Price.TickSize)
+
+        select {
+        case jobs <- j:
+        case <-ctx.Done():
+            return
+        }
+    }
+}
+
+func (g *Generator) pickAction(rng *rand.Rand) Action {
+    mix := g.cfg.Mix
+    r := rng.Float64() * (mix.Limit + mix.Market + mix.Cancel + mix.Amend)
+    switch {
+    case r < mix.Limit:
+        return ActionLimit
+    case r < mix.Limit+mix.Market:
+        return ActionMarket
+    case r < mix.Limit+mix.Market+mix.Cancel:
+        return ActionCancel
+    default:
+        return ActionAmend
+    }
+}
+
+func (g *Generator) quantity(rng *rand.Rand) float64 {
+    quantity := g.cfg.MinQuantity + rng.Float64()*(g.cfg.MaxQuantity-g.cfg.MinQuantity)
+    return max(roundTo(quantity, g.cfg.LotSize), g.cfg.LotSize)
+}
+
+// work carries out jobs for its share of the clients. Worker w acts for
+// clients w, w+Workers, ... and only cancels and amends its own orders.
+func (g *Generator) work(w int, run int64, jobs <-chan job, stats *workerStats) {
+    rng := rand.New(rand.NewSource(g.cfg.Seed + int64(w) + 1))
+    clients := (g.cfg.Clients - w + g.cfg.Workers - 1) / g.cfg.Workers
+    var open []restingOrder
+    sequence := 0
+
+    for j := range jobs {
+        action := j.action
+        if (action == ActionCancel || action == ActionAmend) && len(open) == 0 {
+            action = ActionLimit
+        }
+        // Too many tracked orders: cancel one instead
+        if action == ActionLimit && len(open) >= g.cfg.MaxOpen {
+            action = ActionCancel
+        }
+
+        var result Result
+        var err error
+        begin := time.Now()
+        switch action {
+        case ActionLimit, ActionMarket:
+            sequence++
+            order := &engine.Order{
+                ID:       fmt.Sprintf("LG%d_%d_%d", run, w, sequence),
+                Symbol:   j.symbol,
+                Side:     j.side,
+                Type:     engine.LIMIT,
+                Quantity: j.quantity,
+                Price:    j.price,
+                ClientID: fmt.Sprintf("load-%d", w+rng.Intn(clients)*g.cfg.Workers),
+            }
+            if action == ActionMarket {
+                order.Type = engine.MARKET
+                order.Price = 0
+            }
+            result, err = g.target.Submit(order)
+            if err == nil && result.Resting {
+                open = append(open, restingOrder{symbol: order.Symbol, id: order.ID, side: order.Side, quantity: order.Quantity})
+            }
+
+        case ActionCancel:
+            i := rng.Intn(len(open))
+            order := open[i]
+            open = removeOrder(open, i)
+            err = g.target.Cancel(order.symbol, order.id)
+
+        case ActionAmend:
+            i := rng.Intn(len(open))
+            order := &open[i]
+            // Requote on the order's own side of the current mid
+            offset := float64(rng.Intn(g.cfg.Spread)+1) * g.cfg.Price.TickSize
+            if order.side == engine.SELL {
+                offset = -offset
+            }
+            price := max(roundTo(j.mid-offset, g.cfg.Price.TickSize), g.cfg.Price.TickSize)
+            result, err = g.target.Amend(order.symbol, order.id, price, j.quantity)
+            if err != nil || !result.Resting {
+                open = removeOrder(open, i)
+            } else {
+                order.quantity = j.quantity
+            }
+        }
+        done := time.Now()
+
+        // Orders filled meanwhile by other clients are not failures
+        if errors.Is(err, engine.ErrOrderNotFound) || errors.Is(err, engine.ErrInvalidAmend) {
+            stats.missed[action]++
+        } else if err != nil {
+            stats.errors[action]++
+            if stats.firstErr == nil {
+                stats.firstErr = err
+            }
+            continue
+        }
+        stats.trades += int64(result.Trades)
+        // Jobs can go out up to a millisecond early; count them from when
+        // they started
+        scheduled := j.scheduled
+        if scheduled.After(begin) {
+            scheduled = begin
+        }
+        stats.latency[action].record(done.Sub(begin))
+        stats.response[action].record(done.Sub(scheduled))
+    }
+}
+
+// removeOrder drops open[i], moving the last order into its place
+func removeOrder(open []restingOrder, i int) []restingOrder {
+    open[i] = open[len(open)-1]
+    return open[:len(open)-1]
+}
+
+func (g *Generator) report(elapsed time.Duration, stats []*workerStats) *Report {
+    report := &Report{Elapsed: elapsed, TargetRate: g.cfg.Rate}
+    totalLatency, totalResponse := &histogram{}, &histogram{}
+
+    for _, action := range actions {
+        latency, response := &histogram{}, &histogram{}
+        ar := ActionReport{Action: action}
+        for _, ws := range stats {
+            latency.merge(ws.latency[action])
+            response.merge(ws.response[action])
+            ar.Errors += ws.errors[action]
+            ar.Missed += ws.missed[action]
+        }
+        ar.Latency = latency.stats()
+        ar.Response = response.stats()
+        totalLatency.merge(latency)
+        totalResponse.merge(response)
+        report.Total.Errors += ar.Errors
+        report.Total.Missed += ar.Missed
+        report.ByAction = append(report.ByAction, ar)
+    }
+    report.Total.Action = "total"
+    report.Total.Latency = totalLatency.stats()
+    report.Total.Response = totalResponse.stats()
+
+    var firstErrs []string
+    for _, ws := range stats {
+        report.Trades += ws.trades
+        if ws.firstErr != nil {
+            firstErrs = append(firstErrs, ws.firstErr.Error())
+        }
+    }
+    if len(firstErrs) > 0 {
+        sort.Strings(firstErrs)
+        report.FirstError = firstErrs[0]
+    }
+
+    report.Errors = report.Total.Errors
+    report.Actions = report.Total.Latency.Count + report.Errors
+    if elapsed > 0 {
+        report.Throughput = float64(report.Actions) / elapsed.Seconds()
+    }
+    return report
+}
@@ -0,0 +1,62 @@
+package loadgen
+
+import (
+    "math"
+    "math/rand"
+    "time"
+)
+
+// PriceConfig drives each symbol's mid price. Model is "walk", an
+// arithmetic random walk where Volatility is in price units per square
+// root second, or "gbm", geometric Brownian motion where Volatility and
+// Drift are fractions per square root second and per second.
+type PriceConfig struct {
+    Model      string
+    Start      float64
+    Volatility float64
+    Drift      float64
+    TickSize   float64
+}
+
+// midPrice is one symbol's simulated mid, moved on by the time since it
+// was last used
+type midPrice struct {
+    cfg   PriceConfig
+    price float64
+    last  time.Time
+}
+
+func newMidPrice(cfg PriceConfig) *midPrice {
+    return &midPrice{cfg: cfg, price: cfg.Start}
+}
+
+func (m *midPrice) step(rng *rand.Rand, now time.Time) float64 {
+    seconds := 0.0
+    if !m.last.IsZero() {
+        seconds = now.Sub(m.last).Seconds()
+    }
+    m.last = now
+    if seconds <= 0 {
+        return m.price
+    }
+
+    z := rng.NormFloat64()
+    switch m.cfg.Model {
+    case "gbm":
+        sigma := m.cfg.Volatility
+        m.price *= math.Exp((m.cfg.Drift-sigma*sigma/2)*seconds + sigma*math.Sqrt(seconds)*z)
+    default:
+        m.price += m.cfg.Volatility * math.Sqrt(seconds) * z
+    }
+
+    // Keep the walk off zero so limit prices stay positive
+    if m.price < m.cfg.TickSize*10 {
+        m.price = m.cfg.TickSize * 10
+    }
+    return m.price
+}
+
+// roundTo rounds v to a multiple of step
+func roundTo(v, step float64) float64 {
+    return math.Round(math.Round(v/step)*step*1e8) / 1e8
+}
@@ -0,0 +1,87 @@
+package loadgen
+
+import (
+    "math"
+    "time"
+)
+
+// Histogram buckets grow by 1% from 100ns, so percentiles are within 1%
+// of the true value in constant memory however long the run
+const (
+    histogramMin     = 100 * time.Nanosecond
+    histogramGrowth  = 1.01
+    histogramBuckets = 2400 // up to about 40 minutes
+)
+
+var histogramLogGrowth = math.Log(histogramGrowth)
+
+type histogram struct {
+    counts [histogramBuckets]uint64
+    total  uint64
+    sum    time.Duration
+    max    time.Duration
+}
+
+func (h *histogram) record(d time.Duration) {
+    bucket := 0
+    if d > histogramMin {
+        bucket = int(math.Log(float64(d)/float64(histogramMin)) / histogramLogGrowth)
+        bucket = min(bucket, histogramBuckets-1)
+    }
+    h.counts[bucket]++
+    h.total++
+    h.sum += d
+    h.max = max(h.max, d)
+}
+
+func (h *histogram) merge(other *histogram) {
+    for i, count := range other.counts {
+        h.counts[i] += count
+    }
+    h.total += other.total
+    h.sum += other.sum
+    h.max = max(h.max, other.max)
+}
+
+// percentile returns the upper bound of the bucket holding the p-th value
+func (h *histogram) percentile(p float64) time.Duration {
+    if h.total == 0 {
+        return 0
+    }
+    rank := uint64(math.Ceil(p * float64(h.total)))
+    var seen uint64
+    for i, count := range h.counts {
+        seen += count
+        if seen >= rank {
+            upper := time.Duration(float64(histogramMin) * math.Pow(histogramGrowth, float64(i+1)))
+            return min(upper, h.max)
+        }
+    }
+    return h.max
+}
+
+// LatencyStats summarizes the latencies of one kind of action
+type LatencyStats struct {
+    Count int64         `json:"count"`
+    Mean  time.Duration `json:"mean"`
+    P50   time.Duration `json:"p50"`
+    P90   time.Duration `json:"p90"`
+    P99   time.Duration `json:"p99"`
+    P999  time.Duration `json:"p999"`
+    Max   time.Duration `json:"max"`
+}
+
+func (h *histogram) stats() LatencyStats {
+    stats := LatencyStats{
+        Count: int64(h.total),
+        P50:   h.percentile(0.50),
+        P90:   h.percentile(0.90),
+        P99:   h.percentile(0.99),
+        P999:  h.percentile(0.999),
+        Max:   h.max,
+    }
+    if h.total > 0 {
+        stats.Mean = h.sum / time.Duration(h.total)
+    }
+    return stats
+}
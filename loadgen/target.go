@@ -0,0 +1,166 @@
+package loadgen
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+    "time"
+
+    "high-frequency-matching-engine/engine"
+)
+
+// Result is what a target reports for one order action
+type Result struct {
+    Resting bool // the order is still on the book afterwards
+    Trades  int
+}
+
+// Target executes generated order flow. Cancel and Amend return
+// engine.ErrOrderNotFound for orders that have already left the book, and
+// Amend engine.ErrInvalidAmend below the filled quantity.
+// Targets are called from many workers at once.
+type Target interface {
+    Submit(order *engine.Order) (Result, error)
+    Cancel(symbol, orderID string) error
+    Amend(symbol, orderID string, price, quantity float64) (Result, error)
+}
+
+// EngineTarget drives a MatchingEngine in-process
+type EngineTarget struct {
+    engine *engine.MatchingEngine
+}
+
+func NewEngineTarget(me *engine.MatchingEngine) *EngineTarget {
+    return &EngineTarget{engine: me}
+}
+
+// Submit works out from the trades whether the order rested, as other
+// workers may already be filling it
+func (t *EngineTarget) Submit(order *engine.Order) (Result, error) {
+    orderType, quantity := order.Type, order.Quantity
+    trades := t.engine.ProcessOrder(order)
+
+    var filled float64
+    for _, trade := range trades {
+        filled += trade.Quantity
+    }
+    return Result{Resting: orderType == engine.LIMIT && filled < quantity-1e-9, Trades: len(trades)}, nil
+}
+
+func (t *EngineTarget) Cancel(symbol, orderID string) error {
+    if !t.engine.CancelOrder(symbol, orderID) {
+        return engine.ErrOrderNotFound
+    }
+    return nil
+}
+
+func (t *EngineTarget) Amend(symbol, orderID string, price, quantity float64) (Result, error) {
+    order, trades, err := t.engine.AmendOrder(symbol, orderID, price, quantity)
+    if err != nil {
+        return Result{}, err
+    }
+    return Result{Resting: resting(order.Type, order.Status), Trades: len(trades)}, nil
+}
+
+func resting(orderType engine.OrderType, status engine.OrderStatus) bool {
+    return orderType == engine.LIMIT && (status == engine.PENDING || status == engine.PARTIAL)
+}
+
+// APITarget drives a running engine through its REST API
+type APITarget struct {
+    baseURL string
+    client  *http.Client
+}
+
+// NewAPITarget keeps up to conns connections open to the server at baseURL
+func NewAPITarget(baseURL string, conns int) *APITarget {
+    transport := http.DefaultTransport.(*http.Transport).Clone()
+    transport.MaxIdleConns = conns
+    transport.MaxIdleConnsPerHost = conns
+    return &APITarget{
+        baseURL: baseURL,
+        client:  &http.Client{Transport: transport, Timeout: 10 * time.Second},
+    }
+}
+
+type orderResponse struct {
+    Order  engine.Order    `json:"order"`
+    Trades []*engine.Trade `json:"trades"`
+}
+
+func (t *APITarget) Submit(order *engine.Order) (Result, error) {
+    body, err := json.Marshal(order)
+    if err != nil {
+        return Result{}, err
+    }
+    var response orderResponse
+    if err := t.do(http.MethodPost, "/orders", nil, body, &response); err != nil {
+        return Result{}, err
+    }
+    return Result{Resting: resting(response.Order.Type, response.Order.Status), Trades: len(response.Trades)}, nil
+}
+
+func (t *APITarget) Cancel(symbol, orderID string) error {
+    params := url.Values{"symbol": {symbol}, "order_id": {orderID}}
+    var response struct {
+        Cancelled bool `json:"cancelled"`
+    }
+    if err := t.do(http.MethodDelete, "/orders/cancel", params, nil, &response); err != nil {
+        return err
+    }
+    if !response.Cancelled {
+        return engine.ErrOrderNotFound
+    }
+    return nil
+}
+
+func (t *APITarget) Amend(symbol, orderID string, price, quantity float64) (Result, error) {
+    params := url.Values{
+        "symbol":   {symbol},
+        "order_id": {orderID},
+        "price":    {strconv.FormatFloat(price, 'f', -1, 64)},
+        "quantity": {strconv.FormatFloat(quantity, 'f', -1, 64)},
+    }
+    var response orderResponse
+    if err := t.do(http.MethodPut, "/orders/amend", params, nil, &response); err != nil {
+        return Result{}, err
+    }
+    return Result{Resting: resting(response.Order.Type, response.Order.Status), Trades: len(response.Trades)}, nil
+}
+
+func (t *APITarget) do(method, path string, params url.Values, body []byte, result interface{}) error {
+    target := t.baseURL + path
+    if params != nil {
+        target += "?" + params.Encode()
+    }
+    req, err := http.NewRequest(method, target, bytes.NewReader(body))
+    if err != nil {
+        return err
+    }
+    if body != nil {
+        req.Header.Set("Content-Type", "application/json")
+    }
+
+    resp, err := t.client.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK {
+        message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+        switch {
+        case resp.StatusCode == http.StatusNotFound:
+            return engine.ErrOrderNotFound
+        case strings.TrimSpace(string(message)) == engine.ErrInvalidAmend.Error():
+            return engine.ErrInvalidAmend
+        }
+        return fmt.Errorf("%s %s: status %d: %s", method, path, resp.StatusCode, bytes.TrimSpace(message))
+    }
+    return json.NewDecoder(resp.Body).Decode(result)
+}
@@ -0,0 +1,95 @@
+package marketdata
+
+import (
+    "encoding/json"
+    "fmt"
+    "strconv"
+    "strings"
+
+    "high-frequency-matching-engine/engine"
+)
+
+// FeedAdapter speaks one exchange's WebSocket market data API. It builds the
+// subscription messages for the configured symbols and turns incoming
+// messages into market data with symbols normalized to the engine's form,
+// e.g. BTCUSDT. The feeder fills in Exchange and ReceiveTime.
+type FeedAdapter interface {
+    Name() string
+
+    // SubscribeMessages returns the messages to send after connecting, in
+    // order
+    SubscribeMessages(symbols []string) ([]interface{}, error)
+
+    // Parse decodes one message. Acknowledgements, heartbeats and other
+    // messages without market data return nothing; exchange errors return
+    // an error.
+    Parse(data []byte) ([]*engine.MarketData, error)
+}
+
+// NewFeedAdapter returns the adapter for an exchange name. restURL
+// overrides the exchange's REST API base where one is used; the generic
+// adapter is configured entirely by generic.
+func NewFeedAdapter(name, restURL string, generic GenericConfig) (FeedAdapter, error) {
+    switch strings.ToLower(name) {
+    case "binance":
+        return NewBinanceAdapter(restURL), nil
+    case "coinbase":
+        return NewCoinbaseAdapter(), nil
+    case "kraken":
+        return NewKrakenAdapter(), nil
+    case "generic":
+        return NewGenericAdapter(generic)
+    default:
+        return nil, fmt.Errorf("unsupported exchange %q", name)
+    }
+}
+
+// NormalizeSymbol strips separators and upper-cases an exchange symbol, so
+// BTC-USD and btc/usd both become BTCUSD
+func NormalizeSymbol(symbol string) string {
+    return strings.ToUpper(strings.NewReplacer("-", "", "/", "", "_", "", ":", "").Replace(symbol))
+}
+
+// number accepts the JSON number encodings exchanges use: plain numbers and
+// numeric strings. Anything else is zero.
+type number float64
+
+func (n *number) UnmarshalJSON(data []byte) error {
+    text := strings.Trim(string(data), `"`)
+    if text == "" || text == "null" {
+        *n = 0
+        return nil
+    }
+    value, err := strconv.ParseFloat(text, 64)
+    if err != nil {
+        return err
+    }
+    *n = number(value)
+    return nil
+}
+
+// depthLevels reads [price, quantity, ...] arrays
+func depthLevels(raw [][]number) []DepthLevel {
+    levels := make([]DepthLevel, 0, len(raw))
+    for _, entry := range raw {
+        if len(entry) >= 2 {
+            levels = append(levels, DepthLevel{Price: float64(entry[0]), Quantity: float64(entry[1])})
+        }
+    }
+    return levels
+}
+
+// toNumber converts a decoded JSON value into a float
+func toNumber(value interface{}) (float64, bool) {
+    switch v := value.(type) {
+    case float64:
+        return v, true
+    case string:
+        f, err := strconv.ParseFloat(v, 64)
+        return f, err == nil
+    case json.Number:
+        f, err := v.Float64()
+        return f, err == nil
+    }
+    return 0, false
+}
@@ -0,0 +1,187 @@
+package marketdata
+
+import (
+    "encoding/json"
+    "os"
+    "path/filepath"
+    "reflect"
+    "testing"
+    "time"
+
+    "high-frequency-matching-engine/engine"
+)
+
+var testGenericConfig = GenericConfig{
+    Subscribe:     `{"op":"subscribe","instrument":"{symbol}"}`,
+    SymbolField:   "payload.instrument",
+    PriceField:    "payload.last",
+    QuantityField: "payload.size",
+    BidField:      "payload.bid",
+    AskField:      "payload.ask",
+    TimeField:     "payload.ts",
+}
+
+func testAdapter(t *testing.T, name string) FeedAdapter {
+    t.Helper()
+    adapter, err := NewFeedAdapter(name, "", testGenericConfig)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return adapter
+}
+
+func readFixture(t *testing.T, exchange, name string) []byte {
+    t.Helper()
+    data, err := os.ReadFile(filepath.Join("testdata", exchange, name))
+    if err != nil {
+        t.Fatal(err)
+    }
+    return data
+}
+
+// sameMarketData compares events, with exchange times compared as instants
+func sameMarketData(got, want []*engine.MarketData) bool {
+    if len(got) != len(want) {
+        return false
+    }
+    for i := range got {
+        g, w := *got[i], *want[i]
+        if !g.ExchangeTime.Equal(w.ExchangeTime) {
+            return false
+        }
+        g.ExchangeTime, w.ExchangeTime = time.Time{}, time.Time{}
+        if g != w {
+            return false
+        }
+    }
+    return true
+}
+
+func TestParse(t *testing.T) {
+    tests := []struct {
+        exchange string
+        fixture  string
+        want     []*engine.MarketData
+        wantErr  bool
+    }{
+        {"binance", "ticker.json", []*engine.MarketData{{
+            Symbol: "BTCUSDT", Type: engine.MarketDataTicker, Price: 43210.5, Quantity: 0.015,
+            BidPrice: 43210.4, BidQty: 1.2, AskPrice: 43210.6, AskQty: 0.8, Volume: 12345.6,
+            ExchangeTime: time.UnixMilli(1700000000123),
+        }}, false},
+        {"binance", "combined_ticker.json", []*engine.MarketData{{
+            Symbol: "ETHUSDT", Type: engine.MarketDataTicker, Price: 2027.3, Quantity: 0.5,
+            BidPrice: 2027.2, BidQty: 10, AskPrice: 2027.4, AskQty: 4.5, Volume: 98765.4,
+            ExchangeTime: time.UnixMilli(1700000000456),
+        }}, false},
+        {"binance", "agg_trade.json", []*engine.MarketData{{
+            Symbol: "BTCUSDT", Type: engine.MarketDataTrade, Price: 43210.5, Quantity: 0.25, Side: engine.SELL,
+            ExchangeTime: time.UnixMilli(1700000000199),
+        }}, false},
+        {"binance", "trade.json", []*engine.MarketData{{
+            Symbol: "BTCUSDT", Type: engine.MarketDataTrade, Price: 43210.6, Quantity: 0.01, Side: engine.BUY,
+            ExchangeTime: time.UnixMilli(1700000000299),
+        }}, false},
+        {"binance", "depth_update.json", nil, false},
+        {"binance", "subscribe_ack.json", nil, false},
+        {"binance", "error.json", nil, true},
+
+        {"coinbase", "ticker.json", []*engine.MarketData{
+            {Symbol: "BTCUSD", Type: engine.MarketDataTrade, Price: 43210.5, Quantity: 0.01, Side: engine.SELL,
+                ExchangeTime: time.Date(2023, 11, 14, 22, 13, 20, 123456000, time.UTC)},
+            {Symbol: "BTCUSD", Type: engine.MarketDataTicker, Price: 43210.5, Quantity: 0.01, Side: engine.SELL,
+                BidPrice: 43210.4, BidQty: 0.5, AskPrice: 43210.6, AskQty: 0.3, Volume: 15234.2,
+                ExchangeTime: time.Date(2023, 11, 14, 22, 13, 20, 123456000, time.UTC)},
+        }, false},
+        {"coinbase", "subscriptions.json", nil, false},
+        {"coinbase", "heartbeat.json", nil, false},
+        {"coinbase", "error.json", nil, true},
+
+        {"kraken", "ticker.json", []*engine.MarketData{
+            {Symbol: "BTCUSD", Type: engine.MarketDataTicker, Price: 43210.5,
+                BidPrice: 43210.4, BidQty: 0.5, AskPrice: 43210.6, AskQty: 0.3, Volume: 1523.4},
+            {Symbol: "BTCEUR", Type: engine.MarketDataTicker, Price: 39900.5,
+                BidPrice: 39900.1, BidQty: 1.1, AskPrice: 39900.9, AskQty: 0.7, Volume: 321},
+        }, false},
+        {"kraken", "trade.json", []*engine.MarketData{
+            {Symbol: "BTCUSD", Type: engine.MarketDataTrade, Price: 43210.6, Quantity: 0.0125, Side: engine.BUY,
+                ExchangeTime: time.Date(2023, 11, 14, 22, 13, 20, 456789000, time.UTC)},
+            {Symbol: "BTCUSD", Type: engine.MarketDataTrade, Price: 43210.4, Quantity: 0.5, Side: engine.SELL,
+                ExchangeTime: time.Date(2023, 11, 14, 22, 13, 20, 457001000, time.UTC)},
+        }, false},
+        {"kraken", "trade_snapshot.json", nil, false},
+        {"kraken", "heartbeat.json", nil, false},
+        {"kraken", "subscribe_ack.json", nil, false},
+        {"kraken", "subscribe_error.json", nil, true},
+
+        {"generic", "ticker.json", []*engine.MarketData{{
+            Symbol: "SOLUSD", Type: engine.MarketDataTicker, Price: 61.25, Quantity: 3,
+            BidPrice: 61.2, AskPrice: 61.3, ExchangeTime: time.UnixMilli(1700000000123),
+        }}, false},
+        {"generic", "status.json", nil, false},
+    }
+
+    for _, test := range tests {
+        t.Run(test.exchange+"/"+test.fixture, func(t *testing.T) {
+            got, err := testAdapter(t, test.exchange).Parse(readFixture(t, test.exchange, test.fixture))
+            if (err != nil) != test.wantErr {
+                t.Fatalf("error %v, want error %v", err, test.wantErr)
+            }
+            if !sameMarketData(got, test.want) {
+                gotJSON, _ := json.Marshal(got)
+                wantJSON, _ := json.Marshal(test.want)
+                t.Errorf("got  %s\nwant %s", gotJSON, wantJSON)
+            }
+        })
+    }
+}
+
+// The ticker Coinbase sends on subscribing repeats the last trade
+func TestCoinbaseTradeOnce(t *testing.T) {
+    adapter := testAdapter(t, "coinbase")
+    ticker := readFixture(t, "coinbase", "ticker.json")
+    for i, want := range []int{2, 1} {
+        data, err := adapter.Parse(ticker)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if len(data) != want || data[len(data)-1].Type != engine.MarketDataTicker {
+            t.Errorf("parse %d gave %d events, want %d ending in the ticker", i+1, len(data), want)
+        }
+    }
+}
+
+func TestSubscribeMessages(t *testing.T) {
+    tests := []struct {
+        exchange string
+        symbols  []string
+    }{
+        {"binance", []string{"BTCUSDT", "ETHUSDT"}},
+        {"coinbase", []string{"BTC-USD", "ETH-USD"}},
+        {"kraken", []string{"BTC/USD", "ETH/USD"}},
+        {"generic", []string{"SOL-USD", "ETH-USD"}},
+    }
+
+    for _, test := range tests {
+        t.Run(test.exchange, func(t *testing.T) {
+            messages, err := testAdapter(t, test.exchange).SubscribeMessages(test.symbols)
+            if err != nil {
+                t.Fatal(err)
+            }
+            encoded, err := json.Marshal(messages)
+            if err != nil {
+                t.Fatal(err)
+            }
+
+            // Compared decoded, so key order and spacing do not matter
+            var got, want interface{}
+            json.Unmarshal(encoded, &got)
+            if err := json.Unmarshal(readFixture(t, test.exchange, "subscribe.json"), &want); err != nil {
+                t.Fatal(err)
+            }
+            if !reflect.DeepEqual(got, want) {
+                t.Errorf("got  %s\nwant %s", encoded, readFixture(t, test.exchange, "subscribe.json"))
+            }
+        })
+    }
+}
@@ -0,0 +1,247 @@
+package marketdata
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/url"
+    "strings"
+    "sync"
+    "time"
+
+    "high-frequency-matching-engine/engine"
+)
+
+// BinanceAdapter subscribes to 24h ticker, aggregate trade and diff depth
+// streams on Binance's raw or combined stream endpoints. RESTUrl is the REST API base
+// used for depth snapshots, https://api.binance.com by default.
+type BinanceAdapter struct {
+    RESTUrl string
+
+    native map[string]string // normalized -> Binance symbol
+    mutex  sync.Mutex
+}
+
+func NewBinanceAdapter(restURL string) *BinanceAdapter {
+    return &BinanceAdapter{RESTUrl: restURL, native: make(map[string]string)}
+}
+
+// Field matching is case-insensitive, so every key that differs only in
+// case from one decoded needs a field of its own
+type binanceTicker struct {
+    Event       string `json:"e"` // also keeps "e" from matching "E"
+    EventTime   int64  `json:"E"`
+    Symbol      string `json:"s"`
+    Last        number `json:"c"`
+    CloseTime   int64  `json:"C"`
+    LastQty     number `json:"Q"`
+    QuoteVolume number `json:"q"`
+    Bid         number `json:"b"`
+    BidQty      number `json:"B"`
+    Ask         number `json:"a"`
+    AskQty      number `json:"A"`
+    Volume      number `json:"v"`
+}
+
+// binanceTrade is an aggTrade event, or a trade event, which has the same
+// fields and a trade ID
+type binanceTrade struct {
+    Event      string `json:"e"`
+    EventTime  int64  `json:"E"`
+    Symbol     string `json:"s"`
+    Price      number `json:"p"`
+    Quantity   number `json:"q"`
+    TradeID    int64  `json:"t"`
+    TradeTime  int64  `json:"T"`
+    BuyerMaker bool   `json:"m"`
+    Ignore     bool   `json:"M"`
+}
+
+func (a *BinanceAdapter) Name() string {
+    return "binance"
+}
+
+func (a *BinanceAdapter) SubscribeMessages(symbols []string) ([]interface{}, error) {
+    streams := make([]string, 0, 2*len(symbols))
+    for _, symbol := range symbols {
+        streams = append(streams, strings.ToLower(symbol)+"@ticker", strings.ToLower(symbol)+"@aggTrade")
+    }
+    return []interface{}{map[string]interface{}{
+        "method": "SUBSCRIBE",
+        "params": streams,
+        "id":     1,
+    }}, nil
+}
+
+// binanceEvent unwraps combined stream messages and returns the event
+// type with its payload; responses to requests have no event type
+func binanceEvent(data []byte) (string, []byte, error) {
+    var envelope struct {
+        Stream string          `json:"stream"`
+        Data   json.RawMessage `json:"data"`
+        Event  string          `json:"e"`
+        Time   int64           `json:"E"` // decoding is case-insensitive
+        Error  *struct {
+            Code int    `json:"code"`
+            Msg  string `json:"msg"`
+        } `json:"error"`
+    }
+    if err := json.Unmarshal(data, &envelope); err != nil {
+        return "", nil, err
+    }
+    if envelope.Error != nil {
+        return "", nil, fmt.Errorf("binance error %d: %s", envelope.Error.Code, envelope.Error.Msg)
+    }
+    // Combined streams wrap each event
+    if envelope.Stream != "" {
+        return binanceEvent(envelope.Data)
+    }
+    return envelope.Event, data, nil
+}
+
+func (a *BinanceAdapter) Parse(data []byte) ([]*engine.MarketData, error) {
+    event, data, err := binanceEvent(data)
+    if err != nil {
+        return nil, err
+    }
+    switch event {
+    case "24hrTicker":
+    case "aggTrade", "trade":
+        return parseBinanceTrade(data)
+    default:
+        return nil, nil
+    }
+
+    var ticker binanceTicker
+    if err := json.Unmarshal(data, &ticker); err != nil {
+        return nil, err
+    }
+    return []*engine.MarketData{{
+        Symbol:       NormalizeSymbol(ticker.Symbol),
+        Type:         engine.MarketDataTicker,
+        Price:        float64(ticker.Last),
+        Quantity:     float64(ticker.LastQty),
+        BidPrice:     float64(ticker.Bid),
+        BidQty:       float64(ticker.BidQty),
+        AskPrice:     float64(ticker.Ask),
+        AskQty:       float64(ticker.AskQty),
+        Volume:       float64(ticker.Volume),
+        ExchangeTime: time.UnixMilli(ticker.EventTime),
+    }}, nil
+}
+
+func parseBinanceTrade(data []byte) ([]*engine.MarketData, error) {
+    var trade binanceTrade
+    if err := json.Unmarshal(data, &trade); err != nil {
+        return nil, err
+    }
+    // The buyer making means the seller took
+    side := engine.BUY
+    if trade.BuyerMaker {
+        side = engine.SELL
+    }
+    return []*engine.MarketData{{
+        Symbol:       NormalizeSymbol(trade.Symbol),
+        Type:         engine.MarketDataTrade,
+        Price:        float64(trade.Price),
+        Quantity:     float64(trade.Quantity),
+        Side:         side,
+        ExchangeTime: time.UnixMilli(trade.TradeTime),
+    }}, nil
+}
+
+// Binance depth is a diff stream; each book starts from a REST snapshot
+// and diffs must chain by update ID
+const binanceSnapshotLimit = 1000
+
+var binanceHTTP = &http.Client{Timeout: 10 * time.Second}
+
+type binanceDepth struct {
+    Event     string     `json:"e"` // also keeps "e" from matching "E"
+    EventTime int64      `json:"E"`
+    Symbol    string     `json:"s"`
+    FirstID   uint64     `json:"U"`
+    FinalID   uint64     `json:"u"`
+    Bids      [][]number `json:"b"`
+    Asks      [][]number `json:"a"`
+}
+
+func (a *BinanceAdapter) DepthSubscribeMessages(symbols []string) ([]interface{}, error) {
+    a.mutex.Lock()
+    defer a.mutex.Unlock()
+
+    streams := make([]string, len(symbols))
+    for i, symbol := range symbols {
+        streams[i] = strings.ToLower(symbol) + "@depth@100ms"
+        a.native[NormalizeSymbol(symbol)] = strings.ToUpper(symbol)
+    }
+    return []interface{}{map[string]interface{}{
+        "method": "SUBSCRIBE",
+        "params": streams,
+        "id":     2,
+    }}, nil
+}
+
+func (a *BinanceAdapter) ParseDepth(data []byte) ([]*DepthUpdate, error) {
+    // Errors are reported once, by Parse
+    event, data, err := binanceEvent(data)
+    if err != nil || event != "depthUpdate" {
+        return nil, nil
+    }
+
+    var depth binanceDepth
+    if err := json.Unmarshal(data, &depth); err != nil {
+        return nil, err
+    }
+    return []*DepthUpdate{{
+        Symbol:       NormalizeSymbol(depth.Symbol),
+        FirstSeq:     depth.FirstID,
+        LastSeq:      depth.FinalID,
+        Bids:         depthLevels(depth.Bids),
+        Asks:         depthLevels(depth.Asks),
+        ExchangeTime: time.UnixMilli(depth.EventTime),
+    }}, nil
+}
+
+func (a *BinanceAdapter) ResyncDepth(symbol string) (*DepthUpdate, []interface{}, error) {
+    a.mutex.Lock()
+    native, exists := a.native[symbol]
+    a.mutex.Unlock()
+    if !exists {
+        return nil, nil, fmt.Errorf("binance symbol %s not subscribed", symbol)
+    }
+
+    query := url.Values{"symbol": {native}, "limit": {fmt.Sprint(binanceSnapshotLimit)}}
+    resp, err := binanceHTTP.Get(a.restURL() + "/api/v3/depth?" + query.Encode())
+    if err != nil {
+        return nil, nil, err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        return nil, nil, fmt.Errorf("binance depth snapshot: %s", resp.Status)
+    }
+
+    var snapshot struct {
+        LastUpdateID uint64     `json:"lastUpdateId"`
+        Bids         [][]number `json:"bids"`
+        Asks         [][]number `json:"asks"`
+    }
+    if err := json.NewDecoder(resp.Body).Decode(&snapshot); err != nil {
+        return nil, nil, err
+    }
+    return &DepthUpdate{
+        Symbol:       symbol,
+        Snapshot:     true,
+        LastSeq:      snapshot.LastUpdateID,
+        Bids:         depthLevels(snapshot.Bids),
+        Asks:         depthLevels(snapshot.Asks),
+        ExchangeTime: time.Now(),
+    }, nil, nil
+}
+
+func (a *BinanceAdapter) restURL() string {
+    if a.RESTUrl != "" {
+        return strings.TrimRight(a.RESTUrl, "/")
+    }
+    return "https://api.binance.com"
+}
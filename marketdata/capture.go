@@ -0,0 +1,357 @@
+package marketdata
+
+import (
+    "bufio"
+    "compress/gzip"
+    "encoding/csv"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "high-frequency-matching-engine/engine"
+)
+
+const (
+    captureFilePrefix = "capture-"
+    captureFileExt    = ".jsonl.gz"
+    captureTimeFormat = "20060102T150405.000Z"
+)
+
+// CaptureKind tells a raw exchange message from a normalized event
+type CaptureKind string
+
+const (
+    CaptureRaw  CaptureKind = "raw"
+    CaptureData CaptureKind = "data"
+)
+
+// CaptureRecord is one line of a capture file. Raw records hold a message
+// exactly as the exchange sent it; data records hold the event the feeder
+// produced from it.
+type CaptureRecord struct {
+    Kind     CaptureKind        `json:"kind"`
+    Exchange string             `json:"exchange"`
+    Received time.Time          `json:"received"`
+    Raw      string             `json:"raw,omitempty"`
+    Data     *engine.MarketData `json:"data,omitempty"`
+}
+
+// CaptureFilter selects capture records. Empty fields match everything;
+// Symbol and Type only match data records.
+type CaptureFilter struct {
+    Kind     CaptureKind
+    Exchange string
+    Symbol   string
+    Type     engine.MarketDataType
+    From     time.Time
+    To       time.Time
+}
+
+func (f CaptureFilter) Match(record *CaptureRecord) bool {
+    if f.Kind != "" && record.Kind != f.Kind {
+        return false
+    }
+    if f.Exchange != "" && record.Exchange != f.Exchange {
+        return false
+    }
+    if !f.From.IsZero() && record.Received.Before(f.From) {
+        return false
+    }
+    if !f.To.IsZero() && !record.Received.Before(f.To) {
+        return false
+    }
+    if f.Symbol != "" || f.Type != "" {
+        if record.Data == nil {
+            return false
+        }
+        if f.Symbol != "" && record.Data.Symbol != f.Symbol {
+            return false
+        }
+        if f.Type != "" && record.Data.Type != f.Type {
+            return false
+        }
+    }
+    return true
+}
+
+// CaptureFile describes a capture segment on disk
+type CaptureFile struct {
+    Path  string    `json:"path"`
+    Start time.Time `json:"start"`
+    Size  int64     `json:"size"`
+}
+
+// ListCaptures returns the capture files in dir, oldest first
+func ListCaptures(dir string) ([]CaptureFile, error) {
+    paths, err := filepath.Glob(filepath.Join(dir, captureFilePrefix+"*"+captureFileExt))
+    if err != nil {
+        return nil, err
+    }
+
+    files := make([]CaptureFile, 0, len(paths))
+    for _, path := range paths {
+        name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), captureFilePrefix), captureFileExt)
+        start, err := time.Parse(captureTimeFormat, name)
+        if err != nil {
+            continue
+        }
+        info, err := os.Stat(path)
+        if err != nil {
+            return nil, err
+        }
+        files = append(files, CaptureFile{Path: path, Start: start, Size: info.Size()})
+    }
+    sort.Slice(files, func(i, j int) bool { return files[i].Start.Before(files[j].Start) })
+    return files, nil
+}
+
+// CapturePaths lists the capture files of a directory, oldest first, or
+// returns path itself if it is a file
+func CapturePaths(path string) ([]string, error) {
+    info, err := os.Stat(path)
+    if err != nil {
+        return nil, err
+    }
+    if !info.IsDir() {
+        return []string{path}, nil
+    }
+
+    files, err := ListCaptures(path)
+    if err != nil {
+        return nil, err
+    }
+    paths := make([]string, len(files))
+    for i, file := range files {
+        paths[i] = file.Path
+    }
+    return paths, nil
+}
+
+func captureFileName(start time.Time) string {
+    return captureFilePrefix + start.UTC().Format(captureTimeFormat) + captureFileExt
+}
+
+// CaptureReader reads records in order from a capture file, a JSON lines
+// file or a CSV file in the layout mdcapture exports, any of them gzipped.
+// JSON lines may also be bare engine.MarketData events.
+type CaptureReader struct {
+    file *os.File
+    gz   *gzip.Reader
+    next func() (*CaptureRecord, error)
+}
+
+func OpenCapture(path string) (*CaptureReader, error) {
+    file, err := os.Open(path)
+    if err != nil {
+        return nil, err
+    }
+
+    cr := &CaptureReader{file: file}
+    var r io.Reader = bufio.NewReader(file)
+    name := path
+    if strings.HasSuffix(name, ".gz") {
+        if cr.gz, err = gzip.NewReader(r); err != nil {
+            file.Close()
+            return nil, err
+        }
+        r = cr.gz
+        name = strings.TrimSuffix(name, ".gz")
+    }
+
+    if strings.HasSuffix(name, ".csv") {
+        err = cr.readCSV(r)
+    } else {
+        cr.readJSON(r)
+    }
+    if err != nil {
+        cr.Close()
+        return nil, err
+    }
+    return cr, nil
+}
+
+// Next returns the next record, or io.EOF at the end of the file. A file
+// still being written, or cut short by a crash, ends at its last complete
+// record.
+func (cr *CaptureReader) Next() (*CaptureRecord, error) {
+    record, err := cr.next()
+    if errors.Is(err, io.ErrUnexpectedEOF) {
+        return nil, io.EOF
+    }
+    return record, err
+}
+
+func (cr *CaptureReader) Close() error {
+    if cr.gz != nil {
+        cr.gz.Close()
+    }
+    return cr.file.Close()
+}
+
+func (cr *CaptureReader) readJSON(r io.Reader) {
+    decoder := json.NewDecoder(r)
+    cr.next = func() (*CaptureRecord, error) {
+        var line json.RawMessage
+        if err := decoder.Decode(&line); err != nil {
+            return nil, err
+        }
+        var record CaptureRecord
+        if err := json.Unmarshal(line, &record); err != nil {
+            return nil, err
+        }
+        if record.Kind != "" {
+            return &record, nil
+        }
+
+        var data engine.MarketData
+        if err := json.Unmarshal(line, &data); err != nil {
+            return nil, err
+        }
+        return dataRecord(&data), nil
+    }
+}
+
+// dataRecord wraps a bare event, received when it says or else at its
+// exchange time
+func dataRecord(data *engine.MarketData) *CaptureRecord {
+    received := data.ReceiveTime
+    if received.IsZero() {
+        received = data.ExchangeTime
+    }
+    return &CaptureRecord{Kind: CaptureData, Exchange: data.Exchange, Received: received, Data: data}
+}
+
+// CaptureCSVHeader lists the columns of records exported as CSV
+var CaptureCSVHeader = []string{
+    "received", "kind", "exchange", "type", "symbol", "price", "quantity", "side",
+    "bid_price", "bid_qty", "ask_price", "ask_qty", "volume", "exchange_time", "raw",
+}
+
+// CSVRow formats a record in the CaptureCSVHeader columns. Zero prices and
+// sizes are left empty; side is only set on trades.
+func (record *CaptureRecord) CSVRow() []string {
+    row := make([]string, len(CaptureCSVHeader))
+    row[0] = record.Received.Format(time.RFC3339Nano)
+    row[1] = string(record.Kind)
+    row[2] = record.Exchange
+    if data := record.Data; data != nil {
+        row[3] = string(data.Type)
+        row[4] = data.Symbol
+        row[5] = formatCSVFloat(data.Price)
+        row[6] = formatCSVFloat(data.Quantity)
+        if data.Type == engine.MarketDataTrade {
+            row[7] = "buy"
+            if data.Side == engine.SELL {
+                row[7] = "sell"
+            }
+        }
+        row[8] = formatCSVFloat(data.BidPrice)
+        row[9] = formatCSVFloat(data.BidQty)
+        row[10] = formatCSVFloat(data.AskPrice)
+        row[11] = formatCSVFloat(data.AskQty)
+        row[12] = formatCSVFloat(data.Volume)
+        if !data.ExchangeTime.IsZero() {
+            row[13] = data.ExchangeTime.Format(time.RFC3339Nano)
+        }
+    }
+    row[14] = record.Raw
+    return row
+}
+
+func formatCSVFloat(v float64) string {
+    if v == 0 {
+        return ""
+    }
+    return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// readCSV reads rows by the names in the header line, so columns may be in
+// any order and missing ones are left zero. Rows without a kind are data.
+func (cr *CaptureReader) readCSV(r io.Reader) error {
+    reader := csv.NewReader(r)
+    reader.FieldsPerRecord = -1
+    header, err := reader.Read()
+    if err != nil {
+        return err
+    }
+    columns := make(map[string]int, len(header))
+    for i, name := range header {
+        columns[strings.TrimSpace(name)] = i
+    }
+
+    cr.next = func() (*CaptureRecord, error) {
+        row, err := reader.Read()
+        if err != nil {
+            return nil, err
+        }
+        return parseCSVRow(columns, row)
+    }
+    return nil
+}
+
+func parseCSVRow(columns map[string]int, row []string) (*CaptureRecord, error) {
+    field := func(name string) string {
+        if i, ok := columns[name]; ok && i < len(row) {
+            return strings.TrimSpace(row[i])
+        }
+        return ""
+    }
+    var err error
+    parseFloat := func(name string) float64 {
+        text := field(name)
+        if text == "" || err != nil {
+            return 0
+        }
+        var v float64
+        if v, err = strconv.ParseFloat(text, 64); err != nil {
+            err = fmt.Errorf("%s: %w", name, err)
+        }
+        return v
+    }
+    parseTime := func(name string) time.Time {
+        text := field(name)
+        if text == "" || err != nil {
+            return time.Time{}
+        }
+        var t time.Time
+        if t, err = time.Parse(time.RFC3339Nano, text); err != nil {
+            err = fmt.Errorf("%s: %w", name, err)
+        }
+        return t
+    }
+
+    kind := CaptureKind(field("kind"))
+    if kind == CaptureRaw {
+        record := &CaptureRecord{Kind: kind, Exchange: field("exchange"), Received: parseTime("received"), Raw: field("raw")}
+        return record, err
+    }
+
+    data := &engine.MarketData{
+        Exchange:     field("exchange"),
+        Symbol:       field("symbol"),
+        Type:         engine.MarketDataType(field("type")),
+        Price:        parseFloat("price"),
+        Quantity:     parseFloat("quantity"),
+        BidPrice:     parseFloat("bid_price"),
+        BidQty:       parseFloat("bid_qty"),
+        AskPrice:     parseFloat("ask_price"),
+        AskQty:       parseFloat("ask_qty"),
+        Volume:       parseFloat("volume"),
+        ExchangeTime: parseTime("exchange_time"),
+        ReceiveTime:  parseTime("received"),
+    }
+    if strings.EqualFold(field("side"), "sell") {
+        data.Side = engine.SELL
+    }
+    if err != nil {
+        return nil, err
+    }
+    return dataRecord(data), nil
+}
@@ -0,0 +1,200 @@
+package marketdata
+
+import (
+    "encoding/json"
+    "fmt"
+    "strconv"
+    "sync"
+    "time"
+
+    "high-frequency-matching-engine/engine"
+)
+
+// CoinbaseAdapter subscribes to the ticker channel of the Coinbase Exchange
+// feed, which reports every trade with the current best bid and ask, and
+// to batched level 2 depth. Each ticker is passed on as a trade followed by
+// a ticker.
+type CoinbaseAdapter struct {
+    native    map[string]string // normalized -> product ID
+    lastTrade map[string]int64  // product ID -> last trade ID passed on
+    mutex     sync.Mutex
+}
+
+func NewCoinbaseAdapter() *CoinbaseAdapter {
+    return &CoinbaseAdapter{native: make(map[string]string), lastTrade: make(map[string]int64)}
+}
+
+type coinbaseMessage struct {
+    Type      string    `json:"type"`
+    ProductID string    `json:"product_id"`
+    Price     number    `json:"price"`
+    LastSize  number    `json:"last_size"`
+    Side      string    `json:"side"`
+    BestBid   number    `json:"best_bid"`
+    BidSize   number    `json:"best_bid_size"`
+    BestAsk   number    `json:"best_ask"`
+    AskSize   number    `json:"best_ask_size"`
+    Volume    number    `json:"volume_24h"`
+    Time      time.Time `json:"time"`
+    TradeID   int64     `json:"trade_id"`
+    Message   string    `json:"message"`
+    Reason    string    `json:"reason"`
+}
+
+func (a *CoinbaseAdapter) Name() string {
+    return "coinbase"
+}
+
+func (a *CoinbaseAdapter) SubscribeMessages(symbols []string) ([]interface{}, error) {
+    return []interface{}{map[string]interface{}{
+        "type":        "subscribe",
+        "product_ids": symbols,
+        "channels":    []string{"ticker"},
+    }}, nil
+}
+
+func (a *CoinbaseAdapter) Parse(data []byte) ([]*engine.MarketData, error) {
+    var msg coinbaseMessage
+    if err := json.Unmarshal(data, &msg); err != nil {
+        return nil, err
+    }
+
+    switch msg.Type {
+    case "ticker":
+    case "error":
+        return nil, fmt.Errorf("coinbase error: %s %s", msg.Message, msg.Reason)
+    default:
+        return nil, nil
+    }
+
+    // Side is the taker's side of the last trade
+    side := engine.BUY
+    if msg.Side == "sell" {
+        side = engine.SELL
+    }
+    symbol := NormalizeSymbol(msg.ProductID)
+
+    var result []*engine.MarketData
+    if a.newTrade(msg.ProductID, msg.TradeID) && msg.Price > 0 && msg.LastSize > 0 {
+        result = append(result, &engine.MarketData{
+            Symbol:       symbol,
+            Type:         engine.MarketDataTrade,
+            Price:        float64(msg.Price),
+            Quantity:     float64(msg.LastSize),
+            Side:         side,
+            ExchangeTime: msg.Time,
+        })
+    }
+    return append(result, &engine.MarketData{
+        Symbol:       symbol,
+        Type:         engine.MarketDataTicker,
+        Price:        float64(msg.Price),
+        Quantity:     float64(msg.LastSize),
+        Side:         side,
+        BidPrice:     float64(msg.BestBid),
+        BidQty:       float64(msg.BidSize),
+        AskPrice:     float64(msg.BestAsk),
+        AskQty:       float64(msg.AskSize),
+        Volume:       float64(msg.Volume),
+        ExchangeTime: msg.Time,
+    }), nil
+}
+
+// newTrade reports whether a ticker's trade has not been passed on yet.
+// The ticker sent on subscribing repeats the last trade, which a reconnect
+// has already seen.
+func (a *CoinbaseAdapter) newTrade(productID string, tradeID int64) bool {
+    if tradeID == 0 {
+        return true
+    }
+    a.mutex.Lock()
+    defer a.mutex.Unlock()
+    if tradeID <= a.lastTrade[productID] {
+        return false
+    }
+    a.lastTrade[productID] = tradeID
+    return true
+}
+
+// Coinbase's level2_batch channel starts with a snapshot and then sends
+// batched changes. It carries no sequence numbers, so a resync simply
+// resubscribes.
+const coinbaseDepthChannel = "level2_batch"
+
+type coinbaseDepth struct {
+    Type      string     `json:"type"`
+    ProductID string     `json:"product_id"`
+    Bids      [][]number `json:"bids"`
+    Asks      [][]number `json:"asks"`
+    Changes   [][]string `json:"changes"`
+    Time      time.Time  `json:"time"`
+}
+
+func (a *CoinbaseAdapter) DepthSubscribeMessages(symbols []string) ([]interface{}, error) {
+    a.mutex.Lock()
+    for _, symbol := range symbols {
+        a.native[NormalizeSymbol(symbol)] = symbol
+    }
+    a.mutex.Unlock()
+
+    return []interface{}{coinbaseDepthRequest("subscribe", symbols)}, nil
+}
+
+func coinbaseDepthRequest(op string, products []string) map[string]interface{} {
+    return map[string]interface{}{
+        "type":        op,
+        "product_ids": products,
+        "channels":    []string{coinbaseDepthChannel},
+    }
+}
+
+func (a *CoinbaseAdapter) ParseDepth(data []byte) ([]*DepthUpdate, error) {
+    var msg coinbaseDepth
+    if err := json.Unmarshal(data, &msg); err != nil {
+        return nil, err
+    }
+
+    update := &DepthUpdate{Symbol: NormalizeSymbol(msg.ProductID), ExchangeTime: msg.Time}
+    switch msg.Type {
+    case "snapshot":
+        update.Snapshot = true
+        update.Bids = depthLevels(msg.Bids)
+        update.Asks = depthLevels(msg.Asks)
+    case "l2update":
+        for _, change := range msg.Changes {
+            if len(change) < 3 {
+                continue
+            }
+            price, err := strconv.ParseFloat(change[1], 64)
+            if err != nil {
+                return nil, err
+            }
+            quantity, err := strconv.ParseFloat(change[2], 64)
+            if err != nil {
+                return nil, err
+            }
+            level := DepthLevel{Price: price, Quantity: quantity}
+            if change[0] == "buy" {
+                update.Bids = append(update.Bids, level)
+            } else {
+                update.Asks = append(update.Asks, level)
+            }
+        }
+    default:
+        return nil, nil
+    }
+    return []*DepthUpdate{update}, nil
+}
+
+func (a *CoinbaseAdapter) ResyncDepth(symbol string) (*DepthUpdate, []interface{}, error) {
+    a.mutex.Lock()
+    native, exists := a.native[symbol]
+    a.mutex.Unlock()
+    if !exists {
+        return nil, nil, fmt.Errorf("coinbase product %s not subscribed", symbol)
+    }
+    return nil, []interface{}{
+        coinbaseDepthRequest("unsubscribe", []string{native}),
+        coinbaseDepthRequest("subscribe", []string{native}),
+    }, nil
+}
@@ -0,0 +1,308 @@
+package marketdata
+
+import (
+    "context"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+
+    "go.uber.org/zap"
+
+    "high-frequency-matching-engine/clock"
+    "high-frequency-matching-engine/engine"
+)
+
+const (
+    // ConsolidatedExchange is the Exchange of consolidated quote events
+    ConsolidatedExchange = "nbbo"
+
+    defaultStaleAfter = 5 * time.Second
+)
+
+// ConsolidatorConfig sets up quote consolidation. Symbols maps venue
+// symbols, normalized, to the symbol they are consolidated under, either
+// for every exchange ("BTCUSDT") or one ("coinbase:BTCUSD"); unmapped
+// symbols consolidate under their own name. Quotes older than StaleAfter
+// are left out.
+type ConsolidatorConfig struct {
+    StaleAfter time.Duration
+    Symbols    map[string]string
+}
+
+// VenueQuote is one exchange's latest best bid and offer. Zero prices mean
+// the side is empty.
+type VenueQuote struct {
+    Exchange     string    `json:"exchange"`
+    Symbol       string    `json:"symbol"` // as the exchange names it, normalized
+    BidPrice     float64   `json:"bid_price"`
+    BidQty       float64   `json:"bid_qty"`
+    AskPrice     float64   `json:"ask_price"`
+    AskQty       float64   `json:"ask_qty"`
+    ExchangeTime time.Time `json:"exchange_time"`
+    ReceiveTime  time.Time `json:"receive_time"`
+    Stale        bool      `json:"stale"`
+}
+
+// ConsolidatedQuote is the best bid and offer for a symbol across every
+// venue with a fresh quote. Sizes add up across venues quoting the best
+// price, which are listed. A locked or crossed quote usually means one
+// venue is lagging.
+type ConsolidatedQuote struct {
+    Symbol    string       `json:"symbol"`
+    BidPrice  float64      `json:"bid_price"`
+    BidQty    float64      `json:"bid_qty"`
+    BidVenues []string     `json:"bid_venues"`
+    AskPrice  float64      `json:"ask_price"`
+    AskQty    float64      `json:"ask_qty"`
+    AskVenues []string     `json:"ask_venues"`
+    Locked    bool         `json:"locked"`
+    Crossed   bool         `json:"crossed"`
+    Updated   time.Time    `json:"updated"`
+    Venues    []VenueQuote `json:"venues"`
+}
+
+func (q *ConsolidatedQuote) sameBest(other *ConsolidatedQuote) bool {
+    return q.BidPrice == other.BidPrice && q.BidQty == other.BidQty &&
+        q.AskPrice == other.AskPrice && q.AskQty == other.AskQty &&
+        strings.Join(q.BidVenues, ",") == strings.Join(other.BidVenues, ",") &&
+        strings.Join(q.AskVenues, ",") == strings.Join(other.AskVenues, ",")
+}
+
+type consolidatedSymbol struct {
+    venues map[string]*VenueQuote
+    best   ConsolidatedQuote
+}
+
+// Consolidator merges quotes from every feed into a per-symbol best bid
+// and offer with venue attribution. Each change to the best prices, sizes
+// or venues is sent on its data channel as an nbbo event, including when a
+// venue drops out for going stale.
+type Consolidator struct {
+    cfg      ConsolidatorConfig
+    clock    clock.Clock
+    logger   *zap.Logger
+    symbols  map[string]*consolidatedSymbol
+    mutex    sync.Mutex
+    dataChan chan *engine.MarketData
+}
+
+// NewConsolidator ages quotes on clk, which should be the engine's clock so
+// replayed quotes go stale by their recorded receive times
+func NewConsolidator(cfg ConsolidatorConfig, clk clock.Clock, logger *zap.Logger) *Consolidator {
+    if cfg.StaleAfter <= 0 {
+        cfg.StaleAfter = defaultStaleAfter
+    }
+    symbols := make(map[string]string, len(cfg.Symbols))
+    for from, to := range cfg.Symbols {
+        exchange, symbol, found := strings.Cut(from, ":")
+        if found {
+            from = strings.ToLower(exchange) + ":" + NormalizeSymbol(symbol)
+        } else {
+            from = NormalizeSymbol(from)
+        }
+        symbols[from] = NormalizeSymbol(to)
+    }
+    cfg.Symbols = symbols
+
+    return &Consolidator{
+        cfg:      cfg,
+        clock:    clk,
+        logger:   logger,
+        symbols:  make(map[string]*consolidatedSymbol),
+        dataChan: make(chan *engine.MarketData, 10000),
+    }
+}
+
+// Symbol returns the consolidated symbol for an exchange's symbol
+func (c *Consolidator) Symbol(exchange, symbol string) string {
+    symbol = NormalizeSymbol(symbol)
+    if mapped, ok := c.cfg.Symbols[strings.ToLower(exchange)+":"+symbol]; ok {
+        return mapped
+    }
+    if mapped, ok := c.cfg.Symbols[symbol]; ok {
+        return mapped
+    }
+    return symbol
+}
+
+// Update takes a venue's quote from a feed event. Events without a bid or
+// ask, such as trades, are ignored.
+func (c *Consolidator) Update(data *engine.MarketData) {
+    if data.BidPrice <= 0 && data.AskPrice <= 0 {
+        return
+    }
+    symbol := c.Symbol(data.Exchange, data.Symbol)
+    received := data.ReceiveTime
+    if received.IsZero() {
+        received = c.clock.Now()
+    }
+
+    c.mutex.Lock()
+    cs, exists := c.symbols[symbol]
+    if !exists {
+        cs = &consolidatedSymbol{
+            venues: make(map[string]*VenueQuote),
+            best:   ConsolidatedQuote{Symbol: symbol},
+        }
+        c.symbols[symbol] = cs
+    }
+    cs.venues[data.Exchange] = &VenueQuote{
+        Exchange:     data.Exchange,
+        Symbol:       NormalizeSymbol(data.Symbol),
+        BidPrice:     data.BidPrice,
+        BidQty:       data.BidQty,
+        AskPrice:     data.AskPrice,
+        AskQty:       data.AskQty,
+        ExchangeTime: data.ExchangeTime,
+        ReceiveTime:  received,
+    }
+    event := c.consolidate(cs, c.clock.Now())
+    c.mutex.Unlock()
+
+    c.send(event)
+}
+
+// consolidate recomputes a symbol's best prices and returns an event if
+// they changed
+func (c *Consolidator) consolidate(cs *consolidatedSymbol, now time.Time) *engine.MarketData {
+    best := ConsolidatedQuote{Symbol: cs.best.Symbol}
+    var exchangeTime time.Time
+    for _, venue := range cs.venues {
+        if now.Sub(venue.ReceiveTime) > c.cfg.StaleAfter {
+            continue
+        }
+        if venue.ExchangeTime.After(exchangeTime) {
+            exchangeTime = venue.ExchangeTime
+        }
+
+        if venue.BidPrice > 0 {
+            switch {
+            case venue.BidPrice > best.BidPrice:
+                best.BidPrice, best.BidQty = venue.BidPrice, venue.BidQty
+                best.BidVenues = []string{venue.Exchange}
+            case venue.BidPrice == best.BidPrice:
+                best.BidQty += venue.BidQty
+                best.BidVenues = append(best.BidVenues, venue.Exchange)
+            }
+        }
+        if venue.AskPrice > 0 {
+            switch {
+            case best.AskPrice == 0 || venue.AskPrice < best.AskPrice:
+                best.AskPrice, best.AskQty = venue.AskPrice, venue.AskQty
+                best.AskVenues = []string{venue.Exchange}
+            case venue.AskPrice == best.AskPrice:
+                best.AskQty += venue.AskQty
+                best.AskVenues = append(best.AskVenues, venue.Exchange)
+            }
+        }
+    }
+    sort.Strings(best.BidVenues)
+    sort.Strings(best.AskVenues)
+    if best.BidPrice > 0 && best.AskPrice > 0 {
+        best.Locked = best.BidPrice == best.AskPrice
+        best.Crossed = best.BidPrice > best.AskPrice
+    }
+
+    if best.sameBest(&cs.best) {
+        return nil
+    }
+    best.Updated = now
+    cs.best = best
+
+    return &engine.MarketData{
+        Exchange:     ConsolidatedExchange,
+        Symbol:       best.Symbol,
+        Type:         engine.MarketDataNBBO,
+        BidPrice:     best.BidPrice,
+        BidQty:       best.BidQty,
+        AskPrice:     best.AskPrice,
+        AskQty:       best.AskQty,
+        ExchangeTime: exchangeTime,
+        ReceiveTime:  now,
+    }
+}
+
+func (c *Consolidator) send(event *engine.MarketData) {
+    if event == nil {
+        return
+    }
+    select {
+    case c.dataChan <- event:
+    default:
+        c.logger.Warn("Consolidated quote channel full, dropping update")
+    }
+}
+
+// Run drops venues from the best prices as their quotes go stale, until
+// ctx is cancelled. It checks on a wall clock ticker but judges staleness
+// by the consolidator's clock.
+func (c *Consolidator) Run(ctx context.Context) {
+    ticker := time.NewTicker(max(c.cfg.StaleAfter/4, 100*time.Millisecond))
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+            now := c.clock.Now()
+            var events []*engine.MarketData
+            c.mutex.Lock()
+            for _, cs := range c.symbols {
+                if event := c.consolidate(cs, now); event != nil {
+                    events = append(events, event)
+                }
+            }
+            c.mutex.Unlock()
+
+            for _, event := range events {
+                c.send(event)
+            }
+        }
+    }
+}
+
+// Get returns the consolidated quote for a symbol with every venue's
+// latest quote, or nil if no venue has quoted it
+func (c *Consolidator) Get(symbol string) *ConsolidatedQuote {
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+
+    cs, exists := c.symbols[NormalizeSymbol(symbol)]
+    if !exists {
+        return nil
+    }
+    return c.quote(cs, c.clock.Now())
+}
+
+// List returns every consolidated quote, ordered by symbol
+func (c *Consolidator) List() []*ConsolidatedQuote {
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+
+    now := c.clock.Now()
+    quotes := make([]*ConsolidatedQuote, 0, len(c.symbols))
+    for _, cs := range c.symbols {
+        quotes = append(quotes, c.quote(cs, now))
+    }
+    sort.Slice(quotes, func(i, j int) bool { return quotes[i].Symbol < quotes[j].Symbol })
+    return quotes
+}
+
+func (c *Consolidator) quote(cs *consolidatedSymbol, now time.Time) *ConsolidatedQuote {
+    quote := cs.best
+    quote.Venues = make([]VenueQuote, 0, len(cs.venues))
+    for _, venue := range cs.venues {
+        vq := *venue
+        vq.Stale = now.Sub(vq.ReceiveTime) > c.cfg.StaleAfter
+        quote.Venues = append(quote.Venues, vq)
+    }
+    sort.Slice(quote.Venues, func(i, j int) bool { return quote.Venues[i].Exchange < quote.Venues[j].Exchange })
+    return &quote
+}
+
+// GetDataChannel delivers nbbo events as the consolidated quotes change
+func (c *Consolidator) GetDataChannel() <-chan *engine.MarketData {
+    return c.dataChan
+}
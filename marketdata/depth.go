@@ -0,0 +1,298 @@
+package marketdata
+
+import (
+    "sort"
+    "sync"
+    "time"
+
+    "high-frequency-matching-engine/engine"
+)
+
+// Diffs buffered per book while waiting for a snapshot
+const maxBufferedDepth = 10000
+
+// DepthLevel is one price level of an exchange book. A zero quantity in a
+// diff removes the level.
+type DepthLevel struct {
+    Price    float64
+    Quantity float64
+}
+
+// DepthUpdate is a full book or a diff for one symbol. Exchanges that
+// sequence their depth stream set FirstSeq and LastSeq to the range of
+// updates covered; a snapshot's LastSeq is the last update it includes.
+// Unsequenced streams leave both zero. MaxLevels, if set, is how deep the
+// exchange keeps the book, so levels beyond it are dropped locally too.
+type DepthUpdate struct {
+    Symbol       string
+    Snapshot     bool
+    FirstSeq     uint64
+    LastSeq      uint64
+    Bids         []DepthLevel
+    Asks         []DepthLevel
+    MaxLevels    int
+    ExchangeTime time.Time
+}
+
+// DepthAdapter is implemented by adapters that can stream order book depth
+type DepthAdapter interface {
+    DepthSubscribeMessages(symbols []string) ([]interface{}, error)
+
+    // ParseDepth decodes depth snapshots and diffs; other messages return
+    // nothing
+    ParseDepth(data []byte) ([]*DepthUpdate, error)
+
+    // ResyncDepth starts over for a symbol, either by fetching a snapshot
+    // directly or by returning messages that make the stream send one
+    ResyncDepth(symbol string) (*DepthUpdate, []interface{}, error)
+}
+
+// DepthBook is the local copy of one exchange's L2 book for a symbol, kept
+// from a snapshot plus diffs. It is safe for concurrent readers.
+type DepthBook struct {
+    Exchange string
+    Symbol   string
+
+    mutex      sync.RWMutex
+    bids       map[float64]float64
+    asks       map[float64]float64
+    seq        uint64
+    synced     bool
+    buffered   []*DepthUpdate
+    resyncing  bool
+    lastResync time.Time
+    updated    time.Time
+}
+
+func newDepthBook(exchange, symbol string) *DepthBook {
+    return &DepthBook{
+        Exchange: exchange,
+        Symbol:   symbol,
+        bids:     make(map[float64]float64),
+        asks:     make(map[float64]float64),
+    }
+}
+
+// apply applies an update and reports whether the book needs a resync
+func (book *DepthBook) apply(update *DepthUpdate) bool {
+    book.mutex.Lock()
+    defer book.mutex.Unlock()
+
+    if update.Snapshot {
+        book.bids = make(map[float64]float64)
+        book.asks = make(map[float64]float64)
+        book.change(update)
+        book.seq = update.LastSeq
+        book.synced = true
+        book.resyncing = false
+
+        buffered := book.buffered
+        book.buffered = nil
+        for i, diff := range buffered {
+            if !book.applyDiff(diff) {
+                book.buffered = append(book.buffered, buffered[i+1:]...)
+                return true
+            }
+        }
+        return false
+    }
+
+    if !book.synced {
+        book.buffer(update)
+        return true
+    }
+    return !book.applyDiff(update)
+}
+
+// applyDiff applies a diff in sequence. On a gap it marks the book out of
+// sync, keeps the diff for after the next snapshot and returns false.
+func (book *DepthBook) applyDiff(update *DepthUpdate) bool {
+    if update.LastSeq != 0 {
+        if update.LastSeq <= book.seq {
+            return true // already in the snapshot
+        }
+        if update.FirstSeq > book.seq+1 {
+            book.synced = false
+            book.buffer(update)
+            return false
+        }
+        book.seq = update.LastSeq
+    }
+    book.change(update)
+    return true
+}
+
+func (book *DepthBook) change(update *DepthUpdate) {
+    for _, level := range update.Bids {
+        setLevel(book.bids, level)
+    }
+    for _, level := range update.Asks {
+        setLevel(book.asks, level)
+    }
+    if update.MaxLevels > 0 {
+        trim(book.bids, update.MaxLevels, true)
+        trim(book.asks, update.MaxLevels, false)
+    }
+    book.updated = time.Now()
+}
+
+func (book *DepthBook) buffer(update *DepthUpdate) {
+    if len(book.buffered) == maxBufferedDepth {
+        book.buffered = book.buffered[1:]
+    }
+    book.buffered = append(book.buffered, update)
+}
+
+// reset discards the book's sync state after a reconnect; the levels stay
+// readable until the next snapshot replaces them
+func (book *DepthBook) reset() {
+    book.mutex.Lock()
+    defer book.mutex.Unlock()
+
+    book.synced = false
+    book.resyncing = false
+    book.buffered = nil
+    book.seq = 0
+}
+
+// startResync claims the book's resync, at most once a second
+func (book *DepthBook) startResync() bool {
+    book.mutex.Lock()
+    defer book.mutex.Unlock()
+
+    if book.resyncing && time.Since(book.lastResync) < time.Second {
+        return false
+    }
+    book.synced = false
+    book.resyncing = true
+    book.lastResync = time.Now()
+    return true
+}
+
+func (book *DepthBook) resyncFailed() {
+    book.mutex.Lock()
+    book.resyncing = false
+    book.mutex.Unlock()
+}
+
+func setLevel(levels map[float64]float64, level DepthLevel) {
+    if level.Quantity == 0 {
+        delete(levels, level.Price)
+    } else {
+        levels[level.Price] = level.Quantity
+    }
+}
+
+func trim(levels map[float64]float64, depth int, bids bool) {
+    if len(levels) <= depth {
+        return
+    }
+    for _, level := range sortLevels(levels, bids)[depth:] {
+        delete(levels, level.Price)
+    }
+}
+
+func sortLevels(levels map[float64]float64, bids bool) []engine.OrderBookLevel {
+    sorted := make([]engine.OrderBookLevel, 0, len(levels))
+    for price, quantity := range levels {
+        sorted = append(sorted, engine.OrderBookLevel{Price: price, Quantity: quantity})
+    }
+    sort.Slice(sorted, func(i, j int) bool {
+        if bids {
+            return sorted[i].Price > sorted[j].Price
+        }
+        return sorted[i].Price < sorted[j].Price
+    })
+    return sorted
+}
+
+// Synced reports whether the book currently mirrors the exchange. While a
+// resync is in progress the last known levels are still readable.
+func (book *DepthBook) Synced() bool {
+    book.mutex.RLock()
+    defer book.mutex.RUnlock()
+    return book.synced
+}
+
+// Snapshot returns up to levels price levels per side, best first; zero
+// means all of them
+func (book *DepthBook) Snapshot(levels int) *engine.OrderBookSnapshot {
+    book.mutex.RLock()
+    defer book.mutex.RUnlock()
+
+    bids := sortLevels(book.bids, true)
+    asks := sortLevels(book.asks, false)
+    if levels > 0 && len(bids) > levels {
+        bids = bids[:levels]
+    }
+    if levels > 0 && len(asks) > levels {
+        asks = asks[:levels]
+    }
+    return &engine.OrderBookSnapshot{
+        Symbol:    book.Symbol,
+        Bids:      bids,
+        Asks:      asks,
+        Timestamp: book.updated,
+    }
+}
+
+// Best returns the best bid and ask; a zero price means that side is empty
+func (book *DepthBook) Best() (bid, ask engine.OrderBookLevel) {
+    book.mutex.RLock()
+    defer book.mutex.RUnlock()
+
+    for price, quantity := range book.bids {
+        if bid.Price == 0 || price > bid.Price {
+            bid = engine.OrderBookLevel{Price: price, Quantity: quantity}
+        }
+    }
+    for price, quantity := range book.asks {
+        if ask.Price == 0 || price < ask.Price {
+            ask = engine.OrderBookLevel{Price: price, Quantity: quantity}
+        }
+    }
+    return bid, ask
+}
+
+// DepthBooks holds the local exchange books by exchange and normalized
+// symbol. Feeders write to it; strategies and the API read from it.
+type DepthBooks struct {
+    books map[string]*DepthBook
+    mutex sync.RWMutex
+}
+
+func NewDepthBooks() *DepthBooks {
+    return &DepthBooks{books: make(map[string]*DepthBook)}
+}
+
+// Get returns the book for an exchange and normalized symbol, or nil
+func (db *DepthBooks) Get(exchange, symbol string) *DepthBook {
+    db.mutex.RLock()
+    defer db.mutex.RUnlock()
+    return db.books[exchange+"|"+symbol]
+}
+
+// List returns every book
+func (db *DepthBooks) List() []*DepthBook {
+    db.mutex.RLock()
+    defer db.mutex.RUnlock()
+
+    books := make([]*DepthBook, 0, len(db.books))
+    for _, book := range db.books {
+        books = append(books, book)
+    }
+    return books
+}
+
+func (db *DepthBooks) getOrCreate(exchange, symbol string) *DepthBook {
+    db.mutex.Lock()
+    defer db.mutex.Unlock()
+
+    key := exchange + "|" + symbol
+    book, exists := db.books[key]
+    if !exists {
+        book = newDepthBook(exchange, symbol)
+        db.books[key] = book
+    }
+    return book
+}
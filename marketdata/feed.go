@@ -0,0 +1,109 @@
+package marketdata
+
+import (
+    "context"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    "high-frequency-matching-engine/engine"
+    "high-frequency-matching-engine/utils"
+)
+
+// Feed is a source of normalized market data: a live exchange connection
+// or a replay of recorded data
+type Feed interface {
+    Start(ctx context.Context)
+    Status() FeedStatus
+    GetDataChannel() <-chan *engine.MarketData
+    Close() error
+}
+
+// FeedState is where a feed is in its lifecycle
+type FeedState string
+
+const (
+    FeedConnecting   FeedState = "connecting"
+    FeedConnected    FeedState = "connected"
+    FeedStale        FeedState = "stale"        // dropped for lack of data, reconnecting
+    FeedDisconnected FeedState = "disconnected" // dropped on error, reconnecting
+    FeedFinished     FeedState = "finished"     // replay reached the end of its data
+    FeedStopped      FeedState = "stopped"
+)
+
+var feedStates = []FeedState{FeedConnecting, FeedConnected, FeedStale, FeedDisconnected, FeedFinished, FeedStopped}
+
+// FeedStatus is a snapshot of a feed's health
+type FeedStatus struct {
+    Exchange   string    `json:"exchange"`
+    State      FeedState `json:"state"`
+    Since      time.Time `json:"since"`
+    LastData   time.Time `json:"last_data"`
+    Reconnects int       `json:"reconnects"`
+    LastError  string    `json:"last_error,omitempty"`
+}
+
+// feedHealth tracks a feed's status and keeps the feed metrics in step
+type feedHealth struct {
+    name     string
+    lastData atomic.Int64 // unix nanos
+    status   FeedStatus
+    mutex    sync.Mutex
+}
+
+func newFeedHealth(name string) *feedHealth {
+    h := &feedHealth{name: name, status: FeedStatus{Exchange: name}}
+    h.setState(FeedStopped, nil)
+    return h
+}
+
+func (h *feedHealth) setState(state FeedState, err error) {
+    h.mutex.Lock()
+    defer h.mutex.Unlock()
+
+    if h.status.State != state {
+        h.status.State = state
+        h.status.Since = time.Now()
+    }
+    if err != nil {
+        h.status.LastError = err.Error()
+    }
+    for _, s := range feedStates {
+        value := 0.0
+        if s == state {
+            value = 1
+        }
+        utils.MarketDataFeedState.WithLabelValues(h.name, string(s)).Set(value)
+    }
+}
+
+func (h *feedHealth) reconnecting() {
+    h.mutex.Lock()
+    h.status.Reconnects++
+    h.mutex.Unlock()
+    utils.MarketDataReconnects.WithLabelValues(h.name).Inc()
+}
+
+// received counts an event delivered at the given time
+func (h *feedHealth) received(dataType engine.MarketDataType, at time.Time) {
+    h.lastData.Store(at.UnixNano())
+    utils.MarketDataMessages.WithLabelValues(h.name, string(dataType)).Inc()
+    utils.MarketDataLastReceived.WithLabelValues(h.name).Set(float64(at.UnixNano()) / 1e9)
+}
+
+func (h *feedHealth) lastDataTime() time.Time {
+    if nanos := h.lastData.Load(); nanos != 0 {
+        return time.Unix(0, nanos)
+    }
+    return time.Time{}
+}
+
+// Status reports the feed's state
+func (h *feedHealth) Status() FeedStatus {
+    h.mutex.Lock()
+    status := h.status
+    h.mutex.Unlock()
+
+    status.LastData = h.lastDataTime()
+    return status
+}
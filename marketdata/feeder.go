@@ -1,105 +1,412 @@
 package marketdata
 
 import (
-    "encoding/json"
+    "context"
+    "errors"
+    "fmt"
+    "math/rand"
+    "sync"
+    "sync/atomic"
+    "time"
+
     "github.com/gorilla/websocket"
     "go.uber.org/zap"
+
     "high-frequency-matching-engine/engine"
-    "time"
+    "high-frequency-matching-engine/utils"
 )
+
+const (
+    defaultPingInterval = 15 * time.Second
+    defaultStaleTimeout = 60 * time.Second
+    defaultMinBackoff   = 500 * time.Millisecond
+    defaultMaxBackoff   = 30 * time.Second
+    feedWriteTimeout    = 5 * time.Second
+)
+
+var errStale = errors.New("no market data received")
+
+// FeederConfig sets up a feeder's connection. Zero durations use defaults.
+// The connection is dropped when pongs stop for two ping intervals or no
+// market data arrives within StaleTimeout, and is re-established with
+// exponential backoff between MinBackoff and MaxBackoff.
+type FeederConfig struct {
+    WSUrl        string
+    Symbols      []string
+    PingInterval time.Duration
+    StaleTimeout time.Duration
+    MinBackoff   time.Duration
+    MaxBackoff   time.Duration
+}
+
+// MarketDataFeeder streams market data from one exchange, using its
+// FeedAdapter for the exchange-specific protocol. Once started it keeps
+// reconnecting and resubscribing until closed.
 type MarketDataFeeder struct {
-    conn     *websocket.Conn
+    adapter  FeedAdapter
+    cfg      FeederConfig
     logger   *zap.Logger
     dataChan chan *engine.MarketData
-    wsUrl    string
-    symbols  []string
+
+    depth DepthAdapter // set when depth is enabled
+    books *DepthBooks
+
+    recorder *Recorder // set when recording is enabled
+
+    conn       *websocket.Conn
+    writeMutex sync.Mutex
+
+    *feedHealth
+
+    cancel context.CancelFunc
+    done   chan struct{}
 }
 
-func NewMarketDataFeeder(wsUrl string, symbols []string, logger *zap.Logger) *MarketDataFeeder {
-    return &MarketDataFeeder{
-        logger:   logger,
+func NewMarketDataFeeder(adapter FeedAdapter, cfg FeederConfig, logger *zap.Logger) *MarketDataFeeder {
+    if cfg.PingInterval <= 0 {
+        cfg.PingInterval = defaultPingInterval
+    }
+    if cfg.StaleTimeout <= 0 {
+        cfg.StaleTimeout = defaultStaleTimeout
+    }
+    if cfg.MinBackoff <= 0 {
+        cfg.MinBackoff = defaultMinBackoff
+    }
+    if cfg.MaxBackoff < cfg.MinBackoff {
+        cfg.MaxBackoff = max(defaultMaxBackoff, cfg.MinBackoff)
+    }
+
+    mdf := &MarketDataFeeder{
+        adapter:  adapter,
+        cfg:      cfg,
+        logger:   logger.With(zap.String("exchange", adapter.Name())),
         dataChan: make(chan *engine.MarketData, 10000),
-        wsUrl:    wsUrl,
-        symbols:  symbols,
+
+        feedHealth: newFeedHealth(adapter.Name()),
+    }
+    return mdf
+}
+
+// EnableDepth subscribes to order book depth as well and keeps local books
+// in books. It must be called before Start.
+func (mdf *MarketDataFeeder) EnableDepth(books *DepthBooks) error {
+    depth, supported := mdf.adapter.(DepthAdapter)
+    if !supported {
+        return fmt.Errorf("%s feed does not support depth", mdf.adapter.Name())
+    }
+    mdf.depth = depth
+    mdf.books = books
+    return nil
+}
+
+// EnableRecording captures every raw message and normalized event to
+// recorder. It must be called before Start.
+func (mdf *MarketDataFeeder) EnableRecording(recorder *Recorder) {
+    mdf.recorder = recorder
+}
+
+// Start connects in the background and keeps the feed running until ctx
+// is cancelled or Close is called
+func (mdf *MarketDataFeeder) Start(ctx context.Context) {
+    ctx, mdf.cancel = context.WithCancel(ctx)
+    mdf.done = make(chan struct{})
+    go mdf.run(ctx)
+}
+
+func (mdf *MarketDataFeeder) run(ctx context.Context) {
+    defer close(mdf.done)
+    defer mdf.setState(FeedStopped, nil)
+
+    attempt := 0
+    for {
+        mdf.setState(FeedConnecting, nil)
+        conn, err := mdf.connect(ctx)
+        if err == nil {
+            connected := time.Now()
+            err = mdf.readLoop(ctx, conn, connected)
+            conn.Close()
+
+            // Only a connection that delivered data resets the backoff
+            if mdf.lastDataTime().After(connected) {
+                attempt = 0
+            }
+        }
+        if ctx.Err() != nil {
+            return
+        }
+
+        state := FeedDisconnected
+        if errors.Is(err, errStale) {
+            state = FeedStale
+        }
+        mdf.setState(state, err)
+        mdf.reconnecting()
+
+        delay := mdf.backoff(attempt)
+        attempt++
+        mdf.logger.Warn("Market data feed dropped, reconnecting",
+            zap.Error(err), zap.Duration("backoff", delay))
+
+        timer := time.NewTimer(delay)
+        select {
+        case <-ctx.Done():
+            timer.Stop()
+            return
+        case <-timer.C:
+        }
+    }
+}
+
+// backoff doubles from MinBackoff up to MaxBackoff, randomized over the
+// upper half so that feeders do not reconnect in lockstep
+func (mdf *MarketDataFeeder) backoff(attempt int) time.Duration {
+    delay := mdf.cfg.MaxBackoff
+    if attempt < 32 {
+        delay = min(mdf.cfg.MinBackoff<<attempt, mdf.cfg.MaxBackoff)
     }
+    return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
 }
 
-func (mdf *MarketDataFeeder) Connect() error {
-    var err error
-    mdf.conn, _, err = websocket.DefaultDialer.Dial(mdf.wsUrl, nil)
+// connect dials and subscribes. Local books start over from a new
+// snapshot on every connection.
+func (mdf *MarketDataFeeder) connect(ctx context.Context) (*websocket.Conn, error) {
+    conn, _, err := websocket.DefaultDialer.DialContext(ctx, mdf.cfg.WSUrl, nil)
+    if err != nil {
+        return nil, err
+    }
+
+    messages, err := mdf.adapter.SubscribeMessages(mdf.cfg.Symbols)
     if err != nil {
-        return err
-    }
-    
-    // Subscribe to symbols
-    for _, symbol := range mdf.symbols {
-        subscribeMsg := map[string]interface{}{
-            "method": "SUBSCRIBE",
-            "params": []string{symbol + "@ticker"},
-            "id":     1,
+        conn.Close()
+        return nil, err
+    }
+    if mdf.depth != nil {
+        depthMessages, err := mdf.depth.DepthSubscribeMessages(mdf.cfg.Symbols)
+        if err != nil {
+            conn.Close()
+            return nil, err
         }
-        
-        if err := mdf.conn.WriteJSON(subscribeMsg); err != nil {
-            mdf.logger.Error("Failed to subscribe", zap.String("symbol", symbol), zap.Error(err))
+        messages = append(messages, depthMessages...)
+
+        for _, book := range mdf.books.List() {
+            if book.Exchange == mdf.adapter.Name() {
+                book.reset()
+            }
         }
     }
-    
-    return nil
+
+    mdf.writeMutex.Lock()
+    defer mdf.writeMutex.Unlock()
+
+    mdf.conn = conn
+    for _, msg := range messages {
+        conn.SetWriteDeadline(time.Now().Add(feedWriteTimeout))
+        if err := conn.WriteJSON(msg); err != nil {
+            conn.Close()
+            return nil, fmt.Errorf("subscribe: %w", err)
+        }
+    }
+    return conn, nil
 }
 
-func (mdf *MarketDataFeeder) StartFeed() {
+// readLoop handles messages until the connection fails. A watchdog sends
+// pings and closes the connection on cancellation or when data stops.
+func (mdf *MarketDataFeeder) readLoop(ctx context.Context, conn *websocket.Conn, connected time.Time) error {
+    mdf.setState(FeedConnected, nil)
+    mdf.logger.Info("Market data feed connected", zap.Strings("symbols", mdf.cfg.Symbols))
+
+    var stale atomic.Bool
+    stop := make(chan struct{})
+    defer close(stop)
     go func() {
-        defer mdf.conn.Close()
-        
+        ticker := time.NewTicker(mdf.cfg.PingInterval)
+        defer ticker.Stop()
         for {
-            var rawMessage json.RawMessage
-            err := mdf.conn.ReadJSON(&rawMessage)
-            if err != nil {
-                mdf.logger.Error("WebSocket read error", zap.Error(err))
-                // Implement reconnection logic here
-                time.Sleep(5 * time.Second)
-                if err := mdf.Connect(); err != nil {
-                    mdf.logger.Error("Reconnection failed", zap.Error(err))
-                    continue
+            select {
+            case <-stop:
+                return
+            case <-ctx.Done():
+                conn.Close()
+                return
+            case <-ticker.C:
+                last := mdf.lastDataTime()
+                if last.Before(connected) {
+                    last = connected
+                }
+                if time.Since(last) > mdf.cfg.StaleTimeout {
+                    stale.Store(true)
+                    conn.Close()
+                    return
+                }
+                if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(feedWriteTimeout)); err != nil {
+                    conn.Close()
+                    return
                 }
             }
-            
-            // Parse market data (this is a simplified example)
-            var tickerData struct {
-                Symbol string  `json:"s"`
-                Price  string  `json:"c"`
-                Volume string  `json:"v"`
+        }
+    }()
+
+    pongWait := 2 * mdf.cfg.PingInterval
+    conn.SetReadDeadline(time.Now().Add(pongWait))
+    conn.SetPongHandler(func(string) error {
+        return conn.SetReadDeadline(time.Now().Add(pongWait))
+    })
+
+    for {
+        _, rawMessage, err := conn.ReadMessage()
+        if err != nil {
+            if stale.Load() {
+                return fmt.Errorf("%w for %s", errStale, mdf.cfg.StaleTimeout)
             }
-            
-            if err := json.Unmarshal(rawMessage, &tickerData); err != nil {
-                continue // Skip malformed messages
+            return err
+        }
+        received := time.Now()
+        conn.SetReadDeadline(received.Add(pongWait))
+        mdf.handleMessage(rawMessage, received)
+    }
+}
+
+func (mdf *MarketDataFeeder) handleMessage(rawMessage []byte, received time.Time) {
+    if mdf.recorder != nil {
+        mdf.recorder.RecordRaw(mdf.adapter.Name(), rawMessage, received)
+    }
+
+    data, err := mdf.adapter.Parse(rawMessage)
+    if err != nil {
+        utils.MarketDataParseErrors.WithLabelValues(mdf.adapter.Name()).Inc()
+        mdf.logger.Warn("Failed to parse market data", zap.Error(err))
+        return
+    }
+
+    if mdf.depth != nil {
+        data = append(data, mdf.handleDepth(rawMessage)...)
+    }
+
+    for _, marketData := range data {
+        mdf.send(marketData, received)
+    }
+}
+
+// handleDepth applies depth updates to the local books, starts a resync
+// where one is needed and returns a depth event with the new top of book
+// for each book that changed
+func (mdf *MarketDataFeeder) handleDepth(rawMessage []byte) []*engine.MarketData {
+    updates, err := mdf.depth.ParseDepth(rawMessage)
+    if err != nil {
+        utils.MarketDataParseErrors.WithLabelValues(mdf.adapter.Name()).Inc()
+        mdf.logger.Warn("Failed to parse depth", zap.Error(err))
+        return nil
+    }
+
+    var events []*engine.MarketData
+    for _, update := range updates {
+        book := mdf.books.getOrCreate(mdf.adapter.Name(), update.Symbol)
+        if book.apply(update) {
+            mdf.resync(book)
+        }
+        if book.Synced() {
+            events = append(events, depthEvent(book, update.ExchangeTime))
+        }
+    }
+    return events
+}
+
+// resync starts a book over, fetching the snapshot in the background when
+// the exchange serves it separately
+func (mdf *MarketDataFeeder) resync(book *DepthBook) {
+    if !book.startResync() {
+        return
+    }
+    mdf.logger.Info("Resyncing depth", zap.String("symbol", book.Symbol))
+
+    go func() {
+        snapshot, messages, err := mdf.depth.ResyncDepth(book.Symbol)
+        if err != nil {
+            book.resyncFailed()
+            mdf.logger.Warn("Depth resync failed", zap.String("symbol", book.Symbol), zap.Error(err))
+            return
+        }
+        if snapshot != nil {
+            if book.apply(snapshot) {
+                book.resyncFailed()
+                return
             }
-            
-            // Convert to internal format and send to channel
-            // This is a simplified conversion - real implementation would be more robust
-            if tickerData.Symbol != "" {
-                marketData := &engine.MarketData{
-                    Symbol:    tickerData.Symbol,
-                    Timestamp: time.Now(),
-                }
-                
-                select {
-                case mdf.dataChan <- marketData:
-                default:
-                    mdf.logger.Warn("Market data channel full, dropping message")
-                }
+            mdf.send(depthEvent(book, snapshot.ExchangeTime), time.Now())
+        }
+        for _, msg := range messages {
+            if err := mdf.write(msg); err != nil {
+                book.resyncFailed()
+                mdf.logger.Warn("Depth resync failed", zap.String("symbol", book.Symbol), zap.Error(err))
+                return
             }
         }
     }()
 }
 
+func depthEvent(book *DepthBook, exchangeTime time.Time) *engine.MarketData {
+    bid, ask := book.Best()
+    return &engine.MarketData{
+        Symbol:       book.Symbol,
+        Type:         engine.MarketDataDepth,
+        BidPrice:     bid.Price,
+        BidQty:       bid.Quantity,
+        AskPrice:     ask.Price,
+        AskQty:       ask.Quantity,
+        ExchangeTime: exchangeTime,
+    }
+}
+
+// write sends a message on the current connection
+func (mdf *MarketDataFeeder) write(msg interface{}) error {
+    mdf.writeMutex.Lock()
+    defer mdf.writeMutex.Unlock()
+
+    if mdf.conn == nil {
+        return errors.New("not connected")
+    }
+    mdf.conn.SetWriteDeadline(time.Now().Add(feedWriteTimeout))
+    return mdf.conn.WriteJSON(msg)
+}
+
+// send records an event and queues it for consumers
+func (mdf *MarketDataFeeder) send(data *engine.MarketData, received time.Time) {
+    mdf.record(data, received)
+    if mdf.recorder != nil {
+        mdf.recorder.RecordData(data)
+    }
+    select {
+    case mdf.dataChan <- data:
+    default:
+        mdf.logger.Warn("Market data channel full, dropping message")
+    }
+}
+
+// record stamps an event with its source and receive time and updates the
+// feed metrics
+func (mdf *MarketDataFeeder) record(data *engine.MarketData, received time.Time) {
+    exchange := mdf.adapter.Name()
+    data.Exchange = exchange
+    data.ReceiveTime = received
+    mdf.received(data.Type, received)
+
+    // Clock offset between us and the exchange can make this negative
+    if !data.ExchangeTime.IsZero() {
+        if latency := received.Sub(data.ExchangeTime); latency >= 0 {
+            utils.MarketDataLatency.WithLabelValues(exchange).Observe(latency.Seconds())
+        }
+    }
+}
+
 func (mdf *MarketDataFeeder) GetDataChannel() <-chan *engine.MarketData {
     return mdf.dataChan
 }
 
+// Close stops the feed and waits for its connection to close
 func (mdf *MarketDataFeeder) Close() error {
-    if mdf.conn != nil {
-        return mdf.conn.Close()
+    if mdf.cancel == nil {
+        return nil
     }
+    mdf.cancel()
+    <-mdf.done
     return nil
 }
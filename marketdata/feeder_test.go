@@ -0,0 +1,102 @@
+package marketdata
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/gorilla/websocket"
+    "go.uber.org/zap"
+
+    "high-frequency-matching-engine/engine"
+)
+
+// wsStub is an exchange that answers each subscription with one message
+// and then drops the connection
+type wsStub struct {
+    server        *httptest.Server
+    subscriptions chan []byte
+}
+
+func newWSStub(t *testing.T, message []byte) *wsStub {
+    t.Helper()
+    stub := &wsStub{subscriptions: make(chan []byte, 16)}
+    upgrader := websocket.Upgrader{}
+    stub.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        conn, err := upgrader.Upgrade(w, r, nil)
+        if err != nil {
+            return
+        }
+        defer conn.Close()
+
+        _, subscription, err := conn.ReadMessage()
+        if err != nil {
+            return
+        }
+        stub.subscriptions <- subscription
+        conn.WriteMessage(websocket.TextMessage, []byte(`{"result":null,"id":1}`))
+        conn.WriteMessage(websocket.TextMessage, message)
+    }))
+    t.Cleanup(stub.server.Close)
+    return stub
+}
+
+func (stub *wsStub) url() string {
+    return "ws" + strings.TrimPrefix(stub.server.URL, "http")
+}
+
+func TestFeederSubscribesParsesAndReconnects(t *testing.T) {
+    stub := newWSStub(t, readFixture(t, "binance", "ticker.json"))
+    feeder := NewMarketDataFeeder(NewBinanceAdapter(""), FeederConfig{
+        WSUrl:      stub.url(),
+        Symbols:    []string{"BTCUSDT"},
+        MinBackoff: 10 * time.Millisecond,
+        MaxBackoff: 20 * time.Millisecond,
+    }, zap.NewNop())
+    feeder.Start(context.Background())
+    defer feeder.Close()
+
+    // The stub drops every connection, so each event comes over a new one
+    for connection := 1; connection <= 2; connection++ {
+        select {
+        case subscription := <-stub.subscriptions:
+            var request struct {
+                Method string   `json:"method"`
+                Params []string `json:"params"`
+            }
+            if err := json.Unmarshal(subscription, &request); err != nil {
+                t.Fatal(err)
+            }
+            if request.Method != "SUBSCRIBE" || len(request.Params) != 2 || request.Params[0] != "btcusdt@ticker" {
+                t.Errorf("connection %d subscribed with %s", connection, subscription)
+            }
+        case <-time.After(5 * time.Second):
+            t.Fatalf("no subscription on connection %d", connection)
+        }
+
+        select {
+        case data := <-feeder.GetDataChannel():
+            if data.Exchange != "binance" || data.Symbol != "BTCUSDT" || data.Type != engine.MarketDataTicker || data.Price != 43210.5 {
+                t.Errorf("connection %d delivered %+v", connection, data)
+            }
+            if data.ReceiveTime.IsZero() {
+                t.Errorf("connection %d delivered data without a receive time", connection)
+            }
+        case <-time.After(5 * time.Second):
+            t.Fatalf("no market data on connection %d", connection)
+        }
+    }
+
+    if status := feeder.Status(); status.Reconnects < 1 || status.LastData.IsZero() {
+        t.Errorf("status %+v, want a reconnect and data", status)
+    }
+
+    feeder.Close()
+    if status := feeder.Status(); status.State != FeedStopped {
+        t.Errorf("state %s after Close, want %s", status.State, FeedStopped)
+    }
+}
@@ -0,0 +1,121 @@
+package marketdata
+
+import (
+    "encoding/json"
+    "errors"
+    "strings"
+    "time"
+
+    "high-frequency-matching-engine/engine"
+)
+
+// GenericConfig describes a JSON feed for the generic adapter. Subscribe is
+// a JSON message sent once per symbol with every {symbol} replaced. Fields
+// are dot-separated paths into each incoming message; messages without the
+// symbol field are ignored and other fields are optional. TimeField may
+// hold Unix milliseconds or an RFC 3339 time.
+type GenericConfig struct {
+    Subscribe     string `yaml:"subscribe"`
+    SymbolField   string `yaml:"symbol_field"`
+    PriceField    string `yaml:"price_field"`
+    QuantityField string `yaml:"quantity_field"`
+    BidField      string `yaml:"bid_field"`
+    BidQtyField   string `yaml:"bid_qty_field"`
+    AskField      string `yaml:"ask_field"`
+    AskQtyField   string `yaml:"ask_qty_field"`
+    VolumeField   string `yaml:"volume_field"`
+    TimeField     string `yaml:"time_field"`
+}
+
+// GenericAdapter reads flat or nested JSON ticker messages as described by
+// its GenericConfig
+type GenericAdapter struct {
+    cfg GenericConfig
+}
+
+func NewGenericAdapter(cfg GenericConfig) (*GenericAdapter, error) {
+    if cfg.SymbolField == "" || cfg.PriceField == "" {
+        return nil, errors.New("generic feed needs symbol_field and price_field")
+    }
+    if cfg.Subscribe != "" && !json.Valid([]byte(strings.ReplaceAll(cfg.Subscribe, "{symbol}", "X"))) {
+        return nil, errors.New("generic feed subscribe message is not valid JSON")
+    }
+    return &GenericAdapter{cfg: cfg}, nil
+}
+
+func (a *GenericAdapter) Name() string {
+    return "generic"
+}
+
+func (a *GenericAdapter) SubscribeMessages(symbols []string) ([]interface{}, error) {
+    if a.cfg.Subscribe == "" {
+        return nil, nil
+    }
+    messages := make([]interface{}, len(symbols))
+    for i, symbol := range symbols {
+        messages[i] = json.RawMessage(strings.ReplaceAll(a.cfg.Subscribe, "{symbol}", symbol))
+    }
+    return messages, nil
+}
+
+func (a *GenericAdapter) Parse(data []byte) ([]*engine.MarketData, error) {
+    var msg map[string]interface{}
+    if err := json.Unmarshal(data, &msg); err != nil {
+        return nil, err
+    }
+
+    symbol, _ := lookup(msg, a.cfg.SymbolField).(string)
+    if symbol == "" {
+        return nil, nil
+    }
+    price, ok := toNumber(lookup(msg, a.cfg.PriceField))
+    if !ok {
+        return nil, nil
+    }
+    field := func(path string) float64 {
+        value, _ := toNumber(lookup(msg, path))
+        return value
+    }
+
+    return []*engine.MarketData{{
+        Symbol:       NormalizeSymbol(symbol),
+        Type:         engine.MarketDataTicker,
+        Price:        price,
+        Quantity:     field(a.cfg.QuantityField),
+        BidPrice:     field(a.cfg.BidField),
+        BidQty:       field(a.cfg.BidQtyField),
+        AskPrice:     field(a.cfg.AskField),
+        AskQty:       field(a.cfg.AskQtyField),
+        Volume:       field(a.cfg.VolumeField),
+        ExchangeTime: toTime(lookup(msg, a.cfg.TimeField)),
+    }}, nil
+}
+
+// toTime reads Unix milliseconds or an RFC 3339 string, or returns zero
+func toTime(value interface{}) time.Time {
+    if text, ok := value.(string); ok {
+        if t, err := time.Parse(time.RFC3339Nano, text); err == nil {
+            return t
+        }
+    }
+    if millis, ok := toNumber(value); ok && millis > 0 {
+        return time.UnixMilli(int64(millis))
+    }
+    return time.Time{}
+}
+
+// lookup follows a dot-separated path through nested objects
+func lookup(msg map[string]interface{}, path string) interface{} {
+    if path == "" {
+        return nil
+    }
+    var value interface{} = msg
+    for _, key := range strings.Split(path, ".") {
+        object, ok := value.(map[string]interface{})
+        if !ok {
+            return nil
+        }
+        value = object[key]
+    }
+    return value
+}
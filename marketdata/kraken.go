@@ -0,0 +1,232 @@
+package marketdata
+
+import (
+    "encoding/json"
+    "fmt"
+    "strings"
+    "sync"
+    "time"
+
+    "high-frequency-matching-engine/engine"
+)
+
+// KrakenAdapter subscribes to the ticker, trade and book channels of
+// Kraken's v2 WebSocket API. Symbols are configured as Kraken writes them, e.g. BTC/USD.
+type KrakenAdapter struct {
+    native map[string]string // normalized -> Kraken symbol
+    mutex  sync.Mutex
+}
+
+func NewKrakenAdapter() *KrakenAdapter {
+    return &KrakenAdapter{native: make(map[string]string)}
+}
+
+type krakenMessage struct {
+    Channel string          `json:"channel"`
+    Type    string          `json:"type"`
+    Data    json.RawMessage `json:"data"`
+    Method  string          `json:"method"`
+    Success *bool           `json:"success"`
+    Error   string          `json:"error"`
+}
+
+// Kraken's ticker carries no trade size or event time
+type krakenTicker struct {
+    Symbol string `json:"symbol"`
+    Last   number `json:"last"`
+    Bid    number `json:"bid"`
+    BidQty number `json:"bid_qty"`
+    Ask    number `json:"ask"`
+    AskQty number `json:"ask_qty"`
+    Volume number `json:"volume"`
+}
+
+type krakenTrade struct {
+    Symbol    string    `json:"symbol"`
+    Side      string    `json:"side"`
+    Price     number    `json:"price"`
+    Qty       number    `json:"qty"`
+    Timestamp time.Time `json:"timestamp"`
+}
+
+func (a *KrakenAdapter) Name() string {
+    return "kraken"
+}
+
+func (a *KrakenAdapter) SubscribeMessages(symbols []string) ([]interface{}, error) {
+    // Trades start from now rather than a snapshot of the last ones
+    return []interface{}{
+        map[string]interface{}{
+            "method": "subscribe",
+            "params": map[string]interface{}{
+                "channel": "ticker",
+                "symbol":  symbols,
+            },
+        },
+        map[string]interface{}{
+            "method": "subscribe",
+            "params": map[string]interface{}{
+                "channel":  "trade",
+                "symbol":   symbols,
+                "snapshot": false,
+            },
+        },
+    }, nil
+}
+
+func (a *KrakenAdapter) Parse(data []byte) ([]*engine.MarketData, error) {
+    var msg krakenMessage
+    if err := json.Unmarshal(data, &msg); err != nil {
+        return nil, err
+    }
+    if msg.Success != nil && !*msg.Success {
+        return nil, fmt.Errorf("kraken %s failed: %s", msg.Method, msg.Error)
+    }
+    switch msg.Channel {
+    case "ticker":
+    case "trade":
+        if msg.Type == "snapshot" {
+            return nil, nil
+        }
+        return parseKrakenTrades(msg.Data)
+    default:
+        return nil, nil
+    }
+
+    var tickers []krakenTicker
+    if err := json.Unmarshal(msg.Data, &tickers); err != nil {
+        return nil, err
+    }
+    result := make([]*engine.MarketData, 0, len(tickers))
+    for _, ticker := range tickers {
+        result = append(result, &engine.MarketData{
+            Symbol:   normalizeKrakenSymbol(ticker.Symbol),
+            Type:     engine.MarketDataTicker,
+            Price:    float64(ticker.Last),
+            BidPrice: float64(ticker.Bid),
+            BidQty:   float64(ticker.BidQty),
+            AskPrice: float64(ticker.Ask),
+            AskQty:   float64(ticker.AskQty),
+            Volume:   float64(ticker.Volume),
+        })
+    }
+    return result, nil
+}
+
+func parseKrakenTrades(data json.RawMessage) ([]*engine.MarketData, error) {
+    var trades []krakenTrade
+    if err := json.Unmarshal(data, &trades); err != nil {
+        return nil, err
+    }
+    result := make([]*engine.MarketData, 0, len(trades))
+    for _, trade := range trades {
+        side := engine.BUY
+        if trade.Side == "sell" {
+            side = engine.SELL
+        }
+        result = append(result, &engine.MarketData{
+            Symbol:       normalizeKrakenSymbol(trade.Symbol),
+            Type:         engine.MarketDataTrade,
+            Price:        float64(trade.Price),
+            Quantity:     float64(trade.Qty),
+            Side:         side,
+            ExchangeTime: trade.Timestamp,
+        })
+    }
+    return result, nil
+}
+
+// Kraken still names bitcoin XBT in places
+func normalizeKrakenSymbol(symbol string) string {
+    symbol = NormalizeSymbol(symbol)
+    if strings.HasPrefix(symbol, "XBT") {
+        symbol = "BTC" + symbol[3:]
+    }
+    return symbol
+}
+
+// Kraken keeps books to a fixed depth: the book channel sends a snapshot
+// and then updates, and levels pushed beyond the depth are dropped without
+// a message. There are no sequence numbers, so a resync resubscribes.
+const krakenBookDepth = 100
+
+type krakenBookLevel struct {
+    Price number `json:"price"`
+    Qty   number `json:"qty"`
+}
+
+type krakenBook struct {
+    Symbol    string            `json:"symbol"`
+    Bids      []krakenBookLevel `json:"bids"`
+    Asks      []krakenBookLevel `json:"asks"`
+    Timestamp time.Time         `json:"timestamp"`
+}
+
+func (a *KrakenAdapter) DepthSubscribeMessages(symbols []string) ([]interface{}, error) {
+    a.mutex.Lock()
+    for _, symbol := range symbols {
+        a.native[normalizeKrakenSymbol(symbol)] = symbol
+    }
+    a.mutex.Unlock()
+
+    return []interface{}{krakenBookRequest("subscribe", symbols)}, nil
+}
+
+func krakenBookRequest(method string, symbols []string) map[string]interface{} {
+    params := map[string]interface{}{
+        "channel": "book",
+        "symbol":  symbols,
+    }
+    if method == "subscribe" {
+        params["depth"] = krakenBookDepth
+    }
+    return map[string]interface{}{"method": method, "params": params}
+}
+
+func (a *KrakenAdapter) ParseDepth(data []byte) ([]*DepthUpdate, error) {
+    var msg krakenMessage
+    if err := json.Unmarshal(data, &msg); err != nil {
+        return nil, err
+    }
+    if msg.Channel != "book" {
+        return nil, nil
+    }
+
+    var books []krakenBook
+    if err := json.Unmarshal(msg.Data, &books); err != nil {
+        return nil, err
+    }
+    updates := make([]*DepthUpdate, 0, len(books))
+    for _, book := range books {
+        updates = append(updates, &DepthUpdate{
+            Symbol:       normalizeKrakenSymbol(book.Symbol),
+            Snapshot:     msg.Type == "snapshot",
+            Bids:         krakenLevels(book.Bids),
+            Asks:         krakenLevels(book.Asks),
+            MaxLevels:    krakenBookDepth,
+            ExchangeTime: book.Timestamp,
+        })
+    }
+    return updates, nil
+}
+
+func krakenLevels(raw []krakenBookLevel) []DepthLevel {
+    levels := make([]DepthLevel, len(raw))
+    for i, level := range raw {
+        levels[i] = DepthLevel{Price: float64(level.Price), Quantity: float64(level.Qty)}
+    }
+    return levels
+}
+
+func (a *KrakenAdapter) ResyncDepth(symbol string) (*DepthUpdate, []interface{}, error) {
+    a.mutex.Lock()
+    native, exists := a.native[symbol]
+    a.mutex.Unlock()
+    if !exists {
+        return nil, nil, fmt.Errorf("kraken symbol %s not subscribed", symbol)
+    }
+    return nil, []interface{}{
+        krakenBookRequest("unsubscribe", []string{native}),
+        krakenBookRequest("subscribe", []string{native}),
+    }, nil
+}
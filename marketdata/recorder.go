@@ -0,0 +1,182 @@
+package marketdata
+
+import (
+    "bufio"
+    "compress/gzip"
+    "encoding/json"
+    "os"
+    "path/filepath"
+    "time"
+
+    "go.uber.org/zap"
+
+    "high-frequency-matching-engine/engine"
+    "high-frequency-matching-engine/utils"
+)
+
+const (
+    defaultCaptureMaxBytes = 256 << 20 // uncompressed
+    defaultCaptureRotate   = time.Hour
+    captureFlushInterval   = time.Second
+    captureQueueSize       = 65536
+)
+
+// RecorderConfig sets where captures go and when a new file is started
+type RecorderConfig struct {
+    Dir            string
+    MaxBytes       int64         // rotate after this many uncompressed bytes
+    RotateInterval time.Duration // rotate after a file has been open this long
+}
+
+// Recorder writes raw and normalized market data to gzipped JSON-lines
+// capture files, starting a new file by size or age. Records are queued
+// and written in the background so feeds never wait on the disk; records
+// that do not fit in the queue are dropped and counted.
+type Recorder struct {
+    cfg    RecorderConfig
+    logger *zap.Logger
+    queue  chan *CaptureRecord
+    done   chan struct{}
+
+    file    *os.File
+    buf     *bufio.Writer
+    gz      *gzip.Writer
+    written int64
+    opened  time.Time
+}
+
+func NewRecorder(cfg RecorderConfig, logger *zap.Logger) (*Recorder, error) {
+    if cfg.MaxBytes <= 0 {
+        cfg.MaxBytes = defaultCaptureMaxBytes
+    }
+    if cfg.RotateInterval <= 0 {
+        cfg.RotateInterval = defaultCaptureRotate
+    }
+    if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+        return nil, err
+    }
+
+    r := &Recorder{
+        cfg:    cfg,
+        logger: logger,
+        queue:  make(chan *CaptureRecord, captureQueueSize),
+        done:   make(chan struct{}),
+    }
+    if err := r.rotate(time.Now()); err != nil {
+        return nil, err
+    }
+    go r.run()
+    return r, nil
+}
+
+// RecordRaw queues a message as it arrived from an exchange
+func (r *Recorder) RecordRaw(exchange string, message []byte, received time.Time) {
+    r.enqueue(&CaptureRecord{Kind: CaptureRaw, Exchange: exchange, Received: received, Raw: string(message)})
+}
+
+// RecordData queues a copy of a normalized event
+func (r *Recorder) RecordData(data *engine.MarketData) {
+    event := *data
+    r.enqueue(&CaptureRecord{Kind: CaptureData, Exchange: event.Exchange, Received: event.ReceiveTime, Data: &event})
+}
+
+func (r *Recorder) enqueue(record *CaptureRecord) {
+    select {
+    case r.queue <- record:
+    default:
+        utils.MarketDataCaptureDropped.Inc()
+    }
+}
+
+func (r *Recorder) run() {
+    defer close(r.done)
+    ticker := time.NewTicker(captureFlushInterval)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case record, ok := <-r.queue:
+            if !ok {
+                r.closeFile()
+                return
+            }
+            r.write(record)
+        case now := <-ticker.C:
+            if now.Sub(r.opened) >= r.cfg.RotateInterval {
+                r.rotateOrLog(now)
+            } else if r.gz != nil {
+                // Make the file readable up to here in case we crash
+                r.gz.Flush()
+                r.buf.Flush()
+            }
+        }
+    }
+}
+
+func (r *Recorder) write(record *CaptureRecord) {
+    if r.gz == nil || r.written >= r.cfg.MaxBytes {
+        if !r.rotateOrLog(time.Now()) {
+            return
+        }
+    }
+
+    line, err := json.Marshal(record)
+    if err != nil {
+        r.logger.Warn("Failed to encode capture record", zap.Error(err))
+        return
+    }
+    line = append(line, '\n')
+    if _, err := r.gz.Write(line); err != nil {
+        r.logger.Error("Failed to write capture", zap.String("file", r.file.Name()), zap.Error(err))
+        r.closeFile()
+        return
+    }
+    r.written += int64(len(line))
+    utils.MarketDataCaptureBytes.Add(float64(len(line)))
+}
+
+func (r *Recorder) rotateOrLog(now time.Time) bool {
+    if err := r.rotate(now); err != nil {
+        r.logger.Error("Failed to start capture file", zap.Error(err))
+        return false
+    }
+    return true
+}
+
+// rotate finishes the current file and starts a new one named after now
+func (r *Recorder) rotate(now time.Time) error {
+    r.closeFile()
+
+    path := filepath.Join(r.cfg.Dir, captureFileName(now))
+    file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+    if err != nil {
+        return err
+    }
+    r.file = file
+    r.buf = bufio.NewWriterSize(file, 64*1024)
+    r.gz = gzip.NewWriter(r.buf)
+    r.written = 0
+    r.opened = now
+    r.logger.Info("Started market data capture", zap.String("file", path))
+    return nil
+}
+
+func (r *Recorder) closeFile() {
+    if r.gz == nil {
+        return
+    }
+    r.gz.Close()
+    r.buf.Flush()
+    if err := r.file.Close(); err != nil {
+        r.logger.Warn("Failed to close capture file", zap.Error(err))
+    }
+    r.file, r.buf, r.gz = nil, nil, nil
+}
+
+// Close writes out queued records and closes the current file. Feeders
+// must be closed first.
+func (r *Recorder) Close() error {
+    close(r.queue)
+    <-r.done
+    return nil
+}
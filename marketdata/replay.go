@@ -0,0 +1,223 @@
+package marketdata
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "strings"
+    "time"
+
+    "go.uber.org/zap"
+
+    "high-frequency-matching-engine/clock"
+    "high-frequency-matching-engine/engine"
+)
+
+const replayFeedName = "replay"
+
+// ReplayConfig selects recorded market data to play back. Path is a
+// capture directory or one capture, JSON lines or CSV file. Events are
+// paced as they were received, Speed times faster (1 when unset), or sent
+// as fast as they are consumed with MaxSpeed. With Clock, the engine and
+// strategies run on the recorded time instead of the wall clock.
+type ReplayConfig struct {
+    Path     string  `yaml:"path"`
+    Speed    float64 `yaml:"speed"`
+    MaxSpeed bool    `yaml:"max_speed"`
+    Loop     bool    `yaml:"loop"`     // start over at the end
+    Exchange string  `yaml:"exchange"` // only replay this exchange's events
+    Clock    bool    `yaml:"clock"`
+
+    Symbols []string `yaml:"-"` // only replay these symbols, set from the exchange entry
+}
+
+// ReplayFeeder is a Feed that plays back recorded market data, so the
+// engine and strategies can run offline. Only normalized events are
+// replayed; they keep their exchange time and are stamped with the time
+// they are replayed, or with the time they were recorded when the replay
+// drives a clock.
+type ReplayFeeder struct {
+    cfg      ReplayConfig
+    clock    *clock.Replay
+    logger   *zap.Logger
+    dataChan chan *engine.MarketData
+    symbols  map[string]bool
+
+    *feedHealth
+
+    cancel context.CancelFunc
+    done   chan struct{}
+}
+
+// NewReplayClock returns a clock paced like a replay with cfg, for the
+// replay to drive
+func NewReplayClock(cfg ReplayConfig) *clock.Replay {
+    if cfg.MaxSpeed {
+        return clock.NewReplay(0)
+    }
+    if cfg.Speed <= 0 {
+        return clock.NewReplay(1)
+    }
+    return clock.NewReplay(cfg.Speed)
+}
+
+// NewReplayFeeder creates a replay. If clk is not nil, the replay moves it
+// on to each event's recorded receive time as the event is sent.
+func NewReplayFeeder(cfg ReplayConfig, clk *clock.Replay, logger *zap.Logger) (*ReplayFeeder, error) {
+    if cfg.Path == "" {
+        return nil, errors.New("replay path is required")
+    }
+    if _, err := os.Stat(cfg.Path); err != nil {
+        return nil, err
+    }
+    if cfg.Speed <= 0 {
+        cfg.Speed = 1
+    }
+
+    rf := &ReplayFeeder{
+        cfg:      cfg,
+        clock:    clk,
+        logger:   logger.With(zap.String("exchange", replayFeedName), zap.String("path", cfg.Path)),
+        dataChan: make(chan *engine.MarketData, 10000),
+
+        feedHealth: newFeedHealth(replayFeedName),
+    }
+    if len(cfg.Symbols) > 0 {
+        rf.symbols = make(map[string]bool, len(cfg.Symbols))
+        for _, symbol := range cfg.Symbols {
+            rf.symbols[NormalizeSymbol(symbol)] = true
+        }
+    }
+    return rf, nil
+}
+
+// Start replays in the background until the data ends, ctx is cancelled
+// or Close is called
+func (rf *ReplayFeeder) Start(ctx context.Context) {
+    ctx, rf.cancel = context.WithCancel(ctx)
+    rf.done = make(chan struct{})
+    go rf.run(ctx)
+}
+
+func (rf *ReplayFeeder) run(ctx context.Context) {
+    defer close(rf.done)
+
+    rf.setState(FeedConnected, nil)
+    rf.logger.Info("Market data replay started",
+        zap.Float64("speed", rf.cfg.Speed), zap.Bool("max_speed", rf.cfg.MaxSpeed))
+    for {
+        sent, err := rf.replay(ctx)
+        if ctx.Err() != nil {
+            rf.setState(FeedStopped, nil)
+            return
+        }
+        if err != nil {
+            rf.setState(FeedDisconnected, err)
+            rf.logger.Error("Market data replay failed", zap.Error(err))
+            return
+        }
+        // Looping over data with nothing to send would spin
+        if !rf.cfg.Loop || sent == 0 {
+            rf.setState(FeedFinished, nil)
+            rf.logger.Info("Market data replay finished")
+            return
+        }
+    }
+}
+
+// replay plays every file once and returns how many events it sent
+func (rf *ReplayFeeder) replay(ctx context.Context) (int, error) {
+    paths, err := CapturePaths(rf.cfg.Path)
+    if err != nil {
+        return 0, err
+    }
+
+    var first, start time.Time
+    sent := 0
+    for _, path := range paths {
+        reader, err := OpenCapture(path)
+        if err != nil {
+            return sent, err
+        }
+        for {
+            record, err := reader.Next()
+            if err == io.EOF {
+                break
+            }
+            if err != nil {
+                reader.Close()
+                return sent, fmt.Errorf("%s: %w", path, err)
+            }
+            if record.Kind != CaptureData || record.Data == nil || !rf.match(record) {
+                continue
+            }
+
+            if !rf.cfg.MaxSpeed {
+                if first.IsZero() {
+                    first, start = record.Received, time.Now()
+                }
+                offset := time.Duration(float64(record.Received.Sub(first)) / rf.cfg.Speed)
+                if err := sleepContext(ctx, time.Until(start.Add(offset))); err != nil {
+                    reader.Close()
+                    return sent, err
+                }
+            }
+
+            data := record.Data
+            data.ReceiveTime = time.Now()
+            rf.received(data.Type, data.ReceiveTime)
+            if rf.clock != nil {
+                rf.clock.Observe(record.Received)
+                data.ReceiveTime = record.Received
+            }
+            select {
+            case rf.dataChan <- data:
+                sent++
+            case <-ctx.Done():
+                reader.Close()
+                return sent, ctx.Err()
+            }
+        }
+        reader.Close()
+    }
+    return sent, nil
+}
+
+func (rf *ReplayFeeder) match(record *CaptureRecord) bool {
+    if rf.cfg.Exchange != "" && !strings.EqualFold(record.Exchange, rf.cfg.Exchange) {
+        return false
+    }
+    return rf.symbols == nil || rf.symbols[NormalizeSymbol(record.Data.Symbol)]
+}
+
+// sleepContext waits for d unless ctx ends first. Waits under a
+// millisecond are skipped so bursts go out together.
+func sleepContext(ctx context.Context, d time.Duration) error {
+    if d < time.Millisecond {
+        return ctx.Err()
+    }
+    timer := time.NewTimer(d)
+    defer timer.Stop()
+    select {
+    case <-ctx.Done():
+        return ctx.Err()
+    case <-timer.C:
+        return nil
+    }
+}
+
+func (rf *ReplayFeeder) GetDataChannel() <-chan *engine.MarketData {
+    return rf.dataChan
+}
+
+// Close stops the replay and waits for it to finish
+func (rf *ReplayFeeder) Close() error {
+    if rf.cancel == nil {
+        return nil
+    }
+    rf.cancel()
+    <-rf.done
+    return nil
+}
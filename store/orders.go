@@ -0,0 +1,253 @@
+package store
+
+import (
+    "bufio"
+    "encoding/json"
+    "io"
+    "os"
+    "path/filepath"
+    "sort"
+    "sync"
+
+    "high-frequency-matching-engine/engine"
+)
+
+const orderHistoryFile = "orders.history"
+
+// OrderQuery filters an order lookup. An empty field matches everything.
+type OrderQuery struct {
+    ClientID string
+    Symbol   string
+    Status   string // "open", "filled", "cancelled" or empty for all
+    Limit    int
+}
+
+// OrderStore tracks open orders in memory from the engine's execution
+// reports and moves them to an append-only history file once they are
+// filled or cancelled. History is indexed by order ID, client and symbol;
+// the offset lists only ever grow, so queries read them outside the lock.
+type OrderStore struct {
+    open     map[string]*engine.Order
+    file     *os.File
+    writer   *bufio.Writer
+    size     int64
+    byID     map[string]int64
+    byClient map[string][]int64
+    bySymbol map[string][]int64
+    all      []int64
+    mutex    sync.Mutex
+}
+
+func OpenOrderStore(dir string) (*OrderStore, error) {
+    if err := os.MkdirAll(dir, 0755); err != nil {
+        return nil, err
+    }
+
+    file, err := os.OpenFile(filepath.Join(dir, orderHistoryFile), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+    if err != nil {
+        return nil, err
+    }
+
+    st := &OrderStore{
+        open:     make(map[string]*engine.Order),
+        file:     file,
+        byID:     make(map[string]int64),
+        byClient: make(map[string][]int64),
+        bySymbol: make(map[string][]int64),
+    }
+
+    reader := bufio.NewReader(io.NewSectionReader(file, 0, 1<<62))
+    for {
+        line, err := reader.ReadBytes('\n')
+        if len(line) > 0 && line[len(line)-1] == '\n' {
+            var order engine.Order
+            if json.Unmarshal(line, &order) == nil {
+                st.index(&order, st.size)
+            }
+            st.size += int64(len(line))
+        }
+        if err != nil {
+            break
+        }
+    }
+
+    // Drop a torn trailing record left by a crash mid-write
+    if err := file.Truncate(st.size); err != nil {
+        file.Close()
+        return nil, err
+    }
+
+    st.writer = bufio.NewWriterSize(file, 64*1024)
+    return st, nil
+}
+
+func (st *OrderStore) index(order *engine.Order, offset int64) {
+    st.byID[order.ID] = offset
+    if order.ClientID != "" {
+        st.byClient[order.ClientID] = append(st.byClient[order.ClientID], offset)
+    }
+    st.bySymbol[order.Symbol] = append(st.bySymbol[order.Symbol], offset)
+    st.all = append(st.all, offset)
+}
+
+// Apply records the order state carried by an execution report. Reports
+// must come in engine order and without gaps, as from an engine event
+// queue, or a late update could reopen a finished order.
+func (st *OrderStore) Apply(report *engine.ExecutionReport) error {
+    order := report.Order
+
+    st.mutex.Lock()
+    defer st.mutex.Unlock()
+
+    if order.Status != engine.FILLED && order.Status != engine.CANCELLED {
+        st.open[order.ID] = &order
+        return nil
+    }
+
+    delete(st.open, order.ID)
+
+    data, err := json.Marshal(&order)
+    if err != nil {
+        return err
+    }
+    data = append(data, '\n')
+
+    if _, err := st.writer.Write(data); err != nil {
+        return err
+    }
+    st.index(&order, st.size)
+    st.size += int64(len(data))
+    return nil
+}
+
+// Get looks an order up by ID among open orders first, then history
+func (st *OrderStore) Get(orderID string) (*engine.Order, error) {
+    st.mutex.Lock()
+    defer st.mutex.Unlock()
+
+    if order, exists := st.open[orderID]; exists {
+        copied := *order
+        return &copied, nil
+    }
+
+    offset, exists := st.byID[orderID]
+    if !exists {
+        return nil, nil
+    }
+    if err := st.writer.Flush(); err != nil {
+        return nil, err
+    }
+    return st.readAt(offset, st.size)
+}
+
+// readAt reads the record at offset from history flushed up to size
+func (st *OrderStore) readAt(offset, size int64) (*engine.Order, error) {
+    line, err := bufio.NewReader(io.NewSectionReader(st.file, offset, size-offset)).ReadBytes('\n')
+    if err != nil && err != io.EOF {
+        return nil, err
+    }
+
+    var order engine.Order
+    if err := json.Unmarshal(line, &order); err != nil {
+        return nil, err
+    }
+    return &order, nil
+}
+
+// Query returns orders matching q, open orders first and then history
+// newest first. History is read outside the lock, so a long query does not
+// hold up Apply on the engine's event loop.
+func (st *OrderStore) Query(q OrderQuery) ([]*engine.Order, error) {
+    if q.Limit <= 0 || q.Limit > 1000 {
+        q.Limit = 1000
+    }
+
+    st.mutex.Lock()
+    var result []*engine.Order
+    if q.Status == "" || q.Status == "open" {
+        for _, order := range st.open {
+            if matchesOrder(order, q) {
+                copied := *order
+                result = append(result, &copied)
+            }
+        }
+    }
+    if q.Status == "open" {
+        st.mutex.Unlock()
+        return limitOpen(result, q.Limit), nil
+    }
+
+    if err := st.writer.Flush(); err != nil {
+        st.mutex.Unlock()
+        return nil, err
+    }
+    // The narrowest index that covers the query. Appends never touch the
+    // offsets already in it, so the slice stays valid unlocked.
+    offsets := st.all
+    switch {
+    case q.ClientID != "":
+        offsets = st.byClient[q.ClientID]
+    case q.Symbol != "":
+        offsets = st.bySymbol[q.Symbol]
+    }
+    size := st.size
+    st.mutex.Unlock()
+
+    result = limitOpen(result, q.Limit)
+
+    // Walk history backwards so the newest terminal orders come first. An
+    // ID's newest record is its current state; older ones are superseded.
+    seen := make(map[string]bool)
+    for i := len(offsets) - 1; i >= 0 && len(result) < q.Limit; i-- {
+        order, err := st.readAt(offsets[i], size)
+        if err != nil {
+            return nil, err
+        }
+        if seen[order.ID] {
+            continue
+        }
+        seen[order.ID] = true
+        if matchesOrder(order, q) {
+            result = append(result, order)
+        }
+    }
+    return result, nil
+}
+
+// limitOpen orders open orders oldest first and keeps up to limit
+func limitOpen(orders []*engine.Order, limit int) []*engine.Order {
+    sort.Slice(orders, func(i, j int) bool { return orders[i].Timestamp.Before(orders[j].Timestamp) })
+    if len(orders) > limit {
+        orders = orders[:limit]
+    }
+    return orders
+}
+
+func matchesOrder(order *engine.Order, q OrderQuery) bool {
+    if q.ClientID != "" && order.ClientID != q.ClientID {
+        return false
+    }
+    if q.Symbol != "" && order.Symbol != q.Symbol {
+        return false
+    }
+    switch q.Status {
+    case "open":
+        return order.Status == engine.PENDING || order.Status == engine.PARTIAL
+    case "filled":
+        return order.Status == engine.FILLED
+    case "cancelled":
+        return order.Status == engine.CANCELLED
+    }
+    return true
+}
+
+func (st *OrderStore) Close() error {
+    st.mutex.Lock()
+    defer st.mutex.Unlock()
+
+    if err := st.writer.Flush(); err != nil {
+        st.file.Close()
+        return err
+    }
+    return st.file.Close()
+}
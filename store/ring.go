@@ -0,0 +1,85 @@
+package store
+
+import (
+    "sync"
+
+    "high-frequency-matching-engine/engine"
+)
+
+type tradeBuffer struct {
+    trades []*engine.Trade
+    next   int
+    count  int
+}
+
+func (tb *tradeBuffer) add(trade *engine.Trade) {
+    tb.trades[tb.next] = trade
+    tb.next = (tb.next + 1) % len(tb.trades)
+    if tb.count < len(tb.trades) {
+        tb.count++
+    }
+}
+
+func (tb *tradeBuffer) latest(limit int) []*engine.Trade {
+    if limit <= 0 || limit > tb.count {
+        limit = tb.count
+    }
+
+    result := make([]*engine.Trade, 0, limit)
+    for i := 1; i <= limit; i++ {
+        idx := (tb.next - i + len(tb.trades)) % len(tb.trades)
+        result = append(result, tb.trades[idx])
+    }
+    return result
+}
+
+// TradeRing keeps the most recent trades in memory, both across all symbols
+// and per symbol, so recent-trade lookups never touch disk
+type TradeRing struct {
+    size     int
+    all      *tradeBuffer
+    bySymbol map[string]*tradeBuffer
+    mutex    sync.RWMutex
+}
+
+func NewTradeRing(size int) *TradeRing {
+    if size <= 0 {
+        size = 1000
+    }
+    return &TradeRing{
+        size:     size,
+        all:      &tradeBuffer{trades: make([]*engine.Trade, size)},
+        bySymbol: make(map[string]*tradeBuffer),
+    }
+}
+
+func (tr *TradeRing) Add(trade *engine.Trade) {
+    tr.mutex.Lock()
+    defer tr.mutex.Unlock()
+
+    tr.all.add(trade)
+
+    buf, exists := tr.bySymbol[trade.Symbol]
+    if !exists {
+        buf = &tradeBuffer{trades: make([]*engine.Trade, tr.size)}
+        tr.bySymbol[trade.Symbol] = buf
+    }
+    buf.add(trade)
+}
+
+// Latest returns up to limit trades, newest first. An empty symbol
+// returns trades across all symbols.
+func (tr *TradeRing) Latest(symbol string, limit int) []*engine.Trade {
+    tr.mutex.RLock()
+    defer tr.mutex.RUnlock()
+
+    if symbol == "" {
+        return tr.all.latest(limit)
+    }
+
+    buf, exists := tr.bySymbol[symbol]
+    if !exists {
+        return nil
+    }
+    return buf.latest(limit)
+}
@@ -0,0 +1,298 @@
+package store
+
+import (
+    "bufio"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "sort"
+    "sync"
+    "time"
+
+    "high-frequency-matching-engine/engine"
+    "high-frequency-matching-engine/utils"
+)
+
+const tradeFileExt = ".trades"
+
+// ErrInvalidSymbol rejects symbols that cannot safely name a segment file
+var ErrInvalidSymbol = errors.New("invalid symbol")
+
+// indexEntry locates a single trade record inside a symbol's segment file
+type indexEntry struct {
+    timestamp int64
+    offset    int64
+}
+
+type symbolLog struct {
+    file   *os.File
+    writer *bufio.Writer
+    size   int64
+    index  []indexEntry
+}
+
+// TradeQuery filters a trade history lookup. Cursor is the opaque value
+// returned as NextCursor by a previous page, zero for the first page.
+type TradeQuery struct {
+    Symbol   string
+    From     time.Time
+    To       time.Time
+    ClientID string
+    Cursor   int64
+    Limit    int
+}
+
+type TradePage struct {
+    Trades     []*engine.Trade `json:"trades"`
+    NextCursor int64           `json:"next_cursor,omitempty"`
+}
+
+// TradeStore is an append-only, file-backed trade history. Each symbol gets
+// its own JSON-lines segment and an in-memory time index for range queries.
+type TradeStore struct {
+    dir    string
+    logs   map[string]*symbolLog
+    recent *TradeRing
+    mutex  sync.Mutex
+    done   chan struct{}
+}
+
+func OpenTradeStore(dir string, recentSize int) (*TradeStore, error) {
+    if err := os.MkdirAll(dir, 0755); err != nil {
+        return nil, err
+    }
+
+    ts := &TradeStore{
+        dir:    dir,
+        logs:   make(map[string]*symbolLog),
+        recent: NewTradeRing(recentSize),
+        done:   make(chan struct{}),
+    }
+
+    paths, err := filepath.Glob(filepath.Join(dir, "*"+tradeFileExt))
+    if err != nil {
+        return nil, err
+    }
+    for _, path := range paths {
+        symbol := filepath.Base(path)
+        symbol = symbol[:len(symbol)-len(tradeFileExt)]
+        if _, err := ts.openLog(symbol); err != nil {
+            ts.Close()
+            return nil, err
+        }
+    }
+
+    go ts.flushLoop(time.Second)
+    return ts, nil
+}
+
+// openLog opens a symbol segment and rebuilds its index from disk.
+// Callers must hold the mutex (or be the constructor).
+func (ts *TradeStore) openLog(symbol string) (*symbolLog, error) {
+    path := filepath.Join(ts.dir, symbol+tradeFileExt)
+    file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+    if err != nil {
+        return nil, err
+    }
+
+    sl := &symbolLog{file: file}
+
+    reader := bufio.NewReader(io.NewSectionReader(file, 0, 1<<62))
+    for {
+        line, err := reader.ReadBytes('\n')
+        if len(line) > 0 && line[len(line)-1] == '\n' {
+            var trade engine.Trade
+            if json.Unmarshal(line, &trade) == nil {
+                sl.index = append(sl.index, indexEntry{timestamp: trade.Timestamp.UnixNano(), offset: sl.size})
+                ts.recent.Add(&trade)
+            }
+            sl.size += int64(len(line))
+        }
+        if err != nil {
+            break
+        }
+    }
+
+    // Drop a torn trailing record left by a crash mid-write
+    if err := file.Truncate(sl.size); err != nil {
+        file.Close()
+        return nil, err
+    }
+
+    sl.writer = bufio.NewWriterSize(file, 64*1024)
+    ts.logs[symbol] = sl
+    return sl, nil
+}
+
+// Append persists a trade and records it in the recent-trades buffer
+func (ts *TradeStore) Append(trade *engine.Trade) error {
+    data, err := json.Marshal(trade)
+    if err != nil {
+        return err
+    }
+    data = append(data, '\n')
+    if !utils.ValidSymbol(trade.Symbol) {
+        return fmt.Errorf("%w %q", ErrInvalidSymbol, trade.Symbol)
+    }
+
+    ts.mutex.Lock()
+    defer ts.mutex.Unlock()
+
+    sl, exists := ts.logs[trade.Symbol]
+    if !exists {
+        if sl, err = ts.openLog(trade.Symbol); err != nil {
+            return err
+        }
+    }
+
+    if _, err := sl.writer.Write(data); err != nil {
+        return err
+    }
+
+    timestamp := trade.Timestamp.UnixNano()
+    // Keep the index sorted even if a trade arrives slightly out of order
+    if n := len(sl.index); n > 0 && sl.index[n-1].timestamp > timestamp {
+        timestamp = sl.index[n-1].timestamp
+    }
+    sl.index = append(sl.index, indexEntry{timestamp: timestamp, offset: sl.size})
+    sl.size += int64(len(data))
+
+    ts.recent.Add(trade)
+    return nil
+}
+
+// Query returns one page of trades for a symbol in timestamp order
+func (ts *TradeStore) Query(q TradeQuery) (*TradePage, error) {
+    if !utils.ValidSymbol(q.Symbol) {
+        return nil, fmt.Errorf("%w %q", ErrInvalidSymbol, q.Symbol)
+    }
+    if q.Limit <= 0 || q.Limit > 1000 {
+        q.Limit = 1000
+    }
+
+    ts.mutex.Lock()
+    sl, exists := ts.logs[q.Symbol]
+    if !exists {
+        ts.mutex.Unlock()
+        return &TradePage{}, nil
+    }
+    if err := sl.writer.Flush(); err != nil {
+        ts.mutex.Unlock()
+        return nil, err
+    }
+
+    // Find the first record at or after both the cursor and the from time
+    start := sort.Search(len(sl.index), func(i int) bool {
+        return sl.index[i].offset >= q.Cursor
+    })
+    if !q.From.IsZero() {
+        from := q.From.UnixNano()
+        start += sort.Search(len(sl.index)-start, func(i int) bool {
+            return sl.index[start+i].timestamp >= from
+        })
+    }
+    end := len(sl.index)
+    if !q.To.IsZero() {
+        to := q.To.UnixNano()
+        end = start + sort.Search(len(sl.index)-start, func(i int) bool {
+            return sl.index[start+i].timestamp > to
+        })
+    }
+
+    var startOffset, endOffset int64
+    if start < end {
+        startOffset = sl.index[start].offset
+        endOffset = sl.size
+        if end < len(sl.index) {
+            endOffset = sl.index[end].offset
+        }
+    }
+    file := sl.file
+    ts.mutex.Unlock()
+
+    page := &TradePage{}
+    if startOffset >= endOffset {
+        return page, nil
+    }
+
+    reader := bufio.NewReader(io.NewSectionReader(file, startOffset, endOffset-startOffset))
+    offset := startOffset
+    for {
+        line, err := reader.ReadBytes('\n')
+        if len(line) > 0 {
+            if len(page.Trades) == q.Limit {
+                page.NextCursor = offset
+                break
+            }
+            offset += int64(len(line))
+
+            var trade engine.Trade
+            if json.Unmarshal(line, &trade) == nil && matchesClient(&trade, q.ClientID) {
+                page.Trades = append(page.Trades, &trade)
+            }
+        }
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return nil, err
+        }
+    }
+
+    return page, nil
+}
+
+func matchesClient(trade *engine.Trade, clientID string) bool {
+    return clientID == "" || trade.BuyClientID == clientID || trade.SellClientID == clientID
+}
+
+// Recent returns up to limit of the latest trades, newest first
+func (ts *TradeStore) Recent(symbol string, limit int) []*engine.Trade {
+    return ts.recent.Latest(symbol, limit)
+}
+
+func (ts *TradeStore) flushLoop(interval time.Duration) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-ts.done:
+            return
+        case <-ticker.C:
+            ts.mutex.Lock()
+            for _, sl := range ts.logs {
+                sl.writer.Flush()
+            }
+            ts.mutex.Unlock()
+        }
+    }
+}
+
+func (ts *TradeStore) Close() error {
+    ts.mutex.Lock()
+    defer ts.mutex.Unlock()
+
+    select {
+    case <-ts.done:
+        return nil
+    default:
+        close(ts.done)
+    }
+
+    var firstErr error
+    for _, sl := range ts.logs {
+        if sl.writer != nil {
+            if err := sl.writer.Flush(); err != nil && firstErr == nil {
+                firstErr = err
+            }
+        }
+        if err := sl.file.Close(); err != nil && firstErr == nil {
+            firstErr = err
+        }
+    }
+    return firstErr
+}
@@ -0,0 +1,320 @@
+package strategy
+
+import (
+    "errors"
+    "math"
+    "strings"
+    "time"
+
+    "go.uber.org/zap"
+
+    "high-frequency-matching-engine/engine"
+    "high-frequency-matching-engine/marketdata"
+)
+
+// AvellanedaStoikovConfig sets up an inventory-aware market maker.
+//
+// Quotes are centred on the reservation price mid - q*γ*σ²*τ, where q is
+// the position in lots of Quantity, γ is RiskAversion, σ² the estimated
+// variance of the mid per second and τ the Horizon. The total spread is
+// γ*σ²*τ + (2/γ)*ln(1 + γ/k), where k is how fast trade arrivals fall off
+// with distance from the mid, estimated from observed trades. Volatility
+// and k are exponentially weighted with VolatilityHalfLife, starting from
+// InitialVolatility (price units per square root second) and
+// InitialIntensity (per price unit) if set.
+//
+// Mids are sampled from one source, Exchange: an exchange name, or nbbo
+// for consolidated quotes. Left empty it is the first source to send the
+// symbol. Trades come from that exchange, or from every exchange for nbbo.
+type AvellanedaStoikovConfig struct {
+    Name               string        `yaml:"name"`
+    Symbol             string        `yaml:"symbol"`
+    Exchange           string        `yaml:"exchange"`
+    RiskAversion       float64       `yaml:"risk_aversion"`
+    Horizon            time.Duration `yaml:"horizon"`
+    VolatilityHalfLife time.Duration `yaml:"volatility_half_life"`
+    InitialVolatility  float64       `yaml:"initial_volatility"`
+    InitialIntensity   float64       `yaml:"initial_intensity"`
+    MinSpread          float64       `yaml:"min_spread"`
+    MaxSpread          float64       `yaml:"max_spread"`
+    Quantity           float64       `yaml:"quantity"`      // per quote level
+    MaxInventory       float64       `yaml:"max_inventory"` // absolute position limit
+    Levels             int           `yaml:"levels"`
+    LevelSpacing       float64       `yaml:"level_spacing"` // price step between levels
+    TickSize           float64       `yaml:"tick_size"`
+    RefreshInterval    time.Duration `yaml:"refresh_interval"`
+}
+
+func (c *AvellanedaStoikovConfig) setDefaults() {
+    if c.Name == "" {
+        c.Name = "AvellanedaStoikov-" + c.Symbol
+    }
+    c.Exchange = strings.ToLower(c.Exchange)
+    if c.RiskAversion <= 0 {
+        c.RiskAversion = 0.1
+    }
+    if c.Horizon <= 0 {
+        c.Horizon = 10 * time.Second
+    }
+    if c.VolatilityHalfLife <= 0 {
+        c.VolatilityHalfLife = 30 * time.Second
+    }
+    if c.TickSize <= 0 {
+        c.TickSize = 0.01
+    }
+    if c.MinSpread <= 0 {
+        c.MinSpread = 2 * c.TickSize
+    }
+    if c.MaxInventory <= 0 {
+        c.MaxInventory = 10 * c.Quantity
+    }
+    if c.Levels <= 0 {
+        c.Levels = 1
+    }
+    if c.LevelSpacing <= 0 {
+        c.LevelSpacing = c.TickSize
+    }
+    if c.RefreshInterval <= 0 {
+        c.RefreshInterval = time.Second
+    }
+}
+
+// quoteSlot is one level on one side of the quotes
+type quoteSlot struct {
+    side  engine.OrderSide
+    level int
+}
+
+// quotedOrder is the order on a level and the price last asked for it
+type quotedOrder struct {
+    id    string
+    price float64
+}
+
+// AvellanedaStoikovStrategy makes a market skewed against its inventory,
+// widening with volatility and narrowing as trades arrive closer to the
+// mid. It stops quoting the side that would take it past MaxInventory.
+type AvellanedaStoikovStrategy struct {
+    BaseStrategy
+    cfg AvellanedaStoikovConfig
+
+    mid       float64
+    lastMid   time.Time
+    lastTrade time.Time
+
+    // Exponentially decayed sums behind the volatility and k estimates
+    squaredMoves float64
+    elapsed      float64
+    distances    float64
+    arrivals     float64
+
+    quotes map[quoteSlot]quotedOrder
+}
+
+func NewAvellanedaStoikovStrategy(cfg AvellanedaStoikovConfig) (*AvellanedaStoikovStrategy, error) {
+    if cfg.Symbol == "" {
+        return nil, errors.New("avellaneda-stoikov: symbol required")
+    }
+    if cfg.Quantity <= 0 {
+        return nil, errors.New("avellaneda-stoikov: quantity must be positive")
+    }
+    cfg.Symbol = marketdata.NormalizeSymbol(cfg.Symbol)
+    cfg.setDefaults()
+
+    as := &AvellanedaStoikovStrategy{
+        BaseStrategy: BaseStrategy{Name: cfg.Name},
+        cfg:          cfg,
+        quotes:       make(map[quoteSlot]quotedOrder),
+    }
+
+    // Priors count as one half-life of observations
+    halfLife := cfg.VolatilityHalfLife.Seconds()
+    if cfg.InitialVolatility > 0 {
+        as.squaredMoves = cfg.InitialVolatility * cfg.InitialVolatility * halfLife
+        as.elapsed = halfLife
+    }
+    if cfg.InitialIntensity > 0 {
+        as.distances = 1 / cfg.InitialIntensity
+        as.arrivals = 1
+    }
+    return as, nil
+}
+
+func (as *AvellanedaStoikovStrategy) OnStart(ctx Context) {
+    ctx.Every(as.cfg.RefreshInterval, as.requote)
+}
+
+func (as *AvellanedaStoikovStrategy) OnMarketData(ctx Context, data *engine.MarketData) {
+    if marketdata.NormalizeSymbol(data.Symbol) != as.cfg.Symbol {
+        return
+    }
+
+    if as.cfg.Exchange == "" {
+        as.cfg.Exchange = data.Exchange
+    }
+    source := data.Exchange == as.cfg.Exchange
+
+    // Venues' quotes and the nbbo differ, so mixing them would read as
+    // volatility
+    if source && data.BidPrice > 0 && data.AskPrice > 0 {
+        as.observeMid((data.BidPrice+data.AskPrice)/2, ctx.Now())
+    } else if source && data.Type == engine.MarketDataTicker && data.Price > 0 {
+        as.observeMid(data.Price, ctx.Now())
+    }
+    if data.Type == engine.MarketDataTrade && data.Price > 0 &&
+        (source || as.cfg.Exchange == marketdata.ConsolidatedExchange) {
+        as.observeTrade(data.Price, ctx.Now())
+    }
+    as.requote(ctx)
+}
+
+func (as *AvellanedaStoikovStrategy) OnTrade(ctx Context, trade *engine.Trade) {
+    if trade.Symbol != as.cfg.Symbol {
+        return
+    }
+    as.observeTrade(trade.Price, ctx.Now())
+}
+
+// OnOrderUpdate requotes after a fill, since the inventory skew moved
+func (as *AvellanedaStoikovStrategy) OnOrderUpdate(ctx Context, order *engine.Order) {
+    if order.Status == engine.PARTIAL || order.Status == engine.FILLED {
+        as.requote(ctx)
+    }
+}
+
+func (as *AvellanedaStoikovStrategy) observeMid(mid float64, now time.Time) {
+    if !as.lastMid.IsZero() && as.mid > 0 {
+        if dt := now.Sub(as.lastMid).Seconds(); dt > 0 {
+            decay := as.decay(dt)
+            move := mid - as.mid
+            as.squaredMoves = as.squaredMoves*decay + move*move
+            as.elapsed = as.elapsed*decay + dt
+        }
+    }
+    as.mid = mid
+    as.lastMid = now
+}
+
+// observeTrade takes a trade's distance from the mid as a sample of where
+// orders arrive. For arrivals falling off as exp(-k*distance), k is one
+// over the mean distance.
+func (as *AvellanedaStoikovStrategy) observeTrade(price float64, now time.Time) {
+    if as.mid <= 0 {
+        return
+    }
+    if !as.lastTrade.IsZero() {
+        decay := as.decay(max(now.Sub(as.lastTrade).Seconds(), 0))
+        as.distances *= decay
+        as.arrivals *= decay
+    }
+    as.lastTrade = now
+    as.distances += max(math.Abs(price-as.mid), as.cfg.TickSize/2)
+    as.arrivals++
+}
+
+func (as *AvellanedaStoikovStrategy) decay(seconds float64) float64 {
+    return math.Exp2(-seconds / as.cfg.VolatilityHalfLife.Seconds())
+}
+
+// variance is the estimated variance of the mid per second
+func (as *AvellanedaStoikovStrategy) variance() float64 {
+    if as.elapsed <= 0 {
+        return 0
+    }
+    return as.squaredMoves / as.elapsed
+}
+
+// intensity is the estimated k, or 0 before any trades
+func (as *AvellanedaStoikovStrategy) intensity() float64 {
+    if as.distances <= 0 {
+        return 0
+    }
+    return as.arrivals / as.distances
+}
+
+// reservation returns the inventory-skewed price to quote around and the
+// half spread for inventory q in lots
+func (as *AvellanedaStoikovStrategy) reservation(q float64) (float64, float64) {
+    gamma := as.cfg.RiskAversion
+    risk := gamma * as.variance() * as.cfg.Horizon.Seconds()
+
+    spread := risk
+    if k := as.intensity(); k > 0 {
+        spread += 2 / gamma * math.Log1p(gamma/k)
+    }
+    spread = max(spread, as.cfg.MinSpread)
+    if as.cfg.MaxSpread > 0 {
+        spread = min(spread, as.cfg.MaxSpread)
+    }
+    return as.mid - q*risk, spread / 2
+}
+
+// requote moves each level's order to its price, placing or cancelling
+// levels as the inventory limit allows
+func (as *AvellanedaStoikovStrategy) requote(ctx Context) {
+    if as.mid <= 0 {
+        return
+    }
+
+    position := ctx.Position(as.cfg.Symbol).Quantity
+    price, halfSpread := as.reservation(position / as.cfg.Quantity)
+
+    open := make(map[string]engine.Order)
+    for _, order := range ctx.OpenOrders(as.cfg.Symbol) {
+        open[order.ID] = order
+    }
+
+    for level := 0; level < as.cfg.Levels; level++ {
+        offset := halfSpread + float64(level)*as.cfg.LevelSpacing
+        depth := float64(level+1) * as.cfg.Quantity
+
+        // Bids round down and asks up, so rounding never narrows the spread
+        bid := math.Floor((price-offset)/as.cfg.TickSize) * as.cfg.TickSize
+        ask := math.Ceil((price+offset)/as.cfg.TickSize) * as.cfg.TickSize
+        as.quote(ctx, open, quoteSlot{engine.BUY, level}, bid, position+depth <= as.cfg.MaxInventory && bid > 0)
+        as.quote(ctx, open, quoteSlot{engine.SELL, level}, ask, -position+depth <= as.cfg.MaxInventory)
+    }
+}
+
+// quote keeps one level's order at price, or cancels it if not wanted
+func (as *AvellanedaStoikovStrategy) quote(ctx Context, open map[string]engine.Order, slot quoteSlot, price float64, wanted bool) {
+    price = math.Round(price*1e8) / 1e8
+
+    quoted, exists := as.quotes[slot]
+    order, live := open[quoted.id]
+    if exists && !live {
+        delete(as.quotes, slot)
+        exists = false
+    }
+
+    switch {
+    case !wanted:
+        if exists {
+            delete(as.quotes, slot)
+            if err := ctx.Cancel(as.cfg.Symbol, quoted.id); err != nil {
+                ctx.Logger().Debug("Failed to cancel quote", zap.String("order_id", quoted.id), zap.Error(err))
+            }
+        }
+
+    case !exists:
+        id, err := ctx.Place(&engine.Order{
+            Symbol:   as.cfg.Symbol,
+            Side:     slot.side,
+            Type:     engine.LIMIT,
+            Quantity: as.cfg.Quantity,
+            Price:    price,
+        })
+        if err != nil {
+            ctx.Logger().Debug("Failed to place quote", zap.Error(err))
+            return
+        }
+        as.quotes[slot] = quotedOrder{id: id, price: price}
+
+    case quoted.price != price:
+        if err := ctx.Amend(as.cfg.Symbol, quoted.id, price, order.Quantity); err != nil {
+            ctx.Logger().Debug("Failed to amend quote", zap.String("order_id", quoted.id), zap.Error(err))
+            return
+        }
+        as.quotes[slot] = quotedOrder{id: quoted.id, price: price}
+    }
+}
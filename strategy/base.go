@@ -4,13 +4,20 @@ import (
     "high-frequency-matching-engine/engine"
 )
 
+// Strategy reacts to events through its Context. A strategy's callbacks
+// are never called concurrently; OnStart comes first and OnStop last,
+// after which its open orders are cancelled.
 type Strategy interface {
-    OnMarketData(data *engine.MarketData) []*engine.Order
-    OnTrade(trade *engine.Trade) []*engine.Order
-    OnOrderUpdate(order *engine.Order) []*engine.Order
+    OnStart(ctx Context)
+    OnMarketData(ctx Context, data *engine.MarketData)
+    OnTrade(ctx Context, trade *engine.Trade)
+    OnOrderUpdate(ctx Context, order *engine.Order)
+    OnStop(ctx Context)
     GetName() string
 }
 
+// BaseStrategy ignores every event, so strategies embedding it implement
+// only the callbacks they need
 type BaseStrategy struct {
     Name string
 }
@@ -19,14 +26,12 @@ func (bs *BaseStrategy) GetName() string {
     return bs.Name
 }
 
-func (bs *BaseStrategy) OnMarketData(data *engine.MarketData) []*engine.Order {
-    return nil
-}
+func (bs *BaseStrategy) OnStart(ctx Context) {}
 
-func (bs *BaseStrategy) OnTrade(trade *engine.Trade) []*engine.Order {
-    return nil
-}
+func (bs *BaseStrategy) OnMarketData(ctx Context, data *engine.MarketData) {}
+
+func (bs *BaseStrategy) OnTrade(ctx Context, trade *engine.Trade) {}
+
+func (bs *BaseStrategy) OnOrderUpdate(ctx Context, order *engine.Order) {}
 
-func (bs *BaseStrategy) OnOrderUpdate(order *engine.Order) []*engine.Order {
-    return nil
-}
\ No newline at end of file
+func (bs *BaseStrategy) OnStop(ctx Context) {}
\ No newline at end of file
@@ -0,0 +1,243 @@
+package strategy
+
+import (
+    "errors"
+    "math"
+    "sort"
+    "sync"
+    "time"
+
+    "go.uber.org/zap"
+
+    "high-frequency-matching-engine/engine"
+)
+
+var (
+    ErrInvalidOrder = errors.New("invalid order")
+    ErrThrottled    = errors.New("order rate limit reached")
+    ErrRouterBusy   = errors.New("order router busy")
+)
+
+// Context is a strategy's handle on the engine, passed to every callback.
+// Its methods are meant to be called from those callbacks, which for a
+// given strategy never run concurrently.
+type Context interface {
+    // Place sends a new order and returns its ID, assigning one if the
+    // order has none. The order is copied, so the strategy may reuse it.
+    Place(order *engine.Order) (string, error)
+    // Cancel pulls one of the strategy's open orders. Cancels are never
+    // rate limited.
+    Cancel(symbol, orderID string) error
+    // Amend changes an open order's price and total quantity
+    Amend(symbol, orderID string, price, quantity float64) error
+
+    // OpenOrders returns the strategy's live orders, for one symbol or
+    // every symbol with "", oldest first
+    OpenOrders(symbol string) []engine.Order
+    // Position returns the strategy's position in a symbol
+    Position(symbol string) Position
+
+    TopOfBook(symbol string) *engine.TopOfBook
+    // Depth returns up to levels price levels per side, 0 for all
+    Depth(symbol string, levels int) *engine.OrderBookSnapshot
+
+    // After calls fn once after d; Every calls it every d until stopped.
+    // Timers run on the strategy's goroutine and end when it stops.
+    After(d time.Duration, fn func(Context)) Timer
+    Every(d time.Duration, fn func(Context)) Timer
+
+    Now() time.Time
+    Logger() *zap.Logger
+}
+
+// Timer is a scheduled callback
+type Timer interface {
+    // Stop prevents the callback from running again
+    Stop()
+}
+
+// Position is a strategy's net holding in a symbol at average cost.
+// Quantity is positive when long and negative when short.
+type Position struct {
+    Symbol   string  `json:"symbol"`
+    Quantity float64 `json:"quantity"`
+    AvgPrice float64 `json:"avg_price"`
+    Realized float64 `json:"realized_pnl"`
+    Bought   float64 `json:"bought"`
+    Sold     float64 `json:"sold"`
+}
+
+// Unrealized is the profit on the open quantity marked at price
+func (p Position) Unrealized(mark float64) float64 {
+    if p.Quantity == 0 {
+        return 0
+    }
+    return p.Quantity * (mark - p.AvgPrice)
+}
+
+const positionEpsilon = 1e-12
+
+func (p *Position) fill(side engine.OrderSide, quantity, price float64) {
+    signed := quantity
+    if side == engine.BUY {
+        p.Bought += quantity
+    } else {
+        p.Sold += quantity
+        signed = -quantity
+    }
+
+    // Adding to the position, or opening one, moves the average cost
+    if p.Quantity == 0 || (p.Quantity > 0) == (signed > 0) {
+        total := math.Abs(p.Quantity) + quantity
+        p.AvgPrice = (p.AvgPrice*math.Abs(p.Quantity) + price*quantity) / total
+        p.Quantity += signed
+        return
+    }
+
+    // Reducing it realizes profit on the closed part; going through zero
+    // opens the rest at this price
+    closed := min(quantity, math.Abs(p.Quantity))
+    if p.Quantity > 0 {
+        p.Realized += closed * (price - p.AvgPrice)
+    } else {
+        p.Realized += closed * (p.AvgPrice - price)
+    }
+    flipped := quantity > math.Abs(p.Quantity)
+    p.Quantity += signed
+    switch {
+    case math.Abs(p.Quantity) < positionEpsilon:
+        p.Quantity, p.AvgPrice = 0, 0
+    case flipped:
+        p.AvgPrice = price
+    }
+}
+
+// Portfolio keeps a strategy's open orders and positions up to date from
+// its execution reports. It is safe for concurrent use.
+type Portfolio struct {
+    open       map[string]*engine.Order
+    cancelling map[string]bool
+    positions  map[string]*Position
+    mutex      sync.RWMutex
+}
+
+func NewPortfolio() *Portfolio {
+    return &Portfolio{
+        open:       make(map[string]*engine.Order),
+        cancelling: make(map[string]bool),
+        positions:  make(map[string]*Position),
+    }
+}
+
+// Track records an order as open once it has been sent
+func (p *Portfolio) Track(order engine.Order) {
+    p.mutex.Lock()
+    defer p.mutex.Unlock()
+    p.open[order.ID] = &order
+}
+
+// Untrack forgets an order that never reached the engine
+func (p *Portfolio) Untrack(orderID string) {
+    p.mutex.Lock()
+    defer p.mutex.Unlock()
+    delete(p.open, orderID)
+}
+
+// Apply updates an order and, for fills, its symbol's position
+func (p *Portfolio) Apply(report *engine.ExecutionReport) {
+    p.mutex.Lock()
+    defer p.mutex.Unlock()
+
+    order := report.Order
+    if report.Type == engine.EXEC_TRADE && report.LastQty > 0 {
+        position, exists := p.positions[order.Symbol]
+        if !exists {
+            position = &Position{Symbol: order.Symbol}
+            p.positions[order.Symbol] = position
+        }
+        position.fill(order.Side, report.LastQty, report.LastPrice)
+    }
+
+    if order.Status == engine.FILLED || order.Status == engine.CANCELLED {
+        delete(p.open, order.ID)
+        delete(p.cancelling, order.ID)
+        return
+    }
+    if _, exists := p.open[order.ID]; exists {
+        p.open[order.ID] = &order
+    }
+}
+
+// markCancelling reports whether the order is open and not already being
+// cancelled, and marks it
+func (p *Portfolio) markCancelling(orderID string) (bool, error) {
+    p.mutex.Lock()
+    defer p.mutex.Unlock()
+
+    if _, exists := p.open[orderID]; !exists {
+        return false, engine.ErrOrderNotFound
+    }
+    if p.cancelling[orderID] {
+        return false, nil
+    }
+    p.cancelling[orderID] = true
+    return true, nil
+}
+
+func (p *Portfolio) unmarkCancelling(orderID string) {
+    p.mutex.Lock()
+    defer p.mutex.Unlock()
+    delete(p.cancelling, orderID)
+}
+
+// IsOpen reports whether an order is live
+func (p *Portfolio) IsOpen(orderID string) bool {
+    p.mutex.RLock()
+    defer p.mutex.RUnlock()
+    _, exists := p.open[orderID]
+    return exists
+}
+
+// OpenOrders returns open orders for a symbol, or all with "", oldest first
+func (p *Portfolio) OpenOrders(symbol string) []engine.Order {
+    p.mutex.RLock()
+    defer p.mutex.RUnlock()
+
+    orders := make([]engine.Order, 0, len(p.open))
+    for _, order := range p.open {
+        if symbol == "" || order.Symbol == symbol {
+            orders = append(orders, *order)
+        }
+    }
+    sort.Slice(orders, func(i, j int) bool {
+        if !orders[i].Timestamp.Equal(orders[j].Timestamp) {
+            return orders[i].Timestamp.Before(orders[j].Timestamp)
+        }
+        return orders[i].ID < orders[j].ID
+    })
+    return orders
+}
+
+// Position returns the position in a symbol, flat if never traded
+func (p *Portfolio) Position(symbol string) Position {
+    p.mutex.RLock()
+    defer p.mutex.RUnlock()
+
+    if position, exists := p.positions[symbol]; exists {
+        return *position
+    }
+    return Position{Symbol: symbol}
+}
+
+// Positions returns every symbol's position, ordered by symbol
+func (p *Portfolio) Positions() []Position {
+    p.mutex.RLock()
+    defer p.mutex.RUnlock()
+
+    positions := make([]Position, 0, len(p.positions))
+    for _, position := range p.positions {
+        positions = append(positions, *position)
+    }
+    sort.Slice(positions, func(i, j int) bool { return positions[i].Symbol < positions[j].Symbol })
+    return positions
+}
@@ -0,0 +1,418 @@
+package strategy
+
+import (
+    "context"
+    "fmt"
+    "runtime/debug"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    "go.uber.org/zap"
+
+    "high-frequency-matching-engine/clock"
+    "high-frequency-matching-engine/engine"
+    "high-frequency-matching-engine/utils"
+)
+
+// event is one callback for a strategy; exactly one field is set
+type event struct {
+    data  *engine.MarketData
+    trade *engine.Trade
+    order *engine.Order
+}
+
+// host runs one strategy and is the Context its callbacks get
+type host struct {
+    strategy  Strategy
+    name      string
+    runner    *Runner
+    logger    *zap.Logger
+    inbox     chan event
+    timerChan chan *hostTimer
+    portfolio *Portfolio
+    running   atomic.Bool // running and not paused
+    orderSeq  int64
+
+    status  StrategyStatus
+    limiter *rateLimiter
+    timers  map[*hostTimer]struct{}
+    ctx     context.Context
+    cancel  context.CancelFunc
+    done    chan struct{}
+    mutex   sync.Mutex
+}
+
+func newHost(s Strategy, r *Runner) *host {
+    name := s.GetName()
+    return &host{
+        strategy:  s,
+        name:      name,
+        runner:    r,
+        logger:    r.logger.With(zap.String("strategy", name)),
+        inbox:     make(chan event, r.cfg.InboxSize),
+        timerChan: make(chan *hostTimer, 256),
+        portfolio: NewPortfolio(),
+        status:    StrategyStatus{Name: name, State: StateStopped, Since: r.cfg.Clock.Now()},
+        limiter:   newRateLimiter(r.cfg.MaxOrderRate, r.cfg.OrderBurst),
+        timers:    make(map[*hostTimer]struct{}),
+    }
+}
+
+func (h *host) start(ctx context.Context) {
+    h.mutex.Lock()
+    defer h.mutex.Unlock()
+
+    if h.status.State == StateRunning || h.status.State == StatePaused {
+        return
+    }
+
+    // Events queued before the strategy stopped are out of date
+    for len(h.inbox) > 0 {
+        <-h.inbox
+    }
+    for len(h.timerChan) > 0 {
+        <-h.timerChan
+    }
+
+    h.ctx, h.cancel = context.WithCancel(ctx)
+    h.done = make(chan struct{})
+    h.setState(StateRunning, "")
+    h.running.Store(true)
+    go h.run(h.ctx, h.done)
+
+    h.logger.Info("Strategy started")
+}
+
+// stop ends the strategy's goroutine and cancels its orders. Called from
+// the strategy's own goroutine after a panic, it does not wait.
+func (h *host) stop(state State, reason string) {
+    h.mutex.Lock()
+    if h.status.State != StateRunning && h.status.State != StatePaused {
+        h.mutex.Unlock()
+        return
+    }
+    h.running.Store(false)
+    h.setState(state, reason)
+    h.cancel()
+    done := h.done
+    h.mutex.Unlock()
+
+    if state != StateFailed {
+        <-done
+    }
+    h.stopTimers()
+    if failed := h.runner.router.cancelAll(h.name); failed > 0 {
+        h.logger.Error("Failed to queue cancels for stopped strategy", zap.Int("orders", failed))
+    }
+    h.logger.Info("Strategy stopped", zap.String("state", string(state)))
+}
+
+func (h *host) setPaused(paused bool) error {
+    h.mutex.Lock()
+    defer h.mutex.Unlock()
+
+    switch {
+    case paused && h.status.State == StateRunning:
+        h.running.Store(false)
+        h.setState(StatePaused, "")
+    case !paused && h.status.State == StatePaused:
+        h.setState(StateRunning, "")
+        h.running.Store(true)
+    case paused && h.status.State == StatePaused, !paused && h.status.State == StateRunning:
+    default:
+        return fmt.Errorf("strategy %s is %s", h.name, h.status.State)
+    }
+    return nil
+}
+
+// setState must be called with the mutex held
+func (h *host) setState(state State, reason string) {
+    h.status.State = state
+    h.status.Since = h.Now()
+    if reason != "" {
+        h.status.LastError = reason
+    }
+}
+
+func (h *host) snapshot() StrategyStatus {
+    h.mutex.Lock()
+    status := h.status
+    h.mutex.Unlock()
+
+    status.OpenOrders = len(h.portfolio.OpenOrders(""))
+    status.Positions = h.portfolio.Positions()
+    return status
+}
+
+// deliver queues an event without blocking, dropping it if the strategy
+// is not running or has fallen behind
+func (h *host) deliver(ev event) {
+    if !h.running.Load() {
+        return
+    }
+    select {
+    case h.inbox <- ev:
+    default:
+        utils.StrategyEventsDropped.WithLabelValues(h.name).Inc()
+        h.mutex.Lock()
+        h.status.Dropped++
+        h.mutex.Unlock()
+    }
+}
+
+func (h *host) run(ctx context.Context, done chan struct{}) {
+    defer close(done)
+
+    if !h.call(func() { h.strategy.OnStart(h) }) {
+        return
+    }
+    for {
+        select {
+        case <-ctx.Done():
+            // A panicked strategy is not trusted to clean up
+            if h.snapshot().State != StateFailed {
+                h.call(func() { h.strategy.OnStop(h) })
+            }
+            return
+
+        case t := <-h.timerChan:
+            if !h.fire(t) {
+                return
+            }
+
+        case ev := <-h.inbox:
+            if !h.running.Load() {
+                continue
+            }
+            h.mutex.Lock()
+            h.status.Events++
+            h.mutex.Unlock()
+
+            var ok bool
+            switch {
+            case ev.data != nil:
+                ok = h.call(func() { h.strategy.OnMarketData(h, ev.data) })
+            case ev.trade != nil:
+                ok = h.call(func() { h.strategy.OnTrade(h, ev.trade) })
+            case ev.order != nil:
+                ok = h.call(func() { h.strategy.OnOrderUpdate(h, ev.order) })
+            }
+            if !ok {
+                return
+            }
+        }
+    }
+}
+
+// call runs a strategy callback. A panic fails the strategy and returns
+// false.
+func (h *host) call(fn func()) (ok bool) {
+    defer func() {
+        if p := recover(); p != nil {
+            utils.StrategyPanics.WithLabelValues(h.name).Inc()
+            h.logger.Error("Strategy panicked", zap.Any("panic", p), zap.ByteString("stack", debug.Stack()))
+            h.mutex.Lock()
+            h.status.Panics++
+            h.mutex.Unlock()
+            h.stop(StateFailed, fmt.Sprintf("panic: %v", p))
+            ok = false
+        }
+    }()
+    fn()
+    return true
+}
+
+// Place implements Context
+func (h *host) Place(order *engine.Order) (string, error) {
+    if order == nil || order.Symbol == "" || order.Quantity <= 0 || (order.Type == engine.LIMIT && order.Price <= 0) {
+        return "", ErrInvalidOrder
+    }
+    if !h.allow() {
+        return "", ErrThrottled
+    }
+
+    placed := *order
+    if placed.ID == "" {
+        h.orderSeq++
+        placed.ID = fmt.Sprintf("%s-%d-%d", h.name, h.Now().UnixNano(), h.orderSeq)
+    }
+    if placed.ClientID == "" {
+        placed.ClientID = h.name
+    }
+    placed.Filled = 0
+    placed.Status = engine.PENDING
+    placed.Timestamp = h.Now()
+
+    // The engine gets its own copy to fill in
+    h.portfolio.Track(placed)
+    sent := placed
+    if !h.runner.router.submit(h.name, Action{Type: ActionPlace, Order: &sent}) {
+        h.portfolio.Untrack(placed.ID)
+        h.reject("router_busy")
+        return "", ErrRouterBusy
+    }
+
+    h.mutex.Lock()
+    h.status.Orders++
+    h.mutex.Unlock()
+    return placed.ID, nil
+}
+
+// Cancel implements Context. Cancelling an order already being cancelled
+// does nothing.
+func (h *host) Cancel(symbol, orderID string) error {
+    send, err := h.portfolio.markCancelling(orderID)
+    if err != nil || !send {
+        return err
+    }
+    if !h.runner.router.submit(h.name, Action{Type: ActionCancel, Symbol: symbol, OrderID: orderID}) {
+        h.portfolio.unmarkCancelling(orderID)
+        h.reject("router_busy")
+        return ErrRouterBusy
+    }
+    return nil
+}
+
+// Amend implements Context
+func (h *host) Amend(symbol, orderID string, price, quantity float64) error {
+    if !h.portfolio.IsOpen(orderID) {
+        return engine.ErrOrderNotFound
+    }
+    if price <= 0 || quantity <= 0 {
+        return engine.ErrInvalidAmend
+    }
+    if !h.allow() {
+        return ErrThrottled
+    }
+    action := Action{Type: ActionAmend, Symbol: symbol, OrderID: orderID, Price: price, Quantity: quantity}
+    if !h.runner.router.submit(h.name, action) {
+        h.reject("router_busy")
+        return ErrRouterBusy
+    }
+    return nil
+}
+
+// allow takes a token for a new order or amend
+func (h *host) allow() bool {
+    h.mutex.Lock()
+    allowed := h.limiter.allow(h.Now())
+    h.mutex.Unlock()
+    if !allowed {
+        h.reject("throttled")
+    }
+    return allowed
+}
+
+func (h *host) reject(reason string) {
+    utils.StrategyRejected.WithLabelValues(h.name, reason).Inc()
+    h.mutex.Lock()
+    h.status.Rejected++
+    h.mutex.Unlock()
+}
+
+// OpenOrders implements Context
+func (h *host) OpenOrders(symbol string) []engine.Order {
+    return h.portfolio.OpenOrders(symbol)
+}
+
+// Position implements Context
+func (h *host) Position(symbol string) Position {
+    return h.portfolio.Position(symbol)
+}
+
+// TopOfBook implements Context
+func (h *host) TopOfBook(symbol string) *engine.TopOfBook {
+    return h.runner.router.engine.GetTopOfBook(symbol)
+}
+
+// Depth implements Context
+func (h *host) Depth(symbol string, levels int) *engine.OrderBookSnapshot {
+    return h.runner.router.engine.GetDepth(symbol, engine.DepthQuery{Levels: levels})
+}
+
+// Now implements Context
+func (h *host) Now() time.Time {
+    return h.runner.cfg.Clock.Now()
+}
+
+// Logger implements Context
+func (h *host) Logger() *zap.Logger {
+    return h.logger
+}
+
+// hostTimer fires on the runner's clock and runs on the strategy's
+// goroutine
+type hostTimer struct {
+    fn       func(Context)
+    interval time.Duration // 0 for one-shot
+    timer    clock.Timer
+    stopped  atomic.Bool
+}
+
+func (t *hostTimer) Stop() {
+    t.stopped.Store(true)
+    t.timer.Stop()
+}
+
+// After implements Context
+func (h *host) After(d time.Duration, fn func(Context)) Timer {
+    return h.schedule(d, 0, fn)
+}
+
+// Every implements Context
+func (h *host) Every(d time.Duration, fn func(Context)) Timer {
+    return h.schedule(d, d, fn)
+}
+
+func (h *host) schedule(d, interval time.Duration, fn func(Context)) Timer {
+    t := &hostTimer{fn: fn, interval: interval}
+
+    h.mutex.Lock()
+    defer h.mutex.Unlock()
+
+    ctx := h.ctx
+    h.timers[t] = struct{}{}
+    t.timer = h.runner.cfg.Clock.AfterFunc(d, func() {
+        select {
+        case h.timerChan <- t:
+        case <-ctx.Done():
+        }
+    })
+    return t
+}
+
+// fire runs a timer's callback unless it was stopped or the strategy is
+// paused, and returns false if the callback panicked
+func (h *host) fire(t *hostTimer) bool {
+    if t.stopped.Load() {
+        h.forgetTimer(t)
+        return true
+    }
+    ok := true
+    if h.running.Load() {
+        ok = h.call(func() { t.fn(h) })
+    }
+    if t.interval > 0 && !t.stopped.Load() {
+        t.timer.Reset(t.interval)
+    } else {
+        h.forgetTimer(t)
+    }
+    return ok
+}
+
+func (h *host) forgetTimer(t *hostTimer) {
+    h.mutex.Lock()
+    delete(h.timers, t)
+    h.mutex.Unlock()
+}
+
+func (h *host) stopTimers() {
+    h.mutex.Lock()
+    defer h.mutex.Unlock()
+
+    for t := range h.timers {
+        t.Stop()
+    }
+    clear(h.timers)
+}
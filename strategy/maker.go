@@ -1,97 +1,89 @@
 package strategy
 
 import (
-    "fmt"
+    "go.uber.org/zap"
+
     "high-frequency-matching-engine/engine"
-    "time"
 )
 
 type MarketMakerStrategy struct {
     BaseStrategy
-    symbol     string
-    spread     float64
-    quantity   float64
-    lastPrice  float64
-    activeOrders map[string]*engine.Order
+    symbol      string
+    spread      float64
+    quantity    float64
+    quotedPrice float64
 }
 
 func NewMarketMakerStrategy(symbol string, spread, quantity float64) *MarketMakerStrategy {
     return &MarketMakerStrategy{
         BaseStrategy: BaseStrategy{Name: "MarketMaker"},
-        symbol:      symbol,
-        spread:      spread,
-        quantity:    quantity,
-        activeOrders: make(map[string]*engine.Order),
+        symbol:       symbol,
+        spread:       spread,
+        quantity:     quantity,
     }
 }
 
-func (mms *MarketMakerStrategy) OnMarketData(data *engine.MarketData) []*engine.Order {
+func (mms *MarketMakerStrategy) OnMarketData(ctx Context, data *engine.MarketData) {
     if data.Symbol != mms.symbol {
-        return nil
+        return
     }
     
-    mms.lastPrice = data.Price
-    return mms.generateOrders()
-}
-
-func (mms *MarketMakerStrategy) OnTrade(trade *engine.Trade) []*engine.Order {
-    if trade.Symbol != mms.symbol {
-        return nil
+    // Depth events carry no trade price; quote around their mid instead
+    price := data.Price
+    if price <= 0 && data.BidPrice > 0 && data.AskPrice > 0 {
+        price = (data.BidPrice + data.AskPrice) / 2
+    }
+    if price <= 0 {
+        return
     }
     
-    mms.lastPrice = trade.Price
-    return mms.generateOrders()
+    mms.requote(ctx, price)
 }
 
-func (mms *MarketMakerStrategy) OnOrderUpdate(order *engine.Order) []*engine.Order {
-    if order.Status == engine.FILLED || order.Status == engine.CANCELLED {
-        delete(mms.activeOrders, order.ID)
+func (mms *MarketMakerStrategy) OnTrade(ctx Context, trade *engine.Trade) {
+    if trade.Symbol != mms.symbol {
+        return
     }
-    return nil
+    
+    mms.requote(ctx, trade.Price)
 }
 
-func (mms *MarketMakerStrategy) generateOrders() []*engine.Order {
-    if mms.lastPrice <= 0 {
-        return nil
+// requote replaces the bid and ask around price, unless they are already
+// there
+func (mms *MarketMakerStrategy) requote(ctx Context, price float64) {
+    open := ctx.OpenOrders(mms.symbol)
+    if price == mms.quotedPrice && len(open) == 2 {
+        return
     }
     
-    var orders []*engine.Order
-    
-    // Cancel existing orders (simplified)
-    for orderID := range mms.activeOrders {
-        // In a real implementation, you'd send cancel requests to the engine
-        delete(mms.activeOrders, orderID)
+    // Pull the previous quotes so they don't pile up in the book
+    for _, order := range open {
+        if err := ctx.Cancel(order.Symbol, order.ID); err != nil {
+            ctx.Logger().Debug("Failed to cancel quote", zap.String("order_id", order.ID), zap.Error(err))
+        }
     }
     
-    // Generate new bid and ask orders
-    bidPrice := mms.lastPrice * (1 - mms.spread/2)
-    askPrice := mms.lastPrice * (1 + mms.spread/2)
-    
     bidOrder := &engine.Order{
-        ID:       fmt.Sprintf("MM_BID_%d", time.Now().UnixNano()),
         Symbol:   mms.symbol,
         Side:     engine.BUY,
         Type:     engine.LIMIT,
         Quantity: mms.quantity,
-        Price:    bidPrice,
-        Status:   engine.PENDING,
-        ClientID: "MarketMaker",
+        Price:    price * (1 - mms.spread/2),
     }
     
     askOrder := &engine.Order{
-        ID:       fmt.Sprintf("MM_ASK_%d", time.Now().UnixNano()),
         Symbol:   mms.symbol,
         Side:     engine.SELL,
         Type:     engine.LIMIT,
         Quantity: mms.quantity,
-        Price:    askPrice,
-        Status:   engine.PENDING,
-        ClientID: "MarketMaker",
+        Price:    price * (1 + mms.spread/2),
     }
     
-    orders = append(orders, bidOrder, askOrder)
-    mms.activeOrders[bidOrder.ID] = bidOrder
-    mms.activeOrders[askOrder.ID] = askOrder
-    
-    return orders
+    for _, order := range []*engine.Order{bidOrder, askOrder} {
+        if _, err := ctx.Place(order); err != nil {
+            ctx.Logger().Debug("Failed to place quote", zap.Error(err))
+            return
+        }
+    }
+    mms.quotedPrice = price
 }
\ No newline at end of file
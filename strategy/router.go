@@ -0,0 +1,181 @@
+package strategy
+
+import (
+    "context"
+    "errors"
+    "sync"
+
+    "go.uber.org/zap"
+
+    "high-frequency-matching-engine/engine"
+    "high-frequency-matching-engine/utils"
+)
+
+// ActionType is what a strategy asks the router to do
+type ActionType string
+
+const (
+    ActionPlace  ActionType = "place"
+    ActionCancel ActionType = "cancel"
+    ActionAmend  ActionType = "amend"
+)
+
+// Action is a strategy's request to the engine. Place uses Order; cancel
+// and amend name a resting order of the same strategy by Symbol and
+// OrderID, and amend sets its new Price and total Quantity.
+type Action struct {
+    Type     ActionType
+    Order    *engine.Order
+    Symbol   string
+    OrderID  string
+    Price    float64
+    Quantity float64
+}
+
+var errNotOwned = errors.New("order not owned by strategy")
+
+type routedAction struct {
+    strategy string
+    action   Action
+}
+
+type ownedOrder struct {
+    strategy string
+    symbol   string
+}
+
+// OrderRouter carries out strategies' actions against the engine on its
+// own goroutine, so strategies never run inside the engine's event loop,
+// and remembers which strategy owns each order it placed.
+type OrderRouter struct {
+    engine  *engine.MatchingEngine
+    latency *utils.LatencyTracker
+    logger  *zap.Logger
+    queue   chan routedAction
+
+    owners map[string]ownedOrder // by order ID
+    mutex  sync.RWMutex
+}
+
+func NewOrderRouter(me *engine.MatchingEngine, latency *utils.LatencyTracker, queueSize int, logger *zap.Logger) *OrderRouter {
+    if queueSize <= 0 {
+        queueSize = 10000
+    }
+    return &OrderRouter{
+        engine:  me,
+        latency: latency,
+        logger:  logger,
+        queue:   make(chan routedAction, queueSize),
+        owners:  make(map[string]ownedOrder),
+    }
+}
+
+// submit queues an action and reports false if the router is backed up.
+// A new order belongs to the strategy from here, so cancelling everything
+// a strategy owns also catches orders still queued.
+func (r *OrderRouter) submit(strategy string, action Action) bool {
+    if action.Type == ActionPlace {
+        r.mutex.Lock()
+        r.owners[action.Order.ID] = ownedOrder{strategy: strategy, symbol: action.Order.Symbol}
+        r.mutex.Unlock()
+    }
+    select {
+    case r.queue <- routedAction{strategy: strategy, action: action}:
+        return true
+    default:
+        if action.Type == ActionPlace {
+            r.forget(action.Order.ID)
+        }
+        return false
+    }
+}
+
+// Run carries out queued actions until ctx is cancelled
+func (r *OrderRouter) Run(ctx context.Context) {
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case routed := <-r.queue:
+            if err := r.execute(routed.strategy, routed.action); err != nil {
+                utils.StrategyRejected.WithLabelValues(routed.strategy, string(routed.action.Type)+"_failed").Inc()
+                r.logger.Debug("Strategy action failed",
+                    zap.String("strategy", routed.strategy),
+                    zap.String("action", string(routed.action.Type)),
+                    zap.String("order_id", routed.action.OrderID),
+                    zap.Error(err))
+            }
+        }
+    }
+}
+
+func (r *OrderRouter) execute(strategy string, action Action) error {
+    utils.StrategyActions.WithLabelValues(strategy, string(action.Type)).Inc()
+
+    switch action.Type {
+    case ActionPlace:
+        order := action.Order
+        start := r.latency.Now()
+        r.engine.ProcessOrder(order)
+        r.latency.TrackOrderLatency(order.Symbol, start)
+        return nil
+
+    case ActionCancel:
+        if !r.owns(strategy, action.OrderID) {
+            return errNotOwned
+        }
+        if !r.engine.CancelOrder(action.Symbol, action.OrderID) {
+            return engine.ErrOrderNotFound
+        }
+        return nil
+
+    case ActionAmend:
+        if !r.owns(strategy, action.OrderID) {
+            return errNotOwned
+        }
+        _, _, err := r.engine.AmendOrder(action.Symbol, action.OrderID, action.Price, action.Quantity)
+        return err
+    }
+    return errors.New("unknown action")
+}
+
+func (r *OrderRouter) owns(strategy, orderID string) bool {
+    owner, ok := r.Owner(orderID)
+    return ok && owner == strategy
+}
+
+// Owner returns the strategy that placed an order still live
+func (r *OrderRouter) Owner(orderID string) (string, bool) {
+    r.mutex.RLock()
+    defer r.mutex.RUnlock()
+    owner, ok := r.owners[orderID]
+    return owner.strategy, ok
+}
+
+// cancelAll queues cancels for every order a strategy has on the book and
+// returns how many could not be queued
+func (r *OrderRouter) cancelAll(strategy string) int {
+    var cancels []Action
+    r.mutex.RLock()
+    for orderID, owner := range r.owners {
+        if owner.strategy == strategy {
+            cancels = append(cancels, Action{Type: ActionCancel, Symbol: owner.symbol, OrderID: orderID})
+        }
+    }
+    r.mutex.RUnlock()
+
+    failed := 0
+    for _, cancel := range cancels {
+        if !r.submit(strategy, cancel) {
+            failed++
+        }
+    }
+    return failed
+}
+
+// forget drops an order that has left the book
+func (r *OrderRouter) forget(orderID string) {
+    r.mutex.Lock()
+    delete(r.owners, orderID)
+    r.mutex.Unlock()
+}
@@ -0,0 +1,275 @@
+package strategy
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "sync"
+    "time"
+
+    "go.uber.org/zap"
+
+    "high-frequency-matching-engine/clock"
+    "high-frequency-matching-engine/engine"
+)
+
+// State is where a strategy is in its lifecycle
+type State string
+
+const (
+    StateRunning State = "running"
+    StatePaused  State = "paused"  // events are dropped, orders stay on the book
+    StateStopped State = "stopped" // orders are cancelled
+    StateFailed  State = "failed"  // stopped after a panic
+)
+
+var (
+    ErrUnknownStrategy   = errors.New("unknown strategy")
+    ErrDuplicateStrategy = errors.New("strategy already added")
+)
+
+// RunnerConfig bounds each strategy. InboxSize events may wait for a
+// strategy before more are dropped; MaxOrderRate limits its new orders
+// and amends per second, with bursts of up to OrderBurst. Cancels are
+// never limited, so a throttled strategy can still pull its quotes.
+// Strategies tell the time and run timers on Clock, the engine's clock
+// when unset.
+type RunnerConfig struct {
+    InboxSize    int
+    MaxOrderRate float64
+    OrderBurst   int
+    Clock        clock.Clock
+}
+
+// StrategyStatus is a strategy's state and counters
+type StrategyStatus struct {
+    Name      string    `json:"name"`
+    State     State     `json:"state"`
+    Since     time.Time `json:"since"`
+    Events    int64     `json:"events"`
+    Dropped   int64     `json:"dropped"`
+    Orders    int64     `json:"orders"`
+    Rejected  int64     `json:"rejected"`
+    Panics    int64     `json:"panics"`
+    LastError string    `json:"last_error,omitempty"`
+
+    OpenOrders int        `json:"open_orders"`
+    Positions  []Position `json:"positions"`
+}
+
+// Runner runs each strategy on its own goroutine, fed from a bounded inbox,
+// so a slow or failing strategy never holds up the engine or the others.
+// Their orders go through the OrderRouter.
+type Runner struct {
+    router *OrderRouter
+    cfg    RunnerConfig
+    logger *zap.Logger
+
+    hosts map[string]*host
+    names []string
+    ctx   context.Context
+    mutex sync.RWMutex
+}
+
+func NewRunner(router *OrderRouter, cfg RunnerConfig, logger *zap.Logger) *Runner {
+    if cfg.InboxSize <= 0 {
+        cfg.InboxSize = 1000
+    }
+    if cfg.MaxOrderRate <= 0 {
+        cfg.MaxOrderRate = 100
+    }
+    if cfg.OrderBurst <= 0 {
+        cfg.OrderBurst = int(max(cfg.MaxOrderRate, 1))
+    }
+    if cfg.Clock == nil {
+        cfg.Clock = router.engine.Clock()
+    }
+    r := &Runner{
+        router: router,
+        cfg:    cfg,
+        logger: logger,
+        hosts:  make(map[string]*host),
+    }
+    router.engine.OnExecution(r.onReports)
+    return r
+}
+
+// Add registers a strategy by name. It starts with Start, or straight
+// away if the runner is already started.
+func (r *Runner) Add(s Strategy) error {
+    r.mutex.Lock()
+    defer r.mutex.Unlock()
+
+    name := s.GetName()
+    if _, exists := r.hosts[name]; exists {
+        return fmt.Errorf("%w: %s", ErrDuplicateStrategy, name)
+    }
+    h := newHost(s, r)
+    r.hosts[name] = h
+    r.names = append(r.names, name)
+    if r.ctx != nil {
+        h.start(r.ctx)
+    }
+    return nil
+}
+
+// Start runs every strategy until ctx is cancelled
+func (r *Runner) Start(ctx context.Context) {
+    r.mutex.Lock()
+    defer r.mutex.Unlock()
+
+    r.ctx = ctx
+    for _, name := range r.names {
+        r.hosts[name].start(ctx)
+    }
+}
+
+// StartStrategy starts a stopped or failed strategy again
+func (r *Runner) StartStrategy(name string) error {
+    r.mutex.RLock()
+    defer r.mutex.RUnlock()
+
+    h, ok := r.hosts[name]
+    if !ok {
+        return ErrUnknownStrategy
+    }
+    if r.ctx == nil {
+        return errors.New("runner not started")
+    }
+    h.start(r.ctx)
+    return nil
+}
+
+// Stop stops a strategy and cancels its orders
+func (r *Runner) Stop(name string) error {
+    h, err := r.host(name)
+    if err != nil {
+        return err
+    }
+    h.stop(StateStopped, "")
+    return nil
+}
+
+// Pause stops delivering events to a strategy, leaving its orders alone
+func (r *Runner) Pause(name string) error {
+    h, err := r.host(name)
+    if err != nil {
+        return err
+    }
+    return h.setPaused(true)
+}
+
+// Resume delivers events to a paused strategy again
+func (r *Runner) Resume(name string) error {
+    h, err := r.host(name)
+    if err != nil {
+        return err
+    }
+    return h.setPaused(false)
+}
+
+func (r *Runner) host(name string) (*host, error) {
+    r.mutex.RLock()
+    defer r.mutex.RUnlock()
+
+    h, ok := r.hosts[name]
+    if !ok {
+        return nil, ErrUnknownStrategy
+    }
+    return h, nil
+}
+
+// Status returns every strategy's status in the order they were added
+func (r *Runner) Status() []StrategyStatus {
+    r.mutex.RLock()
+    defer r.mutex.RUnlock()
+
+    statuses := make([]StrategyStatus, 0, len(r.names))
+    for _, name := range r.names {
+        statuses = append(statuses, r.hosts[name].snapshot())
+    }
+    return statuses
+}
+
+// Close stops every strategy and waits for their goroutines to exit
+func (r *Runner) Close() {
+    r.mutex.RLock()
+    defer r.mutex.RUnlock()
+
+    for _, name := range r.names {
+        r.hosts[name].stop(StateStopped, "")
+    }
+}
+
+// OnMarketData passes market data to every running strategy. Strategies
+// share the event and must not modify it.
+func (r *Runner) OnMarketData(data *engine.MarketData) {
+    r.broadcast(event{data: data})
+}
+
+// OnTrade passes an engine trade to every running strategy
+func (r *Runner) OnTrade(trade *engine.Trade) {
+    r.broadcast(event{trade: trade})
+}
+
+// onReports runs under the order book lock with the reports of one book
+// operation, so every fill reaches the portfolios once and in order
+func (r *Runner) onReports(reports []*engine.ExecutionReport) {
+    for _, report := range reports {
+        r.onExecution(report)
+    }
+}
+
+// onExecution updates the open orders and position of the strategy that
+// placed the order, if any, and passes it the order update. The update
+// may be dropped like any event, but the strategy's Context stays right.
+func (r *Runner) onExecution(report *engine.ExecutionReport) {
+    owner, ok := r.router.Owner(report.Order.ID)
+    if !ok {
+        return
+    }
+    if report.Order.Status == engine.FILLED || report.Order.Status == engine.CANCELLED {
+        r.router.forget(report.Order.ID)
+    }
+
+    h, err := r.host(owner)
+    if err != nil {
+        return
+    }
+    h.portfolio.Apply(report)
+    order := report.Order
+    h.deliver(event{order: &order})
+}
+
+func (r *Runner) broadcast(ev event) {
+    r.mutex.RLock()
+    defer r.mutex.RUnlock()
+
+    for _, name := range r.names {
+        r.hosts[name].deliver(ev)
+    }
+}
+
+// rateLimiter is a token bucket refilled at rate per second up to burst
+type rateLimiter struct {
+    rate   float64
+    burst  float64
+    tokens float64
+    last   time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+    return &rateLimiter{rate: rate, burst: float64(burst), tokens: float64(burst)}
+}
+
+func (l *rateLimiter) allow(now time.Time) bool {
+    if !l.last.IsZero() {
+        l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+    }
+    l.last = now
+    if l.tokens < 1 {
+        return false
+    }
+    l.tokens--
+    return true
+}
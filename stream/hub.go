@@ -0,0 +1,317 @@
+package stream
+
+import (
+    "encoding/json"
+    "net/http"
+    "sync"
+    "time"
+
+    "github.com/gorilla/websocket"
+    "go.uber.org/zap"
+
+    "high-frequency-matching-engine/engine"
+)
+
+const (
+    writeWait      = 10 * time.Second
+    pongWait       = 60 * time.Second
+    pingPeriod     = pongWait * 9 / 10
+    maxMessageSize = 64 * 1024
+    sendBufferSize = 4096
+)
+
+const (
+    ChannelTrades = "trades"
+    ChannelL1     = "l1"
+    ChannelL2     = "l2"
+    ChannelTicker = "ticker"
+    ChannelL3     = "l3"
+)
+
+// Request is a client message sent over the socket. Market data requests
+// use Op, Channel and Symbol; order entry requests also carry ReqID, which
+// is echoed back on the matching response.
+type Request struct {
+    Op            string           `json:"op"`
+    Channel       string           `json:"channel"`
+    Symbol        string           `json:"symbol"`
+    ReqID         string           `json:"req_id,omitempty"`
+    APIKey        string           `json:"api_key,omitempty"`
+    OrderID       string           `json:"order_id,omitempty"`
+    ClientOrderID string           `json:"client_order_id,omitempty"`
+    Side          engine.OrderSide `json:"side"`
+    Type          engine.OrderType `json:"type"`
+    Price         float64          `json:"price"`
+    Quantity      float64          `json:"quantity"`
+}
+
+type subscription struct {
+    channel string
+    symbol  string
+}
+
+type client struct {
+    conn     *websocket.Conn
+    send     chan []byte
+    subs     map[subscription]bool
+    clientID string // set once the session has logged in
+    closed   bool
+    mutex    sync.Mutex
+}
+
+// enqueue queues a message without blocking the publisher. A client that
+// cannot keep up is disconnected rather than slowing everyone down.
+func (c *client) enqueue(data []byte) bool {
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+
+    if c.closed {
+        return false
+    }
+    select {
+    case c.send <- data:
+        return true
+    default:
+        c.closed = true
+        close(c.send)
+        return false
+    }
+}
+
+func (c *client) close() {
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+
+    if !c.closed {
+        c.closed = true
+        close(c.send)
+    }
+}
+
+// Hub accepts WebSocket connections and fans published messages out to
+// clients by channel and symbol
+type Hub struct {
+    upgrader websocket.Upgrader
+    clients  map[*client]bool
+    logger   *zap.Logger
+    mutex    sync.RWMutex
+
+    onSubscribe map[string]SubscribeHandler // channel -> handler
+    orderEntry  *OrderEntry
+}
+
+// SubscribeHandler lets a publisher send an initial image to a new
+// subscriber. It must call activate once the image is queued, while still
+// holding whatever lock keeps the image consistent with later updates.
+type SubscribeHandler func(channel, symbol string, send func(msg interface{}), activate func())
+
+func NewHub(logger *zap.Logger) *Hub {
+    return &Hub{
+        upgrader: websocket.Upgrader{
+            ReadBufferSize:  4096,
+            WriteBufferSize: 4096,
+            CheckOrigin:     func(r *http.Request) bool { return true },
+        },
+        clients:     make(map[*client]bool),
+        logger:      logger,
+        onSubscribe: make(map[string]SubscribeHandler),
+    }
+}
+
+func (h *Hub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    conn, err := h.upgrader.Upgrade(w, r, nil)
+    if err != nil {
+        h.logger.Warn("WebSocket upgrade failed", zap.Error(err))
+        return
+    }
+
+    c := &client{
+        conn: conn,
+        send: make(chan []byte, sendBufferSize),
+        subs: make(map[subscription]bool),
+    }
+
+    h.mutex.Lock()
+    h.clients[c] = true
+    h.mutex.Unlock()
+
+    go h.writePump(c)
+    h.readPump(c)
+}
+
+func (h *Hub) readPump(c *client) {
+    defer func() {
+        h.mutex.Lock()
+        delete(h.clients, c)
+        h.mutex.Unlock()
+        c.close()
+        c.conn.Close()
+    }()
+
+    c.conn.SetReadLimit(maxMessageSize)
+    c.conn.SetReadDeadline(time.Now().Add(pongWait))
+    c.conn.SetPongHandler(func(string) error {
+        return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+    })
+
+    for {
+        var req Request
+        if err := c.conn.ReadJSON(&req); err != nil {
+            return
+        }
+        h.handleRequest(c, &req)
+    }
+}
+
+func (h *Hub) writePump(c *client) {
+    ticker := time.NewTicker(pingPeriod)
+    defer func() {
+        ticker.Stop()
+        c.conn.Close()
+    }()
+
+    for {
+        select {
+        case data, ok := <-c.send:
+            c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+            if !ok {
+                c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+                return
+            }
+            if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+                return
+            }
+        case <-ticker.C:
+            c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+            if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+                return
+            }
+        }
+    }
+}
+
+func (h *Hub) handleRequest(c *client, req *Request) {
+    switch req.Op {
+    case "login", "place", "amend", "cancel":
+        if h.orderEntry == nil {
+            h.reply(c, map[string]string{"type": "error", "message": "order entry disabled", "req_id": req.ReqID})
+            return
+        }
+        h.orderEntry.handle(c, req)
+        return
+    }
+
+    switch req.Channel {
+    case ChannelTrades, ChannelL1, ChannelL2, ChannelTicker, ChannelL3:
+    default:
+        h.reply(c, map[string]string{"type": "error", "message": "unknown channel", "channel": req.Channel})
+        return
+    }
+    if req.Symbol == "" {
+        h.reply(c, map[string]string{"type": "error", "message": "symbol required", "channel": req.Channel})
+        return
+    }
+
+    sub := subscription{channel: req.Channel, symbol: req.Symbol}
+    switch req.Op {
+    case "subscribe":
+        h.reply(c, map[string]string{"type": "subscribed", "channel": req.Channel, "symbol": req.Symbol})
+        activate := func() {
+            h.mutex.Lock()
+            c.subs[sub] = true
+            h.mutex.Unlock()
+        }
+        if handler, exists := h.onSubscribe[req.Channel]; exists {
+            handler(req.Channel, req.Symbol, func(msg interface{}) { h.reply(c, msg) }, activate)
+        } else {
+            activate()
+        }
+    case "unsubscribe":
+        h.mutex.Lock()
+        delete(c.subs, sub)
+        h.mutex.Unlock()
+        h.reply(c, map[string]string{"type": "unsubscribed", "channel": req.Channel, "symbol": req.Symbol})
+    default:
+        h.reply(c, map[string]string{"type": "error", "message": "unknown op", "op": req.Op})
+    }
+}
+
+// SetSubscribeHandler installs the handler for new subscriptions to the
+// given channels. It must be called before clients connect.
+func (h *Hub) SetSubscribeHandler(handler SubscribeHandler, channels ...string) {
+    for _, channel := range channels {
+        h.onSubscribe[channel] = handler
+    }
+}
+
+func (h *Hub) reply(c *client, msg interface{}) {
+    data, err := json.Marshal(msg)
+    if err != nil {
+        h.logger.Error("Failed to encode WebSocket message", zap.Error(err))
+        return
+    }
+    c.enqueue(data)
+}
+
+// Publish sends msg to every client subscribed to channel and symbol
+func (h *Hub) Publish(channel, symbol string, msg interface{}) {
+    data, err := json.Marshal(msg)
+    if err != nil {
+        h.logger.Error("Failed to encode WebSocket message", zap.Error(err))
+        return
+    }
+
+    sub := subscription{channel: channel, symbol: symbol}
+
+    h.mutex.RLock()
+    defer h.mutex.RUnlock()
+
+    for c := range h.clients {
+        if c.subs[sub] {
+            c.enqueue(data)
+        }
+    }
+}
+
+// PublishPrivate sends msg to every session logged in as clientID
+func (h *Hub) PublishPrivate(clientID string, msg interface{}) {
+    data, err := json.Marshal(msg)
+    if err != nil {
+        h.logger.Error("Failed to encode WebSocket message", zap.Error(err))
+        return
+    }
+
+    h.mutex.RLock()
+    defer h.mutex.RUnlock()
+
+    for c := range h.clients {
+        if c.clientID == clientID {
+            c.enqueue(data)
+        }
+    }
+}
+
+// HasSubscribers reports whether anyone listens on channel and symbol
+func (h *Hub) HasSubscribers(channel, symbol string) bool {
+    sub := subscription{channel: channel, symbol: symbol}
+
+    h.mutex.RLock()
+    defer h.mutex.RUnlock()
+
+    for c := range h.clients {
+        if c.subs[sub] {
+            return true
+        }
+    }
+    return false
+}
+
+// Close disconnects every client
+func (h *Hub) Close() {
+    h.mutex.Lock()
+    defer h.mutex.Unlock()
+
+    for c := range h.clients {
+        c.close()
+    }
+}
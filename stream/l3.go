@@ -0,0 +1,234 @@
+package stream
+
+import (
+    "sort"
+    "sync"
+    "time"
+
+    "high-frequency-matching-engine/engine"
+)
+
+// L3Event changes one resting order: "add" appends it to the back of its
+// price level, "update" changes its remaining quantity in place and
+// "delete" removes it
+type L3Event struct {
+    Action   string           `json:"action"`
+    OrderID  string           `json:"order_id"`
+    Side     engine.OrderSide `json:"side"`
+    Price    float64          `json:"price"`
+    Quantity float64          `json:"quantity"`
+}
+
+// L3Message is either a full image of every resting order ("snapshot") or
+// the events of one book operation ("update"). Seq is the engine's report
+// sequence for the book; apply an update only if PrevSeq equals the last
+// Seq applied.
+type L3Message struct {
+    Channel   string           `json:"channel"`
+    Type      string           `json:"type"`
+    Symbol    string           `json:"symbol"`
+    Seq       uint64           `json:"seq"`
+    PrevSeq   uint64           `json:"prev_seq,omitempty"`
+    Bids      []engine.L3Order `json:"bids,omitempty"`
+    Asks      []engine.L3Order `json:"asks,omitempty"`
+    Events    []L3Event        `json:"events,omitempty"`
+    Timestamp time.Time        `json:"timestamp"`
+}
+
+type l3Order struct {
+    side      engine.OrderSide
+    price     float64
+    quantity  float64
+    arrival   uint64 // time priority within the price
+    timestamp time.Time
+}
+
+type l3State struct {
+    seq      uint64
+    orders   map[string]*l3Order // resting orders as published
+    arrivals uint64
+}
+
+// L3Publisher streams market-by-order updates on the l3 channel. It is
+// driven synchronously by the engine's execution reports, so every book
+// operation becomes exactly one update in sequence. Snapshots come from
+// the published orders rather than the engine, so a snapshot and the
+// updates after it always share one sequence.
+type L3Publisher struct {
+    hub   *Hub
+    books map[string]*l3State
+    mutex sync.Mutex
+}
+
+// NewL3Publisher must be created before orders reach the engine, as it
+// builds its image of each book from the execution reports
+func NewL3Publisher(hub *Hub, matchingEngine *engine.MatchingEngine) *L3Publisher {
+    l3 := &L3Publisher{
+        hub:   hub,
+        books: make(map[string]*l3State),
+    }
+    matchingEngine.OnExecution(l3.onReports)
+    hub.SetSubscribeHandler(l3.onSubscribe, ChannelL3)
+    return l3
+}
+
+func (l3 *L3Publisher) book(symbol string) *l3State {
+    state, exists := l3.books[symbol]
+    if !exists {
+        state = &l3State{orders: make(map[string]*l3Order)}
+        l3.books[symbol] = state
+    }
+    return state
+}
+
+// onReports runs under the order book lock with the reports of one book
+// operation
+func (l3 *L3Publisher) onReports(reports []*engine.ExecutionReport) {
+    symbol := reports[0].Order.Symbol
+    last := reports[len(reports)-1]
+
+    l3.mutex.Lock()
+    defer l3.mutex.Unlock()
+
+    state := l3.book(symbol)
+    msg := &L3Message{
+        Channel:   ChannelL3,
+        Type:      "update",
+        Symbol:    symbol,
+        Seq:       last.Seq,
+        PrevSeq:   state.seq,
+        Events:    state.apply(reports),
+        Timestamp: last.Timestamp,
+    }
+    state.seq = last.Seq
+
+    if l3.hub.HasSubscribers(ChannelL3, symbol) {
+        l3.hub.Publish(ChannelL3, symbol, msg)
+    }
+}
+
+// apply updates the published orders and returns the resulting events. An
+// incoming order only appears once it rests, after the fills it caused.
+func (state *l3State) apply(reports []*engine.ExecutionReport) []L3Event {
+    events := []L3Event{}
+    var incoming *engine.Order
+
+    for _, report := range reports {
+        order := &report.Order
+        published, resting := state.orders[order.ID]
+
+        switch report.Type {
+        case engine.EXEC_NEW:
+            incoming = order
+        case engine.EXEC_REPLACED:
+            if !resting {
+                continue
+            }
+            // Only a same-price reduction keeps the order's place
+            if order.Price == published.price && order.Quantity-order.Filled <= published.quantity {
+                published.quantity = order.Quantity - order.Filled
+                events = append(events, L3Event{Action: "update", OrderID: order.ID, Side: order.Side, Price: order.Price, Quantity: published.quantity})
+                continue
+            }
+            delete(state.orders, order.ID)
+            events = append(events, L3Event{Action: "delete", OrderID: order.ID, Side: order.Side, Price: published.price})
+            incoming = order
+        case engine.EXEC_TRADE, engine.EXEC_CANCELLED:
+            if incoming != nil && order.ID == incoming.ID {
+                incoming = order
+                continue
+            }
+            if !resting {
+                continue
+            }
+            if order.Status == engine.FILLED || order.Status == engine.CANCELLED {
+                delete(state.orders, order.ID)
+                events = append(events, L3Event{Action: "delete", OrderID: order.ID, Side: order.Side, Price: published.price})
+                continue
+            }
+            published.quantity = order.Quantity - order.Filled
+            events = append(events, L3Event{Action: "update", OrderID: order.ID, Side: order.Side, Price: order.Price, Quantity: published.quantity})
+        }
+    }
+
+    if incoming != nil && incoming.Type == engine.LIMIT &&
+        incoming.Status != engine.FILLED && incoming.Status != engine.CANCELLED {
+        remaining := incoming.Quantity - incoming.Filled
+        state.arrivals++
+        state.orders[incoming.ID] = &l3Order{
+            side:      incoming.Side,
+            price:     incoming.Price,
+            quantity:  remaining,
+            arrival:   state.arrivals,
+            timestamp: incoming.Timestamp,
+        }
+        events = append(events, L3Event{Action: "add", OrderID: incoming.ID, Side: incoming.Side, Price: incoming.Price, Quantity: remaining})
+    }
+    return events
+}
+
+// onSubscribe sends a snapshot of the published orders and activates the
+// subscription under the same lock as onReports, so the next update the
+// subscriber gets follows on from the snapshot
+func (l3 *L3Publisher) onSubscribe(channel, symbol string, send func(interface{}), activate func()) {
+    l3.mutex.Lock()
+    defer l3.mutex.Unlock()
+
+    state := l3.book(symbol)
+    bids, asks := state.snapshot()
+    send(&L3Message{
+        Channel:   ChannelL3,
+        Type:      "snapshot",
+        Symbol:    symbol,
+        Seq:       state.seq,
+        Bids:      bids,
+        Asks:      asks,
+        Timestamp: time.Now(),
+    })
+    activate()
+}
+
+// snapshot lists the published orders in priority order: best price first,
+// then earliest first within a price, numbered within each price
+func (state *l3State) snapshot() (bids, asks []engine.L3Order) {
+    for id, order := range state.orders {
+        l3 := engine.L3Order{
+            ID:        id,
+            Side:      order.side,
+            Price:     order.price,
+            Quantity:  order.quantity,
+            Timestamp: order.timestamp,
+        }
+        if order.side == engine.BUY {
+            bids = append(bids, l3)
+        } else {
+            asks = append(asks, l3)
+        }
+    }
+
+    arrival := func(o engine.L3Order) uint64 { return state.orders[o.ID].arrival }
+    sort.Slice(bids, func(i, j int) bool {
+        if bids[i].Price != bids[j].Price {
+            return bids[i].Price > bids[j].Price
+        }
+        return arrival(bids[i]) < arrival(bids[j])
+    })
+    sort.Slice(asks, func(i, j int) bool {
+        if asks[i].Price != asks[j].Price {
+            return asks[i].Price < asks[j].Price
+        }
+        return arrival(asks[i]) < arrival(asks[j])
+    })
+    numberLevels(bids)
+    numberLevels(asks)
+    return bids, asks
+}
+
+// numberLevels sets each order's queue position within its price
+func numberLevels(orders []engine.L3Order) {
+    for i := 1; i < len(orders); i++ {
+        if orders[i].Price == orders[i-1].Price {
+            orders[i].Position = orders[i-1].Position + 1
+        }
+    }
+}
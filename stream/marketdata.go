@@ -0,0 +1,269 @@
+package stream
+
+import (
+    "sort"
+    "sync"
+    "time"
+
+    "high-frequency-matching-engine/analytics"
+    "high-frequency-matching-engine/engine"
+)
+
+// Level is a [price, quantity] pair; a zero quantity in an update means
+// the level was removed
+type Level [2]float64
+
+type TradeMessage struct {
+    Channel string        `json:"channel"`
+    Symbol  string        `json:"symbol"`
+    Data    *engine.Trade `json:"data"`
+}
+
+type L1Message struct {
+    Channel string            `json:"channel"`
+    Symbol  string            `json:"symbol"`
+    Data    *engine.TopOfBook `json:"data"`
+}
+
+type TickerMessage struct {
+    Channel string            `json:"channel"`
+    Symbol  string            `json:"symbol"`
+    Data    *analytics.Ticker `json:"data"`
+}
+
+// L2Message carries either a full book image ("snapshot") or the levels
+// that changed since the previous message ("update"). Clients apply an
+// update only if PrevSeq equals the last Seq they saw, otherwise they
+// have missed a message and must wait for the next snapshot.
+type L2Message struct {
+    Channel   string    `json:"channel"`
+    Type      string    `json:"type"`
+    Symbol    string    `json:"symbol"`
+    Seq       uint64    `json:"seq"`
+    PrevSeq   uint64    `json:"prev_seq,omitempty"`
+    Bids      []Level   `json:"bids"`
+    Asks      []Level   `json:"asks"`
+    Timestamp time.Time `json:"timestamp"`
+}
+
+type bookState struct {
+    seq  uint64
+    bids map[float64]float64
+    asks map[float64]float64
+    top  engine.TopOfBook
+}
+
+// MarketDataPublisher turns engine events into the public trades, l1, l2
+// and ticker channels of a Hub. Book changes are coalesced: when events
+// arrive faster than they can be diffed, one update covers all of them.
+type MarketDataPublisher struct {
+    hub              *Hub
+    engine           *engine.MatchingEngine
+    books            map[string]*bookState
+    dirty            map[string]bool
+    notify           chan struct{}
+    snapshotInterval time.Duration
+    mutex            sync.Mutex
+}
+
+func NewMarketDataPublisher(hub *Hub, matchingEngine *engine.MatchingEngine, snapshotInterval time.Duration) *MarketDataPublisher {
+    if snapshotInterval <= 0 {
+        snapshotInterval = 5 * time.Second
+    }
+
+    mdp := &MarketDataPublisher{
+        hub:              hub,
+        engine:           matchingEngine,
+        books:            make(map[string]*bookState),
+        dirty:            make(map[string]bool),
+        notify:           make(chan struct{}, 1),
+        snapshotInterval: snapshotInterval,
+    }
+    hub.SetSubscribeHandler(mdp.onSubscribe, ChannelL1, ChannelL2)
+    return mdp
+}
+
+func (mdp *MarketDataPublisher) OnTrade(trade *engine.Trade) {
+    mdp.hub.Publish(ChannelTrades, trade.Symbol, &TradeMessage{Channel: ChannelTrades, Symbol: trade.Symbol, Data: trade})
+}
+
+func (mdp *MarketDataPublisher) OnTicker(ticker *analytics.Ticker) {
+    mdp.hub.Publish(ChannelTicker, ticker.Symbol, &TickerMessage{Channel: ChannelTicker, Symbol: ticker.Symbol, Data: ticker})
+}
+
+// OnBookChange marks a symbol's book as changed; the diff is published
+// asynchronously by Run
+func (mdp *MarketDataPublisher) OnBookChange(symbol string) {
+    mdp.mutex.Lock()
+    mdp.dirty[symbol] = true
+    mdp.mutex.Unlock()
+
+    select {
+    case mdp.notify <- struct{}{}:
+    default:
+    }
+}
+
+func (mdp *MarketDataPublisher) Run(done <-chan struct{}) {
+    ticker := time.NewTicker(mdp.snapshotInterval)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-done:
+            return
+        case <-mdp.notify:
+            mdp.flush()
+        case <-ticker.C:
+            mdp.publishSnapshots()
+        }
+    }
+}
+
+func (mdp *MarketDataPublisher) flush() {
+    mdp.mutex.Lock()
+    defer mdp.mutex.Unlock()
+
+    for symbol := range mdp.dirty {
+        delete(mdp.dirty, symbol)
+        mdp.publishDiff(symbol)
+    }
+}
+
+// publishDiff compares the engine book with the last published state and
+// emits l2 and l1 updates for what changed. Callers must hold the mutex.
+func (mdp *MarketDataPublisher) publishDiff(symbol string) {
+    snapshot := mdp.engine.GetOrderBookSnapshot(symbol)
+    if snapshot == nil {
+        return
+    }
+
+    state := mdp.book(symbol)
+    bids := diffLevels(state.bids, snapshot.Bids)
+    asks := diffLevels(state.asks, snapshot.Asks)
+
+    if len(bids) > 0 || len(asks) > 0 {
+        state.seq++
+        mdp.hub.Publish(ChannelL2, symbol, &L2Message{
+            Channel:   ChannelL2,
+            Type:      "update",
+            Symbol:    symbol,
+            Seq:       state.seq,
+            PrevSeq:   state.seq - 1,
+            Bids:      bids,
+            Asks:      asks,
+            Timestamp: snapshot.Timestamp,
+        })
+    }
+
+    top := topOfBook(snapshot)
+    if top.BidPrice != state.top.BidPrice || top.BidQty != state.top.BidQty ||
+        top.AskPrice != state.top.AskPrice || top.AskQty != state.top.AskQty {
+        state.top = top
+        mdp.hub.Publish(ChannelL1, symbol, &L1Message{Channel: ChannelL1, Symbol: symbol, Data: &top})
+    }
+}
+
+// publishSnapshots sends a full image of every book to its l2 subscribers
+// so clients that detected a gap can resynchronize
+func (mdp *MarketDataPublisher) publishSnapshots() {
+    mdp.mutex.Lock()
+    defer mdp.mutex.Unlock()
+
+    for symbol, state := range mdp.books {
+        if mdp.dirty[symbol] {
+            delete(mdp.dirty, symbol)
+            mdp.publishDiff(symbol)
+        }
+        if mdp.hub.HasSubscribers(ChannelL2, symbol) {
+            mdp.hub.Publish(ChannelL2, symbol, state.snapshotMessage(symbol))
+        }
+    }
+}
+
+func (mdp *MarketDataPublisher) book(symbol string) *bookState {
+    state, exists := mdp.books[symbol]
+    if !exists {
+        state = &bookState{
+            bids: make(map[float64]float64),
+            asks: make(map[float64]float64),
+            top:  engine.TopOfBook{Symbol: symbol},
+        }
+        mdp.books[symbol] = state
+    }
+    return state
+}
+
+func (mdp *MarketDataPublisher) onSubscribe(channel, symbol string, send func(interface{}), activate func()) {
+    mdp.mutex.Lock()
+    defer mdp.mutex.Unlock()
+
+    switch channel {
+    case ChannelL2:
+        // Bring the published state up to date first so the snapshot's
+        // sequence number lines up with the next update
+        mdp.publishDiff(symbol)
+        send(mdp.book(symbol).snapshotMessage(symbol))
+    case ChannelL1:
+        mdp.publishDiff(symbol)
+        top := mdp.book(symbol).top
+        send(&L1Message{Channel: ChannelL1, Symbol: symbol, Data: &top})
+    }
+    activate()
+}
+
+func (state *bookState) snapshotMessage(symbol string) *L2Message {
+    msg := &L2Message{
+        Channel:   ChannelL2,
+        Type:      "snapshot",
+        Symbol:    symbol,
+        Seq:       state.seq,
+        Bids:      make([]Level, 0, len(state.bids)),
+        Asks:      make([]Level, 0, len(state.asks)),
+        Timestamp: time.Now(),
+    }
+    for price, qty := range state.bids {
+        msg.Bids = append(msg.Bids, Level{price, qty})
+    }
+    for price, qty := range state.asks {
+        msg.Asks = append(msg.Asks, Level{price, qty})
+    }
+    sort.Slice(msg.Bids, func(i, j int) bool { return msg.Bids[i][0] > msg.Bids[j][0] })
+    sort.Slice(msg.Asks, func(i, j int) bool { return msg.Asks[i][0] < msg.Asks[j][0] })
+    return msg
+}
+
+// diffLevels updates the published levels in place to match the current
+// ones and returns the changes, with removed levels at zero quantity
+func diffLevels(published map[float64]float64, current []engine.OrderBookLevel) []Level {
+    var changes []Level
+
+    seen := make(map[float64]bool, len(current))
+    for _, level := range current {
+        seen[level.Price] = true
+        if published[level.Price] != level.Quantity {
+            published[level.Price] = level.Quantity
+            changes = append(changes, Level{level.Price, level.Quantity})
+        }
+    }
+    for price := range published {
+        if !seen[price] {
+            delete(published, price)
+            changes = append(changes, Level{price, 0})
+        }
+    }
+    return changes
+}
+
+func topOfBook(snapshot *engine.OrderBookSnapshot) engine.TopOfBook {
+    top := engine.TopOfBook{Symbol: snapshot.Symbol, Timestamp: snapshot.Timestamp}
+    if len(snapshot.Bids) > 0 {
+        top.BidPrice = snapshot.Bids[0].Price
+        top.BidQty = snapshot.Bids[0].Quantity
+    }
+    if len(snapshot.Asks) > 0 {
+        top.AskPrice = snapshot.Asks[0].Price
+        top.AskQty = snapshot.Asks[0].Quantity
+    }
+    return top
+}
@@ -0,0 +1,197 @@
+package stream
+
+import (
+    "fmt"
+    "sync/atomic"
+    "time"
+
+    "go.uber.org/zap"
+
+    "high-frequency-matching-engine/accounts"
+    "high-frequency-matching-engine/engine"
+    "high-frequency-matching-engine/utils"
+)
+
+const (
+    ChannelExecutions = "executions"
+    ChannelBalances   = "balances"
+)
+
+// Response answers a single order entry request
+type Response struct {
+    Type    string          `json:"type"`
+    Op      string          `json:"op"`
+    ReqID   string          `json:"req_id,omitempty"`
+    Order   *engine.Order   `json:"order,omitempty"`
+    Trades  []*engine.Trade `json:"trades,omitempty"`
+    Message string          `json:"message,omitempty"`
+}
+
+type ExecutionMessage struct {
+    Channel string                  `json:"channel"`
+    Data    *engine.ExecutionReport `json:"data"`
+}
+
+type BalanceMessage struct {
+    Channel string             `json:"channel"`
+    Data    *accounts.Position `json:"data"`
+}
+
+// OrderEntry handles authenticated order placement, amendment and
+// cancellation over the Hub's connections and streams each client's
+// execution reports and position changes back to its sessions
+type OrderEntry struct {
+    hub      *Hub
+    engine   *engine.MatchingEngine
+    ledger   *accounts.Ledger
+    apiKeys  map[string]string // API key -> client ID
+    logger   *zap.Logger
+    orderSeq int64
+}
+
+func NewOrderEntry(hub *Hub, matchingEngine *engine.MatchingEngine, ledger *accounts.Ledger, apiKeys map[string]string, logger *zap.Logger) *OrderEntry {
+    oe := &OrderEntry{
+        hub:     hub,
+        engine:  matchingEngine,
+        ledger:  ledger,
+        apiKeys: apiKeys,
+        logger:  logger,
+    }
+    hub.orderEntry = oe
+    return oe
+}
+
+func (oe *OrderEntry) handle(c *client, req *Request) {
+    if req.Op == "login" {
+        oe.login(c, req)
+        return
+    }
+
+    oe.hub.mutex.RLock()
+    clientID := c.clientID
+    oe.hub.mutex.RUnlock()
+
+    if clientID == "" {
+        oe.reject(c, req, "not logged in")
+        return
+    }
+    if req.Symbol == "" {
+        oe.reject(c, req, "symbol required")
+        return
+    }
+
+    switch req.Op {
+    case "place":
+        oe.place(c, req, clientID)
+    case "amend":
+        oe.amend(c, req, clientID)
+    case "cancel":
+        oe.cancel(c, req, clientID)
+    }
+}
+
+func (oe *OrderEntry) login(c *client, req *Request) {
+    clientID, exists := oe.apiKeys[req.APIKey]
+    if !exists {
+        oe.reject(c, req, "invalid api key")
+        return
+    }
+
+    oe.hub.mutex.Lock()
+    if c.clientID != "" && c.clientID != clientID {
+        oe.hub.mutex.Unlock()
+        oe.reject(c, req, "session already logged in")
+        return
+    }
+    c.clientID = clientID
+    oe.hub.mutex.Unlock()
+
+    oe.logger.Info("WebSocket session logged in", zap.String("client_id", clientID))
+    oe.hub.reply(c, &Response{Type: "ack", Op: req.Op, ReqID: req.ReqID})
+
+    // Start the private balance stream with the current positions
+    for _, position := range oe.ledger.Positions(clientID) {
+        position := position
+        oe.hub.reply(c, &BalanceMessage{Channel: ChannelBalances, Data: &position})
+    }
+}
+
+func (oe *OrderEntry) place(c *client, req *Request, clientID string) {
+    switch {
+    case !utils.ValidSymbol(req.Symbol):
+        oe.reject(c, req, "invalid symbol")
+        return
+    case req.Side != engine.BUY && req.Side != engine.SELL:
+        oe.reject(c, req, "invalid side")
+        return
+    case req.Type != engine.LIMIT && req.Type != engine.MARKET:
+        oe.reject(c, req, "invalid order type")
+        return
+    case req.Quantity <= 0 || (req.Type == engine.LIMIT && req.Price <= 0):
+        oe.reject(c, req, "invalid price or quantity")
+        return
+    }
+
+    order := &engine.Order{
+        ID:            fmt.Sprintf("WS_%d_%d", time.Now().UnixNano(), atomic.AddInt64(&oe.orderSeq, 1)),
+        Symbol:        req.Symbol,
+        Side:          req.Side,
+        Type:          req.Type,
+        Quantity:      req.Quantity,
+        Price:         req.Price,
+        Status:        engine.PENDING,
+        ClientID:      clientID,
+        ClientOrderID: req.ClientOrderID,
+    }
+
+    trades := oe.engine.ProcessOrder(order)
+
+    snapshot := *order
+    oe.hub.reply(c, &Response{Type: "ack", Op: req.Op, ReqID: req.ReqID, Order: &snapshot, Trades: trades})
+}
+
+func (oe *OrderEntry) amend(c *client, req *Request, clientID string) {
+    if !oe.owns(req.Symbol, req.OrderID, clientID) {
+        oe.reject(c, req, engine.ErrOrderNotFound.Error())
+        return
+    }
+
+    order, trades, err := oe.engine.AmendOrder(req.Symbol, req.OrderID, req.Price, req.Quantity)
+    if err != nil {
+        oe.reject(c, req, err.Error())
+        return
+    }
+    oe.hub.reply(c, &Response{Type: "ack", Op: req.Op, ReqID: req.ReqID, Order: &order, Trades: trades})
+}
+
+func (oe *OrderEntry) cancel(c *client, req *Request, clientID string) {
+    if !oe.owns(req.Symbol, req.OrderID, clientID) || !oe.engine.CancelOrder(req.Symbol, req.OrderID) {
+        oe.reject(c, req, engine.ErrOrderNotFound.Error())
+        return
+    }
+    oe.hub.reply(c, &Response{Type: "ack", Op: req.Op, ReqID: req.ReqID})
+}
+
+// owns reports whether a resting order belongs to clientID, so sessions
+// cannot touch each other's orders
+func (oe *OrderEntry) owns(symbol, orderID, clientID string) bool {
+    order, exists := oe.engine.GetOrder(symbol, orderID)
+    return exists && order.ClientID == clientID
+}
+
+func (oe *OrderEntry) reject(c *client, req *Request, message string) {
+    oe.hub.reply(c, &Response{Type: "reject", Op: req.Op, ReqID: req.ReqID, Message: message})
+}
+
+// OnExecution routes an execution report, and the position change it
+// caused if any, to the owning client's sessions
+func (oe *OrderEntry) OnExecution(report *engine.ExecutionReport, position *accounts.Position) {
+    if report.Order.ClientID == "" {
+        return
+    }
+
+    oe.hub.PublishPrivate(report.Order.ClientID, &ExecutionMessage{Channel: ChannelExecutions, Data: report})
+    if position != nil {
+        oe.hub.PublishPrivate(report.Order.ClientID, &BalanceMessage{Channel: ChannelBalances, Data: position})
+    }
+}
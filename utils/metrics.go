@@ -5,6 +5,8 @@ import (
     "go.uber.org/zap"
     "github.com/prometheus/client_golang/prometheus"
     "github.com/prometheus/client_golang/prometheus/promauto"
+
+    "high-frequency-matching-engine/clock"
 )
 var (
     OrdersProcessed = promauto.NewCounterVec(
@@ -39,18 +41,121 @@ var (
         },
         []string{"symbol", "side"},
     )
+    
+    MarketDataMessages = promauto.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "marketdata_messages_total",
+            Help: "Market data events received from exchanges",
+        },
+        []string{"exchange", "type"},
+    )
+    
+    MarketDataParseErrors = promauto.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "marketdata_parse_errors_total",
+            Help: "Exchange messages that could not be parsed",
+        },
+        []string{"exchange"},
+    )
+    
+    MarketDataLatency = promauto.NewHistogramVec(
+        prometheus.HistogramOpts{
+            Name:    "marketdata_feed_latency_seconds",
+            Help:    "Delay from the exchange event time to receipt, including clock offset",
+            Buckets: prometheus.ExponentialBuckets(0.0001, 2, 16), // Start at 100μs
+        },
+        []string{"exchange"},
+    )
+    
+    MarketDataFeedState = promauto.NewGaugeVec(
+        prometheus.GaugeOpts{
+            Name: "marketdata_feed_state",
+            Help: "1 for the current connection state of each exchange feed",
+        },
+        []string{"exchange", "state"},
+    )
+    
+    MarketDataReconnects = promauto.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "marketdata_feed_reconnects_total",
+            Help: "Exchange feed connections dropped and retried",
+        },
+        []string{"exchange"},
+    )
+    
+    MarketDataLastReceived = promauto.NewGaugeVec(
+        prometheus.GaugeOpts{
+            Name: "marketdata_feed_last_data_timestamp_seconds",
+            Help: "Unix time of the last market data event from each exchange",
+        },
+        []string{"exchange"},
+    )
+    
+    MarketDataCaptureBytes = promauto.NewCounter(
+        prometheus.CounterOpts{
+            Name: "marketdata_capture_bytes_total",
+            Help: "Uncompressed bytes written to market data capture files",
+        },
+    )
+    
+    MarketDataCaptureDropped = promauto.NewCounter(
+        prometheus.CounterOpts{
+            Name: "marketdata_capture_dropped_total",
+            Help: "Market data records dropped because the capture queue was full",
+        },
+    )
+    
+    StrategyActions = promauto.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "strategy_actions_total",
+            Help: "Orders, cancels and amends sent to the engine for each strategy",
+        },
+        []string{"strategy", "action"},
+    )
+    
+    StrategyRejected = promauto.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "strategy_actions_rejected_total",
+            Help: "Strategy actions throttled, dropped or refused by the engine",
+        },
+        []string{"strategy", "reason"},
+    )
+    
+    StrategyEventsDropped = promauto.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "strategy_events_dropped_total",
+            Help: "Events dropped because a strategy's inbox was full",
+        },
+        []string{"strategy"},
+    )
+    
+    StrategyPanics = promauto.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "strategy_panics_total",
+            Help: "Strategy callbacks that panicked",
+        },
+        []string{"strategy"},
+    )
 )
 
 type LatencyTracker struct {
+    clock  clock.Clock
     logger *zap.Logger
 }
 
-func NewLatencyTracker(logger *zap.Logger) *LatencyTracker {
-    return &LatencyTracker{logger: logger}
+// NewLatencyTracker measures latencies on clk, which should be the clock
+// the start times come from
+func NewLatencyTracker(clk clock.Clock, logger *zap.Logger) *LatencyTracker {
+    return &LatencyTracker{clock: clk, logger: logger}
+}
+
+// Now is the time to measure a latency from
+func (lt *LatencyTracker) Now() time.Time {
+    return lt.clock.Now()
 }
 
 func (lt *LatencyTracker) TrackOrderLatency(symbol string, startTime time.Time) {
-    duration := time.Since(startTime)
+    duration := lt.clock.Since(startTime)
     OrderProcessingLatency.WithLabelValues(symbol).Observe(duration.Seconds())
     
     if duration > time.Millisecond {
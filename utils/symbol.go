@@ -0,0 +1,16 @@
+package utils
+
+// ValidSymbol reports whether a symbol is safe to use in a file name:
+// letters, digits, '-' and '_' only, so client-supplied symbols cannot
+// escape a storage directory
+func ValidSymbol(symbol string) bool {
+    if symbol == "" {
+        return false
+    }
+    for _, r := range symbol {
+        if !(r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+            return false
+        }
+    }
+    return true
+}